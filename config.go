@@ -3,6 +3,8 @@ package caldav
 import (
 	"github.com/samedi/caldav-go/data"
 	"github.com/samedi/caldav-go/global"
+	"github.com/samedi/caldav-go/ics"
+	"github.com/samedi/caldav-go/imip"
 )
 
 // SetupStorage sets the storage to be used by the server. The storage is where the resources data will be fetched from.
@@ -22,3 +24,39 @@ func SetupUser(username string) {
 func SetupSupportedComponents(components []string) {
 	global.SupportedComponents = components
 }
+
+// SetupMaxRequestBodySize sets the maximum size, in bytes, of the request bodies accepted by the server.
+// Requests with bigger bodies are answered with `413 Request Entity Too Large`. Zero means no limit, which is the default.
+func SetupMaxRequestBodySize(size int64) {
+	global.MaxRequestBodySize = size
+}
+
+// SetupUserDirectory sets the directory of the local calendar users and enables the scheduling of events (RFC6638).
+// The directory is used to find out which organizers and attendees are local users, to deliver them the scheduling messages.
+func SetupUserDirectory(directory data.UserDirectory) {
+	global.UserDirectory = directory
+}
+
+// SetupMailer sets the mailer used to send the scheduling messages by email (iMIP, RFC6047) to the organizers
+// and attendees that are not local users. Use the `imip.SMTPMailer` to send them through an SMTP server.
+func SetupMailer(mailer imip.Mailer) {
+	global.Mailer = mailer
+}
+
+// SetupCalendarCache enables a cache of the parsed iCalendar data shared by the requests, keeping the data of up to `size`
+// resources. The resources are kept by path and ETag, so the changed resources are parsed again. Zero disables it, which is the default.
+func SetupCalendarCache(size int) {
+	if size <= 0 {
+		data.SetCalendarCache(nil)
+		return
+	}
+
+	data.SetCalendarCache(data.NewCalendarCache(size))
+}
+
+// SetupNormalizers sets the normalizers applied to the calendar objects sent by the clients before storing them, e.g.
+// `ics.DefaultNormalizers` plus some custom ones. The objects are then stored with CRLF line endings and folded lines,
+// and the objects that cannot be parsed are refused. Calling it with no normalizers disables the normalization.
+func SetupNormalizers(normalizers ...ics.Normalizer) {
+	global.Normalizers = normalizers
+}
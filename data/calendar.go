@@ -0,0 +1,46 @@
+package data
+
+import (
+	"time"
+)
+
+// CalendarMetadata holds the properties of a calendar collection (RFC4791#5.2). The zero value of
+// each field means the property is not defined, i.e. no description, no time zone and no limits.
+type CalendarMetadata struct {
+	// Description is the CALDAV:calendar-description, a human-readable description of the calendar.
+	Description string `json:"description,omitempty"`
+	// Timezone is the CALDAV:calendar-timezone, an iCalendar object with a single VTIMEZONE component,
+	// used to resolve the floating times and the dates of the calendar objects in the collection.
+	Timezone string `json:"timezone,omitempty"`
+	// MaxResourceSize is the CALDAV:max-resource-size, the maximum size in octets of the calendar objects.
+	MaxResourceSize int64 `json:"maxResourceSize,omitempty"`
+	// MinDateTime is the CALDAV:min-date-time, the earliest date and time the calendar objects can have.
+	MinDateTime time.Time `json:"minDateTime"`
+	// MaxDateTime is the CALDAV:max-date-time, the latest date and time the calendar objects can have.
+	MaxDateTime time.Time `json:"maxDateTime"`
+	// MaxInstances is the CALDAV:max-instances, the maximum number of instances of a recurring calendar object.
+	MaxInstances int `json:"maxInstances,omitempty"`
+	// MaxAttendeesPerInstance is the CALDAV:max-attendees-per-instance, the maximum number of ATTENDEE
+	// properties in each instance of a calendar object.
+	MaxAttendeesPerInstance int `json:"maxAttendeesPerInstance,omitempty"`
+}
+
+// CalendarMetadataStorage is an optional interface a `Storage` can implement to keep the properties of the
+// calendar collections. When the storage in use does not implement it, the calendar collections have
+// no description, no time zone and no limits, and these properties cannot be changed by the clients.
+type CalendarMetadataStorage interface {
+	// GetCalendarMetadata returns the properties of the collection on the `rpath` path. When nothing was set
+	// yet, it returns an empty `CalendarMetadata`. It returns `errs.ResourceNotFoundError` if there is no collection.
+	GetCalendarMetadata(rpath string) (*CalendarMetadata, error)
+	// SetCalendarMetadata replaces the properties of the collection on the `rpath` path.
+	SetCalendarMetadata(rpath string, metadata *CalendarMetadata) error
+}
+
+// CollectionCreator is an optional interface a `Storage` can implement when it is able to create empty
+// collections, as requested by the MKCALENDAR method. When the storage in use does not implement it,
+// the collections exist only as the parents of the resources created in them.
+type CollectionCreator interface {
+	// CreateCollection creates an empty collection on the `rpath` path. It returns
+	// `errs.ResourceAlreadyExistsError` when there is already a resource on that path.
+	CreateCollection(rpath string) error
+}
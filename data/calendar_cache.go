@@ -0,0 +1,135 @@
+package data
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/laurent22/ical-go"
+
+	"github.com/samedi/caldav-go/ics"
+)
+
+// The parsed iCalendar data of one version of a resource, identified by its ETag. The data is parsed by
+// `ics.Parse` on first use, and must not be changed, as it can be shared by the resources of different requests.
+type parsedCalendar struct {
+	etag string
+
+	mu        sync.Mutex
+	calParsed bool
+	cal       *ical.Node
+	calErr    error
+}
+
+// The memoized parsing of a resource, shared by the copies of the resource. It is kept until the ETag
+// of the resource changes.
+type calendarMemo struct {
+	mu      sync.Mutex
+	current *parsedCalendar
+}
+
+// CalendarCache is a LRU cache of the parsed iCalendar data of the resources, keyed by resource path and ETag,
+// so that the resources loaded by different requests are not parsed again while they do not change.
+type CalendarCache struct {
+	mu      sync.Mutex
+	size    int
+	entries *list.List // of *parsedCalendarEntry, the most recently used first
+	index   map[string]*list.Element
+}
+
+type parsedCalendarEntry struct {
+	key    string
+	parsed *parsedCalendar
+}
+
+// The cache shared by all the resources, if any. See `SetCalendarCache`.
+var calendarCache *CalendarCache
+
+// NewCalendarCache initializes a cache keeping the parsed data of up to `size` resources.
+func NewCalendarCache(size int) *CalendarCache {
+	return &CalendarCache{
+		size:    size,
+		entries: list.New(),
+		index:   make(map[string]*list.Element),
+	}
+}
+
+// SetCalendarCache sets the cache of parsed data shared by all the resources. Nil, the default, disables it:
+// the data is then parsed once per resource loaded from the storage.
+func SetCalendarCache(cache *CalendarCache) {
+	calendarCache = cache
+}
+
+// Len returns the number of resources in the cache.
+func (c *CalendarCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.entries.Len()
+}
+
+// Returns the parsed data of the resource version, adding it to the cache when not there yet.
+func (c *CalendarCache) get(rpath, etag string) *parsedCalendar {
+	key := rpath + "\x00" + etag
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, found := c.index[key]; found {
+		c.entries.MoveToFront(elem)
+		return elem.Value.(*parsedCalendarEntry).parsed
+	}
+
+	parsed := &parsedCalendar{etag: etag}
+	c.index[key] = c.entries.PushFront(&parsedCalendarEntry{key, parsed})
+
+	for c.entries.Len() > c.size {
+		oldest := c.entries.Back()
+		c.entries.Remove(oldest)
+		delete(c.index, oldest.Value.(*parsedCalendarEntry).key)
+	}
+
+	return parsed
+}
+
+// Returns the parsed data of the current version of the resource.
+func (r *Resource) parsedCalendar() *parsedCalendar {
+	etag := r.adapter.CalculateEtag()
+
+	// without an ETag, the versions of the resource cannot be told apart, so the data is parsed every time
+	if r.memo == nil || etag == "" {
+		return &parsedCalendar{}
+	}
+
+	r.memo.mu.Lock()
+	defer r.memo.mu.Unlock()
+
+	if r.memo.current == nil || r.memo.current.etag != etag {
+		r.memo.current = r.newParsedCalendar(etag)
+	}
+
+	return r.memo.current
+}
+
+func (r *Resource) newParsedCalendar(etag string) *parsedCalendar {
+	if cache := calendarCache; cache != nil {
+		return cache.get(r.Path, etag)
+	}
+
+	return &parsedCalendar{etag: etag}
+}
+
+// Returns the iCalendar data of the resource parsed by `ics.Parse`.
+func (r *Resource) calendar() (*ical.Node, error) {
+	parsed := r.parsedCalendar()
+
+	parsed.mu.Lock()
+	defer parsed.mu.Unlock()
+
+	if !parsed.calParsed {
+		data, _ := r.GetContentData()
+		parsed.cal, parsed.calErr = ics.Parse(data)
+		parsed.calParsed = true
+	}
+
+	return parsed.cal, parsed.calErr
+}
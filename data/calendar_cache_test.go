@@ -0,0 +1,162 @@
+package data
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// Counts the reads of the resource content, i.e. the parsings of the resource.
+type countingResourceAdapter struct {
+	FakeResourceAdapter
+	reads int
+}
+
+func (adp *countingResourceAdapter) GetContent() string {
+	adp.reads++
+	return adp.contentData
+}
+
+func TestResourceMemo(t *testing.T) {
+	adp := &countingResourceAdapter{FakeResourceAdapter: FakeResourceAdapter{
+		etag:        "1",
+		contentData: "BEGIN:VCALENDAR\nBEGIN:VEVENT\nUID:123\nSUMMARY:Party\nDTSTART:20160914T100000Z\nDTEND:20160914T110000Z\nEND:VEVENT\nEND:VCALENDAR",
+	}}
+	res := NewResource("/foo/123.ics", adp)
+
+	res.StartTimeUTC()
+	res.EndTimeUTC()
+	res.GetPropertyValue("VCALENDAR", "VEVENT", "SUMMARY")
+	res.HasProperty("VCALENDAR", "VEVENT", "UID")
+
+	// the content is parsed only once for all the getters
+	if adp.reads != 1 {
+		t.Error("Expected the content to be read once | Got:", adp.reads)
+	}
+
+	// the copies of the resource share the parsed data
+	copied := res
+	copied.GetPropertyValue("VCALENDAR", "VEVENT", "SUMMARY")
+	if adp.reads != 1 {
+		t.Error("Expected the content not to be read again | Got:", adp.reads)
+	}
+
+	// a new ETag invalidates it
+	adp.etag = "2"
+	adp.contentData = "BEGIN:VCALENDAR\nBEGIN:VEVENT\nUID:123\nSUMMARY:Meeting\nEND:VEVENT\nEND:VCALENDAR"
+	if summary := res.GetPropertyValue("VCALENDAR", "VEVENT", "SUMMARY"); summary != "Meeting" {
+		t.Error("Expected the summary of the new version | Got:", summary)
+	}
+	if !res.StartTimeUTC().IsZero() {
+		t.Error("Expected the start time of the new version to be empty | Got:", res.StartTimeUTC())
+	}
+}
+
+func TestCalendarCache(t *testing.T) {
+	cache := NewCalendarCache(2)
+	SetCalendarCache(cache)
+	defer SetCalendarCache(nil)
+
+	newAdapter := func(etag, summary string) *countingResourceAdapter {
+		return &countingResourceAdapter{FakeResourceAdapter: FakeResourceAdapter{
+			etag:        etag,
+			contentData: "BEGIN:VCALENDAR\nBEGIN:VEVENT\nSUMMARY:" + summary + "\nEND:VEVENT\nEND:VCALENDAR",
+		}}
+	}
+
+	// the resources loaded again are not parsed again
+	first := newAdapter("1", "Party")
+	res := NewResource("/foo/1.ics", first)
+	res.GetPropertyValue("VCALENDAR", "VEVENT", "SUMMARY")
+
+	again := newAdapter("1", "Party")
+	res = NewResource("/foo/1.ics", again)
+	if summary := res.GetPropertyValue("VCALENDAR", "VEVENT", "SUMMARY"); summary != "Party" || again.reads != 0 {
+		t.Error("Expected the cached summary without reading the content | Got:", summary, again.reads)
+	}
+
+	// unless their ETag changed
+	changed := newAdapter("2", "Meeting")
+	res = NewResource("/foo/1.ics", changed)
+	if summary := res.GetPropertyValue("VCALENDAR", "VEVENT", "SUMMARY"); summary != "Meeting" || changed.reads != 1 {
+		t.Error("Expected the summary of the new version | Got:", summary, changed.reads)
+	}
+
+	// the least recently used versions are evicted
+	res = NewResource("/foo/2.ics", newAdapter("1", "Lunch"))
+	res.GetPropertyValue("VCALENDAR", "VEVENT", "SUMMARY")
+	if cache.Len() != 2 {
+		t.Error("Expected 2 cached resources | Got:", cache.Len())
+	}
+
+	evicted := newAdapter("1", "Party")
+	res = NewResource("/foo/1.ics", evicted)
+	res.GetPropertyValue("VCALENDAR", "VEVENT", "SUMMARY")
+	if evicted.reads != 1 {
+		t.Error("Expected the evicted version to be parsed again | Got:", evicted.reads)
+	}
+}
+
+// The data of a recurring event with a few properties, as the ones checked by the filters.
+func benchmarkResourceData() string {
+	return "BEGIN:VCALENDAR\nVERSION:2.0\nPRODID:-//Test//EN\n" +
+		"BEGIN:VEVENT\nUID:123\nSUMMARY:Weekly meeting\nDESCRIPTION:The weekly meeting of the team.\n" +
+		"CATEGORIES:WORK,MEETING\nORGANIZER;CN=John:mailto:john@example.com\n" +
+		"ATTENDEE;CN=Jane;PARTSTAT=ACCEPTED:mailto:jane@example.com\n" +
+		"DTSTART:20160914T100000Z\nDTEND:20160914T110000Z\nRRULE:FREQ=WEEKLY;COUNT=10\n" +
+		"END:VEVENT\nEND:VCALENDAR"
+}
+
+func benchmarkResourceFilter() *ResourceFilter {
+	return NewResourceFilter(NewFilter(Comp("VCALENDAR", Comp("VEVENT",
+		Range(time.Date(2016, 10, 1, 0, 0, 0, 0, time.UTC), time.Date(2016, 10, 8, 0, 0, 0, 0, time.UTC)),
+		Prop("SUMMARY", Text("meeting")),
+		Prop("CATEGORIES", Text("WORK")),
+		Prop("ATTENDEE", Param("PARTSTAT", Text("ACCEPTED"))),
+	))))
+}
+
+func benchmarkResourceAccess(b *testing.B, newResource func(i int) Resource) {
+	filter := benchmarkResourceFilter()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		res := newResource(i)
+		if !filter.Match(&res) {
+			b.Fatal("Expected the resource to match")
+		}
+		res.StartTimeUTC()
+		res.EndTimeUTC()
+		res.GetPropertyValue("VCALENDAR", "VEVENT", "SUMMARY")
+		res.HasPropertyParam("VCALENDAR", "VEVENT", "ATTENDEE", "PARTSTAT")
+	}
+}
+
+// Parses the data on every access, as before the memoization.
+func BenchmarkResourceWithoutMemo(b *testing.B) {
+	adp := FakeResourceAdapter{etag: "1", contentData: benchmarkResourceData()}
+	benchmarkResourceAccess(b, func(i int) Resource {
+		res := NewResource(fmt.Sprintf("/foo/%d.ics", i), adp)
+		res.memo = nil
+		return res
+	})
+}
+
+// Parses the data once per resource loaded.
+func BenchmarkResourceMemo(b *testing.B) {
+	adp := FakeResourceAdapter{etag: "1", contentData: benchmarkResourceData()}
+	benchmarkResourceAccess(b, func(i int) Resource {
+		return NewResource(fmt.Sprintf("/foo/%d.ics", i), adp)
+	})
+}
+
+// Parses the data once for all the loadings of the resource.
+func BenchmarkResourceCalendarCache(b *testing.B) {
+	SetCalendarCache(NewCalendarCache(100))
+	defer SetCalendarCache(nil)
+
+	adp := FakeResourceAdapter{etag: "1", contentData: benchmarkResourceData()}
+	benchmarkResourceAccess(b, func(i int) Resource {
+		return NewResource("/foo/123.ics", adp)
+	})
+}
@@ -0,0 +1,49 @@
+package data
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// The collations supported in the text-match filters (RFC4791#7.5 and RFC4790#9).
+const (
+	COLLATION_OCTET           = "i;octet"
+	COLLATION_ASCII_CASEMAP   = "i;ascii-casemap"
+	COLLATION_UNICODE_CASEMAP = "i;unicode-casemap"
+)
+
+// SupportedCollations lists the collations supported in the text-match filters, reported to the
+// clients in the CALDAV:supported-collation-set property.
+var SupportedCollations = []string{COLLATION_ASCII_CASEMAP, COLLATION_OCTET, COLLATION_UNICODE_CASEMAP}
+
+// The collations, as functions returning the form of the text which is compared octet by octet.
+var collations = map[string]func(text string) string{
+	COLLATION_OCTET:           func(text string) string { return text },
+	COLLATION_ASCII_CASEMAP:   asciiCasemap,
+	COLLATION_UNICODE_CASEMAP: unicodeCasemap,
+}
+
+// IsSupportedCollation tells whether the collation with the given name can be used in the text-match filters.
+func IsSupportedCollation(name string) bool {
+	_, found := collations[name]
+	return found
+}
+
+// Only the ASCII letters are case insensitive (RFC4790#9.2).
+func asciiCasemap(text string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' {
+			return r - 'a' + 'A'
+		}
+		return r
+	}, text)
+}
+
+// Each character is converted to its titlecase and the text is then fully decomposed (RFC5051#2), e.g. "é" is
+// compared as "E" and U+0301. The letters given by the compatibility decompositions, e.g. the "fi" of the "ﬁ"
+// ligature, are converted to their titlecase too.
+func unicodeCasemap(text string) string {
+	return strings.Map(unicode.ToTitle, norm.NFKD.String(strings.Map(unicode.ToTitle, text)))
+}
@@ -0,0 +1,311 @@
+package data
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/laurent22/ical-go"
+
+	"github.com/samedi/caldav-go/errs"
+	"github.com/samedi/caldav-go/files"
+	"github.com/samedi/caldav-go/ics"
+	"github.com/samedi/caldav-go/lib"
+)
+
+// The name of the hidden file, inside the directory of a collection, where the index of its resources is kept.
+const fileIndexFile = ".index.json"
+
+// The floating times (and the ones out of the resources' time zones) are indexed in UTC, so their spans
+// are widened with the biggest offset from UTC.
+const floatingTimeMargin = 14 * time.Hour
+
+// The locks serializing the changes of the index file of each directory, keyed by the absolute path of the directory.
+var fileIndexLocks = struct {
+	sync.Mutex
+	dirs map[string]*sync.Mutex
+}{dirs: make(map[string]*sync.Mutex)}
+
+// The index of the resources of a directory, keyed by file name.
+type fileIndex map[string]*fileIndexEntry
+
+// The indexed data of a resource. The first and last times are the UTC span of all the instances of its
+// components, and a zero time leaves the span open on that side, e.g. for the never ending recurrences.
+// The resources that could not be parsed are unknown and match any query, so that they are still checked
+// with the filters.
+type fileIndexEntry struct {
+	Unknown    bool      `json:"unknown,omitempty"`
+	UID        string    `json:"uid"`
+	Components []string  `json:"components"`
+	First      time.Time `json:"first"`
+	Last       time.Time `json:"last"`
+	Etag       string    `json:"etag"`
+	ModTime    time.Time `json:"mtime"`
+}
+
+// QueryResources returns the files of a directory that may fulfill the query, with the index of the directory.
+// The index is created on the first query, and the entries of the files changed since they were indexed (e.g. by
+// other programs) are rebuilt. See `ResourceQuerier.QueryResources` doc.
+func (fs *FileStorage) QueryResources(rpath string, query *ResourceQuery) ([]Resource, error) {
+	dirFiles, err := ioutil.ReadDir(files.AbsPath(rpath))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errs.ResourceNotFoundError
+		}
+		return nil, err
+	}
+
+	lock := fileIndexLock(rpath)
+	lock.Lock()
+	defer lock.Unlock()
+
+	index := fs.readFileIndex(rpath)
+	changed := index == nil
+	if index == nil {
+		index = make(fileIndex)
+	}
+
+	result := []Resource{}
+	present := make(map[string]bool)
+	for _, finfo := range dirFiles {
+		if isHiddenFile(finfo.Name()) {
+			continue
+		}
+
+		childPath := files.JoinPaths(rpath, finfo.Name())
+		resource := NewResource(childPath, &FileResourceAdapter{finfo, childPath})
+		present[finfo.Name()] = true
+
+		entry := index[finfo.Name()]
+		if etag, _ := resource.GetEtag(); entry == nil || entry.Etag != etag {
+			entry = newFileIndexEntry(&resource)
+			index[finfo.Name()] = entry
+			changed = true
+		}
+
+		if entry.match(query) {
+			result = append(result, resource)
+		}
+	}
+
+	for name := range index {
+		if !present[name] {
+			delete(index, name)
+			changed = true
+		}
+	}
+
+	if changed {
+		fs.writeFileIndex(rpath, index)
+	}
+
+	return result, nil
+}
+
+// Updates the entry of a resource in the index of its directory, when the directory has an index. A nil
+// resource removes the entry.
+func (fs *FileStorage) updateFileIndex(rpath string, resource *Resource) {
+	dirPath, name := path.Split(lib.ToSlashPath(rpath))
+
+	lock := fileIndexLock(dirPath)
+	lock.Lock()
+	defer lock.Unlock()
+
+	index := fs.readFileIndex(dirPath)
+	if index == nil {
+		return
+	}
+
+	if resource == nil {
+		delete(index, name)
+	} else {
+		index[name] = newFileIndexEntry(resource)
+	}
+
+	fs.writeFileIndex(dirPath, index)
+}
+
+// Returns the lock of the index of a directory, so that the changes of the indexes of different directories
+// don't wait for each other.
+func fileIndexLock(dirPath string) *sync.Mutex {
+	fileIndexLocks.Lock()
+	defer fileIndexLocks.Unlock()
+
+	absPath := files.AbsPath(dirPath)
+	lock, found := fileIndexLocks.dirs[absPath]
+	if !found {
+		lock = new(sync.Mutex)
+		fileIndexLocks.dirs[absPath] = lock
+	}
+
+	return lock
+}
+
+// Returns the index of a directory, or nil when there is none or it cannot be read.
+func (fs *FileStorage) readFileIndex(dirPath string) fileIndex {
+	content, err := ioutil.ReadFile(files.JoinPaths(files.AbsPath(dirPath), fileIndexFile))
+	if err != nil {
+		return nil
+	}
+
+	var index fileIndex
+	if err := json.Unmarshal(content, &index); err != nil {
+		log.Printf("WARNING: Could not read the index of the collection, it will be rebuilt.\nError: %s.\nResource path: %s.", err, dirPath)
+		return nil
+	}
+
+	return index
+}
+
+// Writes the index of a directory. The index is written to a temporary file first, which then replaces the
+// index file, so that the index is never read half written.
+func (fs *FileStorage) writeFileIndex(dirPath string, index fileIndex) {
+	content, err := json.Marshal(index)
+	if err == nil {
+		err = writeFileAtomically(files.JoinPaths(files.AbsPath(dirPath), fileIndexFile), content)
+	}
+
+	if err != nil {
+		log.Printf("WARNING: Could not write the index of the collection.\nError: %s.\nResource path: %s.", err, dirPath)
+	}
+}
+
+// Writes the content to a hidden temporary file next to the given file, and then renames it to the file.
+func writeFileAtomically(filePath string, content []byte) error {
+	tmp, err := ioutil.TempFile(files.DirPath(filePath), ".tmp-*")
+	if err != nil {
+		return err
+	}
+
+	_, err = tmp.Write(content)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), filePath)
+	}
+
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+
+	return err
+}
+
+func newFileIndexEntry(resource *Resource) *fileIndexEntry {
+	entry := &fileIndexEntry{ModTime: resource.adapter.GetModTime()}
+	entry.Etag, _ = resource.GetEtag()
+
+	cal, err := ics.Parse(resource.adapter.GetContent())
+	if err != nil {
+		entry.Unknown = true
+		return entry
+	}
+
+	timeContext := ics.NewTimeContext(cal, nil)
+	found, openStart, openEnd := false, false, false
+	for _, comp := range ics.Components(cal) {
+		if comp.Name == lib.VTIMEZONE || containsString(entry.Components, comp.Name) {
+			continue
+		}
+
+		entry.Components = append(entry.Components, comp.Name)
+		if entry.UID == "" {
+			entry.UID = comp.PropString("UID", "")
+		}
+
+		instances := 0
+		complete := timeContext.EachInstance(cal, comp.Name, time.Time{}, func(instance *ical.Node, start, end time.Time) bool {
+			instances++
+			if isFloatingTime(ics.Property(instance, "DTSTART")) {
+				start, end = start.Add(-floatingTimeMargin), end.Add(floatingTimeMargin)
+			}
+
+			if !found || start.Before(entry.First) {
+				entry.First = start
+			}
+			if !found || end.After(entry.Last) {
+				entry.Last = end
+			}
+			found = true
+
+			// only the first instance of the never ending recurrences is needed
+			if isEndless(instance) {
+				openEnd = true
+				return false
+			}
+			return true
+		})
+
+		// the components without instances, like the VTODOs without dates, can match any time range
+		if instances == 0 {
+			openStart, openEnd = true, true
+		}
+		// the last instances of an incomplete expansion are unknown
+		if !complete {
+			openEnd = true
+		}
+	}
+
+	if openStart {
+		entry.First = time.Time{}
+	}
+	if openEnd {
+		entry.Last = time.Time{}
+	}
+
+	return entry
+}
+
+// Tells whether the entry may fulfill the query: all the predicates the index knows of are checked.
+func (entry *fileIndexEntry) match(query *ResourceQuery) bool {
+	if entry.Unknown {
+		return true
+	}
+
+	if query.Component != "" && !containsString(entry.Components, query.Component) {
+		return false
+	}
+
+	if !query.Start.IsZero() && !entry.Last.IsZero() && entry.Last.Before(query.Start) {
+		return false
+	}
+
+	if !query.End.IsZero() && !entry.First.IsZero() && !entry.First.Before(query.End) {
+		return false
+	}
+
+	for _, textMatch := range query.TextMatches["UID"] {
+		if !textMatch.Match(entry.UID) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// The times without a time zone in UTC, i.e. the floating times, the dates and the times with a TZID.
+func isFloatingTime(prop *ical.Node) bool {
+	return prop != nil && !strings.HasSuffix(prop.Value, "Z")
+}
+
+// Tells whether the component recurs forever, i.e. its RRULE has neither a COUNT nor an UNTIL.
+func isEndless(comp *ical.Node) bool {
+	rule := comp.PropString("RRULE", "")
+	return rule != "" && !strings.Contains(rule, "COUNT=") && !strings.Contains(rule, "UNTIL=")
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,122 @@
+package data
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFileStorageQueryResources(t *testing.T) {
+	defer os.RemoveAll("test-data/index")
+
+	storage := new(FileStorage)
+	storage.CreateCollection("/test-data/index")
+
+	event := func(uid, props string) string {
+		return "BEGIN:VCALENDAR\nBEGIN:VEVENT\nUID:" + uid + "\n" + props + "\nEND:VEVENT\nEND:VCALENDAR"
+	}
+
+	storage.CreateResource("/test-data/index/sept.ics", event("sept", "DTSTART:20160914T100000Z\nDTEND:20160914T110000Z"))
+	storage.CreateResource("/test-data/index/weekly.ics", event("weekly", "DTSTART:20160101T100000Z\nRRULE:FREQ=WEEKLY"))
+	storage.CreateResource("/test-data/index/floating.ics", event("floating", "DTSTART:20160913T230000"))
+	storage.CreateResource("/test-data/index/todo.ics", "BEGIN:VCALENDAR\nBEGIN:VTODO\nUID:todo\nEND:VTODO\nEND:VCALENDAR")
+	storage.CreateResource("/test-data/index/broken.ics", "BEGIN:VCALENDAR\nBEGIN:VEVENT")
+
+	query := func(q *ResourceQuery) []string {
+		resources, err := storage.QueryResources("/test-data/index", q)
+		if err != nil {
+			t.Fatal("Unexpected error:", err)
+		}
+
+		var names []string
+		for _, resource := range resources {
+			names = append(names, resource.Name)
+		}
+		sort.Strings(names)
+		return names
+	}
+
+	assertNames := func(names []string, expected ...string) {
+		if len(names) != len(expected) {
+			t.Error("Expected:", expected, "| Got:", names)
+			return
+		}
+		for i := range names {
+			if names[i] != expected[i] {
+				t.Error("Expected:", expected, "| Got:", names)
+				return
+			}
+		}
+	}
+
+	september := &ResourceQuery{
+		Component: "VEVENT",
+		Start:     time.Date(2016, 9, 14, 0, 0, 0, 0, time.UTC),
+		End:       time.Date(2016, 9, 15, 0, 0, 0, 0, time.UTC),
+	}
+
+	// the index is built on the first query; the endless recurrences and the floating times
+	// (which may be on the 14th in some time zone) are kept, as well as the files that cannot be parsed
+	assertNames(query(september), "broken.ics", "floating.ics", "sept.ics", "weekly.ics")
+	if _, err := os.Stat("test-data/index/" + fileIndexFile); err != nil {
+		t.Error("The index file should have been created")
+	}
+
+	// the index is not a resource
+	resources, _ := storage.GetResources("/test-data/index", true)
+	if len(resources) != 6 {
+		t.Error("Expected the collection and its 5 resources | Got:", len(resources))
+	}
+
+	assertNames(query(&ResourceQuery{Component: "VTODO"}), "broken.ics", "todo.ics")
+	assertNames(query(&ResourceQuery{TextMatches: map[string][]*TextMatch{"UID": {{Text: "SEPT", MatchType: "equals"}}}}), "broken.ics", "sept.ics")
+
+	// the recurrences whose expansion is stopped by its limits, like the long SECONDLY ones, are open-ended
+	storage.CreateResource("/test-data/index/secondly.ics", event("secondly", "DTSTART:20160910T100000Z\nRRULE:FREQ=SECONDLY;UNTIL=20170101T000000Z"))
+	assertNames(query(september), "broken.ics", "floating.ics", "secondly.ics", "sept.ics", "weekly.ics")
+	storage.DeleteResource("/test-data/index/secondly.ics")
+
+	// the index follows the changes of the storage
+	storage.UpdateResource("/test-data/index/sept.ics", event("sept", "DTSTART:20161014T100000Z"))
+	storage.DeleteResource("/test-data/index/broken.ics")
+	assertNames(query(september), "floating.ics", "weekly.ics")
+	if _, found := storage.readFileIndex("/test-data/index")["broken.ics"]; found {
+		t.Error("The deleted resource should have been removed from the index")
+	}
+
+	// as well as the changes made out of the storage
+	time.Sleep(10 * time.Millisecond)
+	ioutil.WriteFile("test-data/index/weekly.ics", []byte(event("weekly", "DTSTART:20160101T100000Z\nRRULE:FREQ=WEEKLY;COUNT=2")), 0666)
+	ioutil.WriteFile("test-data/index/new.ics", []byte(event("new", "DTSTART:20160914T120000Z")), 0666)
+	assertNames(query(september), "floating.ics", "new.ics")
+
+	// the concurrent changes are all indexed, and the index file is replaced without leaving temporary files
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(uid string) {
+			defer wg.Done()
+			storage.CreateResource("/test-data/index/"+uid+".ics", event(uid, "DTSTART:20160914T120000Z"))
+		}(fmt.Sprintf("concurrent-%d", i))
+	}
+	wg.Wait()
+
+	index := storage.readFileIndex("/test-data/index")
+	for i := 0; i < 10; i++ {
+		if _, found := index[fmt.Sprintf("concurrent-%d.ics", i)]; !found {
+			t.Error("The resource created concurrently should have been indexed:", i)
+		}
+	}
+
+	dirFiles, _ := ioutil.ReadDir("test-data/index")
+	for _, finfo := range dirFiles {
+		if strings.HasPrefix(finfo.Name(), ".tmp") {
+			t.Error("The temporary index file should have been removed:", finfo.Name())
+		}
+	}
+}
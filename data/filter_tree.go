@@ -0,0 +1,512 @@
+package data
+
+import (
+	"strings"
+	"time"
+
+	"github.com/beevik/etree"
+
+	"github.com/samedi/caldav-go/ics"
+	"github.com/samedi/caldav-go/ixml"
+)
+
+// Filter is the typed tree of a CALDAV:filter (RFC4791#9.7). It is what custom storages can translate into
+// the queries of their own backends, instead of matching each resource with `ResourceFilter.Match`.
+// The tree of a parsed filter is given by `ResourceFilter.Tree`, and new filters can be built in Go:
+//
+//	filter := data.NewFilter(data.Comp("VCALENDAR",
+//	  data.Comp("VEVENT",
+//	    data.Range(start, end),
+//	    data.Prop("SUMMARY", data.Text("meeting")),
+//	  ),
+//	))
+type Filter struct {
+	CompFilter *CompFilter
+}
+
+// FilterNode is a node of the filter tree. `Accept` calls the method of the visitor for the node
+// itself, while `WalkFilter` visits the whole subtree of the node.
+type FilterNode interface {
+	Accept(v FilterVisitor) error
+	// Children returns the child nodes, in the order of the CalDAV XML.
+	Children() []FilterNode
+}
+
+// FilterVisitor is implemented to translate the filter trees into other query languages.
+type FilterVisitor interface {
+	VisitCompFilter(f *CompFilter) error
+	VisitPropFilter(f *PropFilter) error
+	VisitParamFilter(f *ParamFilter) error
+	VisitTimeRange(f *TimeRange) error
+	VisitTextMatch(f *TextMatch) error
+	VisitIsNotDefined(f *IsNotDefined) error
+}
+
+// CompFilter filters the resources by their components (RFC4791#9.7.1).
+type CompFilter struct {
+	Name         string
+	IsNotDefined *IsNotDefined
+	TimeRange    *TimeRange
+	PropFilters  []*PropFilter
+	CompFilters  []*CompFilter
+}
+
+// PropFilter filters the resources by the properties of a component (RFC4791#9.7.2).
+type PropFilter struct {
+	Name         string
+	IsNotDefined *IsNotDefined
+	TimeRange    *TimeRange
+	TextMatch    *TextMatch
+	ParamFilters []*ParamFilter
+}
+
+// ParamFilter filters the resources by the parameters of a property (RFC4791#9.7.3).
+type ParamFilter struct {
+	Name         string
+	IsNotDefined *IsNotDefined
+	TextMatch    *TextMatch
+}
+
+// TimeRange limits the time of the components or properties (RFC4791#9.9). A zero start
+// or end leaves the range open on that side.
+type TimeRange struct {
+	Start time.Time
+	End   time.Time
+}
+
+// TextMatch matches the text of a property or parameter (RFC4791#9.7.5). The empty collation and match type
+// are `i;ascii-casemap` and "contains".
+type TextMatch struct {
+	Text            string
+	Collation       string
+	MatchType       string
+	NegateCondition bool
+}
+
+// Match tells whether the text matches (RFC4791#9.7.5). The texts are compared with the collation of the
+// text-match and its match type, which can be "equals", "contains", "starts-with" or "ends-with". Unknown
+// collations and match types never match.
+func (t *TextMatch) Match(text string) bool {
+	collation := t.Collation
+	if collation == "" {
+		collation = COLLATION_ASCII_CASEMAP
+	}
+
+	collate, found := collations[collation]
+	if !found {
+		return false
+	}
+
+	text = collate(text)
+	expectedText := collate(t.Text)
+
+	var match bool
+	switch t.MatchType {
+	case "equals":
+		match = text == expectedText
+	case "", "contains":
+		match = strings.Contains(text, expectedText)
+	case "starts-with":
+		match = strings.HasPrefix(text, expectedText)
+	case "ends-with":
+		match = strings.HasSuffix(text, expectedText)
+	default:
+		return false
+	}
+
+	if t.NegateCondition {
+		return !match
+	}
+
+	return match
+}
+
+// IsNotDefined requires the component, property or parameter to be absent (RFC4791#9.7.4).
+type IsNotDefined struct{}
+
+// The nodes that can be given to each of the builders.
+type (
+	// CompFilterChild is either a `*CompFilter`, `*PropFilter`, `*TimeRange` or `*IsNotDefined`.
+	CompFilterChild interface {
+		FilterNode
+		compFilterChild()
+	}
+
+	// PropFilterChild is either a `*ParamFilter`, `*TimeRange`, `*TextMatch` or `*IsNotDefined`.
+	PropFilterChild interface {
+		FilterNode
+		propFilterChild()
+	}
+
+	// ParamFilterChild is either a `*TextMatch` or `*IsNotDefined`.
+	ParamFilterChild interface {
+		FilterNode
+		paramFilterChild()
+	}
+)
+
+func (*CompFilter) compFilterChild()    {}
+func (*PropFilter) compFilterChild()    {}
+func (*TimeRange) compFilterChild()     {}
+func (*IsNotDefined) compFilterChild()  {}
+func (*ParamFilter) propFilterChild()   {}
+func (*TimeRange) propFilterChild()     {}
+func (*TextMatch) propFilterChild()     {}
+func (*IsNotDefined) propFilterChild()  {}
+func (*TextMatch) paramFilterChild()    {}
+func (*IsNotDefined) paramFilterChild() {}
+
+// NewFilter builds a filter with the given top-level comp-filter, usually the VCALENDAR one.
+func NewFilter(comp *CompFilter) *Filter {
+	return &Filter{CompFilter: comp}
+}
+
+// Comp builds a comp-filter for the component with the given name.
+func Comp(name string, children ...CompFilterChild) *CompFilter {
+	f := &CompFilter{Name: name}
+	for _, child := range children {
+		switch c := child.(type) {
+		case *CompFilter:
+			f.CompFilters = append(f.CompFilters, c)
+		case *PropFilter:
+			f.PropFilters = append(f.PropFilters, c)
+		case *TimeRange:
+			f.TimeRange = c
+		case *IsNotDefined:
+			f.IsNotDefined = c
+		}
+	}
+
+	return f
+}
+
+// Prop builds a prop-filter for the property with the given name.
+func Prop(name string, children ...PropFilterChild) *PropFilter {
+	f := &PropFilter{Name: name}
+	for _, child := range children {
+		switch c := child.(type) {
+		case *ParamFilter:
+			f.ParamFilters = append(f.ParamFilters, c)
+		case *TimeRange:
+			f.TimeRange = c
+		case *TextMatch:
+			f.TextMatch = c
+		case *IsNotDefined:
+			f.IsNotDefined = c
+		}
+	}
+
+	return f
+}
+
+// Param builds a param-filter for the parameter with the given name.
+func Param(name string, children ...ParamFilterChild) *ParamFilter {
+	f := &ParamFilter{Name: name}
+	for _, child := range children {
+		switch c := child.(type) {
+		case *TextMatch:
+			f.TextMatch = c
+		case *IsNotDefined:
+			f.IsNotDefined = c
+		}
+	}
+
+	return f
+}
+
+// Range builds a time-range from `start` (inclusive) to `end` (exclusive).
+func Range(start, end time.Time) *TimeRange {
+	return &TimeRange{Start: start, End: end}
+}
+
+// Text builds a text-match of the given text, with the default collation and match type.
+func Text(text string) *TextMatch {
+	return &TextMatch{Text: text}
+}
+
+// NotDefined builds an is-not-defined filter.
+func NotDefined() *IsNotDefined {
+	return &IsNotDefined{}
+}
+
+// Accept calls `v.VisitCompFilter`.
+func (f *CompFilter) Accept(v FilterVisitor) error { return v.VisitCompFilter(f) }
+
+// Accept calls `v.VisitPropFilter`.
+func (f *PropFilter) Accept(v FilterVisitor) error { return v.VisitPropFilter(f) }
+
+// Accept calls `v.VisitParamFilter`.
+func (f *ParamFilter) Accept(v FilterVisitor) error { return v.VisitParamFilter(f) }
+
+// Accept calls `v.VisitTimeRange`.
+func (f *TimeRange) Accept(v FilterVisitor) error { return v.VisitTimeRange(f) }
+
+// Accept calls `v.VisitTextMatch`.
+func (f *TextMatch) Accept(v FilterVisitor) error { return v.VisitTextMatch(f) }
+
+// Accept calls `v.VisitIsNotDefined`.
+func (f *IsNotDefined) Accept(v FilterVisitor) error { return v.VisitIsNotDefined(f) }
+
+// Children returns the is-not-defined, time-range, prop-filter and comp-filter nodes.
+func (f *CompFilter) Children() []FilterNode {
+	var children []FilterNode
+	if f.IsNotDefined != nil {
+		children = append(children, f.IsNotDefined)
+	}
+	if f.TimeRange != nil {
+		children = append(children, f.TimeRange)
+	}
+	for _, child := range f.PropFilters {
+		children = append(children, child)
+	}
+	for _, child := range f.CompFilters {
+		children = append(children, child)
+	}
+
+	return children
+}
+
+// Children returns the is-not-defined, time-range, text-match and param-filter nodes.
+func (f *PropFilter) Children() []FilterNode {
+	var children []FilterNode
+	if f.IsNotDefined != nil {
+		children = append(children, f.IsNotDefined)
+	}
+	if f.TimeRange != nil {
+		children = append(children, f.TimeRange)
+	}
+	if f.TextMatch != nil {
+		children = append(children, f.TextMatch)
+	}
+	for _, child := range f.ParamFilters {
+		children = append(children, child)
+	}
+
+	return children
+}
+
+// Children returns the is-not-defined and text-match nodes.
+func (f *ParamFilter) Children() []FilterNode {
+	var children []FilterNode
+	if f.IsNotDefined != nil {
+		children = append(children, f.IsNotDefined)
+	}
+	if f.TextMatch != nil {
+		children = append(children, f.TextMatch)
+	}
+
+	return children
+}
+
+// Children returns no nodes: the time ranges are leaves.
+func (f *TimeRange) Children() []FilterNode { return nil }
+
+// Children returns no nodes: the text matches are leaves.
+func (f *TextMatch) Children() []FilterNode { return nil }
+
+// Children returns no nodes: the is-not-defined filters are leaves.
+func (f *IsNotDefined) Children() []FilterNode { return nil }
+
+// WalkFilter visits the node and then, depth-first, all of its descendants. It stops at the first error
+// returned by the visitor.
+func WalkFilter(node FilterNode, v FilterVisitor) error {
+	if err := node.Accept(v); err != nil {
+		return err
+	}
+
+	for _, child := range node.Children() {
+		if err := WalkFilter(child, v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ToXML serializes the filter as a CALDAV:filter element.
+func (f *Filter) ToXML() string {
+	doc := etree.NewDocument()
+	doc.AddChild(f.etreeElem())
+
+	xml, _ := doc.WriteToString()
+	return xml
+}
+
+// NewResourceFilter returns the `ResourceFilter` of a filter tree, to match the resources with it.
+func NewResourceFilter(f *Filter) *ResourceFilter {
+	filter := newFilterFromEtreeElem(f.etreeElem())
+	return &filter
+}
+
+// Builds the CalDAV XML of the filter.
+func (f *Filter) etreeElem() *etree.Element {
+	elem := etree.NewElement(TAG_FILTER)
+	elem.Space = "C"
+	elem.CreateAttr("xmlns:C", ixml.CALDAV_NS)
+
+	if f.CompFilter != nil {
+		f.CompFilter.writeTo(elem)
+	}
+
+	return elem
+}
+
+func (f *CompFilter) writeTo(parent *etree.Element) {
+	elem := createFilterElem(parent, TAG_COMP_FILTER)
+	elem.CreateAttr("name", f.Name)
+
+	for _, child := range f.Children() {
+		child.(treeNode).writeTo(elem)
+	}
+}
+
+func (f *PropFilter) writeTo(parent *etree.Element) {
+	elem := createFilterElem(parent, TAG_PROP_FILTER)
+	elem.CreateAttr("name", f.Name)
+
+	for _, child := range f.Children() {
+		child.(treeNode).writeTo(elem)
+	}
+}
+
+func (f *ParamFilter) writeTo(parent *etree.Element) {
+	elem := createFilterElem(parent, TAG_PARAM_FILTER)
+	elem.CreateAttr("name", f.Name)
+
+	for _, child := range f.Children() {
+		child.(treeNode).writeTo(elem)
+	}
+}
+
+func (f *TimeRange) writeTo(parent *etree.Element) {
+	elem := createFilterElem(parent, TAG_TIME_RANGE)
+	if !f.Start.IsZero() {
+		elem.CreateAttr("start", f.Start.UTC().Format(FILTER_TIME_FORMAT))
+	}
+	if !f.End.IsZero() {
+		elem.CreateAttr("end", f.End.UTC().Format(FILTER_TIME_FORMAT))
+	}
+}
+
+func (f *TextMatch) writeTo(parent *etree.Element) {
+	elem := createFilterElem(parent, TAG_TEXT_MATCH)
+	if f.Collation != "" {
+		elem.CreateAttr("collation", f.Collation)
+	}
+	if f.MatchType != "" {
+		elem.CreateAttr("match-type", f.MatchType)
+	}
+	if f.NegateCondition {
+		elem.CreateAttr("negate-condition", "yes")
+	}
+	elem.SetText(f.Text)
+}
+
+func (f *IsNotDefined) writeTo(parent *etree.Element) {
+	createFilterElem(parent, TAG_IS_NOT_DEFINED)
+}
+
+// The nodes written to the CalDAV XML.
+type treeNode interface {
+	writeTo(parent *etree.Element)
+}
+
+func createFilterElem(parent *etree.Element, tag string) *etree.Element {
+	elem := parent.CreateElement(tag)
+	elem.Space = "C"
+	return elem
+}
+
+// Tree returns the typed tree of the filter. The elements that are not part of the CALDAV:filter
+// syntax are left out.
+func (f *ResourceFilter) Tree() *Filter {
+	tree := new(Filter)
+	if f.etreeElem == nil {
+		return tree
+	}
+
+	for _, child := range f.getChildren() {
+		if child.name == TAG_COMP_FILTER {
+			tree.CompFilter = child.compFilterTree()
+			break
+		}
+	}
+
+	return tree
+}
+
+// Timezone returns the time zone of the floating times in the time-range filters. Nil means UTC.
+func (f *ResourceFilter) Timezone() *ics.Timezone {
+	return f.timezone
+}
+
+func (f *ResourceFilter) compFilterTree() *CompFilter {
+	comp := &CompFilter{Name: f.attrs["name"]}
+	for _, child := range f.getChildren() {
+		switch child.name {
+		case TAG_IS_NOT_DEFINED:
+			comp.IsNotDefined = NotDefined()
+		case TAG_TIME_RANGE:
+			comp.TimeRange = child.timeRangeTree()
+		case TAG_PROP_FILTER:
+			comp.PropFilters = append(comp.PropFilters, child.propFilterTree())
+		case TAG_COMP_FILTER:
+			comp.CompFilters = append(comp.CompFilters, child.compFilterTree())
+		}
+	}
+
+	return comp
+}
+
+func (f *ResourceFilter) propFilterTree() *PropFilter {
+	prop := &PropFilter{Name: f.attrs["name"]}
+	for _, child := range f.getChildren() {
+		switch child.name {
+		case TAG_IS_NOT_DEFINED:
+			prop.IsNotDefined = NotDefined()
+		case TAG_TIME_RANGE:
+			prop.TimeRange = child.timeRangeTree()
+		case TAG_TEXT_MATCH:
+			prop.TextMatch = child.textMatchTree()
+		case TAG_PARAM_FILTER:
+			prop.ParamFilters = append(prop.ParamFilters, child.paramFilterTree())
+		}
+	}
+
+	return prop
+}
+
+func (f *ResourceFilter) paramFilterTree() *ParamFilter {
+	param := &ParamFilter{Name: f.attrs["name"]}
+	for _, child := range f.getChildren() {
+		switch child.name {
+		case TAG_IS_NOT_DEFINED:
+			param.IsNotDefined = NotDefined()
+		case TAG_TEXT_MATCH:
+			param.TextMatch = child.textMatchTree()
+		}
+	}
+
+	return param
+}
+
+func (f *ResourceFilter) timeRangeTree() *TimeRange {
+	timeRange := new(TimeRange)
+	if start := f.TimeAttr("start"); start != nil {
+		timeRange.Start = *start
+	}
+	if end := f.TimeAttr("end"); end != nil {
+		timeRange.End = *end
+	}
+
+	return timeRange
+}
+
+func (f *ResourceFilter) textMatchTree() *TextMatch {
+	return &TextMatch{
+		Text:            f.text,
+		Collation:       f.attrs["collation"],
+		MatchType:       f.attrs["match-type"],
+		NegateCondition: f.attrs["negate-condition"] == "yes",
+	}
+}
@@ -0,0 +1,131 @@
+package data
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var treeFilterXML = `
+  <C:filter xmlns:C="urn:ietf:params:xml:ns:caldav">
+    <C:comp-filter name="VCALENDAR">
+      <C:comp-filter name="VEVENT">
+        <C:time-range start="20160914T000000Z" end="20160915T000000Z"/>
+        <C:prop-filter name="SUMMARY">
+          <C:text-match collation="i;octet" negate-condition="yes">Party</C:text-match>
+        </C:prop-filter>
+        <C:prop-filter name="ATTENDEE">
+          <C:param-filter name="PARTSTAT"><C:is-not-defined/></C:param-filter>
+        </C:prop-filter>
+        <C:comp-filter name="VALARM"><C:is-not-defined/></C:comp-filter>
+      </C:comp-filter>
+    </C:comp-filter>
+  </C:filter>`
+
+func newTreeFilter() *Filter {
+	return NewFilter(Comp("VCALENDAR",
+		Comp("VEVENT",
+			Range(time.Date(2016, 9, 14, 0, 0, 0, 0, time.UTC), time.Date(2016, 9, 15, 0, 0, 0, 0, time.UTC)),
+			Prop("SUMMARY", &TextMatch{Text: "Party", Collation: "i;octet", NegateCondition: true}),
+			Prop("ATTENDEE", Param("PARTSTAT", NotDefined())),
+			Comp("VALARM", NotDefined()),
+		),
+	))
+}
+
+func TestFilterTree(t *testing.T) {
+	filter, err := ParseResourceFilters(treeFilterXML)
+	panicerr(err)
+
+	// the parsed tree is the same as the built one
+	if tree := filter.Tree(); !reflect.DeepEqual(tree, newTreeFilter()) {
+		t.Errorf("Unexpected filter tree: %+v", tree.CompFilter)
+	}
+
+	// the XML of the built tree gives the same tree back
+	filter, err = ParseResourceFilters(newTreeFilter().ToXML())
+	panicerr(err)
+	if !reflect.DeepEqual(filter.Tree(), newTreeFilter()) {
+		t.Error("Unexpected filter tree from the XML:", newTreeFilter().ToXML())
+	}
+
+	if tree := new(ResourceFilter).Tree(); tree.CompFilter != nil {
+		t.Error("Expected an empty tree for an empty filter")
+	}
+}
+
+func TestNewResourceFilter(t *testing.T) {
+	filter := NewResourceFilter(NewFilter(Comp("VCALENDAR",
+		Comp("VEVENT", Prop("SUMMARY", &TextMatch{Text: "party", MatchType: "starts-with"})),
+	)))
+
+	res := FakeResource{comp: "VEVENT"}
+	res.addProperty("VCALENDAR:VEVENT:SUMMARY", "Party at home")
+	if !filter.Match(&res) {
+		t.Error("The built filter should have matched")
+	}
+
+	res.addProperty("VCALENDAR:VEVENT:SUMMARY", "Birthday party")
+	if filter.Match(&res) {
+		t.Error("The built filter should not have matched")
+	}
+}
+
+// Translates the filters into a readable expression, as the visitors of the storages would do.
+type exprVisitor struct {
+	parts []string
+}
+
+func (v *exprVisitor) VisitCompFilter(f *CompFilter) error {
+	v.parts = append(v.parts, "comp:"+f.Name)
+	return nil
+}
+
+func (v *exprVisitor) VisitPropFilter(f *PropFilter) error {
+	v.parts = append(v.parts, "prop:"+f.Name)
+	return nil
+}
+
+func (v *exprVisitor) VisitParamFilter(f *ParamFilter) error {
+	v.parts = append(v.parts, "param:"+f.Name)
+	return nil
+}
+
+func (v *exprVisitor) VisitTimeRange(f *TimeRange) error {
+	v.parts = append(v.parts, fmt.Sprintf("range:%d-%d", f.Start.Day(), f.End.Day()))
+	return nil
+}
+
+func (v *exprVisitor) VisitTextMatch(f *TextMatch) error {
+	if f.Collation != COLLATION_OCTET {
+		return fmt.Errorf("unsupported collation %s", f.Collation)
+	}
+	v.parts = append(v.parts, "text:"+f.Text)
+	return nil
+}
+
+func (v *exprVisitor) VisitIsNotDefined(f *IsNotDefined) error {
+	v.parts = append(v.parts, "undefined")
+	return nil
+}
+
+func TestWalkFilter(t *testing.T) {
+	v := new(exprVisitor)
+	if err := WalkFilter(newTreeFilter().CompFilter, v); err != nil {
+		t.Error("Unexpected error:", err)
+	}
+
+	expected := "comp:VCALENDAR comp:VEVENT range:14-15 prop:SUMMARY text:Party prop:ATTENDEE param:PARTSTAT undefined comp:VALARM undefined"
+	if strings.Join(v.parts, " ") != expected {
+		t.Error("Expected:", expected, "| Got:", strings.Join(v.parts, " "))
+	}
+
+	// the walk stops at the first error
+	v = new(exprVisitor)
+	err := WalkFilter(Comp("VCALENDAR", Prop("SUMMARY", Text("Party")), Prop("LOCATION")), v)
+	if err == nil || strings.Join(v.parts, " ") != "comp:VCALENDAR prop:SUMMARY" {
+		t.Error("Expected the walk to stop at the text-match | Got:", err, v.parts)
+	}
+}
@@ -0,0 +1,215 @@
+package data
+
+import (
+	"encoding/xml"
+	"net/http"
+	"time"
+
+	"github.com/samedi/caldav-go/errs"
+	"github.com/samedi/caldav-go/ixml"
+	"github.com/samedi/caldav-go/lib"
+)
+
+// ParseCalendarQueryFilter parses the CALDAV:filter of a calendar-query request body, checking it strictly
+// against the syntax of RFC4791#9.7, which `ParseResourceFilters` does not do. The filter must be in the CalDAV
+// namespace, have exactly one VCALENDAR comp-filter and only the allowed child elements, and its time ranges
+// must be in the UTC format. Otherwise a `errs.PreconditionError` for CALDAV:valid-filter is returned, or for
+// CALDAV:supported-collation when a text-match uses an unknown collation.
+func ParseCalendarQueryFilter(body string) (*ResourceFilter, error) {
+	var root ixml.Element
+	if err := xml.Unmarshal([]byte(body), &root); err != nil {
+		return new(ResourceFilter), invalidFilterError()
+	}
+
+	var filters []ixml.Element
+	if root.XMLName == filterName(TAG_FILTER) {
+		filters = append(filters, root)
+	} else {
+		for _, child := range root.Children {
+			if child.XMLName == filterName(TAG_FILTER) {
+				filters = append(filters, child)
+			}
+		}
+	}
+
+	if len(filters) != 1 {
+		return new(ResourceFilter), invalidFilterError()
+	}
+
+	if err := validateFilter(filters[0]); err != nil {
+		return new(ResourceFilter), err
+	}
+
+	return ParseResourceFilters(body)
+}
+
+func filterName(tag string) xml.Name {
+	return xml.Name{Space: ixml.CALDAV_NS, Local: tag}
+}
+
+func invalidFilterError() error {
+	return errs.NewPreconditionError(http.StatusForbidden, ixml.VALID_FILTER_TG)
+}
+
+// <!ELEMENT filter (comp-filter)>, with the VCALENDAR component
+func validateFilter(e ixml.Element) error {
+	if len(e.Children) != 1 || e.Children[0].XMLName != filterName(TAG_COMP_FILTER) || e.Children[0].Attr("name") != lib.VCALENDAR {
+		return invalidFilterError()
+	}
+
+	return validateCompFilter(e.Children[0])
+}
+
+// <!ELEMENT comp-filter (is-not-defined | (time-range?, prop-filter*, comp-filter*))>
+func validateCompFilter(e ixml.Element) error {
+	allowed := map[string]int{TAG_IS_NOT_DEFINED: 1, TAG_TIME_RANGE: 1, TAG_PROP_FILTER: -1, TAG_COMP_FILTER: -1}
+	if err := validateFilterChildren(e, allowed); err != nil {
+		return err
+	}
+
+	for _, child := range e.Children {
+		var err error
+		switch child.XMLName.Local {
+		case TAG_TIME_RANGE:
+			err = validateTimeRange(child)
+		case TAG_PROP_FILTER:
+			err = validatePropFilter(child)
+		case TAG_COMP_FILTER:
+			err = validateCompFilter(child)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// <!ELEMENT prop-filter (is-not-defined | ((time-range | text-match)?, param-filter*))>
+func validatePropFilter(e ixml.Element) error {
+	allowed := map[string]int{TAG_IS_NOT_DEFINED: 1, TAG_TIME_RANGE: 1, TAG_TEXT_MATCH: 1, TAG_PARAM_FILTER: -1}
+	if err := validateFilterChildren(e, allowed); err != nil {
+		return err
+	}
+
+	var hasTimeRange, hasTextMatch bool
+	for _, child := range e.Children {
+		var err error
+		switch child.XMLName.Local {
+		case TAG_TIME_RANGE:
+			hasTimeRange = true
+			err = validateTimeRange(child)
+		case TAG_TEXT_MATCH:
+			hasTextMatch = true
+			err = validateTextMatch(child)
+		case TAG_PARAM_FILTER:
+			err = validateParamFilter(child)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if hasTimeRange && hasTextMatch {
+		return invalidFilterError()
+	}
+
+	return nil
+}
+
+// <!ELEMENT param-filter (is-not-defined | text-match?)>
+func validateParamFilter(e ixml.Element) error {
+	if err := validateFilterChildren(e, map[string]int{TAG_IS_NOT_DEFINED: 1, TAG_TEXT_MATCH: 1}); err != nil {
+		return err
+	}
+
+	for _, child := range e.Children {
+		if child.XMLName.Local == TAG_TEXT_MATCH {
+			return validateTextMatch(child)
+		}
+	}
+
+	return nil
+}
+
+// <!ELEMENT time-range EMPTY>, with at least one of the start and end attributes, in UTC
+func validateTimeRange(e ixml.Element) error {
+	if len(e.Children) > 0 {
+		return invalidFilterError()
+	}
+
+	var times []time.Time
+	for _, name := range []string{"start", "end"} {
+		value := e.Attr(name)
+		if value == "" {
+			continue
+		}
+
+		t, err := time.Parse(FILTER_TIME_FORMAT, value)
+		if err != nil {
+			return invalidFilterError()
+		}
+		times = append(times, t)
+	}
+
+	if len(times) == 0 || (len(times) == 2 && !times[0].Before(times[1])) {
+		return invalidFilterError()
+	}
+
+	return nil
+}
+
+// <!ELEMENT text-match (#PCDATA)>, with the collation, negate-condition and match-type attributes
+func validateTextMatch(e ixml.Element) error {
+	if len(e.Children) > 0 {
+		return invalidFilterError()
+	}
+
+	switch e.Attr("negate-condition") {
+	case "", "yes", "no":
+	default:
+		return invalidFilterError()
+	}
+
+	switch e.Attr("match-type") {
+	case "", "equals", "contains", "starts-with", "ends-with":
+	default:
+		return invalidFilterError()
+	}
+
+	if collation := e.Attr("collation"); collation != "" && !IsSupportedCollation(collation) {
+		return errs.NewPreconditionError(http.StatusForbidden, ixml.SUPPORTED_COLLATION_TG)
+	}
+
+	return nil
+}
+
+// Checks the common rules of the comp, prop and param filters: they must have a name and their children must be
+// CalDAV elements among the allowed ones, each up to the given number of times (-1 for any). The is-not-defined
+// element excludes all the others.
+func validateFilterChildren(e ixml.Element, allowed map[string]int) error {
+	if e.Attr("name") == "" {
+		return invalidFilterError()
+	}
+
+	counts := make(map[string]int)
+	for _, child := range e.Children {
+		max, found := allowed[child.XMLName.Local]
+		if !found || child.XMLName.Space != ixml.CALDAV_NS {
+			return invalidFilterError()
+		}
+
+		counts[child.XMLName.Local]++
+		if max != -1 && counts[child.XMLName.Local] > max {
+			return invalidFilterError()
+		}
+	}
+
+	if counts[TAG_IS_NOT_DEFINED] > 0 && len(e.Children) > 1 {
+		return invalidFilterError()
+	}
+
+	return nil
+}
@@ -3,10 +3,13 @@ package data
 import (
 	"errors"
 	"github.com/beevik/etree"
+	"github.com/laurent22/ical-go"
 	"log"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/samedi/caldav-go/ics"
 	"github.com/samedi/caldav-go/lib"
 )
 
@@ -32,6 +35,13 @@ type ResourceFilter struct {
 	attrs     map[string]string
 	children  []ResourceFilter // collection of child filters.
 	etreeElem *etree.Element   // holds the parsed XML node/tag as an `etree` element.
+	timezone  *ics.Timezone    // time zone of the floating times in the time-range filters.
+}
+
+// Resources able to resolve their floating times in a given time zone, like `data.Resource`.
+type floatingTimeResource interface {
+	StartTime(floating *ics.Timezone) time.Time
+	EndTime(floating *ics.Timezone) time.Time
 }
 
 // ParseResourceFilters initializes a new `ResourceFilter` object from a snippet of XML string.
@@ -72,6 +82,14 @@ func newFilterFromEtreeElem(elem *etree.Element) ResourceFilter {
 	return filter
 }
 
+// SetTimezone sets the time zone used to resolve the floating times and dates of the resources in the
+// time-range filters (RFC4791#9.9). It is usually the CALDAV:timezone of the query or the calendar-timezone
+// of the collection. By default, the floating times are taken as UTC.
+func (f *ResourceFilter) SetTimezone(tz *ics.Timezone) {
+	f.timezone = tz
+	f.children = nil
+}
+
 // Attr searches an attribute by its name in the list of filter attributes and returns it.
 func (f *ResourceFilter) Attr(attrName string) string {
 	return f.attrs[attrName]
@@ -95,6 +113,26 @@ func (f *ResourceFilter) GetTimeRangeFilter() *ResourceFilter {
 	return f.findChild(TAG_TIME_RANGE, true)
 }
 
+// UnsupportedCollation searches the text-match filters for a collation which is not supported and returns it.
+// The REPORT requests using it must fail with the CALDAV:supported-collation precondition (RFC4791#7.5.1).
+func (f *ResourceFilter) UnsupportedCollation() (string, bool) {
+	if f.etreeElem == nil {
+		return "", false
+	}
+
+	if collation := f.attrs["collation"]; f.name == TAG_TEXT_MATCH && collation != "" && !IsSupportedCollation(collation) {
+		return collation, true
+	}
+
+	for i := range f.getChildren() {
+		if collation, found := f.children[i].UnsupportedCollation(); found {
+			return collation, true
+		}
+	}
+
+	return "", false
+}
+
 // Match returns whether a provided resource matches the filters.
 func (f *ResourceFilter) Match(target ResourceInterface) bool {
 	if f.name == TAG_FILTER {
@@ -152,7 +190,7 @@ func (f *ResourceFilter) compChildrenMatch(target ResourceInterface, scope []str
 		switch child.name {
 		case TAG_TIME_RANGE:
 			// Point #3 of RFC4791#9.7.1
-			match = child.timeRangeMatch(target)
+			match = child.timeRangeMatch(target, scope)
 		case TAG_PROP_FILTER:
 			// Point #4 of RFC4791#9.7.1
 			match = child.propMatch(target, scope)
@@ -169,15 +207,16 @@ func (f *ResourceFilter) compChildrenMatch(target ResourceInterface, scope []str
 	return true
 }
 
-// See RFC4791-9.9
-func (f *ResourceFilter) timeRangeMatch(target ResourceInterface) bool {
+// Returns the range of a time-range filter. At least one of the `start` and `end` attributes must be present,
+// the missing one is taken as open ended.
+func (f *ResourceFilter) timeRange() (time.Time, time.Time, bool) {
 	startAttr := f.attrs["start"]
 	endAttr := f.attrs["end"]
 
 	// at least one of the two MUST be present
 	if startAttr == "" && endAttr == "" {
 		// if both of them are missing, return false
-		return false
+		return time.Time{}, time.Time{}, false
 	} else if startAttr == "" {
 		// if missing only the `start`, set it open ended to the left
 		startAttr = "00010101T000000Z"
@@ -186,38 +225,78 @@ func (f *ResourceFilter) timeRangeMatch(target ResourceInterface) bool {
 		endAttr = "99991231T235959Z"
 	}
 
-	// The logic below is only applicable for VEVENT components. So
-	// we return false if the resource is not a VEVENT component.
-	if target.ComponentName() != lib.VEVENT {
-		return false
-	}
-
 	rangeStart, err := time.Parse(FILTER_TIME_FORMAT, startAttr)
 	if err != nil {
 		log.Printf("ERROR: Could not parse start time in time-range filter.\nError: %s.\nStart attr: %s", err, startAttr)
-		return false
+		return time.Time{}, time.Time{}, false
 	}
 
 	rangeEnd, err := time.Parse(FILTER_TIME_FORMAT, endAttr)
 	if err != nil {
 		log.Printf("ERROR: Could not parse end time in time-range filter.\nError: %s.\nEnd attr: %s", err, endAttr)
+		return time.Time{}, time.Time{}, false
+	}
+
+	return rangeStart, rangeEnd, true
+}
+
+// the following logic is inferred from the rules table for VEVENT components,
+// described in RFC4791-9.9.
+func overlapRange(dtStart, dtEnd, rangeStart, rangeEnd time.Time) bool {
+	if dtStart.Equal(dtEnd) {
+		// Lines 3 and 4 of the table deal when the DTSTART and DTEND dates are equals.
+		// In this case we use the rule: (start <= DTSTART && end > DTSTART)
+		return inRange(dtStart, rangeStart, rangeEnd)
+	}
+
+	// Lines 1, 2 and 6 of the table deal when the DTSTART and DTEND dates are different.
+	// In this case we use the rule: (start < DTEND && end > DTSTART)
+	return rangeStart.Before(dtEnd) && rangeEnd.After(dtStart)
+}
+
+// The rule for single points in time, like the alarm triggers and the COMPLETED property: (start <= t && end > t).
+func inRange(t, rangeStart, rangeEnd time.Time) bool {
+	return !t.Before(rangeStart) && rangeEnd.After(t)
+}
+
+// See RFC4791-9.9
+func (f *ResourceFilter) timeRangeMatch(target ResourceInterface, scope []string) bool {
+	rangeStart, rangeEnd, ok := f.timeRange()
+	if !ok {
 		return false
 	}
 
-	// the following logic is inferred from the rules table for VEVENT components,
-	// described in RFC4791-9.9.
-	overlapRange := func(dtStart, dtEnd, rangeStart, rangeEnd time.Time) bool {
-		if dtStart.Equal(dtEnd) {
-			// Lines 3 and 4 of the table deal when the DTSTART and DTEND dates are equals.
-			// In this case we use the rule: (start <= DTSTART && end > DTSTART)
-			return (rangeStart.Before(dtStart) || rangeStart.Equal(dtStart)) && rangeEnd.After(dtStart)
-		} else {
-			// Lines 1, 2 and 6 of the table deal when the DTSTART and DTEND dates are different.
-			// In this case we use the rule: (start < DTEND && end > DTSTART)
-			return rangeStart.Before(dtEnd) && rangeEnd.After(dtStart)
+	// when the iCalendar data is available, each instance of the components is checked
+	if cal, ok := calendarData(target); ok {
+		timeContext := ics.NewTimeContext(cal, f.timezone)
+
+		switch {
+		case len(scope) == 2 && scope[1] == lib.VEVENT:
+			match := false
+			complete := timeContext.EachInstance(cal, lib.VEVENT, rangeEnd, func(comp *ical.Node, start, end time.Time) bool {
+				match = match || overlapRange(start, end, rangeStart, rangeEnd)
+				return !match
+			})
+			// the instances of an incomplete expansion may be in the range
+			return match || !complete
+		case len(scope) == 3 && scope[2] == lib.VALARM:
+			return alarmsMatch(cal, scope[1], timeContext, rangeStart, rangeEnd)
+		default:
+			return false
 		}
 	}
 
+	// The logic below is only applicable for VEVENT components. So
+	// we return false if the resource is not a VEVENT component.
+	if target.ComponentName() != lib.VEVENT {
+		return false
+	}
+
+	start, end := target.StartTimeUTC(), target.EndTimeUTC()
+	if resolver, ok := target.(floatingTimeResource); ok {
+		start, end = resolver.StartTime(f.timezone), resolver.EndTime(f.timezone)
+	}
+
 	// first we check each of the target recurrences (if any).
 	for _, recurrence := range target.Recurrences() {
 		// if any of them overlap the filter range, we return true right away
@@ -228,44 +307,260 @@ func (f *ResourceFilter) timeRangeMatch(target ResourceInterface) bool {
 
 	// if none of the recurrences match, we just return if the actual
 	// resource's `start` and `end` times match the filter range
-	return overlapRange(target.StartTimeUTC(), target.EndTimeUTC(), rangeStart, rangeEnd)
+	return overlapRange(start, end, rangeStart, rangeEnd)
+}
+
+// Tells whether any VALARM of the components with the given name triggers in the range, in any of the
+// instances of the components (RFC4791#9.9).
+func alarmsMatch(cal *ical.Node, compName string, timeContext *ics.TimeContext, rangeStart, rangeEnd time.Time) bool {
+	match := false
+	lead := alarmsLead(cal, compName)
+
+	complete := timeContext.EachInstance(cal, compName, time.Time{}, func(comp *ical.Node, start, end time.Time) bool {
+		for _, alarm := range ics.Components(comp, lib.VALARM) {
+			for _, trigger := range alarmTriggers(alarm, timeContext, start, end) {
+				if inRange(trigger, rangeStart, rangeEnd) {
+					match = true
+					return false
+				}
+			}
+		}
+
+		// all the instances starting before the end of the range are checked, and the later ones as long as their
+		// alarms may trigger before it, whatever the alarms of this instance are
+		return start.Add(-lead).Before(rangeEnd)
+	})
+
+	// the alarms of the instances of an incomplete expansion may trigger in the range
+	return match || !complete
+}
+
+// Returns how long before the start of their instances the alarms of the components with the given name may
+// trigger, i.e. the biggest negative offset of their triggers related to the instances, or zero.
+func alarmsLead(cal *ical.Node, compName string) time.Duration {
+	var lead time.Duration
+
+	for _, comp := range ics.Components(cal, compName) {
+		for _, alarm := range ics.Components(comp, lib.VALARM) {
+			if prop := ics.Property(alarm, "TRIGGER"); prop != nil {
+				// the triggers related to the end are not earlier than the same offset from the start
+				if offset, ok := ics.ParseDuration(prop.Value); ok && -offset > lead {
+					lead = -offset
+				}
+			}
+		}
+	}
+
+	return lead
+}
+
+// Returns the times an alarm triggers for the instance of its component with the given period, including its
+// repetitions (RFC5545#3.6.6). The triggers are either related to the instance or absolute times.
+func alarmTriggers(alarm *ical.Node, timeContext *ics.TimeContext, start, end time.Time) []time.Time {
+	prop := ics.Property(alarm, "TRIGGER")
+	if prop == nil {
+		return nil
+	}
+
+	var trigger time.Time
+	if offset, ok := ics.ParseDuration(prop.Value); ok {
+		trigger = start.Add(offset)
+		if strings.ToUpper(prop.Parameter("RELATED", "START")) == "END" {
+			trigger = end.Add(offset)
+		}
+	} else if t, ok := timeContext.DateTime(prop); ok {
+		trigger = t
+	} else {
+		return nil
+	}
+
+	triggers := []time.Time{trigger}
+	if repeat, err := strconv.Atoi(alarm.PropString("REPEAT", "")); err == nil {
+		if interval, ok := ics.ParseDuration(alarm.PropString("DURATION", "")); ok && interval > 0 {
+			for i := 1; i <= repeat; i++ {
+				triggers = append(triggers, trigger.Add(time.Duration(i)*interval))
+			}
+		}
+	}
+
+	return triggers
+}
+
+// See RFC4791-9.9: a time range on a DATE or DATE-TIME property, e.g. COMPLETED, DTSTAMP or LAST-MODIFIED.
+// It is only used for the resources without iCalendar data, whose values can only be taken as UTC.
+func (f *ResourceFilter) propTimeRangeMatch(target ResourceInterface, propPath []string) bool {
+	rangeStart, rangeEnd, ok := f.timeRange()
+	if !ok {
+		return false
+	}
+
+	for _, text := range propertyValues(target, propPath) {
+		if value, ok := ics.DateTime(ics.NewProperty(propPath[len(propPath)-1], text, nil)); ok && inRange(value, rangeStart, rangeEnd) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// The time range on one occurrence of a property, resolved in the time zones of the calendar data.
+func (f *ResourceFilter) propNodeTimeRangeMatch(prop *ical.Node, timeContext *ics.TimeContext) bool {
+	rangeStart, rangeEnd, ok := f.timeRange()
+	if !ok {
+		return false
+	}
+
+	value, ok := timeContext.DateTime(prop)
+	return ok && inRange(value, rangeStart, rangeEnd)
+}
+
+// Resources with iCalendar data, like `data.Resource`, whose time ranges can be checked against each of their instances.
+type calendarDataResource interface {
+	GetContentData() (string, bool)
+}
+
+// Returns the parsed iCalendar data of the resource, when available.
+func calendarData(target ResourceInterface) (*ical.Node, bool) {
+	// the data of the resources is parsed only once for all the filters
+	if resource, ok := target.(*Resource); ok {
+		cal, err := resource.calendar()
+		return cal, err == nil
+	}
+
+	resource, ok := target.(calendarDataResource)
+	if !ok {
+		return nil, false
+	}
+
+	content, found := resource.GetContentData()
+	if !found {
+		return nil, false
+	}
+
+	cal, err := ics.Parse(content)
+	return cal, err == nil
+}
+
+// Resources able to give all the occurrences of a property or param, like `data.Resource`. The filters on the
+// other resources only check the first occurrence.
+type multiValuedResource interface {
+	GetPropertyValues(propPath ...string) []string
+	GetPropertyParamValues(paramPath ...string) []string
+}
+
+// Returns the values of all the occurrences of the property at the given path.
+func propertyValues(target ResourceInterface, propPath []string) []string {
+	if resource, ok := target.(multiValuedResource); ok {
+		return resource.GetPropertyValues(propPath...)
+	}
+
+	if !target.HasProperty(propPath...) {
+		return nil
+	}
+
+	return []string{target.GetPropertyValue(propPath...)}
+}
+
+// Returns the values of the param in all the occurrences of the property at the given path.
+func propertyParamValues(target ResourceInterface, paramPath []string) []string {
+	if resource, ok := target.(multiValuedResource); ok {
+		return resource.GetPropertyParamValues(paramPath...)
+	}
+
+	if !target.HasPropertyParam(paramPath...) {
+		return nil
+	}
+
+	return []string{target.GetPropertyParamValue(paramPath...)}
+}
+
+// The properties holding lists of TEXT values, whose values are matched one by one by the text-match filters.
+var textListProperties = []string{"CATEGORIES", "RESOURCES"}
+
+// Returns the text values of a property to check with the text-match filters: its unescaped value or, for the
+// lists of values, each of them.
+func propertyTextValues(prop *ical.Node) []string {
+	if containsString(textListProperties, prop.Name) {
+		return ics.SplitText(prop.Value)
+	}
+
+	return []string{ics.UnescapeText(prop.Value)}
 }
 
-// See RFC4791-9.7.2.
+// Returns all the properties at the given path, e.g. ["VCALENDAR", "VEVENT", "ATTENDEE"], in all the components
+// at that path, e.g. the recurrence overrides.
+func propertiesAt(cal *ical.Node, propPath []string) []*ical.Node {
+	var props []*ical.Node
+	for _, comp := range componentsAt(cal, propPath[:len(propPath)-1]) {
+		props = append(props, ics.Properties(comp, propPath[len(propPath)-1])...)
+	}
+
+	return props
+}
+
+// Returns the components at the given path of component names, e.g. ["VCALENDAR", "VEVENT", "VALARM"].
+func componentsAt(cal *ical.Node, path []string) []*ical.Node {
+	if len(path) > 0 && path[0] == lib.VCALENDAR {
+		path = path[1:]
+	}
+
+	comps := []*ical.Node{cal}
+	for _, name := range path {
+		var children []*ical.Node
+		for _, comp := range comps {
+			children = append(children, ics.Components(comp, name)...)
+		}
+		comps = children
+	}
+
+	return comps
+}
+
+// See RFC4791-9.7.2. The prop filter matches when any of the occurrences of the property, in any of the
+// components at its path, matches all its child filters.
 func (f *ResourceFilter) propMatch(target ResourceInterface, scope []string) bool {
 	propName := f.attrs["name"]
 	propPath := append(scope, propName)
 
+	cal, ok := calendarData(target)
+	if !ok {
+		return f.propValuesMatch(target, propPath)
+	}
+
+	props := propertiesAt(cal, propPath)
 	if f.isEmpty() {
 		// Point #1 of RFC4791#9.7.2
-		return target.HasProperty(propPath...)
+		return len(props) > 0
 	} else if f.contains(TAG_IS_NOT_DEFINED) {
 		// Point #2 of RFC4791#9.7.2
-		return !target.HasProperty(propPath...)
-	} else {
-		// check each child of the current filter if they all match.
-		return f.propChildrenMatch(target, propPath)
+		return len(props) == 0
 	}
+
+	timeContext := ics.NewTimeContext(cal, f.timezone)
+	for _, prop := range props {
+		if f.propChildrenMatch(prop, timeContext) {
+			return true
+		}
+	}
+
+	return false
 }
 
-// checks if all the prop's child filters match the target resource
-func (f *ResourceFilter) propChildrenMatch(target ResourceInterface, propPath []string) bool {
+// checks if all the prop's child filters match the occurrence of the property
+func (f *ResourceFilter) propChildrenMatch(prop *ical.Node, timeContext *ics.TimeContext) bool {
 	for _, child := range f.getChildren() {
 		var match bool
 
 		switch child.name {
 		case TAG_TIME_RANGE:
 			// Point #3 of RFC4791#9.7.2
-			// TODO: this point is not very clear on how to match time range against properties.
-			// So we're returning `false` in the meantime.
-			match = false
+			match = child.propNodeTimeRangeMatch(prop, timeContext)
 		case TAG_TEXT_MATCH:
 			// Point #4 of RFC4791#9.7.2
-			propText := target.GetPropertyValue(propPath...)
-			match = child.textMatch(propText)
+			match = child.textMatchAny(propertyTextValues(prop))
 		case TAG_PARAM_FILTER:
 			// Point #4 of RFC4791#9.7.2
-			match = child.paramMatch(target, propPath)
+			match = child.paramMatch(prop)
 		}
 
 		if !match {
@@ -277,7 +572,62 @@ func (f *ResourceFilter) propChildrenMatch(target ResourceInterface, propPath []
 }
 
 // See RFC4791-9.7.3
-func (f *ResourceFilter) paramMatch(target ResourceInterface, parentPropPath []string) bool {
+func (f *ResourceFilter) paramMatch(prop *ical.Node) bool {
+	paramValue, defined := prop.Parameters[f.attrs["name"]]
+
+	if f.isEmpty() {
+		// Point #1 of RFC4791#9.7.3
+		return defined
+	} else if f.contains(TAG_IS_NOT_DEFINED) {
+		// Point #2 of RFC4791#9.7.3
+		return !defined
+	} else {
+		child := f.getChildren()[0]
+		// param filters can also have (only-one) nested text-match filter
+		if child.name == TAG_TEXT_MATCH {
+			return defined && child.textMatch(paramValue)
+		}
+	}
+
+	return false
+}
+
+// The prop filter on the resources without iCalendar data, through the property lookups of the resource. The
+// child filters are checked separately, each of them against any of the occurrences of the property.
+func (f *ResourceFilter) propValuesMatch(target ResourceInterface, propPath []string) bool {
+	if f.isEmpty() {
+		// Point #1 of RFC4791#9.7.2
+		return target.HasProperty(propPath...)
+	} else if f.contains(TAG_IS_NOT_DEFINED) {
+		// Point #2 of RFC4791#9.7.2
+		return !target.HasProperty(propPath...)
+	}
+
+	for _, child := range f.getChildren() {
+		var match bool
+
+		switch child.name {
+		case TAG_TIME_RANGE:
+			// Point #3 of RFC4791#9.7.2
+			match = child.propTimeRangeMatch(target, propPath)
+		case TAG_TEXT_MATCH:
+			// Point #4 of RFC4791#9.7.2
+			match = child.textMatchAny(propertyValues(target, propPath))
+		case TAG_PARAM_FILTER:
+			// Point #4 of RFC4791#9.7.2
+			match = child.paramValuesMatch(target, propPath)
+		}
+
+		if !match {
+			return false
+		}
+	}
+
+	return true
+}
+
+// See RFC4791-9.7.3, on the resources without iCalendar data.
+func (f *ResourceFilter) paramValuesMatch(target ResourceInterface, parentPropPath []string) bool {
 	paramName := f.attrs["name"]
 	paramPath := append(parentPropPath, paramName)
 
@@ -291,29 +641,33 @@ func (f *ResourceFilter) paramMatch(target ResourceInterface, parentPropPath []s
 		child := f.getChildren()[0]
 		// param filters can also have (only-one) nested text-match filter
 		if child.name == TAG_TEXT_MATCH {
-			paramValue := target.GetPropertyParamValue(paramPath...)
-			return child.textMatch(paramValue)
+			return child.textMatchAny(propertyParamValues(target, paramPath))
 		}
 	}
 
 	return false
 }
 
-// See RFC4791-9.7.5
-func (f *ResourceFilter) textMatch(targetText string) bool {
-	// TODO: collations are not being considered/supported yet.
-	// Texts are lowered to be case-insensitive, almost as the "i;ascii-casemap" value.
-
-	targetText = strings.ToLower(targetText)
-	expectedSubstr := strings.ToLower(f.text)
-
-	match := strings.Contains(targetText, expectedSubstr)
+// Checks the text-match filter on the values of a property: any of them must match or, for the negated
+// conditions, none of them may contain the text.
+func (f *ResourceFilter) textMatchAny(values []string) bool {
+	textMatch := f.textMatchTree()
+	if len(values) == 0 {
+		return false
+	}
 
-	if f.attrs["negate-condition"] == "yes" {
-		return !match
+	for _, value := range values {
+		if textMatch.Match(value) != textMatch.NegateCondition {
+			return !textMatch.NegateCondition
+		}
 	}
 
-	return match
+	return textMatch.NegateCondition
+}
+
+// See RFC4791-9.7.5 and `TextMatch.Match`.
+func (f *ResourceFilter) textMatch(targetText string) bool {
+	return f.textMatchTree().Match(targetText)
 }
 
 func (f *ResourceFilter) isEmpty() bool {
@@ -355,6 +709,7 @@ func (f *ResourceFilter) getChildren() []ResourceFilter {
 
 		for _, childElem := range f.etreeElem.ChildElements() {
 			childFilter := newFilterFromEtreeElem(childElem)
+			childFilter.timezone = f.timezone
 			f.children = append(f.children, childFilter)
 		}
 	}
@@ -4,6 +4,9 @@ import (
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/samedi/caldav-go/errs"
+	"github.com/samedi/caldav-go/ixml"
 )
 
 func TestParseFilter(t *testing.T) {
@@ -29,6 +32,59 @@ func TestParseFilter(t *testing.T) {
 	}
 }
 
+func TestParseCalendarQueryFilter(t *testing.T) {
+	query := func(filter string) string {
+		return `<C:calendar-query xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav"><D:prop><D:getetag/></D:prop>` + filter + `</C:calendar-query>`
+	}
+
+	filter, err := ParseCalendarQueryFilter(query(`
+    <C:filter>
+      <C:comp-filter name="VCALENDAR">
+        <C:comp-filter name="VEVENT">
+          <C:time-range start="20160914T000000Z"/>
+          <C:prop-filter name="ATTENDEE">
+            <C:text-match collation="i;octet" match-type="equals">mailto:foo@example.com</C:text-match>
+            <C:param-filter name="PARTSTAT"><C:is-not-defined/></C:param-filter>
+          </C:prop-filter>
+        </C:comp-filter>
+      </C:comp-filter>
+    </C:filter>`))
+	if err != nil || filter.Tree().CompFilter.CompFilters[0].Name != "VEVENT" {
+		t.Error("Expected a valid filter | Got:", err)
+	}
+
+	invalidFilters := []string{
+		``,
+		`<C:filter/>`,
+		`<C:filter><C:comp-filter name="VCALENDAR"/></C:filter><C:filter><C:comp-filter name="VCALENDAR"/></C:filter>`,
+		`<filter><comp-filter name="VCALENDAR"/></filter>`,
+		`<C:filter><C:comp-filter name="VEVENT"/></C:filter>`,
+		`<C:filter><C:comp-filter name="VCALENDAR"/><C:comp-filter name="VCALENDAR"/></C:filter>`,
+		`<C:filter><C:comp-filter name="VCALENDAR"><C:comp-filter/></C:comp-filter></C:filter>`,
+		`<C:filter><C:comp-filter name="VCALENDAR"><C:comp-filter name="VEVENT"><D:prop/></C:comp-filter></C:comp-filter></C:filter>`,
+		`<C:filter><C:comp-filter name="VCALENDAR"><C:comp-filter name="VEVENT"><C:is-not-defined/><C:prop-filter name="UID"/></C:comp-filter></C:comp-filter></C:filter>`,
+		`<C:filter><C:comp-filter name="VCALENDAR"><C:comp-filter name="VEVENT"><C:text-match>foo</C:text-match></C:comp-filter></C:comp-filter></C:filter>`,
+		`<C:filter><C:comp-filter name="VCALENDAR"><C:comp-filter name="VEVENT"><C:time-range/></C:comp-filter></C:comp-filter></C:filter>`,
+		`<C:filter><C:comp-filter name="VCALENDAR"><C:comp-filter name="VEVENT"><C:time-range start="20160914T000000"/></C:comp-filter></C:comp-filter></C:filter>`,
+		`<C:filter><C:comp-filter name="VCALENDAR"><C:comp-filter name="VEVENT"><C:time-range start="20160915T000000Z" end="20160914T000000Z"/></C:comp-filter></C:comp-filter></C:filter>`,
+		`<C:filter><C:comp-filter name="VCALENDAR"><C:comp-filter name="VEVENT"><C:prop-filter name="DTSTART"><C:time-range start="20160914T000000Z"/><C:text-match>foo</C:text-match></C:prop-filter></C:comp-filter></C:comp-filter></C:filter>`,
+		`<C:filter><C:comp-filter name="VCALENDAR"><C:comp-filter name="VEVENT"><C:prop-filter name="UID"><C:text-match match-type="like">foo</C:text-match></C:prop-filter></C:comp-filter></C:comp-filter></C:filter>`,
+		`<C:filter><C:comp-filter name="VCALENDAR"><C:comp-filter name="VEVENT"><C:prop-filter name="UID"><C:param-filter name="X"><C:time-range start="20160914T000000Z"/></C:param-filter></C:prop-filter></C:comp-filter></C:comp-filter></C:filter>`,
+	}
+
+	for _, invalidFilter := range invalidFilters {
+		_, err := ParseCalendarQueryFilter(query(invalidFilter))
+		if perr, ok := err.(*errs.PreconditionError); !ok || perr.Condition != ixml.VALID_FILTER_TG {
+			t.Error("Expected the valid-filter precondition | Got:", err, "| Filter:", invalidFilter)
+		}
+	}
+
+	_, err = ParseCalendarQueryFilter(query(`<C:filter><C:comp-filter name="VCALENDAR"><C:comp-filter name="VEVENT"><C:prop-filter name="UID"><C:text-match collation="i;foo">1</C:text-match></C:prop-filter></C:comp-filter></C:comp-filter></C:filter>`))
+	if perr, ok := err.(*errs.PreconditionError); !ok || perr.Condition != ixml.SUPPORTED_COLLATION_TG {
+		t.Error("Expected the supported-collation precondition | Got:", err)
+	}
+}
+
 func TestMatch1(t *testing.T) {
 	filterXML := `
   <filter>
@@ -139,6 +195,14 @@ func TestMatch6(t *testing.T) {
 	res.addRecurrence("20160913T000000Z", "20160915T000000Z")
 	// recurrence is in the interval - match!
 	assertFilterMatch(filterXML, res, t)
+
+	// with the resource data, the recurrences with short periods are expanded up to the interval
+	secondly := func(rrule string) Resource {
+		return NewResource("/foo/event.ics", FakeResourceAdapter{contentData: "BEGIN:VCALENDAR\nBEGIN:VEVENT\nUID:1\n" +
+			"DTSTART:20160910T100000Z\nRRULE:" + rrule + "\nEND:VEVENT\nEND:VCALENDAR"})
+	}
+	assertResourceMatch(filterXML, secondly("FREQ=SECONDLY"), true, t)
+	assertResourceMatch(filterXML, secondly("FREQ=SECONDLY;UNTIL=20160913T000000Z"), false, t)
 }
 
 func TestMatch7(t *testing.T) {
@@ -339,6 +403,254 @@ func TestMatch14(t *testing.T) {
 	assertFilterMatch(filterXML, res, t)
 }
 
+func TestMatch15(t *testing.T) {
+	// time ranges on DATE-TIME properties
+	filterXML := `
+  <filter>
+   <comp-filter name="VCALENDAR">
+     <comp-filter name="VTODO">
+       <prop-filter name="COMPLETED">
+         <time-range start="20160914T000000Z" end="20160915T000000Z"/>
+       </prop-filter>
+     </comp-filter>
+   </comp-filter>
+  </filter>`
+
+	res := FakeResource{}
+	// the resource does not have the property - doesnt match!
+	assertFilterDoesNotMatch(filterXML, res, t)
+	// the property is out of the interval - doesnt match!
+	res.addProperty("VCALENDAR:VTODO:COMPLETED", "20160915T000000Z")
+	assertFilterDoesNotMatch(filterXML, res, t)
+	// the property is in the interval - match!
+	res.addProperty("VCALENDAR:VTODO:COMPLETED", "20160914T120000Z")
+	assertFilterMatch(filterXML, res, t)
+
+	// with the resource data, the time zone of the property is taken into account
+	completed := func(value string) Resource {
+		return NewResource("/foo/todo.ics", FakeResourceAdapter{contentData: "BEGIN:VCALENDAR\nBEGIN:VTODO\nUID:1\n" + value + "\nEND:VTODO\nEND:VCALENDAR"})
+	}
+	assertResourceMatch(filterXML, completed("COMPLETED;TZID=Asia/Tokyo:20160915T080000"), true, t)
+	assertResourceMatch(filterXML, completed("COMPLETED;TZID=Asia/Tokyo:20160915T090000"), false, t)
+}
+
+func TestMatch16(t *testing.T) {
+	// time ranges on the alarms, across the recurrences of the events
+	filterXML := `
+  <filter>
+   <comp-filter name="VCALENDAR">
+     <comp-filter name="VEVENT">
+       <comp-filter name="VALARM">
+         <time-range start="20160920T000000Z" end="20160921T000000Z"/>
+       </comp-filter>
+     </comp-filter>
+   </comp-filter>
+  </filter>`
+
+	event := func(props, alarm string) Resource {
+		return NewResource("/foo/event.ics", FakeResourceAdapter{contentData: "BEGIN:VCALENDAR\nBEGIN:VEVENT\nUID:1\n" + props +
+			"\nBEGIN:VALARM\nACTION:DISPLAY\n" + alarm + "\nEND:VALARM\nEND:VEVENT\nEND:VCALENDAR"})
+	}
+
+	// the event is before the range, but its alarm is not
+	assertResourceMatch(filterXML, event("DTSTART:20160921T000000Z", "TRIGGER:-PT15M"), true, t)
+	assertResourceMatch(filterXML, event("DTSTART:20160921T010000Z", "TRIGGER:-PT15M"), false, t)
+	// the alarm related to the end of the event
+	assertResourceMatch(filterXML, event("DTSTART:20160919T220000Z\nDURATION:PT2H", "TRIGGER;RELATED=END:PT30M"), true, t)
+	// absolute triggers and repetitions
+	assertResourceMatch(filterXML, event("DTSTART:20160925T100000Z", "TRIGGER;VALUE=DATE-TIME:20160920T100000Z"), true, t)
+	assertResourceMatch(filterXML, event("DTSTART:20160919T100000Z", "TRIGGER:PT0M\nREPEAT:2\nDURATION:PT8H"), true, t)
+	assertResourceMatch(filterXML, event("DTSTART:20160919T100000Z", "TRIGGER:PT0M\nREPEAT:1\nDURATION:PT8H"), false, t)
+	// the alarm of the 5th instance of a weekly event, which started in August
+	assertResourceMatch(filterXML, event("DTSTART:20160824T090000Z\nRRULE:FREQ=WEEKLY", "TRIGGER:-P1D"), true, t)
+	assertResourceMatch(filterXML, event("DTSTART:20160824T090000Z\nRRULE:FREQ=WEEKLY;COUNT=4", "TRIGGER:-P1D"), false, t)
+	// the events in the range do not match when their alarms are not
+	assertResourceMatch(filterXML, event("DTSTART:20160920T100000Z", "TRIGGER:P1D"), false, t)
+
+	// the alarms of the overridden instances are checked, even when the other instances have none
+	for _, master := range []string{"BEGIN:VEVENT\nUID:1\nDTSTART:20160824T090000Z\nRRULE:FREQ=WEEKLY\nEND:VEVENT",
+		"BEGIN:VEVENT\nUID:1\nDTSTART:20160824T090000Z\nRRULE:FREQ=WEEKLY\nBEGIN:VALARM\nACTION:DISPLAY\nTRIGGER:PT1H\nEND:VALARM\nEND:VEVENT"} {
+		override := "BEGIN:VEVENT\nUID:1\nRECURRENCE-ID:20160928T090000Z\nDTSTART:20160928T090000Z\nBEGIN:VALARM\nACTION:DISPLAY\nTRIGGER:-P8D\nEND:VALARM\nEND:VEVENT"
+		for _, comps := range []string{master + "\n" + override, override + "\n" + master} {
+			res := NewResource("/foo/event.ics", FakeResourceAdapter{contentData: "BEGIN:VCALENDAR\n" + comps + "\nEND:VCALENDAR"})
+			assertResourceMatch(filterXML, res, true, t)
+		}
+	}
+}
+
+func TestMatch17(t *testing.T) {
+	// collations and match types of the text-match filters
+	filterXML := func(textMatch string) string {
+		return `
+  <filter>
+   <comp-filter name="VCALENDAR">
+     <comp-filter name="VEVENT">
+       <prop-filter name="SUMMARY">` + textMatch + `</prop-filter>
+     </comp-filter>
+   </comp-filter>
+  </filter>`
+	}
+
+	res := FakeResource{}
+	res.addProperty("VCALENDAR:VEVENT:SUMMARY", "Réunion d'Équipe")
+
+	// i;ascii-casemap is the default: only the ASCII letters are case insensitive
+	assertFilterMatch(filterXML(`<text-match>RéUNION</text-match>`), res, t)
+	assertFilterDoesNotMatch(filterXML(`<text-match>RÉUNION</text-match>`), res, t)
+	// i;octet is case sensitive
+	assertFilterMatch(filterXML(`<text-match collation="i;octet">Réunion</text-match>`), res, t)
+	assertFilterDoesNotMatch(filterXML(`<text-match collation="i;octet">RÉUNION</text-match>`), res, t)
+	// i;unicode-casemap is case insensitive for all the letters, and the accents are decomposed
+	assertFilterMatch(filterXML(`<text-match collation="i;unicode-casemap">d'équipe</text-match>`), res, t)
+	assertFilterMatch(filterXML(`<text-match collation="i;unicode-casemap">RE`+"\u0301"+`UNION</text-match>`), res, t)
+	assertFilterDoesNotMatch(filterXML(`<text-match collation="i;unicode-casemap">reunion</text-match>`), res, t)
+	// and not only the Latin ones, the compatibility characters being decomposed too
+	greek := FakeResource{}
+	greek.addProperty("VCALENDAR:VEVENT:SUMMARY", "Ἀθῆναι ﬁesta")
+	assertFilterMatch(filterXML(`<text-match collation="i;unicode-casemap">ἈΘΗ͂ΝΑΙ FIESTA</text-match>`), greek, t)
+	// unknown collations never match
+	assertFilterDoesNotMatch(filterXML(`<text-match collation="i;foo">Réunion</text-match>`), res, t)
+
+	// the match types
+	assertFilterMatch(filterXML(`<text-match match-type="equals">réunion D'Équipe</text-match>`), res, t)
+	assertFilterDoesNotMatch(filterXML(`<text-match match-type="equals">Réunion</text-match>`), res, t)
+	assertFilterMatch(filterXML(`<text-match match-type="starts-with">Réunion</text-match>`), res, t)
+	assertFilterDoesNotMatch(filterXML(`<text-match match-type="starts-with">Équipe</text-match>`), res, t)
+	assertFilterMatch(filterXML(`<text-match match-type="ends-with">Équipe</text-match>`), res, t)
+	assertFilterDoesNotMatch(filterXML(`<text-match match-type="ends-with">Réunion</text-match>`), res, t)
+	assertFilterMatch(filterXML(`<text-match match-type="ends-with" negate-condition="yes">Réunion</text-match>`), res, t)
+}
+
+func TestMatch18(t *testing.T) {
+	// the repeated and multi-valued properties, in all the components of the resource
+	filterXML := func(propFilter string) string {
+		return `
+  <filter>
+   <comp-filter name="VCALENDAR">
+     <comp-filter name="VEVENT">` + propFilter + `</comp-filter>
+   </comp-filter>
+  </filter>`
+	}
+
+	res := NewResource("/foo/event.ics", FakeResourceAdapter{contentData: `
+  BEGIN:VCALENDAR
+  BEGIN:VEVENT
+  UID:1
+  DTSTART:20160914T100000Z
+  RRULE:FREQ=DAILY
+  ATTENDEE;PARTSTAT=ACCEPTED:mailto:john@example.com
+  ATTENDEE;PARTSTAT=DECLINED:mailto:jane@example.com
+  ATTENDEE:mailto:bob@example.com
+  CATEGORIES:WORK,MEETING
+  CATEGORIES:TEAM
+  END:VEVENT
+  BEGIN:VEVENT
+  UID:1
+  RECURRENCE-ID:20160915T100000Z
+  DTSTART:20160915T120000Z
+  SUMMARY:Moved
+  ATTENDEE;PARTSTAT=TENTATIVE:mailto:alice@example.com
+  END:VEVENT
+  END:VCALENDAR
+  `})
+
+	// any of the attendees, in any of the components
+	assertResourceMatch(filterXML(`<prop-filter name="ATTENDEE"><text-match>jane</text-match></prop-filter>`), res, true, t)
+	assertResourceMatch(filterXML(`<prop-filter name="ATTENDEE"><text-match>alice</text-match></prop-filter>`), res, true, t)
+	assertResourceMatch(filterXML(`<prop-filter name="ATTENDEE"><text-match>carol</text-match></prop-filter>`), res, false, t)
+	assertResourceMatch(filterXML(`<prop-filter name="SUMMARY"><text-match>Moved</text-match></prop-filter>`), res, true, t)
+
+	// the text-match and the param-filter are checked on the same attendee
+	assertResourceMatch(filterXML(`<prop-filter name="ATTENDEE"><text-match>jane</text-match>
+	  <param-filter name="PARTSTAT"><text-match>DECLINED</text-match></param-filter></prop-filter>`), res, true, t)
+	assertResourceMatch(filterXML(`<prop-filter name="ATTENDEE"><text-match>jane</text-match>
+	  <param-filter name="PARTSTAT"><text-match>ACCEPTED</text-match></param-filter></prop-filter>`), res, false, t)
+	assertResourceMatch(filterXML(`<prop-filter name="ATTENDEE"><param-filter name="PARTSTAT"><is-not-defined/></param-filter></prop-filter>`), res, true, t)
+	assertResourceMatch(filterXML(`<prop-filter name="ATTENDEE"><param-filter name="PARTSTAT"><text-match>TENTATIVE</text-match></param-filter></prop-filter>`), res, true, t)
+
+	// each of the categories
+	assertResourceMatch(filterXML(`<prop-filter name="CATEGORIES"><text-match match-type="equals">meeting</text-match></prop-filter>`), res, true, t)
+	assertResourceMatch(filterXML(`<prop-filter name="CATEGORIES"><text-match match-type="equals">team</text-match></prop-filter>`), res, true, t)
+	assertResourceMatch(filterXML(`<prop-filter name="CATEGORIES"><text-match match-type="equals">WORK,MEETING</text-match></prop-filter>`), res, false, t)
+	// the negated conditions match when none of the values of a property contain the text
+	res = NewResource("/foo/event.ics", FakeResourceAdapter{contentData: "BEGIN:VCALENDAR\nBEGIN:VEVENT\nUID:1\nCATEGORIES:WORK,MEETING\nEND:VEVENT\nEND:VCALENDAR"})
+	assertResourceMatch(filterXML(`<prop-filter name="CATEGORIES"><text-match negate-condition="yes">MEETING</text-match></prop-filter>`), res, false, t)
+	assertResourceMatch(filterXML(`<prop-filter name="CATEGORIES"><text-match negate-condition="yes">HOME</text-match></prop-filter>`), res, true, t)
+}
+
+func TestMatchMultiValuedResource(t *testing.T) {
+	filterXML := `
+  <filter>
+   <comp-filter name="VCALENDAR">
+     <comp-filter name="VEVENT">
+       <prop-filter name="ATTENDEE">
+         <text-match>jane</text-match>
+         <param-filter name="PARTSTAT"><text-match>DECLINED</text-match></param-filter>
+       </prop-filter>
+     </comp-filter>
+   </comp-filter>
+  </filter>`
+
+	// the resources without iCalendar data check the filters with their lookups of all the occurrences
+	res := &multiValuedFakeResource{
+		values: map[string][]string{
+			"VCALENDAR:VEVENT:ATTENDEE":          {"mailto:john@example.com", "mailto:jane@example.com"},
+			"VCALENDAR:VEVENT:ATTENDEE:PARTSTAT": {"ACCEPTED", "DECLINED"},
+		},
+	}
+	res.addProperty("VCALENDAR:VEVENT:ATTENDEE", "mailto:john@example.com")
+	res.addPropertyParam("VCALENDAR:VEVENT:ATTENDEE:PARTSTAT", "ACCEPTED")
+
+	filter, _ := ParseResourceFilters(filterXML)
+	if !filter.Match(res) {
+		t.Error("Filter should have been matched")
+	}
+	if filter.Match(&res.FakeResource) {
+		t.Error("Filter should not have been matched by the first occurrences only")
+	}
+}
+
+type multiValuedFakeResource struct {
+	FakeResource
+	values map[string][]string
+}
+
+func (r *multiValuedFakeResource) GetPropertyValues(propPath ...string) []string {
+	return r.values[r.getPropParamKey(propPath...)]
+}
+
+func (r *multiValuedFakeResource) GetPropertyParamValues(paramPath ...string) []string {
+	return r.values[r.getPropParamKey(paramPath...)]
+}
+
+func TestUnsupportedCollation(t *testing.T) {
+	filter, _ := ParseResourceFilters(`
+  <filter>
+   <comp-filter name="VCALENDAR">
+     <comp-filter name="VEVENT">
+       <prop-filter name="SUMMARY"><text-match collation="i;octet">Foo</text-match></prop-filter>
+       <prop-filter name="ATTENDEE">
+         <param-filter name="CN"><text-match collation="i;basic">Foo</text-match></param-filter>
+       </prop-filter>
+     </comp-filter>
+   </comp-filter>
+  </filter>`)
+
+	collation, found := filter.UnsupportedCollation()
+	if !found || collation != "i;basic" {
+		t.Error("Expected the unsupported collation i;basic | Got:", collation, found)
+	}
+
+	filter, _ = ParseResourceFilters(`<filter><comp-filter name="VCALENDAR"/></filter>`)
+	if _, found := filter.UnsupportedCollation(); found {
+		t.Error("Expected no unsupported collation")
+	}
+
+	if _, found := new(ResourceFilter).UnsupportedCollation(); found {
+		t.Error("Expected no unsupported collation in an empty filter")
+	}
+}
+
 func TestGetTimeRangeFilter(t *testing.T) {
 	// First testing when the filters contain a time-range filter
 	filterXML := `
@@ -422,6 +734,14 @@ func assertFilterMatch(filterXML string, res FakeResource, t *testing.T) {
 	}
 }
 
+func assertResourceMatch(filterXML string, res Resource, expected bool, t *testing.T) {
+	filter, err := ParseResourceFilters(filterXML)
+	panicerr(err)
+	if filter.Match(&res) != expected {
+		t.Error("Filter should have matched:", expected, "| Resource:", res.adapter.GetContent())
+	}
+}
+
 func assertFilterDoesNotMatch(filterXML string, res FakeResource, t *testing.T) {
 	filter, err := ParseResourceFilters(filterXML)
 	panicerr(err)
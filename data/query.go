@@ -0,0 +1,93 @@
+package data
+
+import (
+	"time"
+
+	"github.com/samedi/caldav-go/lib"
+)
+
+// The properties whose text-match filters are extracted into a `ResourceQuery`.
+var queryTextProperties = []string{"UID", "SUMMARY", "CATEGORIES"}
+
+// ResourceQuery holds the predicates of a filter that storages can answer with their indexes, to narrow down
+// the resources to check with the filter. Each predicate is a necessary condition for a resource to match the
+// filter, so the resources not fulfilling any of them can be left out. See `ResourceQuerier`.
+type ResourceQuery struct {
+	// Component is the name of the component queried in the calendar, e.g. VEVENT. Empty for any component.
+	Component string
+	// Start and End limit the time of the component, in UTC: at least one of its instances, including the
+	// recurrences, overlaps them. The zero times leave the range open on that side. The floating times of the
+	// resources are evaluated in the time zone of the filter, so an index in UTC must widen their span.
+	Start time.Time
+	End   time.Time
+	// TextMatches holds the text-match filters of the UID, SUMMARY and CATEGORIES properties of the component,
+	// keyed by property name. At least one of the values of the property matches each of them.
+	TextMatches map[string][]*TextMatch
+}
+
+// ResourceQuerier is the optional storage capability to find the resources with an index, e.g. the ones of a
+// database, instead of loading all of them. The resources found are still checked against the filter by
+// `FindResources`, so the storages can return more resources than the matching ones, but never less.
+type ResourceQuerier interface {
+	// QueryResources returns the children of the collection in `rpath` which may fulfill the query.
+	QueryResources(rpath string, query *ResourceQuery) ([]Resource, error)
+}
+
+// PlanQuery extracts the predicates of the filter that can be answered by an index. The predicates that
+// cannot be expressed in the query are left out: the query may match more resources than the filter.
+func PlanQuery(filters *ResourceFilter) *ResourceQuery {
+	query := &ResourceQuery{TextMatches: make(map[string][]*TextMatch)}
+
+	calendar := filters.Tree().CompFilter
+	if calendar == nil || calendar.IsNotDefined != nil {
+		return query
+	}
+
+	for _, comp := range calendar.CompFilters {
+		// the first defined component gives the predicates, as all of them have to match anyway
+		if comp.IsNotDefined != nil || comp.Name == lib.VTIMEZONE {
+			continue
+		}
+
+		query.Component = comp.Name
+		if comp.TimeRange != nil {
+			query.Start = comp.TimeRange.Start
+			query.End = comp.TimeRange.End
+		}
+
+		for _, prop := range comp.PropFilters {
+			if prop.TextMatch == nil || prop.TextMatch.NegateCondition || !containsString(queryTextProperties, prop.Name) {
+				continue
+			}
+			query.TextMatches[prop.Name] = append(query.TextMatches[prop.Name], prop.TextMatch)
+		}
+
+		break
+	}
+
+	return query
+}
+
+// FindResources returns the children of the collection in `rpath` matching the filters. When the storage
+// implements `ResourceQuerier`, the candidates are found with the query planned out of the filters and then
+// checked with `ResourceFilter.Match`. Otherwise, it is the same as `Storage.GetResourcesByFilters`.
+func FindResources(storage Storage, rpath string, filters *ResourceFilter) ([]Resource, error) {
+	querier, ok := storage.(ResourceQuerier)
+	if !ok {
+		return storage.GetResourcesByFilters(rpath, filters)
+	}
+
+	candidates, err := querier.QueryResources(rpath, PlanQuery(filters))
+	if err != nil {
+		return nil, err
+	}
+
+	result := []Resource{}
+	for i := range candidates {
+		if filters.Match(&candidates[i]) {
+			result = append(result, candidates[i])
+		}
+	}
+
+	return result, nil
+}
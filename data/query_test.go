@@ -0,0 +1,70 @@
+package data
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPlanQuery(t *testing.T) {
+	start := time.Date(2016, 9, 14, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2016, 9, 15, 0, 0, 0, 0, time.UTC)
+
+	filter := NewResourceFilter(NewFilter(Comp("VCALENDAR",
+		Comp("VTIMEZONE"),
+		Comp("VTODO", NotDefined()),
+		Comp("VEVENT",
+			Range(start, end),
+			Prop("UID", &TextMatch{Text: "123", MatchType: "equals"}),
+			Prop("SUMMARY", &TextMatch{Text: "party", NegateCondition: true}),
+			Prop("CATEGORIES", Text("work")),
+			Prop("LOCATION", Text("home")),
+		),
+	)))
+
+	query := PlanQuery(filter)
+	if query.Component != "VEVENT" || !query.Start.Equal(start) || !query.End.Equal(end) {
+		t.Error("Unexpected component and time range in the query:", query.Component, query.Start, query.End)
+	}
+
+	// the negated text matches and the other properties are left out
+	if len(query.TextMatches) != 2 || query.TextMatches["UID"][0].Text != "123" || query.TextMatches["CATEGORIES"][0].Text != "work" {
+		t.Errorf("Unexpected text matches in the query: %+v", query.TextMatches)
+	}
+
+	// nothing can be extracted from the empty filters
+	query = PlanQuery(new(ResourceFilter))
+	if query.Component != "" || !query.Start.IsZero() || len(query.TextMatches) != 0 {
+		t.Errorf("Expected an empty query | Got: %+v", query)
+	}
+}
+
+// Storage that answers the queries with a fixed set of candidates.
+type querierStorage struct {
+	Storage
+	candidates []Resource
+	query      *ResourceQuery
+}
+
+func (s *querierStorage) QueryResources(rpath string, query *ResourceQuery) ([]Resource, error) {
+	s.query = query
+	return s.candidates, nil
+}
+
+func TestFindResources(t *testing.T) {
+	event := func(name, summary string) Resource {
+		return NewResource("/foo/"+name, FakeResourceAdapter{contentData: "BEGIN:VCALENDAR\nBEGIN:VEVENT\nSUMMARY:" + summary + "\nEND:VEVENT\nEND:VCALENDAR"})
+	}
+
+	storage := &querierStorage{candidates: []Resource{event("1.ics", "Party"), event("2.ics", "Meeting"), event("3.ics", "Garden party")}}
+	filter := NewResourceFilter(NewFilter(Comp("VCALENDAR", Comp("VEVENT", Prop("SUMMARY", Text("party"))))))
+
+	// the candidates of the storage are checked with the filter
+	resources, err := FindResources(storage, "/foo", filter)
+	if err != nil || len(resources) != 2 || resources[0].Name != "1.ics" || resources[1].Name != "3.ics" {
+		t.Error("Unexpected resources found:", resources, err)
+	}
+
+	if storage.query == nil || storage.query.TextMatches["SUMMARY"][0].Text != "party" {
+		t.Error("The storage should have been queried with the SUMMARY text match")
+	}
+}
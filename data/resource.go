@@ -2,6 +2,7 @@ package data
 
 import (
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"os"
@@ -12,6 +13,7 @@ import (
 	"github.com/laurent22/ical-go"
 
 	"github.com/samedi/caldav-go/files"
+	"github.com/samedi/caldav-go/ics"
 	"github.com/samedi/caldav-go/lib"
 )
 
@@ -43,6 +45,12 @@ type ResourceAdapter interface {
 	GetModTime() time.Time
 }
 
+// ResourceContentReader is an optional interface a `ResourceAdapter` can implement when it is able to provide
+// the resource content as a stream. Big contents can then be sent to the client without loading them fully in memory.
+type ResourceContentReader interface {
+	GetContentReader() (io.ReadCloser, error)
+}
+
 // ResourceRecurrence represents a recurrence for a resource.
 // NOTE: recurrences are not supported yet.
 type ResourceRecurrence struct {
@@ -61,6 +69,7 @@ type Resource struct {
 
 	pathSplit []string
 	adapter   ResourceAdapter
+	memo      *calendarMemo
 
 	emptyTime time.Time
 }
@@ -75,6 +84,7 @@ func NewResource(rawPath string, adp ResourceAdapter) Resource {
 		Path:      pClean,
 		pathSplit: pSplit,
 		adapter:   adp,
+		memo:      new(calendarMemo),
 	}
 }
 
@@ -98,31 +108,51 @@ func (r *Resource) ComponentName() string {
 	return lib.VEVENT
 }
 
-// StartTimeUTC returns the start time in UTC of a VEVENT resource.
+// StartTimeUTC returns the start time in UTC of a VEVENT resource. The floating times are taken as UTC, see `StartTime`.
 func (r *Resource) StartTimeUTC() time.Time {
-	vevent := r.icalVEVENT()
-	dtstart := vevent.PropDate(ical.DTSTART, r.emptyTime)
+	return r.StartTime(nil)
+}
 
-	if dtstart == r.emptyTime {
-		log.Printf("WARNING: The property DTSTART was not found in the resource's ical data.\nResource path: %s", r.Path)
-		return r.emptyTime
-	}
+// EndTimeUTC returns the end time in UTC of a VEVENT resource. The floating times are taken as UTC, see `EndTime`.
+func (r *Resource) EndTimeUTC() time.Time {
+	return r.EndTime(nil)
+}
 
-	return dtstart.UTC()
+// StartTime returns the start time in UTC of a VEVENT resource. The times with a TZID are resolved with the IANA
+// time zones or the VTIMEZONEs of the resource, and the floating times and dates in the `floating` time zone
+// (e.g. the calendar-timezone of the collection). A nil `floating` time zone means UTC.
+func (r *Resource) StartTime(floating *ics.Timezone) time.Time {
+	start, _ := r.period(floating)
+	return start
 }
 
-// EndTimeUTC returns the end time in UTC of a VEVENT resource.
-func (r *Resource) EndTimeUTC() time.Time {
-	vevent := r.icalVEVENT()
-	dtend := vevent.PropDate(ical.DTEND, r.emptyTime)
+// EndTime returns the end time in UTC of a VEVENT resource. When the DTEND property is not present, it is
+// the start plus the DURATION, or the next day for all-day events. See `StartTime` about the time zones.
+func (r *Resource) EndTime(floating *ics.Timezone) time.Time {
+	_, end := r.period(floating)
+	return end
+}
+
+func (r *Resource) period(floating *ics.Timezone) (time.Time, time.Time) {
+	cal, err := r.calendar()
+	if err != nil {
+		log.Printf("WARNING: The resource's ical data could not be parsed.\nError: %s.\nResource path: %s", err, r.Path)
+		return r.emptyTime, r.emptyTime
+	}
 
-	// when the DTEND property is not present, we just add the DURATION (if any) to the DTSTART
-	if dtend == r.emptyTime {
-		duration := vevent.PropDuration(ical.DURATION)
-		dtend = r.StartTimeUTC().Add(duration)
+	vevents := ics.Components(cal, ical.VEVENT)
+	if len(vevents) == 0 {
+		log.Printf("WARNING: The resource's ical data is missing the VEVENT property.\nResource path: %s", r.Path)
+		return r.emptyTime, r.emptyTime
+	}
+
+	start, end, ok := ics.NewTimeContext(cal, floating).Period(vevents[0])
+	if !ok {
+		log.Printf("WARNING: The property DTSTART was not found in the resource's ical data.\nResource path: %s", r.Path)
+		return r.emptyTime, r.emptyTime
 	}
 
-	return dtend.UTC()
+	return start, end
 }
 
 // Recurrences returns an array of resource recurrences.
@@ -148,6 +178,17 @@ func (r *Resource) HasProperty(propPath ...string) bool {
 	return r.GetPropertyValue(propPath...) != ""
 }
 
+// CalendarObject returns the typed model of the resource's iCal content, with its events, to-dos and journals.
+// The object is a copy of the content, which can be changed and encoded back with `ics.Object.String`.
+func (r *Resource) CalendarObject() (*ics.Object, error) {
+	cal, err := r.calendar()
+	if err != nil {
+		return nil, err
+	}
+
+	return ics.DecodeObject(cal)
+}
+
 // GetPropertyValue gets a property value from the resource's iCal content.
 // The path to the property should be provided in case of nested properties.
 // Example, suppose the resource has this content:
@@ -161,12 +202,12 @@ func (r *Resource) HasProperty(propPath ...string) bool {
 // GetPropertyValue("VEVENT", "DTSTART") => returns "20160914T170000"
 // GetPropertyValue("VEVENT", "DTEND") => returns ""
 func (r *Resource) GetPropertyValue(propPath ...string) string {
-	if propPath[0] == ical.VCALENDAR {
-		propPath = propPath[1:]
+	prop := r.firstNodeAt(propPath)
+	if prop == nil {
+		return ""
 	}
 
-	prop, _ := r.icalendar().DigProperty(propPath...)
-	return prop
+	return ics.UnescapeText(prop.Value)
 }
 
 // HasPropertyParam tells whether the resource has the provided property param in its iCal content.
@@ -198,12 +239,94 @@ func (r *Resource) HasPropertyParam(paramPath ...string) bool {
 // GetPropertyParamValue("VEVENT", "ATTENDEE", "PARTSTAT") => returns "NEEDS-ACTION"
 // GetPropertyParamValue("VEVENT", "ATTENDEE", "OTHER") => returns ""
 func (r *Resource) GetPropertyParamValue(paramPath ...string) string {
-	if paramPath[0] == ical.VCALENDAR {
-		paramPath = paramPath[1:]
+	prop := r.firstNodeAt(paramPath[:len(paramPath)-1])
+	if prop == nil {
+		return ""
 	}
 
-	param, _ := r.icalendar().DigParameter(paramPath...)
-	return param
+	return prop.Parameters[paramPath[len(paramPath)-1]]
+}
+
+// Returns the first node found at the given path of names in the resource's iCal content, following the first
+// component with each name, e.g. the first ATTENDEE of the first VEVENT. It returns nil when there is no such
+// node or the content cannot be parsed.
+func (r *Resource) firstNodeAt(path []string) *ical.Node {
+	cal, err := r.calendar()
+	if err != nil {
+		return nil
+	}
+
+	if len(path) > 0 && path[0] == ical.VCALENDAR {
+		path = path[1:]
+	}
+
+	node := cal
+	for _, name := range path {
+		if node = node.ChildByName(name); node == nil {
+			return nil
+		}
+	}
+
+	return node
+}
+
+// GetPropertyValues gets the values of all the occurrences of a property in the resource's iCal content,
+// in all the components with the given path, e.g. in all the VEVENTs of a recurring event with overridden instances.
+// Example, suppose the resource has this content:
+//
+// 	BEGIN:VCALENDAR
+// 	BEGIN:VEVENT
+// 	ATTENDEE:mailto:john@example.com
+// 	ATTENDEE:mailto:jane@example.com
+// 	END:VEVENT
+// 	END:VCALENDAR
+//
+// GetPropertyValues("VEVENT", "ATTENDEE") => returns ["mailto:john@example.com", "mailto:jane@example.com"]
+// GetPropertyValues("VEVENT", "DTEND") => returns []
+func (r *Resource) GetPropertyValues(propPath ...string) []string {
+	values := []string{}
+
+	cal, err := r.calendar()
+	if err != nil {
+		return values
+	}
+
+	for _, prop := range propertiesAt(cal, propPath) {
+		values = append(values, ics.UnescapeText(prop.Value))
+	}
+
+	return values
+}
+
+// GetPropertyParamValues gets the values of a param in all the occurrences of a property in the resource's
+// iCal content, as `GetPropertyValues`. The occurrences without the param are left out.
+// Example, suppose the resource has this content:
+//
+// 	BEGIN:VCALENDAR
+// 	BEGIN:VEVENT
+// 	ATTENDEE;PARTSTAT=ACCEPTED:mailto:john@example.com
+// 	ATTENDEE:mailto:bob@example.com
+// 	ATTENDEE;PARTSTAT=DECLINED:mailto:jane@example.com
+// 	END:VEVENT
+// 	END:VCALENDAR
+//
+// GetPropertyParamValues("VEVENT", "ATTENDEE", "PARTSTAT") => returns ["ACCEPTED", "DECLINED"]
+func (r *Resource) GetPropertyParamValues(paramPath ...string) []string {
+	values := []string{}
+
+	cal, err := r.calendar()
+	if err != nil {
+		return values
+	}
+
+	paramName := paramPath[len(paramPath)-1]
+	for _, prop := range propertiesAt(cal, paramPath[:len(paramPath)-1]) {
+		if value, found := prop.Parameters[paramName]; found {
+			values = append(values, value)
+		}
+	}
+
+	return values
 }
 
 // GetEtag returns the ETag of the resource and a flag saying if the ETag is present.
@@ -240,6 +363,16 @@ func (r *Resource) GetContentData() (string, bool) {
 	return data, found
 }
 
+// GetContentReader returns a reader for the raw content of the resource. The caller must close it after reading.
+// If the resource adapter does not implement `ResourceContentReader`, the content is read as a whole and wrapped in a reader.
+func (r *Resource) GetContentReader() (io.ReadCloser, error) {
+	if reader, ok := r.adapter.(ResourceContentReader); ok {
+		return reader.GetContentReader()
+	}
+
+	return ioutil.NopCloser(strings.NewReader(r.adapter.GetContent())), nil
+}
+
 // GetContentLength returns the length of the resource's content and flag saying if the length is present.
 // If the resource does not have content (like collection resource), it returns an empty string and false.
 func (r *Resource) GetContentLength() (string, bool) {
@@ -258,6 +391,12 @@ func (r *Resource) GetLastModified(format string) (string, bool) {
 	return r.adapter.GetModTime().Format(format), true
 }
 
+// GetLastModifiedTime returns the last time the resource was modified and a flag saying if it is known.
+func (r *Resource) GetLastModifiedTime() (time.Time, bool) {
+	modTime := r.adapter.GetModTime()
+	return modTime, !modTime.IsZero()
+}
+
 // GetOwner returns the owner of the resource. This is usually the principal resource associated (the root resource).
 // If the resource does not have a owner (for example it's a principal resource alread), it returns an empty string.
 func (r *Resource) GetOwner() (string, bool) {
@@ -282,44 +421,6 @@ func (r *Resource) GetOwnerPath() (string, bool) {
 	return "", false
 }
 
-// TODO: memoize
-func (r *Resource) icalVEVENT() *ical.Node {
-	vevent := r.icalendar().ChildByName(ical.VEVENT)
-
-	// if nil, log it and return an empty vevent
-	if vevent == nil {
-		log.Printf("WARNING: The resource's ical data is missing the VEVENT property.\nResource path: %s", r.Path)
-
-		return &ical.Node{
-			Name: ical.VEVENT,
-		}
-	}
-
-	return vevent
-}
-
-// TODO: memoize
-func (r *Resource) icalendar() *ical.Node {
-	data, found := r.GetContentData()
-
-	if !found {
-		log.Printf("WARNING: The resource's ical data does not have any data.\nResource path: %s", r.Path)
-		return &ical.Node{
-			Name: ical.VCALENDAR,
-		}
-	}
-
-	icalNode, err := ical.ParseCalendar(data)
-	if err != nil {
-		log.Printf("ERROR: Could not parse the resource's ical data.\nError: %s.\nResource path: %s", err, r.Path)
-		return &ical.Node{
-			Name: ical.VCALENDAR,
-		}
-	}
-
-	return icalNode
-}
-
 // FileResourceAdapter implements the `ResourceAdapter` for resources stored as files in the file system.
 type FileResourceAdapter struct {
 	finfo        os.FileInfo
@@ -347,6 +448,15 @@ func (adp *FileResourceAdapter) GetContent() string {
 	return string(data)
 }
 
+// GetContentReader opens the file for reading. For collection resources (directories), it returns an empty reader.
+func (adp *FileResourceAdapter) GetContentReader() (io.ReadCloser, error) {
+	if adp.IsCollection() {
+		return ioutil.NopCloser(strings.NewReader("")), nil
+	}
+
+	return os.Open(files.AbsPath(adp.resourcePath))
+}
+
 // GetContentSize returns the content length.
 func (adp *FileResourceAdapter) GetContentSize() int64 {
 	return adp.finfo.Size()
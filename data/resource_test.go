@@ -2,8 +2,11 @@ package data
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/samedi/caldav-go/ics"
 )
 
 func TestNewResource(t *testing.T) {
@@ -250,6 +253,35 @@ func TestStartEndTimesUTC(t *testing.T) {
   `)
 
 	assertTime(res.EndTimeUTC(), time.Date(2016, 9, 14, 15, 0, 0, 0, time.UTC))
+
+	// test a time zone known only by its VTIMEZONE definition
+	res = newResource(`
+    DTSTART;TZID=Europe/Berlin:20160914T170000
+  `)
+	adp := new(FakeResourceAdapter)
+	adp.contentData = strings.Replace(res.adapter.GetContent(), "Europe/Berlin", "Custom Berlin", -1)
+	res = NewResource("/foo", adp)
+
+	assertTime(res.StartTimeUTC(), time.Date(2016, 9, 14, 15, 0, 0, 0, time.UTC))
+
+	// test floating times, which are UTC unless a floating time zone is given
+	res = newResource(`
+    DTSTART:20160914T170000
+    DTEND:20160914T180000
+  `)
+
+	newYork, _ := ics.LoadTimezone("America/New_York")
+	assertTime(res.StartTimeUTC(), time.Date(2016, 9, 14, 17, 0, 0, 0, time.UTC))
+	assertTime(res.StartTime(newYork), time.Date(2016, 9, 14, 21, 0, 0, 0, time.UTC))
+	assertTime(res.EndTime(newYork), time.Date(2016, 9, 14, 22, 0, 0, 0, time.UTC))
+
+	// test all-day events, which last the whole day when there is no DTEND
+	res = newResource(`
+    DTSTART;VALUE=DATE:20160914
+  `)
+
+	assertTime(res.StartTime(newYork), time.Date(2016, 9, 14, 4, 0, 0, 0, time.UTC))
+	assertTime(res.EndTime(newYork), time.Date(2016, 9, 15, 4, 0, 0, 0, time.UTC))
 }
 
 func TestProperties(t *testing.T) {
@@ -327,6 +359,69 @@ func TestPropertyParams(t *testing.T) {
 	}
 }
 
+func TestPropertyValues(t *testing.T) {
+	res := NewResource("/foo", FakeResourceAdapter{etag: "1", contentData: `
+  BEGIN:VCALENDAR
+  BEGIN:VEVENT
+  SUMMARY:Party\, again
+  ATTENDEE;PARTSTAT=ACCEPTED:mailto:john@example.com
+  ATTENDEE:mailto:bob@example.com
+  END:VEVENT
+  BEGIN:VEVENT
+  ATTENDEE;PARTSTAT=DECLINED:mailto:jane@example.com
+  END:VEVENT
+  END:VCALENDAR
+  `})
+
+	assertValues := func(values []string, expected ...string) {
+		if strings.Join(values, "|") != strings.Join(expected, "|") {
+			t.Error("Expected:", expected, "| Got:", values)
+		}
+	}
+
+	assertValues(res.GetPropertyValues("VCALENDAR", "VEVENT", "ATTENDEE"), "mailto:john@example.com", "mailto:bob@example.com", "mailto:jane@example.com")
+	assertValues(res.GetPropertyValues("VEVENT", "SUMMARY"), "Party, again")
+	assertValues(res.GetPropertyValues("VEVENT", "DTEND"))
+	assertValues(res.GetPropertyParamValues("VEVENT", "ATTENDEE", "PARTSTAT"), "ACCEPTED", "DECLINED")
+	assertValues(res.GetPropertyParamValues("VEVENT", "ATTENDEE", "ROLE"))
+}
+
+func TestCalendarObject(t *testing.T) {
+	adp := &FakeResourceAdapter{etag: "1", contentData: `
+  BEGIN:VCALENDAR
+  BEGIN:VEVENT
+  UID:123
+  SUMMARY:Party
+  DTSTART:20160914T170000Z
+  ATTENDEE;PARTSTAT=ACCEPTED:mailto:jane@example.com
+  END:VEVENT
+  END:VCALENDAR
+  `}
+	res := NewResource("/foo/123.ics", adp)
+
+	obj, err := res.CalendarObject()
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if len(obj.Events) != 1 || obj.Events[0].Summary != "Party" || obj.Events[0].Attendees[0].PartStat != "ACCEPTED" {
+		t.Error("Wrong calendar object:", obj.String())
+	}
+
+	// the object is a copy of the content
+	obj.Events[0].Summary = "Meeting"
+	if summary := res.GetPropertyValue("VEVENT", "SUMMARY"); summary != "Party" {
+		t.Error("The content should not change | Got:", summary)
+	}
+	if again, _ := res.CalendarObject(); again.Events[0].Summary != "Party" {
+		t.Error("The content should not change | Got:", again.Events[0].Summary)
+	}
+
+	adp.etag, adp.contentData = "2", "BEGIN:VCALENDAR"
+	if _, err := res.CalendarObject(); err == nil {
+		t.Error("Expected an error for invalid data")
+	}
+}
+
 type FakeResourceAdapter struct {
 	collection  bool
 	etag        string
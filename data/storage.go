@@ -1,11 +1,16 @@
 package data
 
 import (
+	"encoding/json"
+	"fmt"
 	"github.com/samedi/caldav-go/errs"
 	"github.com/samedi/caldav-go/files"
 	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 )
 
 // Storage is the inteface responsible for the CRUD operations on the CalDAV resources. It represents
@@ -44,10 +49,21 @@ type Storage interface {
 	CreateResource(rpath, content string) (*Resource, error)
 	// UpdateResource udpates a resource on the `rpath` path with a given `content`.
 	UpdateResource(rpath, content string) (*Resource, error)
-	// DeleteResource deletes a resource on the `rpath` path.
+	// DeleteResource deletes a resource on the `rpath` path. When `rpath` points to a collection, the
+	// handlers only call it once all the collection's children were already deleted.
 	DeleteResource(rpath string) error
 }
 
+// CollectionDeleter is an optional interface a `Storage` can implement when it is able to delete a
+// collection resource together with all its children in one single atomic operation. When the storage
+// in use does not implement it, collections are deleted child by child through `Storage.DeleteResource`.
+type CollectionDeleter interface {
+	// DeleteCollection deletes the collection on the `rpath` path and all of its children. Either
+	// everything is deleted or nothing is. It returns `errs.ForbiddenError` or `errs.LockedError`
+	// when the collection (or any of its children) cannot be deleted due to permissions or locks.
+	DeleteCollection(rpath string) error
+}
+
 // FileStorage is the storage that deals with resources as files in the file system. So, a collection resource
 // is treated as a folder/directory and its children resources are the files it contains. Non-collection resources are just plain files.
 // Each file represents then a CalAV resource and the data expects to contain the iCal data to feed the calendar events.
@@ -73,6 +89,9 @@ func (fs *FileStorage) GetResources(rpath string, withChildren bool) ([]Resource
 	if withChildren && finfo.IsDir() {
 		dirFiles, _ := f.Readdir(0)
 		for _, finfo := range dirFiles {
+			if isHiddenFile(finfo.Name()) {
+				continue
+			}
 			childPath := files.JoinPaths(rpath, finfo.Name())
 			resource = NewResource(childPath, &FileResourceAdapter{finfo, childPath})
 			result = append(result, resource)
@@ -168,6 +187,7 @@ func (fs *FileStorage) CreateResource(rpath, content string) (*Resource, error)
 
 	finfo, _ := f.Stat()
 	res := NewResource(rpath, &FileResourceAdapter{finfo, rpath})
+	fs.updateFileIndex(rpath, &res)
 	return &res, nil
 }
 
@@ -184,16 +204,97 @@ func (fs *FileStorage) UpdateResource(rpath, content string) (*Resource, error)
 
 	finfo, _ := f.Stat()
 	res := NewResource(rpath, &FileResourceAdapter{finfo, rpath})
+	fs.updateFileIndex(rpath, &res)
 	return &res, nil
 }
 
-// DeleteResource deletes a file resource (and possibly all its children in case of a collection). See `Storage.DeleteResource` doc.
+// DeleteResource deletes a file resource (or an empty directory in case of a collection). See `Storage.DeleteResource` doc.
 func (fs *FileStorage) DeleteResource(rpath string) error {
 	err := os.Remove(files.AbsPath(rpath))
+	if os.IsNotExist(err) {
+		return errs.ResourceNotFoundError
+	} else if err == nil {
+		fs.updateFileIndex(rpath, nil)
+	}
 
 	return err
 }
 
+// DeleteCollection deletes a directory and all its content. See `CollectionDeleter.DeleteCollection` doc.
+// The directory is first renamed to a temporary hidden name, which is atomic in the file system, so that the
+// collection is gone right away for any other request even if removing its files afterwards takes a while.
+func (fs *FileStorage) DeleteCollection(rpath string) error {
+	absPath := files.AbsPath(rpath)
+
+	trashPath := files.JoinPaths(files.DirPath(absPath), fmt.Sprintf(".trash-%s-%d", filepath.Base(absPath), time.Now().UnixNano()))
+	if err := os.Rename(absPath, trashPath); err != nil {
+		if os.IsNotExist(err) {
+			return errs.ResourceNotFoundError
+		}
+		return err
+	}
+
+	if err := os.RemoveAll(trashPath); err != nil {
+		// the collection is already gone from its original path, so we just log the leftovers
+		log.Printf("WARNING: Could not remove all files of deleted collection.\nError: %s.\nResource path: %s.", err, rpath)
+	}
+
+	return nil
+}
+
+// CreateCollection creates an empty directory, and its parent directories if needed. See `CollectionCreator.CreateCollection` doc.
+func (fs *FileStorage) CreateCollection(rpath string) error {
+	if fs.isResourcePresent(rpath) {
+		return errs.ResourceAlreadyExistsError
+	}
+
+	return os.MkdirAll(files.AbsPath(rpath), os.ModePerm)
+}
+
+// The name of the hidden file, inside the directory of a collection, where its calendar properties are kept.
+const calendarMetadataFile = ".calendar.json"
+
+// GetCalendarMetadata reads the calendar properties of a directory. See `CalendarMetadataStorage.GetCalendarMetadata` doc.
+func (fs *FileStorage) GetCalendarMetadata(rpath string) (*CalendarMetadata, error) {
+	metadata := new(CalendarMetadata)
+
+	content, err := ioutil.ReadFile(files.JoinPaths(files.AbsPath(rpath), calendarMetadataFile))
+	if os.IsNotExist(err) {
+		if finfo, err := os.Stat(files.AbsPath(rpath)); err != nil || !finfo.IsDir() {
+			return nil, errs.ResourceNotFoundError
+		}
+		return metadata, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(content, metadata); err != nil {
+		return nil, err
+	}
+
+	return metadata, nil
+}
+
+// SetCalendarMetadata writes the calendar properties of a directory. See `CalendarMetadataStorage.SetCalendarMetadata` doc.
+func (fs *FileStorage) SetCalendarMetadata(rpath string, metadata *CalendarMetadata) error {
+	finfo, err := os.Stat(files.AbsPath(rpath))
+	if err != nil || !finfo.IsDir() {
+		return errs.ResourceNotFoundError
+	}
+
+	content, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(files.JoinPaths(files.AbsPath(rpath), calendarMetadataFile), content, 0666)
+}
+
+// Hidden files, like the calendar properties of the collections, are not resources.
+func isHiddenFile(name string) bool {
+	return strings.HasPrefix(name, ".")
+}
+
 func (fs *FileStorage) isResourcePresent(rpath string) bool {
 	_, found, _ := fs.GetShallowResource(rpath)
 
@@ -221,6 +322,9 @@ func (fs *FileStorage) getDirectoryChildPaths(dirpath string) []string {
 
 	result := []string{}
 	for _, file := range content {
+		if isHiddenFile(file.Name()) {
+			continue
+		}
 		fpath := files.JoinPaths(dirpath, file.Name())
 		result = append(result, fpath)
 	}
@@ -1,8 +1,101 @@
 package data
 
+import (
+	"strings"
+)
+
 // CalUser represents the calendar user. It is used, for example, to
 // keep track globally what is the current user interacting with the calendar.
 // This user data can be used in various places, including in some of the CALDAV responses.
 type CalUser struct {
 	Name string
+	// Addresses are the calendar user addresses of the user (e.g. "mailto:john@example.com"),
+	// which identify the user as organizer or attendee when scheduling.
+	Addresses []string
+}
+
+// HasAddress tells whether the given calendar user address belongs to the user. The "mailto:" addresses are case insensitive.
+func (u *CalUser) HasAddress(address string) bool {
+	for _, a := range u.Addresses {
+		if SameAddress(a, address) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// UserDirectory knows the local calendar users. It is used when scheduling to find out which
+// organizers and attendees are local users, whose calendars are handled by this server.
+type UserDirectory interface {
+	// GetUser returns the user with the given name and a flag saying if it was found.
+	GetUser(name string) (*CalUser, bool)
+	// GetUserByAddress returns the user owning the given calendar user address and a flag saying if it was found.
+	GetUserByAddress(address string) (*CalUser, bool)
+}
+
+// FreeBusyAuthorizer is an optional interface a `UserDirectory` can implement to restrict whose free-busy time
+// each user can look up, i.e. the CALDAV:read-free-busy privilege (RFC6638#6.1.1). When the directory does
+// not implement it, all the local users can look up the free-busy time of each other.
+type FreeBusyAuthorizer interface {
+	CanReadFreeBusy(requester, target *CalUser) bool
+}
+
+// StaticUserDirectory is a `UserDirectory` with a fixed list of users, kept in memory.
+type StaticUserDirectory struct {
+	users []*CalUser
+}
+
+// NewStaticUserDirectory initializes a new directory with the given users.
+func NewStaticUserDirectory(users ...*CalUser) *StaticUserDirectory {
+	return &StaticUserDirectory{users}
+}
+
+// GetUser returns the user with the given name. See `UserDirectory.GetUser` doc.
+func (d *StaticUserDirectory) GetUser(name string) (*CalUser, bool) {
+	for _, user := range d.users {
+		if user.Name == name {
+			return user, true
+		}
+	}
+
+	return nil, false
+}
+
+// GetUserByAddress returns the user owning the given address. See `UserDirectory.GetUserByAddress` doc.
+func (d *StaticUserDirectory) GetUserByAddress(address string) (*CalUser, bool) {
+	for _, user := range d.users {
+		if user.HasAddress(address) {
+			return user, true
+		}
+	}
+
+	return nil, false
+}
+
+// NormalizeAddress normalizes a calendar user address, so that addresses can be compared. The "mailto:"
+// addresses are case insensitive and normalized to lower case. Other addresses are only trimmed.
+func NormalizeAddress(address string) string {
+	address = strings.TrimSpace(address)
+	if strings.HasPrefix(strings.ToLower(address), "mailto:") {
+		return strings.ToLower(address)
+	}
+
+	return address
+}
+
+// SameAddress tells whether both calendar user addresses are the same.
+func SameAddress(a, b string) bool {
+	return NormalizeAddress(a) == NormalizeAddress(b)
+}
+
+// ContainsAddress tells whether the calendar user address is one of the given addresses.
+func ContainsAddress(addresses []string, address string) bool {
+	for _, a := range addresses {
+		if SameAddress(a, address) {
+			return true
+		}
+	}
+
+	return false
 }
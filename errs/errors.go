@@ -1,7 +1,11 @@
 package errs
 
 import (
+	"encoding/xml"
 	"errors"
+	"fmt"
+
+	"github.com/samedi/caldav-go/ixml"
 )
 
 var (
@@ -9,4 +13,29 @@ var (
 	ResourceAlreadyExistsError = errors.New("caldav: resource already exists")
 	UnauthorizedError          = errors.New("caldav: unauthorized. credentials needed.")
 	ForbiddenError             = errors.New("caldav: forbidden operation.")
+	LockedError                = errors.New("caldav: resource is locked.")
+	RequestBodyTooLargeError   = errors.New("caldav: request body too large.")
+	ConflictError              = errors.New("caldav: conflicting value.")
 )
+
+// PreconditionError represents a failed WebDAV/CalDAV precondition (or postcondition). Besides the HTTP
+// status, it holds the XML name of the failed condition, which is sent back to the client inside
+// a <DAV:error> element. [See RFC4918#section-16 and RFC4791#section-1.3]
+type PreconditionError struct {
+	Status    int
+	Condition xml.Name
+	// Optional content of the condition element.
+	Content []ixml.Element
+}
+
+// NewPreconditionError initializes a new `PreconditionError` for the given status and condition.
+func NewPreconditionError(status int, condition xml.Name) *PreconditionError {
+	return &PreconditionError{
+		Status:    status,
+		Condition: condition,
+	}
+}
+
+func (e *PreconditionError) Error() string {
+	return fmt.Sprintf("caldav: precondition %s failed", e.Condition.Local)
+}
@@ -4,6 +4,8 @@ package global
 
 import (
 	"github.com/samedi/caldav-go/data"
+	"github.com/samedi/caldav-go/ics"
+	"github.com/samedi/caldav-go/imip"
 	"github.com/samedi/caldav-go/lib"
 )
 
@@ -15,3 +17,18 @@ var User *data.CalUser
 
 // SupportedComponents contains all components which are supported by the current storage implementation
 var SupportedComponents = []string{lib.VCALENDAR, lib.VEVENT}
+
+// MaxRequestBodySize is the maximum size, in bytes, accepted for request bodies. Requests with bigger
+// bodies are rejected with `413 Request Entity Too Large`. Zero (the default) means no limit.
+var MaxRequestBodySize int64
+
+// UserDirectory knows the local calendar users. Scheduling (RFC6638) is enabled only when it is set.
+var UserDirectory data.UserDirectory
+
+// Mailer sends by email (iMIP) the scheduling messages to the calendar users that are not local. When it is
+// not set, these users cannot be scheduled with.
+var Mailer imip.Mailer
+
+// Normalizers are applied, in order, to the calendar objects sent by the clients before storing them. When there
+// are none (the default), the objects are stored as they are sent.
+var Normalizers []ics.Normalizer
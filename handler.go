@@ -1,10 +1,12 @@
 package caldav
 
 import (
+	"io"
 	"net/http"
 
 	"github.com/samedi/caldav-go/data"
 	"github.com/samedi/caldav-go/handlers"
+	"github.com/samedi/caldav-go/imip"
 )
 
 // RequestHandler handles the given CALDAV request and writes the reponse righ away. This function is to be
@@ -27,3 +29,19 @@ func HandleRequestWithStorage(request *http.Request, stg data.Storage) *handlers
 	SetupStorage(stg)
 	return HandleRequest(request)
 }
+
+// HandleMail handles a scheduling message received by email (iMIP), e.g. piped from the mail server. The iTIP message
+// is delivered into the scheduling inboxes of the local recipients and, for replies, the organizer's copy of the object
+// is updated. It returns the scheduling status for each recipient. See `handlers.DeliverIMIP`.
+//
+// The From header of the email is trusted only when `senderVerified` is true, which the caller must set only when the
+// mail server authenticated the sender (e.g. DKIM or SPF aligned with the From address). Otherwise anyone able to send
+// an email could change the participation status of the attendees, so the replies are only delivered to the inboxes.
+func HandleMail(email io.Reader, senderVerified bool) (map[string]string, error) {
+	msg, err := imip.Parse(email)
+	if err != nil {
+		return nil, err
+	}
+
+	return handlers.DeliverIMIP(msg, senderVerified), nil
+}
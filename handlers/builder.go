@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"net/http"
+	"sync"
 
 	"github.com/samedi/caldav-go/data"
 	"github.com/samedi/caldav-go/global"
@@ -13,6 +14,28 @@ type HandlerInterface interface {
 	Handle() *Response
 }
 
+// RequestData holds the data of the request being handled. It is given to the handler factories and to the
+// middlewares, which can change it, e.g. a middleware can set a different `Storage` for the current tenant.
+type RequestData struct {
+	Request *http.Request
+	// The request body, already read.
+	Body string
+	Path string
+	// The storage used to handle the request. Defaults to the global storage.
+	Storage data.Storage
+	// The response being built. Handlers are expected to set it and return it.
+	Response *Response
+}
+
+// HandlerFactory builds the handler of a request, based on the request data.
+type HandlerFactory func(rdata *RequestData) HandlerInterface
+
+// Middleware wraps the handling of the requests. It receives the request data and a `next` function, which calls
+// the next middleware in the chain or, at the end, the handler itself. A middleware can inspect and change
+// the request data before calling `next`, change the response returned by it, or not call it at all and
+// return its own response instead.
+type Middleware func(rdata *RequestData, next func() *Response) *Response
+
 // Common data shared across the specific handlers. Defined here to
 // easily make available, in a single place, all the basic data possibly needed by the handlers.
 type handlerData struct {
@@ -24,34 +47,158 @@ type handlerData struct {
 	storage     data.Storage
 }
 
+var (
+	handlerFactories = make(map[string]HandlerFactory)
+	// the registered methods, in the order they were registered
+	handlerMethods []string
+	middlewares    []Middleware
+	handlersLock   sync.RWMutex
+)
+
+// RegisterHandler registers the factory of the handlers for the given HTTP method. If there was already a
+// factory for the method, including the built-in ones, it is replaced by the new factory.
+func RegisterHandler(method string, factory HandlerFactory) {
+	handlersLock.Lock()
+	defer handlersLock.Unlock()
+
+	if _, found := handlerFactories[method]; !found {
+		handlerMethods = append(handlerMethods, method)
+	}
+	handlerFactories[method] = factory
+}
+
+// UnregisterHandler removes the factory of the handlers for the given HTTP method. Requests
+// with that method are then answered with `501 Not Implemented`.
+func UnregisterHandler(method string) {
+	handlersLock.Lock()
+	defer handlersLock.Unlock()
+
+	delete(handlerFactories, method)
+	for i, m := range handlerMethods {
+		if m == method {
+			handlerMethods = append(handlerMethods[:i:i], handlerMethods[i+1:]...)
+			break
+		}
+	}
+}
+
+// RegisteredMethods returns the HTTP methods with a registered handler, in the order they were registered.
+func RegisteredMethods() []string {
+	handlersLock.RLock()
+	defer handlersLock.RUnlock()
+
+	return append([]string(nil), handlerMethods...)
+}
+
+// UseMiddleware adds a middleware to the chain wrapping the handling of all requests. The middlewares
+// are called in the order they were added, so the first one added is the outermost one.
+func UseMiddleware(mw Middleware) {
+	handlersLock.Lock()
+	defer handlersLock.Unlock()
+
+	middlewares = append(middlewares, mw)
+}
+
 // NewHandler returns a new CalDAV request handler object based on the provided request.
 // With the returned request handler, you can call `Handle()` to handle the request.
+// The request is handled by the handler registered for its method, wrapped by the middlewares.
+// When the request body cannot be read, the error is replied right away, without calling them.
 func NewHandler(request *http.Request) HandlerInterface {
-	hData := handlerData{
-		request: request,
-		requestBody: readRequestBody(request),
-		requestPath: request.URL.Path,
-		headers: headers{request.Header},
-		response: NewResponse(),
-		storage: global.Storage,
+	rdata := &RequestData{
+		Request:  request,
+		Path:     request.URL.Path,
+		Response: NewResponse(),
+		Storage:  global.Storage,
 	}
 
-	switch request.Method {
-	case "GET":
-		return getHandler{handlerData: hData, onlyHeaders: false}
-	case "HEAD":
-		return getHandler{handlerData: hData, onlyHeaders: true}
-	case "PUT":
-		return putHandler{hData}
-	case "DELETE":
-		return deleteHandler{hData}
-	case "PROPFIND":
-		return propfindHandler{hData}
-	case "OPTIONS":
-		return optionsHandler{hData}
-	case "REPORT":
-		return reportHandler{hData}
-	default:
-		return notImplementedHandler{hData}
+	body, err := readRequestBody(request, global.MaxRequestBodySize)
+	if err != nil {
+		return errorHandler{rdata.handlerData(), err}
 	}
+	rdata.Body = body
+
+	handlersLock.RLock()
+	defer handlersLock.RUnlock()
+
+	return chainHandler{rdata, append([]Middleware(nil), middlewares...)}
+}
+
+// Handler that calls the middlewares in the chain and then the handler registered for the request method.
+type chainHandler struct {
+	rdata       *RequestData
+	middlewares []Middleware
+}
+
+func (h chainHandler) Handle() *Response {
+	return h.next(0)
+}
+
+func (h chainHandler) next(i int) *Response {
+	if i == len(h.middlewares) {
+		return newMethodHandler(h.rdata).Handle()
+	}
+
+	return h.middlewares[i](h.rdata, func() *Response {
+		return h.next(i + 1)
+	})
+}
+
+// Builds the handler registered for the request method, or a handler replying
+// `501 Not Implemented` if there is none.
+func newMethodHandler(rdata *RequestData) HandlerInterface {
+	handlersLock.RLock()
+	factory, found := handlerFactories[rdata.Request.Method]
+	handlersLock.RUnlock()
+
+	if !found {
+		return notImplementedHandler{rdata.handlerData()}
+	}
+
+	return factory(rdata)
+}
+
+// Converts the request data into the data used by the built-in handlers.
+func (rdata *RequestData) handlerData() handlerData {
+	return handlerData{
+		request:     rdata.Request,
+		requestBody: rdata.Body,
+		requestPath: rdata.Path,
+		headers:     headers{rdata.Request.Header},
+		response:    rdata.Response,
+		storage:     rdata.Storage,
+	}
+}
+
+// The built-in handlers.
+func init() {
+	RegisterHandler("GET", func(rdata *RequestData) HandlerInterface {
+		return getHandler{handlerData: rdata.handlerData(), onlyHeaders: false}
+	})
+	RegisterHandler("HEAD", func(rdata *RequestData) HandlerInterface {
+		return getHandler{handlerData: rdata.handlerData(), onlyHeaders: true}
+	})
+	RegisterHandler("POST", func(rdata *RequestData) HandlerInterface {
+		return postHandler{rdata.handlerData()}
+	})
+	RegisterHandler("PUT", func(rdata *RequestData) HandlerInterface {
+		return putHandler{rdata.handlerData()}
+	})
+	RegisterHandler("DELETE", func(rdata *RequestData) HandlerInterface {
+		return deleteHandler{rdata.handlerData()}
+	})
+	RegisterHandler("OPTIONS", func(rdata *RequestData) HandlerInterface {
+		return optionsHandler{rdata.handlerData()}
+	})
+	RegisterHandler("PROPFIND", func(rdata *RequestData) HandlerInterface {
+		return propfindHandler{rdata.handlerData()}
+	})
+	RegisterHandler("PROPPATCH", func(rdata *RequestData) HandlerInterface {
+		return proppatchHandler{rdata.handlerData()}
+	})
+	RegisterHandler("REPORT", func(rdata *RequestData) HandlerInterface {
+		return reportHandler{rdata.handlerData()}
+	})
+	RegisterHandler("MKCALENDAR", func(rdata *RequestData) HandlerInterface {
+		return mkcalendarHandler{rdata.handlerData()}
+	})
 }
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/samedi/caldav-go/test"
+)
+
+type echoHandler struct {
+	rdata *RequestData
+}
+
+func (h echoHandler) Handle() *Response {
+	return h.rdata.Response.Set(http.StatusOK, h.rdata.Body)
+}
+
+func TestRegisterHandler(t *testing.T) {
+	RegisterHandler("BULK", func(rdata *RequestData) HandlerInterface {
+		return echoHandler{rdata}
+	})
+	defer UnregisterHandler("BULK")
+
+	resp := NewHandler(httptest.NewRequest("BULK", "/foo", strings.NewReader("bar"))).Handle()
+	test.AssertInt(resp.Status, http.StatusOK, t)
+	test.AssertStr(resp.BodyString(), "bar", t)
+
+	// the custom methods are listed as allowed
+	resp = NewHandler(httptest.NewRequest("OPTIONS", "/foo", nil)).Handle()
+	test.AssertStr(resp.Header.Get("Allow"), "GET, HEAD, POST, PUT, DELETE, OPTIONS, PROPFIND, PROPPATCH, REPORT, MKCALENDAR, BULK", t)
+
+	UnregisterHandler("BULK")
+	resp = NewHandler(httptest.NewRequest("BULK", "/foo", strings.NewReader("bar"))).Handle()
+	test.AssertInt(resp.Status, http.StatusNotImplemented, t)
+}
+
+func TestMiddlewares(t *testing.T) {
+	RegisterHandler("BULK", func(rdata *RequestData) HandlerInterface {
+		return echoHandler{rdata}
+	})
+	defer UnregisterHandler("BULK")
+	defer func() { middlewares = nil }()
+
+	calls := []string{}
+	// changes the request data and the response
+	UseMiddleware(func(rdata *RequestData, next func() *Response) *Response {
+		calls = append(calls, "first")
+		rdata.Body = strings.ToUpper(rdata.Body)
+		return next().SetHeader("X-Audited", "true")
+	})
+	// refuses the requests without a tenant
+	UseMiddleware(func(rdata *RequestData, next func() *Response) *Response {
+		calls = append(calls, "second")
+		if rdata.Request.Header.Get("X-Tenant") == "" {
+			return rdata.Response.Set(http.StatusForbidden, "")
+		}
+		return next()
+	})
+
+	request := httptest.NewRequest("BULK", "/foo", strings.NewReader("bar"))
+	request.Header.Set("X-Tenant", "acme")
+	resp := NewHandler(request).Handle()
+	test.AssertInt(resp.Status, http.StatusOK, t)
+	test.AssertStr(resp.BodyString(), "BAR", t)
+	test.AssertStr(resp.Header.Get("X-Audited"), "true", t)
+	test.AssertStr(strings.Join(calls, ","), "first,second", t)
+
+	resp = NewHandler(httptest.NewRequest("BULK", "/foo", strings.NewReader("bar"))).Handle()
+	test.AssertInt(resp.Status, http.StatusForbidden, t)
+	test.AssertStr(resp.Header.Get("X-Audited"), "true", t)
+}
@@ -0,0 +1,329 @@
+package handlers
+
+import (
+	"encoding/xml"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/laurent22/ical-go"
+
+	"github.com/samedi/caldav-go/data"
+	"github.com/samedi/caldav-go/errs"
+	"github.com/samedi/caldav-go/ics"
+	"github.com/samedi/caldav-go/ixml"
+	"github.com/samedi/caldav-go/lib"
+)
+
+// The format of the CALDAV:min-date-time and CALDAV:max-date-time values (RFC4791#5.2.6 and #5.2.7).
+const calendarDateTimeFormat = "20060102T150405Z"
+
+// Provider of a property kept in the `data.CalendarMetadata` of the calendar collections. The properties are
+// defined only when the storage in use implements `data.CalendarMetadataStorage`.
+type calendarProperty struct {
+	// returns the value of the property and whether it is defined
+	get func(metadata *data.CalendarMetadata) (string, bool)
+	// changes the property to the given value, or removes it when the value is nil
+	set func(metadata *data.CalendarMetadata, value *ixml.Element) error
+}
+
+func (p calendarProperty) GetProperty(ctx *PropertyContext, resource *data.Resource) (ixml.Element, bool) {
+	storage, ok := ctx.Storage.(data.CalendarMetadataStorage)
+	if !ok || !isCalendarCollection(resource) {
+		return ixml.Element{}, false
+	}
+
+	metadata, err := storage.GetCalendarMetadata(resource.Path)
+	if err != nil {
+		return ixml.Element{}, false
+	}
+
+	value, found := p.get(metadata)
+	if !found {
+		return ixml.Element{}, false
+	}
+
+	return ixml.Element{Text: value}, true
+}
+
+func (p calendarProperty) SetProperty(ctx *PropertyContext, resource *data.Resource, value *ixml.Element) error {
+	storage, ok := ctx.Storage.(data.CalendarMetadataStorage)
+	if !ok || !isCalendarCollection(resource) {
+		return errs.ForbiddenError
+	}
+
+	metadata, err := storage.GetCalendarMetadata(resource.Path)
+	if err != nil {
+		return err
+	}
+
+	if err := p.set(metadata, value); err != nil {
+		return err
+	}
+
+	return storage.SetCalendarMetadata(resource.Path, metadata)
+}
+
+// Tells whether the resource is a calendar collection, i.e. a collection other than the scheduling boxes.
+func isCalendarCollection(resource *data.Resource) bool {
+	return resource.IsCollection() && !isScheduleBox(resource.Path, ScheduleInboxName) && !isScheduleBox(resource.Path, ScheduleOutboxName)
+}
+
+// Returns the text of the property value, or an empty text when it must be removed.
+func propertyText(value *ixml.Element) string {
+	if value == nil {
+		return ""
+	}
+
+	return strings.TrimSpace(value.Text)
+}
+
+// Parses the value of a property holding a positive integer. A removed property has the value 0.
+func parsePositiveInt(value *ixml.Element) (int64, error) {
+	text := propertyText(value)
+	if text == "" {
+		if value != nil {
+			return 0, errs.ConflictError
+		}
+		return 0, nil
+	}
+
+	n, err := strconv.ParseInt(text, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, errs.ConflictError
+	}
+
+	return n, nil
+}
+
+// Parses the value of a property holding a UTC date and time. A removed property has the zero time.
+func parseCalendarDateTime(value *ixml.Element) (time.Time, error) {
+	text := propertyText(value)
+	if text == "" {
+		if value != nil {
+			return time.Time{}, errs.ConflictError
+		}
+		return time.Time{}, nil
+	}
+
+	t, err := time.Parse(calendarDateTimeFormat, text)
+	if err != nil {
+		return time.Time{}, errs.ConflictError
+	}
+
+	return t, nil
+}
+
+// Returns the value of a property holding a positive integer, which is not defined when it is 0.
+func positiveIntValue(n int64) (string, bool) {
+	return strconv.FormatInt(n, 10), n > 0
+}
+
+// Returns the value of a property holding a UTC date and time, which is not defined when it is the zero time.
+func dateTimeValue(t time.Time) (string, bool) {
+	return t.UTC().Format(calendarDateTimeFormat), !t.IsZero()
+}
+
+// The properties of the calendar collections (RFC4791#5.2).
+func init() {
+	RegisterPropertyProvider(ixml.CALENDAR_DESCRIPTION_TG, calendarProperty{
+		get: func(metadata *data.CalendarMetadata) (string, bool) {
+			return metadata.Description, metadata.Description != ""
+		},
+		set: func(metadata *data.CalendarMetadata, value *ixml.Element) error {
+			metadata.Description = propertyText(value)
+			return nil
+		},
+	})
+
+	RegisterPropertyProvider(ixml.CALENDAR_TIMEZONE_TG, calendarProperty{
+		get: func(metadata *data.CalendarMetadata) (string, bool) {
+			return metadata.Timezone, metadata.Timezone != ""
+		},
+		set: func(metadata *data.CalendarMetadata, value *ixml.Element) error {
+			text := propertyText(value)
+			if text != "" {
+				if _, err := ics.ParseCalendarTimezone(text); err != nil {
+					return errs.NewPreconditionError(http.StatusForbidden, ixml.VALID_CALENDAR_DATA_TG)
+				}
+			}
+			metadata.Timezone = text
+			return nil
+		},
+	})
+
+	RegisterPropertyProvider(ixml.MAX_RESOURCE_SIZE_TG, calendarProperty{
+		get: func(metadata *data.CalendarMetadata) (string, bool) {
+			return positiveIntValue(metadata.MaxResourceSize)
+		},
+		set: func(metadata *data.CalendarMetadata, value *ixml.Element) (err error) {
+			metadata.MaxResourceSize, err = parsePositiveInt(value)
+			return err
+		},
+	})
+
+	RegisterPropertyProvider(ixml.MIN_DATE_TIME_TG, calendarProperty{
+		get: func(metadata *data.CalendarMetadata) (string, bool) {
+			return dateTimeValue(metadata.MinDateTime)
+		},
+		set: func(metadata *data.CalendarMetadata, value *ixml.Element) (err error) {
+			metadata.MinDateTime, err = parseCalendarDateTime(value)
+			return err
+		},
+	})
+
+	RegisterPropertyProvider(ixml.MAX_DATE_TIME_TG, calendarProperty{
+		get: func(metadata *data.CalendarMetadata) (string, bool) {
+			return dateTimeValue(metadata.MaxDateTime)
+		},
+		set: func(metadata *data.CalendarMetadata, value *ixml.Element) (err error) {
+			metadata.MaxDateTime, err = parseCalendarDateTime(value)
+			return err
+		},
+	})
+
+	RegisterPropertyProvider(ixml.MAX_INSTANCES_TG, calendarProperty{
+		get: func(metadata *data.CalendarMetadata) (string, bool) {
+			return positiveIntValue(int64(metadata.MaxInstances))
+		},
+		set: func(metadata *data.CalendarMetadata, value *ixml.Element) error {
+			n, err := parsePositiveInt(value)
+			metadata.MaxInstances = int(n)
+			return err
+		},
+	})
+
+	RegisterPropertyProvider(ixml.MAX_ATTENDEES_PER_INSTANCE_TG, calendarProperty{
+		get: func(metadata *data.CalendarMetadata) (string, bool) {
+			return positiveIntValue(int64(metadata.MaxAttendeesPerInstance))
+		},
+		set: func(metadata *data.CalendarMetadata, value *ixml.Element) error {
+			n, err := parsePositiveInt(value)
+			metadata.MaxAttendeesPerInstance = int(n)
+			return err
+		},
+	})
+
+	// the calendar objects are stored as iCalendar 2.0, but can also be sent and fetched as jCal or xCal
+	RegisterPropertyProvider(ixml.SUPPORTED_CALENDAR_DATA_TG, PropertyGetterFunc(func(ctx *PropertyContext, resource *data.Resource) (ixml.Element, bool) {
+		if !isCalendarCollection(resource) {
+			return ixml.Element{}, false
+		}
+
+		var types []ixml.Element
+		for _, mediaType := range ics.MediaTypes {
+			calendarData := ixml.NewElement(ixml.CALENDAR_DATA_TG)
+			calendarData.Attrs = []xml.Attr{
+				{Name: xml.Name{Local: "content-type"}, Value: mediaType},
+				{Name: xml.Name{Local: "version"}, Value: "2.0"},
+			}
+			types = append(types, calendarData)
+		}
+
+		return ixml.NewElement(xml.Name{}, types...), true
+	}))
+
+	// the collations that can be used in the text-match filters of the calendar queries (RFC4791#7.5.1)
+	RegisterPropertyProvider(ixml.SUPPORTED_COLLATION_SET_TG, PropertyGetterFunc(func(ctx *PropertyContext, resource *data.Resource) (ixml.Element, bool) {
+		if !isCalendarCollection(resource) {
+			return ixml.Element{}, false
+		}
+
+		var collations []ixml.Element
+		for _, collation := range data.SupportedCollations {
+			collations = append(collations, ixml.NewTextElement(ixml.SUPPORTED_COLLATION_TG, collation))
+		}
+
+		return ixml.NewElement(xml.Name{}, collations...), true
+	}))
+}
+
+// Returns the properties of the calendar collection on the given path. When the storage does not
+// keep the properties of the collections, or there is no such collection, there are no properties.
+func (h handlerData) calendarMetadata(rpath string) *data.CalendarMetadata {
+	if storage, ok := h.storage.(data.CalendarMetadataStorage); ok {
+		if metadata, err := storage.GetCalendarMetadata(rpath); err == nil {
+			return metadata
+		}
+	}
+
+	return new(data.CalendarMetadata)
+}
+
+// Checks the calendar object with the given content against the limits of its calendar collection
+// (RFC4791#5.3.2.1). It returns the precondition error of the first limit exceeded.
+func checkCalendarLimits(metadata *data.CalendarMetadata, content string) error {
+	forbidden := func(condition xml.Name) error {
+		return errs.NewPreconditionError(http.StatusForbidden, condition)
+	}
+
+	if metadata.MaxResourceSize > 0 && int64(len(content)) > metadata.MaxResourceSize {
+		return forbidden(ixml.MAX_RESOURCE_SIZE_TG)
+	}
+
+	if metadata.MinDateTime.IsZero() && metadata.MaxDateTime.IsZero() && metadata.MaxInstances == 0 && metadata.MaxAttendeesPerInstance == 0 {
+		return nil
+	}
+
+	cal, err := ics.Parse(content)
+	if err != nil {
+		// the content itself is not validated here
+		return nil
+	}
+
+	for _, comp := range ics.Components(cal, lib.VEVENT, lib.VTODO, lib.VJOURNAL) {
+		if metadata.MaxAttendeesPerInstance > 0 && len(ics.Properties(comp, "ATTENDEE")) > metadata.MaxAttendeesPerInstance {
+			return forbidden(ixml.MAX_ATTENDEES_PER_INSTANCE_TG)
+		}
+	}
+
+	var floating *ics.Timezone
+	if metadata.Timezone != "" {
+		floating, _ = ics.ParseCalendarTimezone(metadata.Timezone)
+	}
+	timeContext := ics.NewTimeContext(cal, floating)
+
+	// every instance is checked against the dates, and the instances are counted up to the first one over the
+	// maximum. As the instances of a component come in chronological order, the later ones need to be checked
+	// only when there is a maximum date or a maximum of instances. The recurrences whose expansion is incomplete
+	// may have later instances, so they are considered over these maximums.
+	var exceeded xml.Name
+	instances := 0
+	for _, name := range []string{lib.VEVENT, lib.VTODO, lib.VJOURNAL} {
+		complete := timeContext.EachInstance(cal, name, time.Time{}, func(comp *ical.Node, start, end time.Time) bool {
+			switch {
+			case exceeded.Local != "":
+				return false
+			case !metadata.MinDateTime.IsZero() && start.Before(metadata.MinDateTime):
+				exceeded = ixml.MIN_DATE_TIME_TG
+				return false
+			case !metadata.MaxDateTime.IsZero() && end.After(metadata.MaxDateTime):
+				exceeded = ixml.MAX_DATE_TIME_TG
+				return false
+			}
+
+			instances++
+			if metadata.MaxInstances > 0 && instances > metadata.MaxInstances {
+				exceeded = ixml.MAX_INSTANCES_TG
+				return false
+			}
+
+			return !metadata.MaxDateTime.IsZero() || metadata.MaxInstances > 0
+		})
+
+		if !complete && exceeded.Local == "" {
+			if !metadata.MaxDateTime.IsZero() {
+				exceeded = ixml.MAX_DATE_TIME_TG
+			} else {
+				exceeded = ixml.MAX_INSTANCES_TG
+			}
+		}
+
+		if exceeded.Local != "" {
+			return forbidden(exceeded)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"encoding/xml"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/samedi/caldav-go/data"
+	"github.com/samedi/caldav-go/errs"
+	"github.com/samedi/caldav-go/ixml"
+	"github.com/samedi/caldav-go/test"
+)
+
+func newCalendarHandlerData(rpath, body string) handlerData {
+	return handlerData{
+		request:     &http.Request{Header: make(http.Header)},
+		requestBody: body,
+		requestPath: rpath,
+		response:    NewResponse(),
+		storage:     new(data.FileStorage),
+	}
+}
+
+func TestMkcalendar(t *testing.T) {
+	defer os.RemoveAll("test-data/mkcalendar")
+
+	mkcalendar := func(rpath, body string) *Response {
+		return mkcalendarHandler{newCalendarHandlerData(rpath, body)}.Handle()
+	}
+
+	// Test 1: the calendar is created with the properties given in the request
+	resp := mkcalendar("/test-data/mkcalendar/work/", `
+  <C:mkcalendar xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">
+    <D:set>
+      <D:prop>
+        <C:calendar-description>Work meetings</C:calendar-description>
+        <C:max-attendees-per-instance>2</C:max-attendees-per-instance>
+        <C:min-date-time>20160101T000000Z</C:min-date-time>
+      </D:prop>
+    </D:set>
+  </C:mkcalendar>`)
+
+	test.AssertInt(resp.Status, http.StatusCreated, t)
+	test.AssertResourceExists("/test-data/mkcalendar/work", t)
+
+	collection, _, _ := new(data.FileStorage).GetShallowResource("/test-data/mkcalendar/work")
+	ms := &multistatusResp{Context: &PropertyContext{Storage: new(data.FileStorage)}}
+	ms.AddResponse(collection.Path, true, ms.Propstats(collection, []xml.Name{
+		ixml.CALENDAR_DESCRIPTION_TG, ixml.MAX_ATTENDEES_PER_INSTANCE_TG, ixml.MIN_DATE_TIME_TG,
+		ixml.SUPPORTED_CALENDAR_DATA_TG, ixml.SUPPORTED_COLLATION_SET_TG, ixml.MAX_RESOURCE_SIZE_TG,
+	}))
+
+	expected := `
+  <?xml version="1.0" encoding="UTF-8"?>
+  <D:multistatus xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav" xmlns:CS="http://calendarserver.org/ns/">
+    <D:response>
+      <D:href>/test-data/mkcalendar/work</D:href>
+      <D:propstat>
+        <D:prop>
+          <C:calendar-description>Work meetings</C:calendar-description>
+          <C:max-attendees-per-instance>2</C:max-attendees-per-instance>
+          <C:min-date-time>20160101T000000Z</C:min-date-time>
+          <C:supported-calendar-data>
+            <C:calendar-data content-type="text/calendar" version="2.0"/>
+            <C:calendar-data content-type="application/calendar+json" version="2.0"/>
+            <C:calendar-data content-type="application/calendar+xml" version="2.0"/>
+          </C:supported-calendar-data>
+          <C:supported-collation-set>
+            <C:supported-collation>i;ascii-casemap</C:supported-collation>
+            <C:supported-collation>i;octet</C:supported-collation>
+            <C:supported-collation>i;unicode-casemap</C:supported-collation>
+          </C:supported-collation-set>
+        </D:prop>
+        <D:status>HTTP/1.1 200 OK</D:status>
+      </D:propstat>
+      <D:propstat>
+        <D:prop>
+          <C:max-resource-size/>
+        </D:prop>
+        <D:status>HTTP/1.1 404 Not Found</D:status>
+      </D:propstat>
+    </D:response>
+  </D:multistatus>`
+
+	test.AssertMultistatusXML(ms.ToXML(), expected, t)
+
+	// the properties are not listed as a resource of the collection
+	resources, _ := new(data.FileStorage).GetResources("/test-data/mkcalendar/work", true)
+	test.AssertInt(len(resources), 1, t)
+
+	// Test 2: the calendar already exists
+	resp = mkcalendar("/test-data/mkcalendar/work/", "")
+	test.AssertInt(resp.Status, http.StatusForbidden, t)
+	test.AssertInt(errorStatus(resp.Error), http.StatusForbidden, t)
+
+	// Test 3: when a property cannot be set, the calendar is not created
+	resp = mkcalendar("/test-data/mkcalendar/home/", `
+  <C:mkcalendar xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">
+    <D:set>
+      <D:prop>
+        <C:calendar-description>Home</C:calendar-description>
+        <C:max-instances>many</C:max-instances>
+      </D:prop>
+    </D:set>
+  </C:mkcalendar>`)
+
+	expected = `
+  <?xml version="1.0" encoding="UTF-8"?>
+  <C:mkcalendar-response xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav" xmlns:CS="http://calendarserver.org/ns/">
+    <D:propstat>
+      <D:prop>
+        <C:max-instances/>
+      </D:prop>
+      <D:status>HTTP/1.1 409 Conflict</D:status>
+    </D:propstat>
+    <D:propstat>
+      <D:prop>
+        <C:calendar-description/>
+      </D:prop>
+      <D:status>HTTP/1.1 424 Failed Dependency</D:status>
+    </D:propstat>
+  </C:mkcalendar-response>`
+
+	test.AssertInt(resp.Status, http.StatusForbidden, t)
+	test.AssertMultistatusXML(resp.BodyString(), expected, t)
+	test.AssertResourceDoesNotExist("/test-data/mkcalendar/home", t)
+
+	// Test 4: invalid calendar time zones are refused
+	resp = proppatchHandler{newCalendarHandlerData("/test-data/mkcalendar/work/", `
+  <D:propertyupdate xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">
+    <D:set><D:prop><C:calendar-timezone>BEGIN:VCALENDAR</C:calendar-timezone></D:prop></D:set>
+  </D:propertyupdate>`)}.Handle()
+
+	test.AssertInt(resp.Status, http.StatusMultiStatus, t)
+	test.AssertMultistatusXML(resp.BodyString(), `
+  <?xml version="1.0" encoding="UTF-8"?>
+  <D:multistatus xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav" xmlns:CS="http://calendarserver.org/ns/">
+    <D:response>
+      <D:href>/test-data/mkcalendar/work</D:href>
+      <D:propstat>
+        <D:prop>
+          <C:calendar-timezone/>
+        </D:prop>
+        <D:status>HTTP/1.1 403 Forbidden</D:status>
+      </D:propstat>
+    </D:response>
+  </D:multistatus>`, t)
+}
+
+func TestCalendarLimits(t *testing.T) {
+	defer os.RemoveAll("test-data/limits")
+
+	storage := new(data.FileStorage)
+	storage.CreateCollection("/test-data/limits")
+	storage.SetCalendarMetadata("/test-data/limits", &data.CalendarMetadata{
+		MaxResourceSize:         400,
+		MaxInstances:            5,
+		MaxAttendeesPerInstance: 2,
+	})
+
+	put := func(name, content string) *Response {
+		return putHandler{newCalendarHandlerData("/test-data/limits/"+name, content)}.Handle()
+	}
+
+	event := func(props string) string {
+		return "BEGIN:VCALENDAR\nBEGIN:VEVENT\nUID:1\nDTSTART:20160914T100000Z\nDTEND:20160914T110000Z\n" + props + "END:VEVENT\nEND:VCALENDAR"
+	}
+
+	assertCondition := func(resp *Response, condition xml.Name) {
+		test.AssertInt(resp.Status, http.StatusForbidden, t)
+		if perr, ok := resp.Error.(*errs.PreconditionError); !ok || perr.Condition != condition {
+			t.Error("Expected precondition", condition.Local, "| Got:", resp.Error)
+		}
+	}
+
+	test.AssertInt(put("ok.ics", event("ATTENDEE:mailto:a@example.com\nRRULE:FREQ=DAILY;COUNT=5\n")).Status, http.StatusCreated, t)
+
+	assertCondition(put("big.ics", event("DESCRIPTION:"+string(make([]byte, 400))+"\n")), ixml.MAX_RESOURCE_SIZE_TG)
+	assertCondition(put("crowded.ics", event("ATTENDEE:mailto:a@example.com\nATTENDEE:mailto:b@example.com\nATTENDEE:mailto:c@example.com\n")), ixml.MAX_ATTENDEES_PER_INSTANCE_TG)
+	assertCondition(put("forever.ics", event("RRULE:FREQ=WEEKLY\n")), ixml.MAX_INSTANCES_TG)
+	assertCondition(put("many.ics", event("RRULE:FREQ=DAILY;UNTIL=20161231T000000Z\n")), ixml.MAX_INSTANCES_TG)
+	assertCondition(put("rdates.ics", event("RRULE:FREQ=DAILY;COUNT=4\nRDATE:20161001T100000Z,20161002T100000Z\n")), ixml.MAX_INSTANCES_TG)
+	assertCondition(put("secondly.ics", event("RRULE:FREQ=SECONDLY;UNTIL=99991231T000000Z\n")), ixml.MAX_INSTANCES_TG)
+	// the BYxxx parts of the rules are taken into account: only 4 Mondays until October 4th
+	test.AssertInt(put("mondays.ics", event("RRULE:FREQ=DAILY;BYDAY=MO;UNTIL=20161004T000000Z\n")).Status, http.StatusCreated, t)
+
+	storage.SetCalendarMetadata("/test-data/limits", &data.CalendarMetadata{
+		MinDateTime: time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC),
+		MaxDateTime: time.Date(2016, 12, 31, 0, 0, 0, 0, time.UTC),
+	})
+
+	assertCondition(put("old.ics", "BEGIN:VCALENDAR\nBEGIN:VEVENT\nDTSTART:20151231T230000Z\nDTEND:20160101T010000Z\nEND:VEVENT\nEND:VCALENDAR"), ixml.MIN_DATE_TIME_TG)
+	assertCondition(put("late.ics", "BEGIN:VCALENDAR\nBEGIN:VEVENT\nDTSTART:20161231\nEND:VEVENT\nEND:VCALENDAR"), ixml.MAX_DATE_TIME_TG)
+	test.AssertInt(put("new-year.ics", "BEGIN:VCALENDAR\nBEGIN:VEVENT\nDTSTART:20160101\nEND:VEVENT\nEND:VCALENDAR").Status, http.StatusCreated, t)
+	// all the instances are checked, not only the first one
+	assertCondition(put("yearly.ics", event("RRULE:FREQ=YEARLY;COUNT=2\n")), ixml.MAX_DATE_TIME_TG)
+
+	// without limit of instances, the instances of the rules are not counted
+	storage.SetCalendarMetadata("/test-data/limits", &data.CalendarMetadata{MaxResourceSize: 400})
+	test.AssertInt(put("secondly.ics", event("RRULE:FREQ=SECONDLY;UNTIL=99991231T000000Z\n")).Status, http.StatusCreated, t)
+}
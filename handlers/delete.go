@@ -2,6 +2,8 @@ package handlers
 
 import (
 	"net/http"
+
+	"github.com/samedi/caldav-go/data"
 )
 
 type deleteHandler struct {
@@ -9,23 +11,27 @@ type deleteHandler struct {
 }
 
 func (dh deleteHandler) Handle() *Response {
-	precond := requestPreconditions{dh.request}
-
 	// get the event from the storage
 	resource, _, err := dh.storage.GetShallowResource(dh.requestPath)
 	if err != nil {
 		return dh.response.SetError(err)
 	}
 
-	// TODO: Handle delete on collections
+	// check ETag and modification date pre-conditions
+	if resp := dh.checkPreconditions(resource); resp != nil {
+		return resp
+	}
+
 	if resource.IsCollection() {
-		return dh.response.Set(http.StatusMethodNotAllowed, "")
+		return dh.deleteCollection(resource)
 	}
 
-	// check ETag pre-condition
-	resourceEtag, _ := resource.GetEtag()
-	if !precond.IfMatch(resourceEtag) {
-		return dh.response.Set(http.StatusPreconditionFailed, "")
+	// the cancellation or the reply of the deleted object is sent once the object is deleted
+	sched := dh.scheduler()
+	var scheduling *scheduling
+	if sched != nil {
+		content, _ := resource.GetContentData()
+		scheduling = sched.scheduleDelete(resource.Path, content)
 	}
 
 	// delete event after pre-condition passed
@@ -34,5 +40,115 @@ func (dh deleteHandler) Handle() *Response {
 		return dh.response.SetError(err)
 	}
 
+	if sched != nil {
+		sched.deliverAll(scheduling)
+	}
+
+	return dh.response.Set(http.StatusNoContent, "")
+}
+
+// Deletes a collection and all its children. If the storage is able to delete the whole collection at once,
+// that's what is used. Otherwise each child is deleted separately and, in case any of them could not be
+// deleted (e.g. it is locked or the user has no permission), the collection itself is kept and a multistatus
+// response listing the children that failed is returned. [See RFC4918#section-9.6.1]
+// As for a single object, the cancellations or replies of the deleted calendar objects are sent.
+func (dh deleteHandler) deleteCollection(collection *data.Resource) *Response {
+	sched := dh.scheduler()
+
+	if deleter, ok := dh.storage.(data.CollectionDeleter); ok {
+		var schedulings []*scheduling
+		if sched != nil {
+			schedulings = dh.scheduleDeleteChildren(sched, collection)
+		}
+
+		if err := deleter.DeleteCollection(collection.Path); err != nil {
+			return dh.response.SetError(err)
+		}
+
+		for _, scheduling := range schedulings {
+			sched.deliverAll(scheduling)
+		}
+
+		return dh.response.Set(http.StatusNoContent, "")
+	}
+
+	multistatus := new(multistatusResp)
+	if !dh.deleteChildren(sched, collection, multistatus) {
+		return dh.response.Set(207, multistatus.ToXML())
+	}
+
+	if err := dh.storage.DeleteResource(collection.Path); err != nil {
+		return dh.response.SetError(err)
+	}
+
 	return dh.response.Set(http.StatusNoContent, "")
 }
+
+// Deletes recursively all the children of a collection. The children that could not be deleted are added to
+// the `multistatus` with the error status. It returns true only if all the children were deleted.
+func (dh deleteHandler) deleteChildren(sched *scheduler, collection *data.Resource, multistatus *multistatusResp) bool {
+	resources, err := dh.storage.GetResources(collection.Path, true)
+	if err != nil {
+		multistatus.AddStatusResponse(collection.Path, errorStatus(err))
+		return false
+	}
+
+	success := true
+	for _, child := range resources {
+		// the collection itself is also part of the result
+		if child.Path == collection.Path {
+			continue
+		}
+
+		if child.IsCollection() && !dh.deleteChildren(sched, &child, multistatus) {
+			// the members that failed were already reported. The sub collection itself
+			// must not be reported as failed dependency (424) in the response.
+			success = false
+			continue
+		}
+
+		var scheduling *scheduling
+		if sched != nil && !child.IsCollection() {
+			content, _ := child.GetContentData()
+			scheduling = sched.scheduleDelete(child.Path, content)
+		}
+
+		if err := dh.storage.DeleteResource(child.Path); err != nil {
+			multistatus.AddStatusResponse(child.Path, errorStatus(err))
+			success = false
+			continue
+		}
+
+		if sched != nil {
+			sched.deliverAll(scheduling)
+		}
+	}
+
+	return success
+}
+
+// Returns the scheduling of the deletion of all the calendar objects in the collection and its sub collections,
+// computed before they are deleted at once.
+func (dh deleteHandler) scheduleDeleteChildren(sched *scheduler, collection *data.Resource) []*scheduling {
+	resources, err := dh.storage.GetResources(collection.Path, true)
+	if err != nil {
+		return nil
+	}
+
+	var schedulings []*scheduling
+	for _, child := range resources {
+		if child.Path == collection.Path {
+			continue
+		}
+
+		if child.IsCollection() {
+			schedulings = append(schedulings, dh.scheduleDeleteChildren(sched, &child)...)
+		} else if content, found := child.GetContentData(); found {
+			if scheduling := sched.scheduleDelete(child.Path, content); scheduling != nil {
+				schedulings = append(schedulings, scheduling)
+			}
+		}
+	}
+
+	return schedulings
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/samedi/caldav-go/errs"
+	"github.com/samedi/caldav-go/test"
+)
+
+// Storage that does not support deleting collections atomically and refuses to delete locked resources.
+type lockingStorage struct {
+	test.FakeStorage
+	locked map[string]bool
+}
+
+func (s lockingStorage) DeleteResource(rpath string) error {
+	if s.locked[rpath] {
+		return errs.LockedError
+	}
+
+	return s.FakeStorage.DeleteResource(rpath)
+}
+
+// Test 1: deleting a collection child by child when none of the children fail.
+func TestDeleteCollection1(t *testing.T) {
+	stg := lockingStorage{test.NewFakeStorage(), map[string]bool{}}
+	stg.AddFakeResource("/test-data/delete-collection/", "123-456-789.ics", "BEGIN:VEVENT\nSUMMARY:Party\nEND:VEVENT")
+	stg.AddFakeResource("/test-data/delete-collection/nested/", "789-456-123.ics", "BEGIN:VEVENT\nSUMMARY:Watch movies\nEND:VEVENT")
+
+	handler := deleteHandler{
+		handlerData{
+			request:     &http.Request{Header: make(http.Header)},
+			requestPath: "/test-data/delete-collection/",
+			response:    NewResponse(),
+			storage:     stg,
+		},
+	}
+
+	resp := handler.Handle()
+	test.AssertInt(resp.Status, http.StatusNoContent, t)
+	test.AssertResourceDoesNotExist("/test-data/delete-collection/", t)
+}
+
+// Test 2: deleting a collection child by child when one of the children is locked.
+// The collection and the locked child are kept and the failure is reported in a multistatus.
+func TestDeleteCollection2(t *testing.T) {
+	stg := lockingStorage{test.NewFakeStorage(), map[string]bool{"/test-data/delete-collection/nested/789-456-123.ics": true}}
+	stg.AddFakeResource("/test-data/delete-collection/", "123-456-789.ics", "BEGIN:VEVENT\nSUMMARY:Party\nEND:VEVENT")
+	stg.AddFakeResource("/test-data/delete-collection/nested/", "789-456-123.ics", "BEGIN:VEVENT\nSUMMARY:Watch movies\nEND:VEVENT")
+
+	handler := deleteHandler{
+		handlerData{
+			request:     &http.Request{Header: make(http.Header)},
+			requestPath: "/test-data/delete-collection/",
+			response:    NewResponse(),
+			storage:     stg,
+		},
+	}
+
+	expectedRespBody := `
+	<?xml version="1.0" encoding="UTF-8"?>
+	<D:multistatus xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav" xmlns:CS="http://calendarserver.org/ns/">
+		<D:response>
+			<D:href>/test-data/delete-collection/nested/789-456-123.ics</D:href>
+			<D:status>HTTP/1.1 423 Locked</D:status>
+		</D:response>
+	</D:multistatus>
+	`
+
+	resp := handler.Handle()
+	test.AssertInt(resp.Status, 207, t)
+	test.AssertMultistatusXML(resp.BodyString(), expectedRespBody, t)
+	test.AssertResourceDoesNotExist("/test-data/delete-collection/123-456-789.ics", t)
+	test.AssertResourceExists("/test-data/delete-collection/nested/789-456-123.ics", t)
+}
@@ -0,0 +1,12 @@
+package handlers
+
+// Handler used when the request cannot be handled at all, e.g. its body could not be read.
+// It just replies with the status matching the error.
+type errorHandler struct {
+	handlerData
+	err error
+}
+
+func (h errorHandler) Handle() *Response {
+	return h.response.SetError(h.err)
+}
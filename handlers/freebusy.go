@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"path"
+	"strings"
+	"time"
+
+	"github.com/laurent22/ical-go"
+
+	"github.com/samedi/caldav-go/data"
+	"github.com/samedi/caldav-go/ics"
+	"github.com/samedi/caldav-go/itip"
+	"github.com/samedi/caldav-go/lib"
+)
+
+// Answers a free-busy request sent by the `requester` to the outbox (RFC6638#5.1.1). Each attendee of the request gets
+// a result with the free-busy REPLY, built out of the events in its calendars, or the status telling why it could not
+// be looked up. The flag is false when the request has no valid time range.
+func (s *scheduler) freeBusy(requester *data.CalUser, request *ical.Node) ([]scheduleResult, bool) {
+	freebusy, _ := itip.FreeBusyRequest(request)
+	start, end, ok := itip.FreeBusyRange(freebusy)
+	if !ok {
+		return nil, false
+	}
+
+	results := []scheduleResult{}
+	for _, attendee := range itip.Attendees(request) {
+		user, found := s.directory.GetUserByAddress(attendee)
+		if !found {
+			results = append(results, scheduleResult{recipient: attendee, status: itip.StatusInvalidUser})
+			continue
+		}
+
+		if authorizer, ok := s.directory.(data.FreeBusyAuthorizer); ok && !authorizer.CanReadFreeBusy(requester, user) {
+			results = append(results, scheduleResult{recipient: attendee, status: itip.StatusNoPrivileges})
+			continue
+		}
+
+		reply := itip.NewFreeBusyReply(request, attendee, s.busyPeriods(user, start, end))
+		results = append(results, scheduleResult{recipient: attendee, status: itip.StatusSuccess, calendarData: ics.Serialize(reply)})
+	}
+
+	return results, true
+}
+
+// Returns the busy periods of the user between `start` and `end`, out of the events in all its calendars.
+// The transparent and cancelled events do not take time, and the tentative ones are tentatively busy.
+// The floating times are in the time zone of the calendar of the event (its CALDAV:calendar-timezone).
+func (s *scheduler) busyPeriods(user *data.CalUser, start, end time.Time) []itip.Period {
+	periods := []itip.Period{}
+	timezones := make(map[string]*ics.Timezone)
+
+	for _, object := range s.calendarObjects(user.Name) {
+		content, _ := object.GetContentData()
+		cal, err := ics.Parse(content)
+		if err != nil {
+			continue
+		}
+
+		calendarPath := path.Dir(object.Path)
+		floating, found := timezones[calendarPath]
+		if !found {
+			if tz := (handlerData{storage: s.storage}).calendarMetadata(calendarPath).Timezone; tz != "" {
+				floating, _ = ics.ParseCalendarTimezone(tz)
+			}
+			timezones[calendarPath] = floating
+		}
+
+		periods = append(periods, eventBusyPeriods(cal, floating, start, end)...)
+	}
+
+	return periods
+}
+
+// Returns the busy periods of the instances of the events in the calendar object that overlap the range between
+// `start` and `end`. The recurring events are expanded, without their excluded and overridden instances, and each
+// instance has the free-busy type of the component defining it.
+func eventBusyPeriods(cal *ical.Node, floating *ics.Timezone, start, end time.Time) []itip.Period {
+	periods := []itip.Period{}
+
+	ics.NewTimeContext(cal, floating).EachInstance(cal, lib.VEVENT, end, func(comp *ical.Node, instanceStart, instanceEnd time.Time) bool {
+		if fbtype, busy := freeBusyType(comp); busy && instanceEnd.After(start) {
+			periods = append(periods, itip.Period{Start: instanceStart.UTC(), End: instanceEnd.UTC(), Type: fbtype})
+		}
+
+		return true
+	})
+
+	return periods
+}
+
+// Returns the free-busy type of the event and whether it takes time at all (RFC5545#3.8.2.7).
+func freeBusyType(comp *ical.Node) (string, bool) {
+	if strings.ToUpper(comp.PropString("TRANSP", "OPAQUE")) == "TRANSPARENT" {
+		return "", false
+	}
+
+	switch strings.ToUpper(comp.PropString("STATUS", "")) {
+	case "CANCELLED":
+		return "", false
+	case "TENTATIVE":
+		return itip.FreeBusyTentative, true
+	default:
+		return itip.FreeBusyBusy, true
+	}
+}
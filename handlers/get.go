@@ -1,9 +1,22 @@
 package handlers
 
 import (
+	"encoding/json"
+	"log"
+	"mime"
 	"net/http"
+	"strings"
+
+	"github.com/laurent22/ical-go"
+
+	"github.com/samedi/caldav-go/data"
+	"github.com/samedi/caldav-go/ics"
+	"github.com/samedi/caldav-go/jscalendar"
 )
 
+// The formats the calendar data can be sent in: the iCalendar ones and JSCalendar.
+var getMediaTypes = append(append([]string{}, ics.MediaTypes...), jscalendar.MediaType)
+
 type getHandler struct {
 	handlerData
 	onlyHeaders bool
@@ -15,21 +28,132 @@ func (gh getHandler) Handle() *Response {
 		return gh.response.SetError(err)
 	}
 
-	var response string
-	if gh.onlyHeaders {
-		response = ""
-	} else {
-		response, _ = resource.GetContentData()
+	// the calendar data is sent in the format accepted by the client, e.g. jCal or JSCalendar,
+	// each format having its own ETag
+	mediaType := gh.headers.AcceptedMediaType(getMediaTypes)
+	if resp := gh.checkRepresentationPreconditions(resource, mediaType); resp != nil {
+		return resp
 	}
 
-	etag, _ := resource.GetEtag()
+	etag := representationEtag(resource, mediaType)
 	lastm, _ := resource.GetLastModified(http.TimeFormat)
 	ctype, _ := resource.GetContentType()
+	if mediaType != ics.MediaTypeICalendar {
+		ctype = mediaType
+	}
 
 	gh.response.SetHeader("ETag", etag).
 		SetHeader("Last-Modified", lastm).
 		SetHeader("Content-Type", ctype).
-		Set(http.StatusOK, response)
+		SetHeader(HD_VARY, HD_ACCEPT)
+
+	if gh.onlyHeaders {
+		return gh.response.Set(http.StatusOK, "")
+	}
+
+	if resource.IsCollection() {
+		response, err := gh.collectionContent(resource)
+		if err != nil {
+			return gh.response.SetError(err)
+		}
+
+		return gh.convertedContent(resource, response, mediaType)
+	}
+
+	if mediaType != ics.MediaTypeICalendar {
+		content, _ := resource.GetContentData()
+		return gh.convertedContent(resource, content, mediaType)
+	}
+
+	// the content of calendar object resources is streamed from the storage
+	reader, err := resource.GetContentReader()
+	if err != nil {
+		return gh.response.SetError(err)
+	}
+
+	return gh.response.SetReader(http.StatusOK, reader)
+}
+
+// Returns the content of a whole calendar collection as a single VCALENDAR object, which is
+// the merge of all its calendar object resources. If the storage already provides the
+// content of the collection resource, that content is used instead.
+func (gh getHandler) collectionContent(collection *data.Resource) (string, error) {
+	if content, found := collection.GetContentData(); found {
+		return content, nil
+	}
+
+	resources, err := gh.storage.GetResources(collection.Path, true)
+	if err != nil {
+		return "", err
+	}
+
+	calendars := []*ical.Node{}
+	for _, resource := range resources {
+		if resource.IsCollection() {
+			continue
+		}
+
+		content, _ := resource.GetContentData()
+		cal, err := ics.Parse(content)
+		if err != nil {
+			// a broken resource should not prevent the export of the whole calendar, so we just skip it
+			log.Printf("WARNING: Skipping resource with invalid iCal data on calendar export.\nError: %s.\nResource path: %s", err, resource.Path)
+			continue
+		}
+
+		calendars = append(calendars, cal)
+	}
+
+	return ics.Serialize(ics.Merge(calendars...)), nil
+}
+
+// Responds with the calendar data converted to the given format. The data that cannot be converted,
+// i.e. that is not valid iCalendar, is sent as it is.
+func (gh getHandler) convertedContent(resource *data.Resource, content, mediaType string) *Response {
+	if mediaType == jscalendar.MediaType {
+		return gh.jscalendarContent(resource, content)
+	}
+
+	converted, err := ics.ConvertTo(content, mediaType)
+	if err != nil {
+		log.Printf("WARNING: Sending resource with invalid iCal data as it is.\nError: %s.\nResource path: %s", err, resource.Path)
+
+		ctype, _ := resource.GetContentType()
+		gh.response.SetHeader("Content-Type", ctype)
+		return gh.response.Set(http.StatusOK, content)
+	}
+
+	return gh.response.Set(http.StatusOK, converted)
+}
+
+// Responds with the calendar data converted to a JSCalendar object, whose type (event, task or group)
+// is given by the `type` param of the content type.
+func (gh getHandler) jscalendarContent(resource *data.Resource, content string) *Response {
+	obj, converted, err := convertToJSCalendar(content)
+	if err != nil {
+		log.Printf("WARNING: Sending resource not convertible to JSCalendar as it is.\nError: %s.\nResource path: %s", err, resource.Path)
+
+		ctype, _ := resource.GetContentType()
+		gh.response.SetHeader("Content-Type", ctype)
+		return gh.response.Set(http.StatusOK, content)
+	}
+
+	ctype := mime.FormatMediaType(jscalendar.MediaType, map[string]string{"type": strings.ToLower(obj.ObjectType())})
+	gh.response.SetHeader("Content-Type", ctype)
+	return gh.response.Set(http.StatusOK, string(converted))
+}
+
+func convertToJSCalendar(content string) (jscalendar.Object, []byte, error) {
+	cal, err := ics.Parse(content)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	obj, err := jscalendar.Convert(cal)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	return gh.response
+	converted, err := json.Marshal(obj)
+	return obj, converted, err
 }
@@ -1,15 +1,21 @@
 package handlers
 
 import (
+	"mime"
 	"net/http"
+	"strconv"
+	"strings"
 )
 
 const (
+	HD_ACCEPT             = "Accept"
+	HD_CONTENT_TYPE       = "Content-Type"
 	HD_DEPTH              = "Depth"
 	HD_DEPTH_DEEP         = "1"
 	HD_PREFER             = "Prefer"
 	HD_PREFER_MINIMAL     = "return=minimal"
 	HD_PREFERENCE_APPLIED = "Preference-Applied"
+	HD_VARY               = "Vary"
 )
 
 type headers struct {
@@ -25,3 +31,69 @@ func (h headers) IsMinimal() bool {
 	prefer := h.Get(HD_PREFER)
 	return (prefer == HD_PREFER_MINIMAL)
 }
+
+// AcceptedMediaType returns the format of the calendar data preferred by the client, given by the
+// Accept header, among the given ones. It defaults to the first one, which is also the preferred
+// one on ties, e.g. when all the types are accepted.
+func (h headers) AcceptedMediaType(mediaTypes []string) string {
+	type mediaRange struct {
+		name    string
+		quality float64
+	}
+
+	var ranges []mediaRange
+	for _, value := range strings.Split(h.Get(HD_ACCEPT), ",") {
+		name, params, err := mime.ParseMediaType(strings.TrimSpace(value))
+		if err != nil {
+			continue
+		}
+
+		quality := 1.0
+		if q, err := strconv.ParseFloat(params["q"], 64); err == nil {
+			quality = q
+		}
+		ranges = append(ranges, mediaRange{name, quality})
+	}
+
+	accepted, acceptedQuality := mediaTypes[0], 0.0
+	for _, mediaType := range mediaTypes {
+		// the quality of a type is the one of the most specific range matching it
+		quality, specificity := 0.0, -1
+		for _, r := range ranges {
+			if s := mediaRangeSpecificity(r.name, mediaType); s > specificity {
+				quality, specificity = r.quality, s
+			}
+		}
+
+		if quality > acceptedQuality {
+			accepted, acceptedQuality = mediaType, quality
+		}
+	}
+
+	return accepted
+}
+
+// ContentMediaType returns the media type of the request body, given by the Content-Type header without its params.
+func (h headers) ContentMediaType() string {
+	mediaType, _, err := mime.ParseMediaType(h.Get(HD_CONTENT_TYPE))
+	if err != nil {
+		return ""
+	}
+
+	return mediaType
+}
+
+// Returns how specific the media range is when it matches the media type: 2 for the type itself,
+// 1 for the type/* ranges and 0 for */*. It returns -1 when the range does not match the type.
+func mediaRangeSpecificity(mediaRange, mediaType string) int {
+	switch {
+	case mediaRange == mediaType:
+		return 2
+	case mediaRange == "*/*":
+		return 0
+	case strings.HasSuffix(mediaRange, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(mediaRange, "*")):
+		return 1
+	}
+
+	return -1
+}
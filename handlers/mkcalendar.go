@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/xml"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/samedi/caldav-go/data"
+	"github.com/samedi/caldav-go/errs"
+	"github.com/samedi/caldav-go/ixml"
+)
+
+type mkcalendarHandler struct {
+	handlerData
+}
+
+// Handles the MKCALENDAR requests (RFC4791#5.3.1), which create a new calendar collection. The request body can
+// set the properties of the new calendar, like in a PROPPATCH request. If any of them cannot be set, the
+// collection is removed and the response lists the status of each property. It requires a storage
+// implementing `data.CollectionCreator`.
+func (mh mkcalendarHandler) Handle() *Response {
+	creator, ok := mh.storage.(data.CollectionCreator)
+	if !ok {
+		return mh.response.SetError(errs.ForbiddenError)
+	}
+
+	_, found, err := mh.storage.GetShallowResource(mh.requestPath)
+	if err != nil && err != errs.ResourceNotFoundError {
+		return mh.response.SetError(err)
+	} else if found {
+		return mh.response.SetError(errs.NewPreconditionError(http.StatusForbidden, ixml.RESOURCE_MUST_BE_NULL_TG))
+	}
+
+	var updates []propUpdate
+	if strings.TrimSpace(mh.requestBody) != "" {
+		var requestXML ixml.Element
+		if err := xml.Unmarshal([]byte(mh.requestBody), &requestXML); err != nil || requestXML.XMLName != ixml.MKCALENDAR_TG {
+			return mh.response.Set(http.StatusBadRequest, "")
+		}
+		updates = readPropUpdates(requestXML)
+	}
+
+	if err := creator.CreateCollection(mh.requestPath); err != nil {
+		return mh.response.SetError(err)
+	}
+
+	if len(updates) == 0 {
+		return mh.response.Set(http.StatusCreated, "")
+	}
+
+	collection, _, err := mh.storage.GetShallowResource(mh.requestPath)
+	if err != nil {
+		return mh.response.SetError(err)
+	}
+
+	propstats, ok := applyPropUpdates(mh.propertyContext(), collection, updates)
+	if ok {
+		return mh.response.Set(http.StatusCreated, "")
+	}
+
+	mh.removeCollection(collection.Path)
+
+	var buffer bytes.Buffer
+	w := ixml.NewWriter(&buffer)
+	w.Header()
+	w.Start(ixml.MKCALENDAR_RESPONSE_TG)
+	writePropstats(w, propstats)
+	w.End()
+	w.Flush()
+
+	mh.response.SetHeader("Content-Type", "application/xml; charset=utf-8")
+	return mh.response.Set(http.StatusForbidden, buffer.String())
+}
+
+// Removes the collection just created, when its properties could not be set.
+func (mh mkcalendarHandler) removeCollection(rpath string) {
+	var err error
+	if deleter, ok := mh.storage.(data.CollectionDeleter); ok {
+		err = deleter.DeleteCollection(rpath)
+	} else {
+		err = mh.storage.DeleteResource(rpath)
+	}
+
+	if err != nil {
+		log.Printf("WARNING: Could not remove the collection after failing to set its properties.\nError: %s.\nResource path: %s.", err, rpath)
+	}
+}
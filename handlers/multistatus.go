@@ -1,13 +1,15 @@
 package handlers
 
 import (
+	"bytes"
 	"encoding/xml"
-	"fmt"
 	"github.com/samedi/caldav-go/data"
+	"github.com/samedi/caldav-go/errs"
 	"github.com/samedi/caldav-go/global"
 	"github.com/samedi/caldav-go/ixml"
-	"github.com/samedi/caldav-go/lib"
+	"io"
 	"net/http"
+	"sort"
 )
 
 // Wraps a multistatus response. It contains the set of `Responses`
@@ -19,12 +21,19 @@ type multistatusResp struct {
 	// Flag that XML should be minimal or not
 	// [defined in the draft https://tools.ietf.org/html/draft-murchison-webdav-prefer-05]
 	Minimal bool
+	// The request context given to the property providers.
+	Context *PropertyContext
 }
 
 type msResponse struct {
 	Href      string
 	Found     bool
 	Propstats msPropstats
+	// Status of a response without propstats. Used only when `Found` is false
+	// and defaults to 404 when not set.
+	Status int
+	// Failed precondition reported in the <DAV:error> of a response without propstats.
+	Error *errs.PreconditionError
 }
 
 type msPropstats map[int]msProps
@@ -47,9 +56,11 @@ func (stats msPropstats) Clone() msPropstats {
 type msProps []msProp
 
 type msProp struct {
-	Tag      xml.Name
-	Content  string
-	Contents []string
+	Tag xml.Name
+	// Text content of the prop. It's escaped when written in the XML.
+	Content string
+	// Child elements of the prop.
+	Contents []ixml.Element
 	Status   int
 }
 
@@ -58,14 +69,19 @@ type msProp struct {
 // resource: the target calendar resource.
 // reqprops: set of required props that must be processed for the resource.
 // ## Returns
-// The set of props (msProp) processed. Each prop is mapped to a HTTP status code.
-// So if a prop is found and processed ok, it'll be mapped to 200. If it's not found,
+// The set of props (msProp) processed, each one computed by its registered `PropertyProvider`.
+// Each prop is mapped to a HTTP status code. So if a prop is found and processed ok, it'll be mapped to 200. If it's not found,
 // it'll be mapped to 404, and so on.
 func (ms *multistatusResp) Propstats(resource *data.Resource, reqprops []xml.Name) msPropstats {
 	if resource == nil {
 		return nil
 	}
 
+	ctx := ms.Context
+	if ctx == nil {
+		ctx = &PropertyContext{User: global.User}
+	}
+
 	result := make(msPropstats)
 
 	for _, ptag := range reqprops {
@@ -75,59 +91,10 @@ func (ms *multistatusResp) Propstats(resource *data.Resource, reqprops []xml.Nam
 		}
 
 		pfound := false
-		switch ptag {
-		case ixml.CALENDAR_DATA_TG:
-			pvalue.Content, pfound = resource.GetContentData()
-			if pfound {
-				pvalue.Content = ixml.EscapeText(pvalue.Content)
-			}
-		case ixml.GET_ETAG_TG:
-			pvalue.Content, pfound = resource.GetEtag()
-		case ixml.GET_CONTENT_TYPE_TG:
-			pvalue.Content, pfound = resource.GetContentType()
-		case ixml.GET_CONTENT_LENGTH_TG:
-			pvalue.Content, pfound = resource.GetContentLength()
-		case ixml.DISPLAY_NAME_TG:
-			pvalue.Content, pfound = resource.GetDisplayName()
-			if pfound {
-				pvalue.Content = ixml.EscapeText(pvalue.Content)
-			}
-		case ixml.GET_LAST_MODIFIED_TG:
-			pvalue.Content, pfound = resource.GetLastModified(http.TimeFormat)
-		case ixml.OWNER_TG:
-			pvalue.Content, pfound = resource.GetOwnerPath()
-		case ixml.GET_CTAG_TG:
-			pvalue.Content, pfound = resource.GetEtag()
-		case ixml.PRINCIPAL_URL_TG,
-			ixml.PRINCIPAL_COLLECTION_SET_TG,
-			ixml.CALENDAR_USER_ADDRESS_SET_TG,
-			ixml.CALENDAR_HOME_SET_TG:
-			pvalue.Content, pfound = ixml.HrefTag(resource.Path), true
-		case ixml.RESOURCE_TYPE_TG:
-			if resource.IsCollection() {
-				pvalue.Content, pfound = ixml.Tag(ixml.COLLECTION_TG, "")+ixml.Tag(ixml.CALENDAR_TG, ""), true
-
-				if resource.IsPrincipal() {
-					pvalue.Content += ixml.Tag(ixml.PRINCIPAL_TG, "")
-				}
-			} else {
-				// resourcetype must be returned empty for non-collection elements
-				pvalue.Content, pfound = "", true
-			}
-		case ixml.CURRENT_USER_PRINCIPAL_TG:
-			if global.User != nil {
-				path := fmt.Sprintf("/%s/", global.User.Name)
-				pvalue.Content, pfound = ixml.HrefTag(path), true
-			}
-		case ixml.SUPPORTED_CALENDAR_COMPONENT_SET_TG:
-			if resource.IsCollection() {
-				for _, component := range global.SupportedComponents {
-					// TODO: use ixml somehow to build the below tag
-					compTag := fmt.Sprintf(`<C:comp name="%s"/>`, component)
-					pvalue.Contents = append(pvalue.Contents, compTag)
-				}
-				pfound = true
-			}
+		if provider, found := GetPropertyProvider(ptag); found {
+			var value ixml.Element
+			value, pfound = provider.GetProperty(ctx, resource)
+			pvalue.Content, pvalue.Contents = value.Text, value.Children
 		}
 
 		if !pfound {
@@ -149,59 +116,132 @@ func (ms *multistatusResp) AddResponse(href string, found bool, propstats msProp
 	})
 }
 
+// Adds a new `msResponse` without propstats to the `Responses` array, carrying only the given status.
+func (ms *multistatusResp) AddStatusResponse(href string, status int) {
+	ms.Responses = append(ms.Responses, msResponse{
+		Href:   href,
+		Found:  false,
+		Status: status,
+	})
+}
+
+// Adds a new `msResponse` without propstats to the `Responses` array, carrying the status of the given error
+// and, when it is a failed precondition, the condition too.
+func (ms *multistatusResp) AddErrorResponse(href string, err error) {
+	perr, _ := err.(*errs.PreconditionError)
+
+	ms.Responses = append(ms.Responses, msResponse{
+		Href:   href,
+		Found:  false,
+		Status: errorStatus(err),
+		Error:  perr,
+	})
+}
+
+// ToXML returns the whole multistatus XML as a string.
 func (ms *multistatusResp) ToXML() string {
-	// init multistatus
-	var bf lib.StringBuffer
-	bf.Write(`<?xml version="1.0" encoding="UTF-8"?>`)
-	bf.Write(`<D:multistatus %s>`, ixml.Namespaces())
+	var buffer bytes.Buffer
+	ms.WriteXML(&buffer)
 
-	// iterate over event hrefs and build multistatus XML on the fly
+	return buffer.String()
+}
+
+// WriteXML writes the multistatus XML, with all its `Responses`, into the given writer.
+func (ms *multistatusResp) WriteXML(w io.Writer) error {
+	mw := ms.newWriter(w)
 	for _, response := range ms.Responses {
-		bf.Write("<D:response>")
-		bf.Write(ixml.HrefTag(response.Href))
+		mw.WriteResponse(response)
+	}
 
-		if response.Found {
-			propstats := response.Propstats.Clone()
+	return mw.Close()
+}
 
-			if ms.Minimal {
-				delete(propstats, http.StatusNotFound)
+// Writes the multistatus XML into a stream, one <DAV:response> at a time. This allows the handlers to
+// build and write each response on the fly, without keeping the whole multistatus in memory.
+type msWriter struct {
+	ms *multistatusResp
+	w  *ixml.Writer
+}
 
-				if len(propstats) == 0 {
-					bf.Write("<D:propstat>")
-					bf.Write("<D:prop/>")
-					bf.Write(ixml.StatusTag(http.StatusOK))
-					bf.Write("</D:propstat>")
-					bf.Write("</D:response>")
+// Initializes a new writer of the multistatus XML, which starts writing right away the XML header.
+// The writer must be closed after all the responses are written.
+func (ms *multistatusResp) newWriter(w io.Writer) *msWriter {
+	mw := &msWriter{ms, ixml.NewWriter(w)}
 
-					continue
-				}
-			}
+	mw.w.Header()
+	mw.w.Start(ixml.MULTISTATUS_TG)
+
+	return mw
+}
+
+// WriteResponse writes a single <DAV:response> node.
+func (mw *msWriter) WriteResponse(response msResponse) {
+	w := mw.w
+	w.Start(ixml.RESPONSE_TG)
+	w.Element(ixml.HrefElement(response.Href))
+
+	if response.Found {
+		propstats := response.Propstats.Clone()
 
-			for status, props := range propstats {
-				bf.Write("<D:propstat>")
-				bf.Write("<D:prop>")
-				for _, prop := range props {
-					bf.Write(ms.propToXML(prop))
-				}
-				bf.Write("</D:prop>")
-				bf.Write(ixml.StatusTag(status))
-				bf.Write("</D:propstat>")
+		if mw.ms.Minimal {
+			delete(propstats, http.StatusNotFound)
+
+			if len(propstats) == 0 {
+				w.Element(ixml.NewElement(ixml.PROPSTAT_TG, ixml.NewElement(ixml.PROP_TG), ixml.StatusElement(http.StatusOK)))
+				w.End()
+
+				return
 			}
-		} else {
-			// if does not find the resource set 404
-			bf.Write(ixml.StatusTag(http.StatusNotFound))
 		}
-		bf.Write("</D:response>")
+
+		writePropstats(w, propstats)
+	} else {
+		// if does not find the resource set 404, unless a specific status was given
+		status := response.Status
+		if status == 0 {
+			status = http.StatusNotFound
+		}
+		w.Element(ixml.StatusElement(status))
+
+		if response.Error != nil {
+			w.Element(ixml.NewElement(ixml.ERROR_TG, ixml.NewElement(response.Error.Condition, response.Error.Content...)))
+		}
+	}
+
+	w.End()
+}
+
+// Writes the <DAV:propstat> nodes, sorted by status so that the output is always the same.
+func writePropstats(w *ixml.Writer, propstats msPropstats) {
+	statuses := make([]int, 0, len(propstats))
+	for status := range propstats {
+		statuses = append(statuses, status)
+	}
+	sort.Ints(statuses)
+
+	for _, status := range statuses {
+		w.Start(ixml.PROPSTAT_TG)
+		w.Start(ixml.PROP_TG)
+		for _, prop := range propstats[status] {
+			w.Element(prop.toElement())
+		}
+		w.End()
+		w.Element(ixml.StatusElement(status))
+		w.End()
 	}
-	bf.Write("</D:multistatus>")
+}
+
+// Close finishes the multistatus XML and flushes any pending data to the underlying stream.
+func (mw *msWriter) Close() error {
+	mw.w.End()
 
-	return bf.String()
+	return mw.w.Flush()
 }
 
-func (ms *multistatusResp) propToXML(prop msProp) string {
-	for _, content := range prop.Contents {
-		prop.Content += content
+func (prop msProp) toElement() ixml.Element {
+	return ixml.Element{
+		XMLName:  prop.Tag,
+		Text:     prop.Content,
+		Children: prop.Contents,
 	}
-	xmlString := ixml.Tag(prop.Tag, prop.Content)
-	return xmlString
 }
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"net/http"
+	"strings"
 )
 
 type optionsHandler struct {
@@ -9,14 +10,21 @@ type optionsHandler struct {
 }
 
 // Returns the allowed methods and the DAV features implemented by the current server.
+// The allowed methods are the ones with a registered handler.
 // For more information about the values and format read RFC4918 Sections 10.1 and 18.
 func (oh optionsHandler) Handle() *Response {
 	// Set the DAV compliance header:
 	// 1: Server supports all the requirements specified in RFC2518
 	// 3: Server supports all the revisions specified in RFC4918
 	// calendar-access: Server supports all the extensions specified in RFC4791
-	oh.response.SetHeader("DAV", "1, 3, calendar-access").
-		SetHeader("Allow", "GET, HEAD, PUT, DELETE, OPTIONS, PROPFIND, REPORT").
+	// calendar-auto-schedule: Server supports the scheduling extensions specified in RFC6638, when enabled
+	dav := "1, 3, calendar-access"
+	if oh.scheduler() != nil {
+		dav += ", calendar-auto-schedule"
+	}
+
+	oh.response.SetHeader("DAV", dav).
+		SetHeader("Allow", strings.Join(RegisteredMethods(), ", ")).
 		Set(http.StatusOK, "")
 
 	return oh.response
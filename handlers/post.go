@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+
+	"github.com/samedi/caldav-go/errs"
+	"github.com/samedi/caldav-go/global"
+	"github.com/samedi/caldav-go/ics"
+	"github.com/samedi/caldav-go/itip"
+	"github.com/samedi/caldav-go/ixml"
+)
+
+type postHandler struct {
+	handlerData
+}
+
+// The result of delivering a scheduling message to one of its recipients. The calendar data is
+// the answer of the recipient, e.g. to a free-busy request.
+type scheduleResult struct {
+	recipient    string
+	status       string
+	calendarData string
+}
+
+// Handles the POST requests to the scheduling outbox (RFC6638#5), used by the calendar user to send iTIP messages
+// explicitly. The message is delivered to its recipients, which are the attendees when sent by the organizer
+// or the organizer when sent by an attendee. The response lists the delivery status for each recipient.
+// Free-busy requests (a REQUEST with a VFREEBUSY) are answered right away with the free-busy time of the attendees.
+// Only the owner of the outbox, who must be the current user (`global.User`), can send messages through it.
+func (ph postHandler) Handle() *Response {
+	sched := ph.scheduler()
+	if sched == nil || !isScheduleBox(ph.requestPath, ScheduleOutboxName) {
+		return ph.response.Set(http.StatusMethodNotAllowed, "")
+	}
+
+	owner, found := sched.pathUser(ph.requestPath)
+	if !found || global.User == nil || global.User.Name != owner.Name {
+		return ph.response.SetError(errs.ForbiddenError)
+	}
+
+	msg, err := ics.Parse(ph.requestBody)
+	if err != nil {
+		return ph.response.SetError(errs.NewPreconditionError(http.StatusForbidden, ixml.VALID_CALENDAR_DATA_TG))
+	}
+
+	organizer := itip.Organizer(msg)
+	if itip.UID(msg) == "" || organizer == "" {
+		return ph.response.SetError(errs.NewPreconditionError(http.StatusForbidden, ixml.VALID_SCHEDULING_MESSAGE_TG))
+	}
+
+	if _, ok := itip.FreeBusyRequest(msg); ok {
+		if !owner.HasAddress(organizer) {
+			return ph.response.SetError(errs.NewPreconditionError(http.StatusForbidden, ixml.ORGANIZER_ALLOWED_TG))
+		}
+
+		results, ok := sched.freeBusy(owner, msg)
+		if !ok {
+			return ph.response.SetError(errs.NewPreconditionError(http.StatusForbidden, ixml.VALID_SCHEDULING_MESSAGE_TG))
+		}
+
+		return ph.scheduleResponse(results)
+	}
+
+	var recipients []string
+	switch msg.PropString("METHOD", "") {
+	case itip.MethodRequest, itip.MethodCancel, itip.MethodAdd, itip.MethodDeclineCounter:
+		// only the organizer can send these messages to the attendees
+		if !owner.HasAddress(organizer) {
+			return ph.response.SetError(errs.NewPreconditionError(http.StatusForbidden, ixml.ORGANIZER_ALLOWED_TG))
+		}
+		recipients = sched.scheduledAttendees(msg, organizer)
+	case itip.MethodReply, itip.MethodCounter, itip.MethodRefresh:
+		// only an attendee can send these messages to the organizer, and only reply for itself
+		attendee, found := userAttendee(msg, owner)
+		if !found {
+			return ph.response.SetError(errs.NewPreconditionError(http.StatusForbidden, ixml.ATTENDEE_ALLOWED_TG))
+		}
+		if msg.PropString("METHOD", "") == itip.MethodReply {
+			msg = itip.NewReply(msg, attendee)
+		}
+		recipients = []string{organizer}
+	default:
+		return ph.response.SetError(errs.NewPreconditionError(http.StatusForbidden, ixml.VALID_SCHEDULING_MESSAGE_TG))
+	}
+
+	results := []scheduleResult{}
+	for _, recipient := range recipients {
+		results = append(results, scheduleResult{recipient: recipient, status: sched.deliver(recipient, msg)})
+	}
+
+	return ph.scheduleResponse(results)
+}
+
+func (ph postHandler) scheduleResponse(results []scheduleResult) *Response {
+	return ph.response.SetHeader("Content-Type", "application/xml; charset=utf-8").
+		Set(http.StatusOK, scheduleResponseXML(results))
+}
+
+// Builds the <C:schedule-response> XML, with the delivery status for each recipient.
+func scheduleResponseXML(results []scheduleResult) string {
+	var buffer bytes.Buffer
+	w := ixml.NewWriter(&buffer)
+
+	w.Header()
+	w.Start(ixml.SCHEDULE_RESPONSE_TG)
+	for _, result := range results {
+		response := ixml.NewElement(ixml.CALDAV_RESPONSE_TG,
+			ixml.NewElement(ixml.RECIPIENT_TG, ixml.HrefElement(result.recipient)),
+			ixml.NewTextElement(ixml.REQUEST_STATUS_TG, itip.RequestStatus(result.status)),
+		)
+		if result.calendarData != "" {
+			response.Children = append(response.Children, ixml.NewTextElement(ixml.CALENDAR_DATA_TG, result.calendarData))
+		}
+		w.Element(response)
+	}
+	w.End()
+	w.Flush()
+
+	return buffer.String()
+}
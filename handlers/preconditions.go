@@ -1,23 +1,186 @@
 package handlers
 
 import (
+	"fmt"
 	"net/http"
+	"strings"
+	"time"
+
+	"github.com/samedi/caldav-go/data"
+	"github.com/samedi/caldav-go/ics"
+	"github.com/samedi/caldav-go/jscalendar"
 )
 
 type requestPreconditions struct {
 	request *http.Request
+	// the media type of the representation whose entity tag the conditions are evaluated against,
+	// the iCalendar one when empty
+	mediaType string
+}
+
+// Evaluate evaluates all the conditional headers of the request (If-Match, If-None-Match, If-Modified-Since
+// and If-Unmodified-Since) against the current state of the target `resource`, following the precedence
+// described in RFC7232#section-6. The `resource` is nil when it does not exist. It returns 0 if the request
+// can proceed, or the status the request must be answered with otherwise: 304 (Not Modified) for GET
+// and HEAD requests or 412 (Precondition Failed).
+// The date conditions are not evaluated for collections, whose modification time does not change when
+// their calendar objects are edited. The entity tags are compared against the one of the selected representation.
+func (p *requestPreconditions) Evaluate(resource *data.Resource) int {
+	var etag string
+	var lastModified time.Time
+	var hasLastModified bool
+
+	if resource != nil {
+		etag = representationEtag(resource, p.mediaType)
+		if !resource.IsCollection() {
+			lastModified, hasLastModified = resource.GetLastModifiedTime()
+		}
+	}
+
+	// 1. If-Match
+	if p.present("If-Match") {
+		if !p.etagsMatch("If-Match", resource != nil, etag, true) {
+			return http.StatusPreconditionFailed
+		}
+	} else if since, ok := p.date("If-Unmodified-Since"); ok && hasLastModified {
+		// 2. If-Unmodified-Since, only evaluated when If-Match is not present
+		if lastModified.Truncate(time.Second).After(since) {
+			return http.StatusPreconditionFailed
+		}
+	}
+
+	// 3. If-None-Match
+	if p.present("If-None-Match") {
+		if p.etagsMatch("If-None-Match", resource != nil, etag, false) {
+			if p.isSafeMethod() {
+				return http.StatusNotModified
+			}
+			return http.StatusPreconditionFailed
+		}
+	} else if since, ok := p.date("If-Modified-Since"); ok && hasLastModified && p.isSafeMethod() {
+		// 4. If-Modified-Since, only evaluated for GET and HEAD and when If-None-Match is not present
+		if !lastModified.Truncate(time.Second).After(since) {
+			return http.StatusNotModified
+		}
+	}
+
+	return 0
+}
+
+// checkPreconditions evaluates the request preconditions against the target `resource` (nil when it does not exist).
+// It returns the response to be sent back when they fail, or nil when the request can proceed.
+func (h handlerData) checkPreconditions(resource *data.Resource) *Response {
+	return h.checkRepresentationPreconditions(resource, "")
+}
+
+// checkRepresentationPreconditions evaluates the request preconditions against the representation of the
+// target `resource` in the given `mediaType`, e.g. the jCal one.
+func (h handlerData) checkRepresentationPreconditions(resource *data.Resource, mediaType string) *Response {
+	precond := requestPreconditions{h.request, mediaType}
+
+	status := precond.Evaluate(resource)
+	if status == 0 {
+		return nil
+	}
+
+	if status == http.StatusNotModified {
+		etag := representationEtag(resource, mediaType)
+		lastm, _ := resource.GetLastModified(http.TimeFormat)
+		h.response.SetHeader("ETag", etag).SetHeader("Last-Modified", lastm)
+	}
+
+	return h.response.Set(status, "")
+}
+
+// The suffixes of the entity tags of the representations other than iCalendar.
+var representationEtagSuffixes = map[string]string{
+	ics.MediaTypeJCal:    "jcal",
+	ics.MediaTypeXCal:    "xcal",
+	jscalendar.MediaType: "jscalendar",
+}
+
+// Returns the entity tag of the representation of the `resource` in the given `mediaType`. Each format has
+// its own strong entity tag, derived from the one of the iCalendar data. [See RFC7232#section-2.3.3]
+func representationEtag(resource *data.Resource, mediaType string) string {
+	etag, _ := resource.GetEtag()
+	suffix, found := representationEtagSuffixes[mediaType]
+	if etag == "" || !found {
+		return etag
+	}
+
+	weak, value := splitEtag(etag)
+	value = fmt.Sprintf(`"%s-%s"`, strings.Trim(value, `"`), suffix)
+	if weak {
+		return "W/" + value
+	}
+
+	return value
 }
 
-func (p *requestPreconditions) IfMatch(etag string) bool {
-	etagMatch := p.request.Header["If-Match"]
-	return len(etagMatch) == 0 || etagMatch[0] == "*" || etagMatch[0] == etag
+func (p *requestPreconditions) present(header string) bool {
+	return len(p.request.Header[header]) != 0
 }
 
-func (p *requestPreconditions) IfMatchPresent() bool {
-	return len(p.request.Header["If-Match"]) != 0
+func (p *requestPreconditions) isSafeMethod() bool {
+	return p.request.Method == "GET" || p.request.Method == "HEAD"
 }
 
-func (p *requestPreconditions) IfNoneMatch(value string) bool {
-	valueMatch := p.request.Header["If-None-Match"]
-	return len(valueMatch) == 1 && valueMatch[0] == value
+// Checks if any of the entity tags listed in the `header` matches the resource `etag`. The `*` value
+// matches any existing resource. The If-Match header uses the strong comparison, while the If-None-Match
+// uses the weak comparison. [See RFC7232#section-2.3.2]
+func (p *requestPreconditions) etagsMatch(header string, exists bool, etag string, strong bool) bool {
+	for _, value := range p.request.Header[header] {
+		for _, requested := range strings.Split(value, ",") {
+			requested = strings.TrimSpace(requested)
+
+			if requested == "*" {
+				if exists {
+					return true
+				}
+				continue
+			}
+
+			if exists && etag != "" && compareEtags(requested, etag, strong) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Returns the date in the `header` and whether it is present and valid. Invalid dates are ignored. [See RFC7232#section-3.3]
+func (p *requestPreconditions) date(header string) (time.Time, bool) {
+	value := p.request.Header.Get(header)
+	if value == "" {
+		return time.Time{}, false
+	}
+
+	date, err := http.ParseTime(value)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return date, true
+}
+
+// Compares two entity tags. In the strong comparison, both tags must not be weak and their opaque values
+// must be equal. In the weak comparison, only the opaque values must be equal.
+func compareEtags(a, b string, strong bool) bool {
+	aWeak, aValue := splitEtag(a)
+	bWeak, bValue := splitEtag(b)
+
+	if strong && (aWeak || bWeak) {
+		return false
+	}
+
+	return aValue == bValue
+}
+
+func splitEtag(etag string) (weak bool, value string) {
+	if strings.HasPrefix(etag, "W/") {
+		return true, etag[2:]
+	}
+
+	return false, etag
 }
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/samedi/caldav-go/data"
+	"github.com/samedi/caldav-go/ics"
+	"github.com/samedi/caldav-go/jscalendar"
+	"github.com/samedi/caldav-go/test"
+)
+
+func TestEvaluatePreconditions(t *testing.T) {
+	modTime := time.Date(2016, 9, 14, 17, 0, 0, 0, time.UTC)
+	before := modTime.Add(-time.Hour).Format(http.TimeFormat)
+	after := modTime.Add(time.Hour).Format(http.TimeFormat)
+	resource := data.NewResource("/foo/bar.ics", fakeAdapter{etag: `"123"`, modTime: modTime})
+
+	tests := []struct {
+		method   string
+		headers  map[string]string
+		exists   bool
+		expected int
+	}{
+		// no conditional headers
+		{"GET", map[string]string{}, true, 0},
+		// If-Match: lists, `*` and strong comparison
+		{"PUT", map[string]string{"If-Match": `"123"`}, true, 0},
+		{"PUT", map[string]string{"If-Match": `"456", "123"`}, true, 0},
+		{"PUT", map[string]string{"If-Match": `"456"`}, true, http.StatusPreconditionFailed},
+		{"PUT", map[string]string{"If-Match": `W/"123"`}, true, http.StatusPreconditionFailed},
+		{"PUT", map[string]string{"If-Match": `*`}, true, 0},
+		{"PUT", map[string]string{"If-Match": `*`}, false, http.StatusPreconditionFailed},
+		// If-None-Match: 304 for GET/HEAD, 412 for others and weak comparison
+		{"GET", map[string]string{"If-None-Match": `"123"`}, true, http.StatusNotModified},
+		{"HEAD", map[string]string{"If-None-Match": `W/"123"`}, true, http.StatusNotModified},
+		{"GET", map[string]string{"If-None-Match": `"456"`}, true, 0},
+		{"PUT", map[string]string{"If-None-Match": `*`}, true, http.StatusPreconditionFailed},
+		{"PUT", map[string]string{"If-None-Match": `*`}, false, 0},
+		// If-Modified-Since: only for GET/HEAD
+		{"GET", map[string]string{"If-Modified-Since": after}, true, http.StatusNotModified},
+		{"GET", map[string]string{"If-Modified-Since": modTime.Format(http.TimeFormat)}, true, http.StatusNotModified},
+		{"GET", map[string]string{"If-Modified-Since": before}, true, 0},
+		{"DELETE", map[string]string{"If-Modified-Since": after}, true, 0},
+		{"GET", map[string]string{"If-Modified-Since": "invalid date"}, true, 0},
+		// If-Unmodified-Since
+		{"PUT", map[string]string{"If-Unmodified-Since": before}, true, http.StatusPreconditionFailed},
+		{"PUT", map[string]string{"If-Unmodified-Since": after}, true, 0},
+		// precedence: If-None-Match wins over If-Modified-Since and If-Match over If-Unmodified-Since
+		{"GET", map[string]string{"If-None-Match": `"456"`, "If-Modified-Since": after}, true, 0},
+		{"PUT", map[string]string{"If-Match": `"123"`, "If-Unmodified-Since": before}, true, 0},
+		{"GET", map[string]string{"If-Match": `"456"`, "If-None-Match": `"123"`}, true, http.StatusPreconditionFailed},
+	}
+
+	for i, tt := range tests {
+		request := &http.Request{Method: tt.method, Header: make(http.Header)}
+		for k, v := range tt.headers {
+			request.Header.Set(k, v)
+		}
+
+		target := &resource
+		if !tt.exists {
+			target = nil
+		}
+
+		precond := requestPreconditions{request: request}
+		if !test.AssertInt(precond.Evaluate(target), tt.expected, t) {
+			t.Log("Failed test case", i, tt.method, tt.headers)
+		}
+	}
+
+	// each representation has its own entity tag
+	for mediaType, etag := range map[string]string{"": `"123"`, ics.MediaTypeJCal: `"123-jcal"`, jscalendar.MediaType: `"123-jscalendar"`} {
+		request := &http.Request{Method: "GET", Header: make(http.Header)}
+		request.Header.Set("If-None-Match", etag)
+
+		precond := requestPreconditions{request, mediaType}
+		test.AssertInt(precond.Evaluate(&resource), http.StatusNotModified, t)
+		test.AssertStr(representationEtag(&resource, mediaType), etag, t)
+
+		request.Header.Set("If-None-Match", `"123-xcal"`)
+		test.AssertInt(precond.Evaluate(&resource), 0, t)
+	}
+
+	// the dates are ignored for collections, whose content can change without changing their modification time
+	collection := data.NewResource("/foo/", fakeAdapter{collection: true, modTime: modTime})
+	for header, value := range map[string]string{"If-Modified-Since": after, "If-Unmodified-Since": before} {
+		request := &http.Request{Method: "GET", Header: make(http.Header)}
+		request.Header.Set(header, value)
+
+		precond := requestPreconditions{request: request}
+		test.AssertInt(precond.Evaluate(&collection), 0, t)
+	}
+}
+
+type fakeAdapter struct {
+	collection bool
+	etag       string
+	content    string
+	modTime    time.Time
+}
+
+func (adp fakeAdapter) IsCollection() bool {
+	return adp.collection
+}
+
+func (adp fakeAdapter) CalculateEtag() string {
+	return adp.etag
+}
+
+func (adp fakeAdapter) GetContent() string {
+	return adp.content
+}
+
+func (adp fakeAdapter) GetContentSize() int64 {
+	return int64(len(adp.content))
+}
+
+func (adp fakeAdapter) GetModTime() time.Time {
+	return adp.modTime
+}
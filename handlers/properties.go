@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/samedi/caldav-go/data"
+	"github.com/samedi/caldav-go/global"
+	"github.com/samedi/caldav-go/ics"
+	"github.com/samedi/caldav-go/ixml"
+)
+
+// PropertyContext holds the data of the current request that is made available to the property providers.
+type PropertyContext struct {
+	Request *http.Request
+	Storage data.Storage
+	User    *data.CalUser
+	// The media type of the calendar data requested, e.g. "application/calendar+json" for jCal.
+	// Empty means iCalendar.
+	CalendarDataType string
+}
+
+// PropertyProvider computes the value of a WebDAV property for a resource. The providers are registered per
+// property name through `RegisterPropertyProvider` and are used to build the PROPFIND and REPORT responses.
+type PropertyProvider interface {
+	// GetProperty returns the content of the property for the given resource and a flag saying if the property
+	// is defined for the resource. The name of the returned element is ignored, only its content is used.
+	GetProperty(ctx *PropertyContext, resource *data.Resource) (ixml.Element, bool)
+}
+
+// PropertySetter is an optional interface a `PropertyProvider` can implement when the property can be
+// changed by the clients through PROPPATCH requests. Properties without a setter are protected.
+type PropertySetter interface {
+	// SetProperty sets the property of the given resource with the `value` sent by the client. A nil `value` means
+	// the property must be removed. Errors are reported back to the client for that property, e.g.: returning
+	// `errs.ForbiddenError` results in a 403 status or a `errs.PreconditionError` results in its status.
+	SetProperty(ctx *PropertyContext, resource *data.Resource, value *ixml.Element) error
+}
+
+// PropertyGetterFunc is an adapter to allow the use of ordinary functions as read-only property providers.
+type PropertyGetterFunc func(ctx *PropertyContext, resource *data.Resource) (ixml.Element, bool)
+
+// GetProperty calls `f(ctx, resource)`.
+func (f PropertyGetterFunc) GetProperty(ctx *PropertyContext, resource *data.Resource) (ixml.Element, bool) {
+	return f(ctx, resource)
+}
+
+var (
+	propertyProviders     = make(map[xml.Name]PropertyProvider)
+	propertyProvidersLock sync.RWMutex
+)
+
+// RegisterPropertyProvider registers the provider for the property with the given name. If there was
+// already a provider for the property, including the built-in ones, it is replaced by the new provider.
+func RegisterPropertyProvider(name xml.Name, provider PropertyProvider) {
+	propertyProvidersLock.Lock()
+	defer propertyProvidersLock.Unlock()
+
+	propertyProviders[name] = provider
+}
+
+// UnregisterPropertyProvider removes the provider of the property with the given name, which
+// will then be reported as not found.
+func UnregisterPropertyProvider(name xml.Name) {
+	propertyProvidersLock.Lock()
+	defer propertyProvidersLock.Unlock()
+
+	delete(propertyProviders, name)
+}
+
+// GetPropertyProvider returns the provider registered for the property with the given name and a flag saying if it was found.
+func GetPropertyProvider(name xml.Name) (PropertyProvider, bool) {
+	propertyProvidersLock.RLock()
+	defer propertyProvidersLock.RUnlock()
+
+	provider, found := propertyProviders[name]
+	return provider, found
+}
+
+// Builds the property context out of the handler data.
+func (h handlerData) propertyContext() *PropertyContext {
+	return &PropertyContext{
+		Request: h.request,
+		Storage: h.storage,
+		User:    global.User,
+	}
+}
+
+// The built-in properties.
+func init() {
+	// returns a provider for a text property, which uses the given resource getter to compute the text
+	text := func(getter func(resource *data.Resource) (string, bool)) PropertyProvider {
+		return PropertyGetterFunc(func(ctx *PropertyContext, resource *data.Resource) (ixml.Element, bool) {
+			value, found := getter(resource)
+			return ixml.Element{Text: value}, found
+		})
+	}
+
+	// returns a provider for a property with a <DAV:href> to the resource path
+	resourceHref := PropertyGetterFunc(func(ctx *PropertyContext, resource *data.Resource) (ixml.Element, bool) {
+		return ixml.NewElement(xml.Name{}, ixml.HrefElement(resource.Path)), true
+	})
+
+	RegisterPropertyProvider(ixml.CALENDAR_DATA_TG, PropertyGetterFunc(func(ctx *PropertyContext, resource *data.Resource) (ixml.Element, bool) {
+		content, found := resource.GetContentData()
+		if !found || ctx.CalendarDataType == "" || ctx.CalendarDataType == ics.MediaTypeICalendar {
+			return ixml.Element{Text: content}, found
+		}
+
+		// the data that cannot be converted, i.e. that is not valid iCalendar, is reported as it is
+		converted, err := ics.ConvertTo(content, ctx.CalendarDataType)
+		if err != nil {
+			log.Printf("WARNING: Reporting resource with invalid iCal data as it is.\nError: %s.\nResource path: %s", err, resource.Path)
+			return ixml.Element{Text: content}, true
+		}
+
+		return ixml.Element{Text: converted}, true
+	}))
+	RegisterPropertyProvider(ixml.GET_ETAG_TG, text((*data.Resource).GetEtag))
+	RegisterPropertyProvider(ixml.GET_CONTENT_TYPE_TG, text((*data.Resource).GetContentType))
+	RegisterPropertyProvider(ixml.GET_CONTENT_LENGTH_TG, text((*data.Resource).GetContentLength))
+	RegisterPropertyProvider(ixml.DISPLAY_NAME_TG, text((*data.Resource).GetDisplayName))
+	RegisterPropertyProvider(ixml.OWNER_TG, text((*data.Resource).GetOwnerPath))
+	RegisterPropertyProvider(ixml.GET_CTAG_TG, text((*data.Resource).GetEtag))
+	RegisterPropertyProvider(ixml.GET_LAST_MODIFIED_TG, text(func(resource *data.Resource) (string, bool) {
+		return resource.GetLastModified(http.TimeFormat)
+	}))
+
+	RegisterPropertyProvider(ixml.PRINCIPAL_URL_TG, resourceHref)
+	RegisterPropertyProvider(ixml.PRINCIPAL_COLLECTION_SET_TG, resourceHref)
+	RegisterPropertyProvider(ixml.CALENDAR_USER_ADDRESS_SET_TG, PropertyGetterFunc(func(ctx *PropertyContext, resource *data.Resource) (ixml.Element, bool) {
+		value, _ := resourceHref(ctx, resource)
+
+		// the addresses of the user are known only when scheduling is enabled
+		if global.UserDirectory != nil {
+			if user, found := global.UserDirectory.GetUser(splitPath(resource.Path)[0]); found {
+				for _, address := range user.Addresses {
+					value.Children = append(value.Children, ixml.HrefElement(address))
+				}
+			}
+		}
+
+		return value, true
+	}))
+	RegisterPropertyProvider(ixml.CALENDAR_HOME_SET_TG, resourceHref)
+
+	// returns a provider for a property with a <DAV:href> to the scheduling box of the resource's user
+	scheduleBoxHref := func(boxPath func(username string) string) PropertyProvider {
+		return PropertyGetterFunc(func(ctx *PropertyContext, resource *data.Resource) (ixml.Element, bool) {
+			if global.UserDirectory == nil {
+				return ixml.Element{}, false
+			}
+
+			return ixml.NewElement(xml.Name{}, ixml.HrefElement(boxPath(splitPath(resource.Path)[0])+"/")), true
+		})
+	}
+
+	RegisterPropertyProvider(ixml.SCHEDULE_INBOX_URL_TG, scheduleBoxHref(ScheduleInboxPath))
+	RegisterPropertyProvider(ixml.SCHEDULE_OUTBOX_URL_TG, scheduleBoxHref(ScheduleOutboxPath))
+
+	RegisterPropertyProvider(ixml.RESOURCE_TYPE_TG, PropertyGetterFunc(func(ctx *PropertyContext, resource *data.Resource) (ixml.Element, bool) {
+		// resourcetype must be returned empty for non-collection elements
+		if !resource.IsCollection() {
+			return ixml.Element{}, true
+		}
+
+		value := ixml.NewElement(xml.Name{}, ixml.NewElement(ixml.COLLECTION_TG))
+		switch {
+		case isScheduleBox(resource.Path, ScheduleInboxName):
+			value.Children = append(value.Children, ixml.NewElement(ixml.SCHEDULE_INBOX_TG))
+		case isScheduleBox(resource.Path, ScheduleOutboxName):
+			value.Children = append(value.Children, ixml.NewElement(ixml.SCHEDULE_OUTBOX_TG))
+		default:
+			value.Children = append(value.Children, ixml.NewElement(ixml.CALENDAR_TG))
+		}
+
+		if resource.IsPrincipal() {
+			value.Children = append(value.Children, ixml.NewElement(ixml.PRINCIPAL_TG))
+		}
+
+		return value, true
+	}))
+
+	RegisterPropertyProvider(ixml.CURRENT_USER_PRINCIPAL_TG, PropertyGetterFunc(func(ctx *PropertyContext, resource *data.Resource) (ixml.Element, bool) {
+		if ctx.User == nil {
+			return ixml.Element{}, false
+		}
+
+		path := fmt.Sprintf("/%s/", ctx.User.Name)
+		return ixml.NewElement(xml.Name{}, ixml.HrefElement(path)), true
+	}))
+
+	RegisterPropertyProvider(ixml.SUPPORTED_CALENDAR_COMPONENT_SET_TG, PropertyGetterFunc(func(ctx *PropertyContext, resource *data.Resource) (ixml.Element, bool) {
+		if !resource.IsCollection() {
+			return ixml.Element{}, false
+		}
+
+		value := ixml.NewElement(xml.Name{})
+		for _, component := range global.SupportedComponents {
+			compTag := ixml.NewElement(ixml.COMP_TG)
+			compTag.Attrs = []xml.Attr{{Name: xml.Name{Local: "name"}, Value: component}}
+			value.Children = append(value.Children, compTag)
+		}
+
+		return value, true
+	}))
+}
@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"encoding/xml"
+	"net/http"
+	"testing"
+
+	"github.com/samedi/caldav-go/data"
+	"github.com/samedi/caldav-go/errs"
+	"github.com/samedi/caldav-go/ixml"
+	"github.com/samedi/caldav-go/test"
+)
+
+var calendarColorTG = xml.Name{Space: "http://apple.com/ns/ical/", Local: "calendar-color"}
+
+// Provider of a writable property, which keeps the values in memory.
+type colorProvider map[string]string
+
+func (p colorProvider) GetProperty(ctx *PropertyContext, resource *data.Resource) (ixml.Element, bool) {
+	color, found := p[resource.Path]
+	return ixml.Element{Text: color}, found
+}
+
+func (p colorProvider) SetProperty(ctx *PropertyContext, resource *data.Resource, value *ixml.Element) error {
+	if value == nil {
+		delete(p, resource.Path)
+	} else {
+		p[resource.Path] = value.Text
+	}
+
+	return nil
+}
+
+// Provider of a property whose setter always fails.
+type readOnlyProvider struct{}
+
+func (p readOnlyProvider) GetProperty(ctx *PropertyContext, resource *data.Resource) (ixml.Element, bool) {
+	return ixml.Element{}, false
+}
+
+func (p readOnlyProvider) SetProperty(ctx *PropertyContext, resource *data.Resource, value *ixml.Element) error {
+	return errs.ForbiddenError
+}
+
+func TestPropertyProviders(t *testing.T) {
+	colors := colorProvider{"/foo": "#FF0000"}
+	RegisterPropertyProvider(calendarColorTG, colors)
+	defer UnregisterPropertyProvider(calendarColorTG)
+
+	// overrides a built-in property
+	displayName, _ := GetPropertyProvider(ixml.DISPLAY_NAME_TG)
+	RegisterPropertyProvider(ixml.DISPLAY_NAME_TG, PropertyGetterFunc(func(ctx *PropertyContext, resource *data.Resource) (ixml.Element, bool) {
+		return ixml.Element{Text: "My calendar"}, true
+	}))
+	defer RegisterPropertyProvider(ixml.DISPLAY_NAME_TG, displayName)
+
+	resource := data.NewResource("/foo/", fakeAdapter{collection: true})
+	ms := &multistatusResp{Context: &PropertyContext{}}
+	ms.AddResponse(resource.Path, true, ms.Propstats(&resource, []xml.Name{calendarColorTG, ixml.DISPLAY_NAME_TG, {Space: "urn:foo", Local: "unknown"}}))
+
+	expected := `
+  <?xml version="1.0" encoding="UTF-8"?>
+  <D:multistatus xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav" xmlns:CS="http://calendarserver.org/ns/">
+    <D:response>
+      <D:href>/foo</D:href>
+      <D:propstat>
+        <D:prop>
+          <x1:calendar-color xmlns:x1="http://apple.com/ns/ical/">#FF0000</x1:calendar-color>
+          <D:displayname>My calendar</D:displayname>
+        </D:prop>
+        <D:status>HTTP/1.1 200 OK</D:status>
+      </D:propstat>
+      <D:propstat>
+        <D:prop>
+          <x2:unknown xmlns:x2="urn:foo"/>
+        </D:prop>
+        <D:status>HTTP/1.1 404 Not Found</D:status>
+      </D:propstat>
+    </D:response>
+  </D:multistatus>`
+
+	test.AssertMultistatusXML(ms.ToXML(), expected, t)
+}
+
+func TestPropPatch(t *testing.T) {
+	colors := colorProvider{}
+	RegisterPropertyProvider(calendarColorTG, colors)
+	defer UnregisterPropertyProvider(calendarColorTG)
+
+	stg := test.NewFakeStorage()
+	stg.AddFakeResource("/test-data/proppatch/", "123-456-789.ics", "BEGIN:VEVENT\nSUMMARY:Party\nEND:VEVENT")
+
+	proppatch := func(body string) *Response {
+		handler := proppatchHandler{
+			handlerData{
+				request:     &http.Request{Header: make(http.Header)},
+				requestBody: body,
+				requestPath: "/test-data/proppatch/",
+				response:    NewResponse(),
+				storage:     stg,
+			},
+		}
+
+		return handler.Handle()
+	}
+
+	// Test 1: when one of the properties is protected, nothing is changed
+	resp := proppatch(`
+  <D:propertyupdate xmlns:D="DAV:" xmlns:A="http://apple.com/ns/ical/">
+    <D:set><D:prop><A:calendar-color>#00FF00</A:calendar-color></D:prop></D:set>
+    <D:remove><D:prop><D:getetag/></D:prop></D:remove>
+  </D:propertyupdate>`)
+
+	expected := `
+  <?xml version="1.0" encoding="UTF-8"?>
+  <D:multistatus xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav" xmlns:CS="http://calendarserver.org/ns/">
+    <D:response>
+      <D:href>/test-data/proppatch</D:href>
+      <D:propstat>
+        <D:prop>
+          <D:getetag/>
+        </D:prop>
+        <D:status>HTTP/1.1 403 Forbidden</D:status>
+      </D:propstat>
+      <D:propstat>
+        <D:prop>
+          <x1:calendar-color xmlns:x1="http://apple.com/ns/ical/"/>
+        </D:prop>
+        <D:status>HTTP/1.1 424 Failed Dependency</D:status>
+      </D:propstat>
+    </D:response>
+  </D:multistatus>`
+
+	test.AssertInt(resp.Status, http.StatusMultiStatus, t)
+	test.AssertMultistatusXML(resp.BodyString(), expected, t)
+	test.AssertInt(len(colors), 0, t)
+
+	// Test 2: the properties are set and removed in the order given in the request
+	resp = proppatch(`
+  <D:propertyupdate xmlns:D="DAV:" xmlns:A="http://apple.com/ns/ical/">
+    <D:remove><D:prop><A:calendar-color/></D:prop></D:remove>
+    <D:set><D:prop><A:calendar-color>#00FF00</A:calendar-color></D:prop></D:set>
+  </D:propertyupdate>`)
+
+	test.AssertInt(resp.Status, http.StatusMultiStatus, t)
+	test.AssertStr(colors["/test-data/proppatch"], "#00FF00", t)
+
+	// Test 3: when a setter fails, the properties already changed are restored
+	readOnlyTG := xml.Name{Space: "urn:foo", Local: "read-only"}
+	RegisterPropertyProvider(readOnlyTG, readOnlyProvider{})
+	defer UnregisterPropertyProvider(readOnlyTG)
+
+	resp = proppatch(`
+  <D:propertyupdate xmlns:D="DAV:" xmlns:A="http://apple.com/ns/ical/" xmlns:F="urn:foo">
+    <D:set><D:prop><A:calendar-color>#0000FF</A:calendar-color></D:prop></D:set>
+    <D:set><D:prop><F:read-only>foo</F:read-only></D:prop></D:set>
+  </D:propertyupdate>`)
+
+	expected = `
+  <?xml version="1.0" encoding="UTF-8"?>
+  <D:multistatus xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav" xmlns:CS="http://calendarserver.org/ns/">
+    <D:response>
+      <D:href>/test-data/proppatch</D:href>
+      <D:propstat>
+        <D:prop>
+          <x1:read-only xmlns:x1="urn:foo"/>
+        </D:prop>
+        <D:status>HTTP/1.1 403 Forbidden</D:status>
+      </D:propstat>
+      <D:propstat>
+        <D:prop>
+          <x2:calendar-color xmlns:x2="http://apple.com/ns/ical/"/>
+        </D:prop>
+        <D:status>HTTP/1.1 424 Failed Dependency</D:status>
+      </D:propstat>
+    </D:response>
+  </D:multistatus>`
+
+	test.AssertInt(resp.Status, http.StatusMultiStatus, t)
+	test.AssertMultistatusXML(resp.BodyString(), expected, t)
+	test.AssertStr(colors["/test-data/proppatch"], "#00FF00", t)
+
+	// Test 4: invalid request bodies
+	resp = proppatch(`<D:propfind xmlns:D="DAV:"><D:prop><D:getetag/></D:prop></D:propfind>`)
+	test.AssertInt(resp.Status, http.StatusBadRequest, t)
+}
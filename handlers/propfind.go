@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"encoding/xml"
+	"io"
 )
 
 type propfindHandler struct {
@@ -15,6 +16,11 @@ func (ph propfindHandler) Handle() *Response {
 		return ph.response.SetError(err)
 	}
 
+	// the requested resource is always the first one
+	if resp := ph.checkPreconditions(&resources[0]); resp != nil {
+		return resp
+	}
+
 	// read body string to xml struct
 	type XMLProp2 struct {
 		Tags []xml.Name `xml:",any"`
@@ -27,17 +33,25 @@ func (ph propfindHandler) Handle() *Response {
 	xml.Unmarshal([]byte(ph.requestBody), &requestXML)
 
 	multistatus := &multistatusResp{
+		Context: ph.propertyContext(),
 		Minimal: ph.headers.IsMinimal(),
 	}
-	// for each href, build the multistatus responses
-	for _, resource := range resources {
-		propstats := multistatus.Propstats(&resource, requestXML.Prop.Tags)
-		multistatus.AddResponse(resource.Path, true, propstats)
-	}
 
 	if multistatus.Minimal {
 		ph.response.SetHeader(HD_PREFERENCE_APPLIED, HD_PREFER_MINIMAL)
 	}
 
-	return ph.response.Set(207, multistatus.ToXML())
+	// for each href, build the multistatus response and stream it to the client
+	return ph.response.SetWriter(207, func(w io.Writer) error {
+		mw := multistatus.newWriter(w)
+		for i := range resources {
+			mw.WriteResponse(msResponse{
+				Href:      resources[i].Path,
+				Found:     true,
+				Propstats: multistatus.Propstats(&resources[i], requestXML.Prop.Tags),
+			})
+		}
+
+		return mw.Close()
+	})
 }
@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"encoding/xml"
+	"log"
+	"net/http"
+
+	"github.com/samedi/caldav-go/data"
+	"github.com/samedi/caldav-go/errs"
+	"github.com/samedi/caldav-go/ixml"
+)
+
+type proppatchHandler struct {
+	handlerData
+}
+
+// A single instruction of the PROPPATCH request: the property to set, or to remove, and its provider.
+type propUpdate struct {
+	prop     ixml.Element
+	remove   bool
+	provider PropertyProvider
+	setter   PropertySetter
+}
+
+// The value of a property before an update, used to undo it when a later update fails.
+type propSnapshot struct {
+	update  propUpdate
+	value   ixml.Element
+	defined bool
+}
+
+// Handles the PROPPATCH requests (RFC4918 Section 9.2). The properties are changed through the
+// setters of their registered providers, in the order they are given in the request. All the
+// properties are checked before any change is made: if any of them has no setter, nothing is
+// changed and the other properties are reported with 424 (Failed Dependency). If a setter fails,
+// the properties already changed are restored to their previous values, so that the request is
+// applied all-or-nothing, and all the other properties are reported with 424.
+func (ph proppatchHandler) Handle() *Response {
+	resource, found, err := ph.storage.GetShallowResource(ph.requestPath)
+	if err != nil {
+		return ph.response.SetError(err)
+	} else if !found {
+		return ph.response.SetError(errs.ResourceNotFoundError)
+	}
+
+	if resp := ph.checkPreconditions(resource); resp != nil {
+		return resp
+	}
+
+	var requestXML ixml.Element
+	if err := xml.Unmarshal([]byte(ph.requestBody), &requestXML); err != nil || requestXML.XMLName != ixml.PROPERTY_UPDATE_TG {
+		return ph.response.Set(http.StatusBadRequest, "")
+	}
+
+	updates := readPropUpdates(requestXML)
+	if len(updates) == 0 {
+		return ph.response.Set(http.StatusBadRequest, "")
+	}
+
+	propstats, _ := applyPropUpdates(ph.propertyContext(), resource, updates)
+
+	multistatus := new(multistatusResp)
+	multistatus.AddResponse(resource.Path, true, propstats)
+
+	return ph.response.Set(http.StatusMultiStatus, multistatus.ToXML())
+}
+
+// Reads the instructions of a DAV:propertyupdate, or of a CALDAV:mkcalendar, in the document order.
+func readPropUpdates(requestXML ixml.Element) []propUpdate {
+	var updates []propUpdate
+	for _, instruction := range requestXML.Children {
+		remove := instruction.XMLName == ixml.REMOVE_TG
+		if !remove && instruction.XMLName != ixml.SET_TG {
+			continue
+		}
+
+		for _, prop := range instruction.Children {
+			if prop.XMLName != ixml.PROP_TG {
+				continue
+			}
+
+			for _, property := range prop.Children {
+				update := propUpdate{prop: property, remove: remove}
+				if provider, found := GetPropertyProvider(property.XMLName); found {
+					update.provider = provider
+					update.setter, _ = provider.(PropertySetter)
+				}
+				updates = append(updates, update)
+			}
+		}
+	}
+
+	return updates
+}
+
+// Applies the updates to the properties of the resource and returns their statuses, together with a flag
+// saying whether all of them succeeded. See `proppatchHandler.Handle` for how the failures are handled.
+func applyPropUpdates(ctx *PropertyContext, resource *data.Resource, updates []propUpdate) (msPropstats, bool) {
+	statuses := make([]int, len(updates))
+	protected := false
+	for i, update := range updates {
+		if update.setter == nil {
+			statuses[i] = http.StatusForbidden
+			protected = true
+		}
+	}
+
+	failed := protected
+	var applied []propSnapshot
+	for i, update := range updates {
+		if statuses[i] != 0 {
+			continue
+		} else if failed {
+			statuses[i] = http.StatusFailedDependency
+			continue
+		}
+
+		value := &update.prop
+		if update.remove {
+			value = nil
+		}
+
+		snapshot := propSnapshot{update: update}
+		snapshot.value, snapshot.defined = update.provider.GetProperty(ctx, resource)
+		if err := update.setter.SetProperty(ctx, resource, value); err != nil {
+			statuses[i] = errorStatus(err)
+			failed = true
+		} else {
+			statuses[i] = http.StatusOK
+			applied = append(applied, snapshot)
+		}
+	}
+
+	if failed {
+		undoPropUpdates(ctx, resource, applied)
+		for i := range statuses {
+			if statuses[i] == http.StatusOK {
+				statuses[i] = http.StatusFailedDependency
+			}
+		}
+	}
+
+	propstats := make(msPropstats)
+	for i, update := range updates {
+		propstats.Add(msProp{Tag: update.prop.XMLName, Status: statuses[i]})
+	}
+
+	return propstats, !failed
+}
+
+// Restores the previous values of the properties, undoing the updates in the reverse order they were applied.
+func undoPropUpdates(ctx *PropertyContext, resource *data.Resource, applied []propSnapshot) {
+	for i := len(applied) - 1; i >= 0; i-- {
+		snapshot := applied[i]
+
+		var value *ixml.Element
+		if snapshot.defined {
+			value = &snapshot.value
+			value.XMLName = snapshot.update.prop.XMLName
+		}
+
+		if err := snapshot.update.setter.SetProperty(ctx, resource, value); err != nil {
+			log.Printf("WARNING: Could not restore the property %s after a failed PROPPATCH.\nError: %s.\nResource path: %s.", snapshot.update.prop.XMLName.Local, err, resource.Path)
+		}
+	}
+}
@@ -1,8 +1,20 @@
 package handlers
 
 import (
-	"github.com/samedi/caldav-go/errs"
+	"fmt"
+	"hash/crc32"
 	"net/http"
+	"path"
+	"regexp"
+
+	"github.com/laurent22/ical-go"
+
+	"github.com/samedi/caldav-go/data"
+	"github.com/samedi/caldav-go/errs"
+	"github.com/samedi/caldav-go/global"
+	"github.com/samedi/caldav-go/ics"
+	"github.com/samedi/caldav-go/itip"
+	"github.com/samedi/caldav-go/ixml"
 )
 
 type putHandler struct {
@@ -10,9 +22,6 @@ type putHandler struct {
 }
 
 func (ph putHandler) Handle() *Response {
-	precond := requestPreconditions{ph.request}
-	success := false
-
 	// check if resource exists
 	resourcePath := ph.requestPath
 	resource, found, err := ph.storage.GetShallowResource(resourcePath)
@@ -20,43 +29,240 @@ func (ph putHandler) Handle() *Response {
 		return ph.response.SetError(err)
 	}
 
-	// PUT is allowed in 2 cases:
-	//
-	// 1. Item NOT FOUND and there is NO ETAG match header: CREATE a new item
-	if !found && !precond.IfMatchPresent() {
-		// create new event resource
-		resource, err = ph.storage.CreateResource(resourcePath, ph.requestBody)
+	// PUT is allowed only when the request preconditions pass, e.g.: when there is an ETag match header,
+	// the item must exist and match it; when there is an IF-NONE-MATCH=* header, the item must not exist.
+	if !found {
+		resource = nil
+	}
+	if resp := ph.checkPreconditions(resource); resp != nil {
+		return resp
+	}
+
+	body, err := ph.calendarData()
+	if err != nil {
+		return ph.response.SetError(err)
+	}
+
+	if found && resource.IsCollection() {
+		// PUT on collections imports the calendar data into the collection
+		return ph.importCalendar(resource, body)
+	}
+
+	content, err := normalize(body)
+	if err != nil {
+		return ph.response.SetError(err)
+	}
+	altered := content != ph.requestBody
+
+	// the calendar objects must be within the limits of their calendar collection (RFC4791#5.3.2.1)
+	if err := checkCalendarLimits(ph.calendarMetadata(path.Dir(resourcePath)), content); err != nil {
+		return ph.response.SetError(err)
+	}
+
+	// when scheduling is enabled, the object is stored with the scheduling status of the messages to the
+	// attendees or to the organizer, which are sent only once the object is stored
+	sched := ph.scheduler()
+	var scheduling *scheduling
+	if sched != nil {
+		content, scheduling = sched.schedulePut(resourcePath, resource, content)
+		altered = altered || scheduling != nil
+	}
+
+	if !found {
+		// Item NOT FOUND: CREATE a new item
+		resource, err = ph.storage.CreateResource(resourcePath, content)
+	} else {
+		// Item exists: UPDATE the item
+		resource, err = ph.storage.UpdateResource(resourcePath, content)
+	}
+
+	if err != nil {
+		return ph.response.SetError(err)
+	}
+
+	if sched != nil {
+		sched.deliverAll(scheduling)
+	}
+
+	// the ETag is returned only when the stored content is the same sent by the client (RFC4791#5.3.4)
+	if !altered {
+		resourceEtag, _ := resource.GetEtag()
+		ph.response.SetHeader("ETag", resourceEtag)
+	}
+
+	return ph.response.Set(http.StatusCreated, "")
+}
+
+// Characters not allowed in the names of the resources created when importing a calendar.
+var unsafeNameChars = regexp.MustCompile(`[^A-Za-z0-9@._-]`)
+
+// Returns the name of the resource created for the given UID when importing a calendar. The names of the
+// UIDs with characters not allowed get a checksum of the UID, so that they do not take the name of other
+// UIDs, e.g. `a/b` and `a_b`.
+func importedName(uid string) string {
+	name := unsafeNameChars.ReplaceAllString(uid, "_")
+	if name != uid {
+		name = fmt.Sprintf("%s-%08x", name, crc32.ChecksumIEEE([]byte(uid)))
+	}
+
+	return name + ".ics"
+}
+
+// Imports a VCALENDAR object, possibly with many components, into a collection. The calendar is split
+// by UID into individual calendar object resources, named after the UID. Resources already existing
+// with the same name and UID are updated, and the objects are scheduled like the ones sent with PUT.
+// The UIDs already used by other resources of the collection fail with the `no-uid-conflict` precondition
+// (RFC4791#5.3.2.1) and the names already used by other UIDs with a conflict. The response is a multistatus
+// listing the status of each resource.
+func (ph putHandler) importCalendar(collection *data.Resource, body string) *Response {
+	cal, err := ics.Parse(body)
+	if err != nil {
+		return ph.response.SetError(errs.NewPreconditionError(http.StatusForbidden, ixml.VALID_CALENDAR_DATA_TG))
+	}
+
+	uids, objects, err := ics.SplitByUID(cal)
+	if err != nil {
+		return ph.response.SetError(errs.NewPreconditionError(http.StatusForbidden, ixml.VALID_CALENDAR_DATA_TG))
+	}
+
+	uidPaths, pathUIDs, err := ph.collectionUIDs(collection)
+	if err != nil {
+		return ph.response.SetError(err)
+	}
+
+	metadata := ph.calendarMetadata(collection.Path)
+
+	multistatus := new(multistatusResp)
+	for _, uid := range uids {
+		rpath := collection.Path + "/" + importedName(uid)
+
+		if href, used := uidPaths[uid]; used && href != rpath {
+			perr := errs.NewPreconditionError(http.StatusForbidden, ixml.NO_UID_CONFLICT_TG)
+			perr.Content = []ixml.Element{ixml.HrefElement(href)}
+			multistatus.AddErrorResponse(rpath, perr)
+			continue
+		}
+
+		if other, taken := pathUIDs[rpath]; taken && other != uid {
+			multistatus.AddErrorResponse(rpath, errs.ConflictError)
+			continue
+		}
+
+		status, err := ph.importObject(rpath, objects[uid], metadata)
 		if err != nil {
-			return ph.response.SetError(err)
+			multistatus.AddErrorResponse(rpath, err)
+			continue
 		}
 
-		success = true
+		uidPaths[uid], pathUIDs[rpath] = rpath, uid
+		multistatus.AddStatusResponse(rpath, status)
+	}
+
+	return ph.response.Set(207, multistatus.ToXML())
+}
+
+// Stores a calendar object imported into a collection, creating or updating the resource at `rpath`.
+// It returns the status of the resource: 201 (Created) or 204 (No Content) when it was updated.
+func (ph putHandler) importObject(rpath string, object *ical.Node, metadata *data.CalendarMetadata) (int, error) {
+	content, err := normalize(ics.Serialize(object))
+	if err != nil {
+		return 0, err
 	}
 
+	if err := checkCalendarLimits(metadata, content); err != nil {
+		return 0, err
+	}
+
+	resource, found, err := ph.storage.GetShallowResource(rpath)
+	if err != nil && err != errs.ResourceNotFoundError {
+		return 0, err
+	}
+	if !found {
+		resource = nil
+	}
+
+	sched := ph.scheduler()
+	var scheduling *scheduling
+	if sched != nil {
+		content, scheduling = sched.schedulePut(rpath, resource, content)
+	}
+
+	status := http.StatusCreated
 	if found {
-		// TODO: Handle PUT on collections
+		_, err = ph.storage.UpdateResource(rpath, content)
+		status = http.StatusNoContent
+	} else {
+		_, err = ph.storage.CreateResource(rpath, content)
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	if sched != nil {
+		sched.deliverAll(scheduling)
+	}
+
+	return status, nil
+}
+
+// Returns the UIDs of the calendar objects of the collection, mapped to their paths, and the other way round.
+// The objects that cannot be parsed are mapped to an empty UID.
+func (ph putHandler) collectionUIDs(collection *data.Resource) (map[string]string, map[string]string, error) {
+	uidPaths, pathUIDs := make(map[string]string), make(map[string]string)
+
+	resources, err := ph.storage.GetResources(collection.Path, true)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, resource := range resources {
 		if resource.IsCollection() {
-			return ph.response.Set(http.StatusPreconditionFailed, "")
+			continue
 		}
 
-		// 2. Item exists, the resource etag is verified and there's no IF-NONE-MATCH=* header: UPDATE the item
-		resourceEtag, _ := resource.GetEtag()
-		if found && precond.IfMatch(resourceEtag) && !precond.IfNoneMatch("*") {
-			// update resource
-			resource, err = ph.storage.UpdateResource(resourcePath, ph.requestBody)
-			if err != nil {
-				return ph.response.SetError(err)
-			}
-
-			success = true
+		var uid string
+		content, _ := resource.GetContentData()
+		if object, err := ics.Parse(content); err == nil {
+			uid = itip.UID(object)
+		}
+
+		pathUIDs[resource.Path] = uid
+		if uid != "" {
+			uidPaths[uid] = resource.Path
 		}
 	}
 
-	if !success {
-		return ph.response.Set(http.StatusPreconditionFailed, "")
+	return uidPaths, pathUIDs, nil
+}
+
+// Returns the calendar data sent by the client. The data sent in the jCal or xCal formats, as given by
+// the Content-Type header, is converted to iCalendar. The data of any other type is taken as iCalendar.
+func (ph putHandler) calendarData() (string, error) {
+	mediaType := ph.headers.ContentMediaType()
+	if mediaType != ics.MediaTypeJCal && mediaType != ics.MediaTypeXCal {
+		return ph.requestBody, nil
+	}
+
+	content, err := ics.ConvertFrom(ph.requestBody, mediaType)
+	if err != nil {
+		return "", errs.NewPreconditionError(http.StatusForbidden, ixml.VALID_CALENDAR_DATA_TG)
+	}
+
+	return content, nil
+}
+
+// Applies the normalizers set up to the calendar object sent by the client. Without normalizers, the object
+// is returned as it is. The objects that cannot be parsed or normalized are not valid calendar data.
+func normalize(content string) (string, error) {
+	if len(global.Normalizers) == 0 {
+		return content, nil
+	}
+
+	normalized, err := ics.Normalize(content, global.Normalizers...)
+	if err != nil {
+		return "", errs.NewPreconditionError(http.StatusForbidden, ixml.VALID_CALENDAR_DATA_TG)
 	}
 
-	resourceEtag, _ := resource.GetEtag()
-	return ph.response.SetHeader("ETag", resourceEtag).
-		Set(http.StatusCreated, "")
+	return normalized, nil
 }
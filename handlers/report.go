@@ -2,12 +2,16 @@ package handlers
 
 import (
 	"encoding/xml"
-	"fmt"
+	"io"
 	"net/http"
 	"strings"
 
 	"github.com/samedi/caldav-go/data"
+	"github.com/samedi/caldav-go/errs"
+	"github.com/samedi/caldav-go/global"
+	"github.com/samedi/caldav-go/ics"
 	"github.com/samedi/caldav-go/ixml"
+	"github.com/samedi/caldav-go/lib"
 )
 
 type reportHandler struct {
@@ -27,6 +31,12 @@ func (rh reportHandler) Handle() *Response {
 	var requestXML reportRootXML
 	xml.Unmarshal([]byte(rh.requestBody), &requestXML)
 
+	// the calendar data can be requested in other formats than iCalendar, e.g. jCal or xCal
+	calendarDataType, err := requestXML.Prop.CalendarDataType()
+	if err != nil {
+		return rh.response.SetError(err)
+	}
+
 	// The resources to be reported are fetched by the type of the request. If it is
 	// a `calendar-multiget`, the resources come based on a set of `hrefs` in the request body.
 	// If it is a `calendar-query`, the resources are calculated based on set of filters in the request.
@@ -35,7 +45,19 @@ func (rh reportHandler) Handle() *Response {
 	case ixml.CALENDAR_MULTIGET_TG:
 		resourcesToReport, err = rh.fetchResourcesByList(urlResource, requestXML.Hrefs)
 	case ixml.CALENDAR_QUERY_TG:
-		resourcesToReport, err = rh.fetchResourcesByFilters(urlResource, requestXML.Filters)
+		filters, filterErr := data.ParseCalendarQueryFilter(rh.requestBody)
+		if filterErr == nil {
+			filterErr = checkSupportedFilter(filters)
+		}
+		if filterErr != nil {
+			return rh.response.SetError(filterErr)
+		}
+
+		tz, tzErr := rh.queryTimezone(urlResource, requestXML.Timezone)
+		if tzErr != nil {
+			return rh.response.SetError(tzErr)
+		}
+		resourcesToReport, err = rh.fetchResourcesByFilters(urlResource, filters, tz)
 	default:
 		return rh.response.Set(http.StatusPreconditionFailed, "")
 	}
@@ -45,39 +67,86 @@ func (rh reportHandler) Handle() *Response {
 	}
 
 	multistatus := &multistatusResp{
+		Context: rh.propertyContext(),
 		Minimal: rh.headers.IsMinimal(),
 	}
-	// for each href, build the multistatus responses
-	for _, r := range resourcesToReport {
-		propstats := multistatus.Propstats(r.resource, requestXML.Prop.Tags)
-		multistatus.AddResponse(r.href, r.found, propstats)
-	}
+	multistatus.Context.CalendarDataType = calendarDataType
 
 	if multistatus.Minimal {
 		rh.response.SetHeader(HD_PREFERENCE_APPLIED, HD_PREFER_MINIMAL)
 	}
 
-	return rh.response.Set(207, multistatus.ToXML())
+	reqprops := requestXML.Prop.Tags()
+
+	// the multistatus is streamed to the client: for each href, the response is built
+	// and written right away, so that big reports are never fully held in memory.
+	return rh.response.SetWriter(207, func(w io.Writer) error {
+		mw := multistatus.newWriter(w)
+		for _, r := range resourcesToReport {
+			mw.WriteResponse(msResponse{
+				Href:      r.href,
+				Found:     r.found,
+				Propstats: multistatus.Propstats(r.resource, reqprops),
+			})
+		}
+
+		return mw.Close()
+	})
 }
 
 type reportPropXML struct {
-	Tags []xml.Name `xml:",any"`
+	Props []reportPropElemXML `xml:",any"`
 }
 
-type reportRootXML struct {
+type reportPropElemXML struct {
 	XMLName xml.Name
-	Prop    reportPropXML   `xml:"DAV: prop"`
-	Hrefs   []string        `xml:"DAV: href"`
-	Filters reportFilterXML `xml:"urn:ietf:params:xml:ns:caldav filter"`
+	Attrs   []xml.Attr `xml:",any,attr"`
 }
 
-type reportFilterXML struct {
-	XMLName      xml.Name
-	InnerContent string `xml:",innerxml"`
+// Returns the names of the requested props.
+func (p reportPropXML) Tags() []xml.Name {
+	tags := make([]xml.Name, len(p.Props))
+	for i, prop := range p.Props {
+		tags[i] = prop.XMLName
+	}
+
+	return tags
 }
 
-func (rfXml reportFilterXML) toString() string {
-	return fmt.Sprintf("<%s>%s</%s>", rfXml.XMLName.Local, rfXml.InnerContent, rfXml.XMLName.Local)
+// Returns the media type of the calendar data requested, given by the `content-type` attribute of
+// the <C:calendar-data> prop (RFC4791#9.6). It defaults to iCalendar.
+func (p reportPropXML) CalendarDataType() (string, error) {
+	for _, prop := range p.Props {
+		if prop.XMLName != ixml.CALENDAR_DATA_TG {
+			continue
+		}
+
+		mediaType, version := ics.MediaTypeICalendar, "2.0"
+		for _, attr := range prop.Attrs {
+			switch attr.Name.Local {
+			case "content-type":
+				mediaType = attr.Value
+			case "version":
+				version = attr.Value
+			}
+		}
+
+		supported := mediaType == ics.MediaTypeICalendar || mediaType == ics.MediaTypeJCal || mediaType == ics.MediaTypeXCal
+		if !supported || version != "2.0" {
+			return "", errs.NewPreconditionError(http.StatusForbidden, ixml.SUPPORTED_CALENDAR_DATA_TG)
+		}
+
+		return mediaType, nil
+	}
+
+	return ics.MediaTypeICalendar, nil
+}
+
+type reportRootXML struct {
+	XMLName  xml.Name
+	Prop     reportPropXML `xml:"DAV: prop"`
+	Hrefs    []string      `xml:"DAV: href"`
+	Timezone string        `xml:"urn:ietf:params:xml:ns:caldav timezone"`
 }
 
 // Wraps a resource that has to be reported, either fetched by filters or by a list.
@@ -96,13 +165,14 @@ type reportRes struct {
 // match the filter will not appear in the response result.
 // If the origin resource is not a collection, the function just returns it and ignore any filter processing.
 // [See RFC4791#section-7.8]
-func (rh reportHandler) fetchResourcesByFilters(origin *data.Resource, filtersXML reportFilterXML) ([]reportRes, error) {
+// The floating times and dates in the resources are evaluated in the given time zone.
+func (rh reportHandler) fetchResourcesByFilters(origin *data.Resource, filters *data.ResourceFilter, tz *ics.Timezone) ([]reportRes, error) {
 	// The list of resources that has to be reported back in the response.
 	reps := []reportRes{}
 
 	if origin.IsCollection() {
-		filters, _ := data.ParseResourceFilters(filtersXML.toString())
-		resources, err := rh.storage.GetResourcesByFilters(origin.Path, filters)
+		filters.SetTimezone(tz)
+		resources, err := data.FindResources(rh.storage, origin.Path, filters)
 
 		if err != nil {
 			return reps, err
@@ -119,6 +189,32 @@ func (rh reportHandler) fetchResourcesByFilters(origin *data.Resource, filtersXM
 	return reps, nil
 }
 
+// Returns the time zone of the floating times in a calendar-query: the CALDAV:timezone given in the query or,
+// when not given, the calendar-timezone property of the collection (RFC4791#7.8). Nil means UTC.
+func (rh reportHandler) queryTimezone(origin *data.Resource, queryTimezone string) (*ics.Timezone, error) {
+	if strings.TrimSpace(queryTimezone) != "" {
+		tz, err := ics.ParseCalendarTimezone(queryTimezone)
+		if err != nil {
+			return nil, errs.NewPreconditionError(http.StatusBadRequest, ixml.VALID_CALENDAR_DATA_TG)
+		}
+		return tz, nil
+	}
+
+	if !origin.IsCollection() {
+		return nil, nil
+	}
+
+	if provider, found := GetPropertyProvider(ixml.CALENDAR_TIMEZONE_TG); found {
+		if prop, found := provider.GetProperty(rh.propertyContext(), origin); found {
+			if tz, err := ics.ParseCalendarTimezone(prop.Text); err == nil {
+				return tz, nil
+			}
+		}
+	}
+
+	return nil, nil
+}
+
 // The hrefs can come from (1) the request URL or (2) from the request body itself.
 // If the origin resource from the URL points to a collection (2), we will check the request body
 // to get the requested `hrefs` (resource paths). Each requested href has to be related to the collection.
@@ -161,3 +257,35 @@ func (rh reportHandler) fetchResourcesByList(origin *data.Resource, requestedPat
 
 	return reps, nil
 }
+
+// Checks that the components queried by the filter are supported by the server, i.e. they are either one of the
+// `global.SupportedComponents` or time zones. Otherwise it fails with the CALDAV:supported-filter precondition,
+// listing the comp-filters of the unsupported components (RFC4791#7.8).
+func checkSupportedFilter(filters *data.ResourceFilter) error {
+	var unsupported []ixml.Element
+	for _, comp := range filters.Tree().CompFilter.CompFilters {
+		if comp.Name != lib.VTIMEZONE && !isSupportedComponent(comp.Name) {
+			compFilter := ixml.NewElement(ixml.COMP_FILTER_TG)
+			compFilter.Attrs = []xml.Attr{{Name: xml.Name{Local: "name"}, Value: comp.Name}}
+			unsupported = append(unsupported, compFilter)
+		}
+	}
+
+	if len(unsupported) == 0 {
+		return nil
+	}
+
+	err := errs.NewPreconditionError(http.StatusForbidden, ixml.SUPPORTED_FILTER_TG)
+	err.Content = unsupported
+	return err
+}
+
+func isSupportedComponent(name string) bool {
+	for _, component := range global.SupportedComponents {
+		if component == name {
+			return true
+		}
+	}
+
+	return false
+}
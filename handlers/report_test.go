@@ -3,9 +3,14 @@ package handlers
 import (
 	"fmt"
 	"net/http"
+	"strings"
 	"testing"
 
+	"github.com/samedi/caldav-go/data"
+	"github.com/samedi/caldav-go/errs"
+	"github.com/samedi/caldav-go/global"
 	"github.com/samedi/caldav-go/ixml"
+	"github.com/samedi/caldav-go/lib"
 	"github.com/samedi/caldav-go/test"
 )
 
@@ -71,7 +76,7 @@ func TestHandle1(t *testing.T) {
 	`, ixml.EscapeText(r1Data), ixml.EscapeText(r2Data))
 
 	resp := handler.Handle()
-	test.AssertMultistatusXML(resp.Body, expectedRespBody, t)
+	test.AssertMultistatusXML(resp.BodyString(), expectedRespBody, t)
 }
 
 // Test 2: when the URL path points to an actual resource.
@@ -120,7 +125,7 @@ func TestHandle2(t *testing.T) {
   `, ixml.EscapeText(r1Data))
 
 	resp := handler.Handle()
-	test.AssertMultistatusXML(resp.Body, expectedRespBody, t)
+	test.AssertMultistatusXML(resp.BodyString(), expectedRespBody, t)
 }
 
 // Test 3: when the URL points to a collection and passing filter rules in the body.
@@ -185,7 +190,7 @@ func TestHandle3(t *testing.T) {
 	`, ixml.EscapeText(r1Data), ixml.EscapeText(r2Data))
 
 	resp := handler.Handle()
-	test.AssertMultistatusXML(resp.Body, expectedRespBody, t)
+	test.AssertMultistatusXML(resp.BodyString(), expectedRespBody, t)
 }
 
 // Test 4: when making a request with a `Prefer` header.
@@ -231,9 +236,198 @@ func TestHandle4(t *testing.T) {
   </D:multistatus>`)
 
 	resp := handler.Handle()
-	test.AssertMultistatusXML(resp.Body, expectedRespBody, t)
+	test.AssertMultistatusXML(resp.BodyString(), expectedRespBody, t)
 
 	if test.AssertInt(len(resp.Header["Preference-Applied"]), 1, t) {
 		test.AssertStr(resp.Header.Get("Preference-Applied"), "return=minimal", t)
 	}
 }
+
+// Test 5: the floating times are evaluated in the time zone of the query or of the collection.
+func TestHandleTimezone(t *testing.T) {
+	stg := test.NewFakeStorage()
+	stg.AddFakeResource("/test-data/report/", "late.ics", "BEGIN:VCALENDAR\nBEGIN:VEVENT\nDTSTART:20160914T220000\nDTEND:20160914T230000\nEND:VEVENT\nEND:VCALENDAR")
+
+	newYork := "BEGIN:VCALENDAR\nBEGIN:VTIMEZONE\nTZID:America/New_York\nEND:VTIMEZONE\nEND:VCALENDAR"
+	query := func(timezone string) *Response {
+		return reportHandler{
+			handlerData{
+				requestPath: "/test-data/report/",
+				requestBody: fmt.Sprintf(`
+				<?xml version="1.0" encoding="UTF-8"?>
+				<C:calendar-query xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">
+					<D:prop><D:getetag/></D:prop>
+					<C:filter>
+						<C:comp-filter name="VCALENDAR">
+							<C:comp-filter name="VEVENT">
+								<C:time-range start="20160915T000000Z" end="20160916T000000Z"/>
+							</C:comp-filter>
+						</C:comp-filter>
+					</C:filter>
+					%s
+				</C:calendar-query>`, timezone),
+				response: NewResponse(),
+				storage:  stg,
+			},
+		}.Handle()
+	}
+
+	// in UTC, the event is on the 14th
+	if strings.Contains(query("").BodyString(), "late.ics") {
+		t.Error("The floating event should not match in UTC")
+	}
+
+	// in New York, it ends on the 15th in UTC
+	if !strings.Contains(query("<C:timezone>"+ixml.EscapeText(newYork)+"</C:timezone>").BodyString(), "late.ics") {
+		t.Error("The floating event should match in the time zone of the query")
+	}
+
+	// the calendar-timezone of the collection is used when the query has no time zone
+	RegisterPropertyProvider(ixml.CALENDAR_TIMEZONE_TG, PropertyGetterFunc(func(ctx *PropertyContext, resource *data.Resource) (ixml.Element, bool) {
+		return ixml.NewTextElement(ixml.CALENDAR_TIMEZONE_TG, newYork), true
+	}))
+	defer UnregisterPropertyProvider(ixml.CALENDAR_TIMEZONE_TG)
+
+	if !strings.Contains(query("").BodyString(), "late.ics") {
+		t.Error("The floating event should match in the time zone of the collection")
+	}
+
+	resp := query("<C:timezone>invalid</C:timezone>")
+	test.AssertInt(resp.Status, http.StatusBadRequest, t)
+}
+
+func TestHandleCollation(t *testing.T) {
+	stg := test.NewFakeStorage()
+	stg.AddFakeResource("/test-data/report/", "meeting.ics", "BEGIN:VCALENDAR\nBEGIN:VEVENT\nSUMMARY:Réunion\nEND:VEVENT\nEND:VCALENDAR")
+
+	query := func(textMatch string) *Response {
+		return reportHandler{
+			handlerData{
+				requestPath: "/test-data/report/",
+				requestBody: fmt.Sprintf(`
+				<?xml version="1.0" encoding="UTF-8"?>
+				<C:calendar-query xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">
+					<D:prop><D:getetag/></D:prop>
+					<C:filter>
+						<C:comp-filter name="VCALENDAR">
+							<C:comp-filter name="VEVENT">
+								<C:prop-filter name="SUMMARY">%s</C:prop-filter>
+							</C:comp-filter>
+						</C:comp-filter>
+					</C:filter>
+				</C:calendar-query>`, textMatch),
+				response: NewResponse(),
+				storage:  stg,
+			},
+		}.Handle()
+	}
+
+	if !strings.Contains(query(`<C:text-match collation="i;unicode-casemap">RÉUNION</C:text-match>`).BodyString(), "meeting.ics") {
+		t.Error("The event should match with the i;unicode-casemap collation")
+	}
+
+	resp := query(`<C:text-match collation="i;klingon">Réunion</C:text-match>`)
+	test.AssertInt(resp.Status, http.StatusForbidden, t)
+	if perr, ok := resp.Error.(*errs.PreconditionError); !ok || perr.Condition != ixml.SUPPORTED_COLLATION_TG {
+		t.Error("Expected the supported-collation precondition | Got:", resp.Error)
+	}
+}
+
+func TestHandleInvalidFilter(t *testing.T) {
+	stg := test.NewFakeStorage()
+	stg.AddFakeResource("/test-data/report/", "todo.ics", "BEGIN:VCALENDAR\nBEGIN:VTODO\nSUMMARY:Shopping\nEND:VTODO\nEND:VCALENDAR")
+
+	query := func(filter string) *Response {
+		return reportHandler{
+			handlerData{
+				requestPath: "/test-data/report/",
+				requestBody: `
+				<?xml version="1.0" encoding="UTF-8"?>
+				<C:calendar-query xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">
+					<D:prop><D:getetag/></D:prop>
+					<C:filter>` + filter + `</C:filter>
+				</C:calendar-query>`,
+				response: NewResponse(),
+				storage:  stg,
+			},
+		}.Handle()
+	}
+
+	// malformed filters are refused instead of matching nothing
+	resp := query(`<C:comp-filter name="VCALENDAR"><C:comp-filter name="VEVENT"><C:time-range start="yesterday"/></C:comp-filter></C:comp-filter>`)
+	test.AssertInt(resp.Status, http.StatusForbidden, t)
+	if perr, ok := resp.Error.(*errs.PreconditionError); !ok || perr.Condition != ixml.VALID_FILTER_TG {
+		t.Error("Expected the valid-filter precondition | Got:", resp.Error)
+	}
+
+	// the VTODO components are not supported by default
+	resp = query(`<C:comp-filter name="VCALENDAR"><C:comp-filter name="VTODO"/></C:comp-filter>`)
+	test.AssertInt(resp.Status, http.StatusForbidden, t)
+	test.AssertMultistatusXML(resp.BodyString(), `
+	<?xml version="1.0" encoding="UTF-8"?>
+	<D:error xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav" xmlns:CS="http://calendarserver.org/ns/">
+		<C:supported-filter>
+			<C:comp-filter name="VTODO"/>
+		</C:supported-filter>
+	</D:error>`, t)
+
+	global.SupportedComponents = []string{lib.VCALENDAR, lib.VEVENT, lib.VTODO}
+	defer func() { global.SupportedComponents = []string{lib.VCALENDAR, lib.VEVENT} }()
+
+	resp = query(`<C:comp-filter name="VCALENDAR"><C:comp-filter name="VTODO"><C:prop-filter name="SUMMARY"/></C:comp-filter></C:comp-filter>`)
+	if !strings.Contains(resp.BodyString(), "todo.ics") {
+		t.Error("The todo should match once the VTODO components are supported")
+	}
+}
+
+func TestHandleCalendarDataType(t *testing.T) {
+	stg := test.NewFakeStorage()
+	stg.AddFakeResource("/test-data/report/", "lunch.ics", "BEGIN:VCALENDAR\nBEGIN:VEVENT\nUID:1\nSUMMARY:Lunch\nEND:VEVENT\nEND:VCALENDAR")
+
+	report := func(calendarData string) *Response {
+		return reportHandler{
+			handlerData{
+				requestPath: "/test-data/report/",
+				requestBody: `
+				<?xml version="1.0" encoding="UTF-8"?>
+				<C:calendar-multiget xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">
+					<D:prop>` + calendarData + `</D:prop>
+					<D:href>/test-data/report/lunch.ics</D:href>
+				</C:calendar-multiget>`,
+				response: NewResponse(),
+				storage:  stg,
+			},
+		}.Handle()
+	}
+
+	jcal := `["vcalendar",[],[["vevent",[["uid",{},"text","1"],["summary",{},"text","Lunch"]],[]]]]`
+	test.AssertMultistatusXML(report(`<C:calendar-data content-type="application/calendar+json" version="2.0"/>`).BodyString(), fmt.Sprintf(`
+	<?xml version="1.0" encoding="UTF-8"?>
+	<D:multistatus xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav" xmlns:CS="http://calendarserver.org/ns/">
+		<D:response>
+			<D:href>/test-data/report/lunch.ics</D:href>
+			<D:propstat>
+				<D:prop>
+					<C:calendar-data>%s</C:calendar-data>
+				</D:prop>
+				<D:status>HTTP/1.1 200 OK</D:status>
+			</D:propstat>
+		</D:response>
+	</D:multistatus>`, ixml.EscapeText(jcal)), t)
+
+	xcal := report(`<C:calendar-data content-type="application/calendar+xml"/>`).BodyString()
+	if !strings.Contains(xcal, ixml.EscapeText(`<summary><text>Lunch</text></summary>`)) {
+		t.Error("Expected the calendar data in xCal | Got:", xcal)
+	}
+
+	for _, calendarData := range []string{
+		`<C:calendar-data content-type="text/plain"/>`,
+		`<C:calendar-data content-type="application/calendar+json" version="1.0"/>`,
+	} {
+		resp := report(calendarData)
+		test.AssertInt(resp.Status, http.StatusForbidden, t)
+		if perr, ok := resp.Error.(*errs.PreconditionError); !ok || perr.Condition != ixml.SUPPORTED_CALENDAR_DATA_TG {
+			t.Error("Expected the supported-calendar-data precondition | Got:", resp.Error)
+		}
+	}
+}
@@ -1,18 +1,28 @@
 package handlers
 
 import (
+	"bytes"
 	"github.com/samedi/caldav-go/errs"
+	"github.com/samedi/caldav-go/ixml"
 	"io"
+	"log"
 	"net/http"
 )
 
 // Response represents the handled CalDAV response. Used this when one needs to proxy the generated
 // response before being sent back to the client.
+//
+// The body of the response can be given in three different ways: as a string in `Body`, as a stream
+// in `BodyReader` or as a function in `BodyWriter` that writes it directly into the client stream. When set,
+// `BodyWriter` takes precedence over `BodyReader`, which takes precedence over `Body`. Streamed bodies are
+// meant for big contents (e.g. a multistatus for a whole calendar), which are then never fully held in memory.
 type Response struct {
-	Status int
-	Header http.Header
-	Body   string
-	Error  error
+	Status     int
+	Header     http.Header
+	Body       string
+	BodyReader io.Reader
+	BodyWriter func(io.Writer) error
+	Error      error
 }
 
 // NewResponse initializes a new response object.
@@ -26,6 +36,26 @@ func NewResponse() *Response {
 func (r *Response) Set(status int, body string) *Response {
 	r.Status = status
 	r.Body = body
+	r.BodyReader = nil
+	r.BodyWriter = nil
+
+	return r
+}
+
+// SetReader sets the status of the response and the stream from where the body is read. If the
+// reader is also a `io.Closer`, it is closed after the body is written.
+func (r *Response) SetReader(status int, body io.Reader) *Response {
+	r.Set(status, "")
+	r.BodyReader = body
+
+	return r
+}
+
+// SetWriter sets the status of the response and the function that writes the body. The function is
+// called only when the response is written, receiving the stream where the body must be written to.
+func (r *Response) SetWriter(status int, body func(io.Writer) error) *Response {
+	r.Set(status, "")
+	r.BodyWriter = body
 
 	return r
 }
@@ -40,19 +70,72 @@ func (r *Response) SetHeader(key, value string) *Response {
 // SetError sets the response as an error. It inflects the response status based on the provided error.
 func (r *Response) SetError(err error) *Response {
 	r.Error = err
+	r.Status = errorStatus(err)
+
+	if perr, ok := err.(*errs.PreconditionError); ok {
+		r.SetHeader("Content-Type", "application/xml; charset=utf-8")
+		r.Body = ixml.ErrorXML(perr.Condition, perr.Content...)
+	}
+
+	return r
+}
+
+// errorStatus translates the provided error into the matching HTTP status code.
+func errorStatus(err error) int {
+	if perr, ok := err.(*errs.PreconditionError); ok {
+		return perr.Status
+	}
 
 	switch err {
 	case errs.ResourceNotFoundError:
-		r.Status = http.StatusNotFound
+		return http.StatusNotFound
 	case errs.UnauthorizedError:
-		r.Status = http.StatusUnauthorized
+		return http.StatusUnauthorized
 	case errs.ForbiddenError:
-		r.Status = http.StatusForbidden
+		return http.StatusForbidden
+	case errs.LockedError:
+		return http.StatusLocked
+	case errs.RequestBodyTooLargeError:
+		return http.StatusRequestEntityTooLarge
+	case errs.ConflictError:
+		return http.StatusConflict
 	default:
-		r.Status = http.StatusInternalServerError
+		return http.StatusInternalServerError
 	}
+}
 
-	return r
+// WriteBody writes only the response body into the given writer, whichever way the body was set.
+func (r *Response) WriteBody(writer io.Writer) error {
+	if r.BodyWriter != nil {
+		return r.BodyWriter(writer)
+	}
+
+	if r.BodyReader != nil {
+		if closer, ok := r.BodyReader.(io.Closer); ok {
+			defer closer.Close()
+		}
+
+		_, err := io.Copy(writer, r.BodyReader)
+		return err
+	}
+
+	_, err := io.WriteString(writer, r.Body)
+	return err
+}
+
+// BodyString returns the response body as a string. Streamed bodies are consumed and kept in `Body`,
+// so that this function can be called more than once. Only recommended for small bodies or testing.
+func (r *Response) BodyString() string {
+	if r.BodyWriter == nil && r.BodyReader == nil {
+		return r.Body
+	}
+
+	var buffer bytes.Buffer
+	if err := r.WriteBody(&buffer); err != nil {
+		log.Printf("ERROR: Could not read the response body.\nError: %s.", err)
+	}
+
+	return r.Set(r.Status, buffer.String()).Body
 }
 
 // Write writes the response back to the client using the provided `ResponseWriter`.
@@ -68,5 +151,8 @@ func (r *Response) Write(writer http.ResponseWriter) {
 	}
 
 	writer.WriteHeader(r.Status)
-	io.WriteString(writer, r.Body)
+	if err := r.WriteBody(writer); err != nil {
+		// at this point the status was already sent, so there's nothing else to do than log it
+		log.Printf("ERROR: Could not write the response body.\nError: %s.", err)
+	}
 }
@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/samedi/caldav-go/test"
+)
+
+func TestResponseBody(t *testing.T) {
+	resp := NewResponse().Set(200, "string body")
+	test.AssertStr(resp.BodyString(), "string body", t)
+
+	resp = NewResponse().SetReader(200, ioutil.NopCloser(strings.NewReader("reader body")))
+	test.AssertStr(resp.BodyString(), "reader body", t)
+	// the streamed body is kept after being consumed
+	test.AssertStr(resp.BodyString(), "reader body", t)
+
+	resp = NewResponse().SetWriter(207, func(w io.Writer) error {
+		_, err := io.WriteString(w, "writer body")
+		return err
+	})
+	recorder := httptest.NewRecorder()
+	resp.Write(recorder)
+	test.AssertInt(recorder.Code, 207, t)
+	test.AssertStr(recorder.Body.String(), "writer body", t)
+}
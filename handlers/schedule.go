@@ -0,0 +1,474 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/laurent22/ical-go"
+
+	"github.com/samedi/caldav-go/data"
+	"github.com/samedi/caldav-go/global"
+	"github.com/samedi/caldav-go/ics"
+	"github.com/samedi/caldav-go/imip"
+	"github.com/samedi/caldav-go/itip"
+	"github.com/samedi/caldav-go/lib"
+)
+
+const (
+	// ScheduleInboxName is the name of the collection, right under the principal, where the scheduling messages sent to the user are delivered.
+	ScheduleInboxName = "inbox"
+	// ScheduleOutboxName is the name of the collection, right under the principal, where the user POSTs the scheduling messages to be sent.
+	ScheduleOutboxName = "outbox"
+)
+
+// ScheduleInboxPath returns the path of the scheduling inbox of the given user.
+func ScheduleInboxPath(username string) string {
+	return fmt.Sprintf("/%s/%s", username, ScheduleInboxName)
+}
+
+// ScheduleOutboxPath returns the path of the scheduling outbox of the given user.
+func ScheduleOutboxPath(username string) string {
+	return fmt.Sprintf("/%s/%s", username, ScheduleOutboxName)
+}
+
+// Splits a resource path into its segments, e.g.: "/john/inbox/" => ["john", "inbox"].
+func splitPath(rpath string) []string {
+	return strings.Split(strings.Trim(lib.ToSlashPath(rpath), "/"), "/")
+}
+
+// Tells whether the path is the scheduling box with the given name, e.g. "/john/inbox".
+func isScheduleBox(rpath, name string) bool {
+	split := splitPath(rpath)
+	return len(split) == 2 && split[1] == name
+}
+
+// Tells whether the path points to a scheduling box or to a resource inside one of them.
+func isInScheduleBox(rpath string) bool {
+	split := splitPath(rpath)
+	return len(split) >= 2 && (split[1] == ScheduleInboxName || split[1] == ScheduleOutboxName)
+}
+
+// Handles the implicit scheduling (RFC6638#3.2): when calendar objects with attendees are stored or deleted by the
+// organizer, the iTIP messages are sent to the attendees and, when stored by an attendee, the reply is sent to the organizer.
+// The messages to local users are delivered into their scheduling inboxes and, when there is a mailer, the messages
+// to other users are sent by email.
+type scheduler struct {
+	storage   data.Storage
+	directory data.UserDirectory
+	mailer    imip.Mailer
+}
+
+// Returns the scheduler to be used by the handler, or nil when the scheduling is disabled.
+func (h handlerData) scheduler() *scheduler {
+	if global.UserDirectory == nil {
+		return nil
+	}
+
+	return &scheduler{h.storage, global.UserDirectory, global.Mailer}
+}
+
+// Returns the local user owning the resource on the given path.
+func (s *scheduler) pathUser(rpath string) (*data.CalUser, bool) {
+	return s.directory.GetUser(splitPath(rpath)[0])
+}
+
+// The iTIP messages resulting from the implicit scheduling of a calendar object. They are delivered only once the
+// change of the object is stored, so that no message is sent about an object that could not be stored.
+type scheduling struct {
+	// the path and the content of the stored object, with the expected SCHEDULE-STATUS of the messages, nil on deletion
+	rpath string
+	cal   *ical.Node
+	// the messages to be delivered
+	messages []schedulingMessage
+}
+
+type schedulingMessage struct {
+	recipient string
+	msg       *ical.Node
+	// the property of the recipient, ORGANIZER or ATTENDEE, whose SCHEDULE-STATUS tells the status of the delivery, if any
+	statusProp string
+	status     string
+}
+
+// Adds the message to be delivered. When `statusProp` is given, the expected status of the delivery is set as the
+// SCHEDULE-STATUS of the recipient's property in the object.
+func (sc *scheduling) add(s *scheduler, recipient string, msg *ical.Node, statusProp string) {
+	message := schedulingMessage{recipient: recipient, msg: msg, statusProp: statusProp}
+	if statusProp != "" {
+		message.status = s.expectedStatus(recipient)
+		itip.SetScheduleStatus(sc.cal, statusProp, recipient, message.status)
+	}
+
+	sc.messages = append(sc.messages, message)
+}
+
+// schedulePut runs the implicit scheduling for the calendar object being stored on `rpath`. The `old` resource is
+// the one being replaced, nil when the object is new. It returns the content to be stored, which has the
+// SCHEDULE-STATUS parameters set when there are messages to send, and the messages, to be delivered with
+// `deliverAll` once the content is stored. The scheduling is nil when there are no messages.
+func (s *scheduler) schedulePut(rpath string, old *data.Resource, content string) (string, *scheduling) {
+	if isInScheduleBox(rpath) {
+		return content, nil
+	}
+
+	user, found := s.pathUser(rpath)
+	if !found {
+		return content, nil
+	}
+
+	newCal, err := ics.Parse(content)
+	if err != nil {
+		return content, nil
+	}
+
+	var oldCal *ical.Node
+	if old != nil {
+		if oldContent, found := old.GetContentData(); found {
+			oldCal, _ = ics.Parse(oldContent)
+		}
+	}
+
+	organizer := itip.Organizer(newCal)
+	if organizer == "" {
+		return content, nil
+	}
+
+	sc := &scheduling{rpath: rpath, cal: newCal}
+	if user.HasAddress(organizer) {
+		s.organizerUpdate(sc, oldCal, organizer)
+	} else if attendee, found := userAttendee(newCal, user); found {
+		s.attendeeUpdate(sc, oldCal, attendee, organizer)
+	}
+
+	if len(sc.messages) == 0 {
+		return content, nil
+	}
+
+	return ics.Serialize(newCal), sc
+}
+
+// scheduleDelete runs the implicit scheduling for the calendar object being deleted from `rpath`: the organizer
+// cancels it for all the attendees and an attendee declines it. The messages are to be delivered with `deliverAll`
+// once the object is deleted. The scheduling is nil when there are no messages.
+func (s *scheduler) scheduleDelete(rpath string, content string) *scheduling {
+	if isInScheduleBox(rpath) {
+		return nil
+	}
+
+	user, found := s.pathUser(rpath)
+	if !found {
+		return nil
+	}
+
+	cal, err := ics.Parse(content)
+	if err != nil {
+		return nil
+	}
+
+	organizer := itip.Organizer(cal)
+	if organizer == "" {
+		return nil
+	}
+
+	sc := new(scheduling)
+	if user.HasAddress(organizer) {
+		for _, attendee := range s.scheduledAttendees(cal, organizer) {
+			sc.add(s, attendee, itip.NewCancel(cal, attendee), "")
+		}
+	} else if attendee, found := userAttendee(cal, user); found && organizerScheduledByServer(cal) {
+		for _, comp := range itip.Components(cal) {
+			if prop := itip.Attendee(comp, attendee); prop != nil {
+				if prop.Parameters == nil {
+					prop.Parameters = make(map[string]string)
+				}
+				prop.Parameters["PARTSTAT"] = "DECLINED"
+			}
+		}
+		sc.add(s, organizer, itip.NewReply(cal, attendee), "")
+	}
+
+	if len(sc.messages) == 0 {
+		return nil
+	}
+
+	return sc
+}
+
+// Adds the REQUEST to all the attendees when the object is new or changed significantly, and the CANCEL
+// to the attendees removed from it.
+func (s *scheduler) organizerUpdate(sc *scheduling, oldCal *ical.Node, organizer string) {
+	attendees := s.scheduledAttendees(sc.cal, organizer)
+
+	if oldCal != nil {
+		for _, attendee := range s.scheduledAttendees(oldCal, organizer) {
+			if !data.ContainsAddress(attendees, attendee) {
+				sc.add(s, attendee, itip.NewCancel(oldCal, attendee), "")
+			}
+		}
+
+		if !itip.HasSignificantChange(oldCal, sc.cal) {
+			return
+		}
+	}
+
+	request := itip.NewRequest(sc.cal)
+	for _, attendee := range attendees {
+		sc.add(s, attendee, request, "ATTENDEE")
+	}
+}
+
+// Adds the REPLY to the organizer when the attendee changed its participation status.
+func (s *scheduler) attendeeUpdate(sc *scheduling, oldCal *ical.Node, attendee, organizer string) {
+	if !organizerScheduledByServer(sc.cal) {
+		return
+	}
+
+	oldPartStat := "NEEDS-ACTION"
+	if oldCal != nil {
+		oldPartStat = itip.PartStat(oldCal, attendee)
+	}
+
+	if itip.PartStat(sc.cal, attendee) == oldPartStat {
+		return
+	}
+
+	sc.add(s, organizer, itip.NewReply(sc.cal, attendee), "ORGANIZER")
+}
+
+// Delivers the messages of the scheduling, after the change of the object was stored. When a delivery does not
+// end up with its expected status, e.g. the inbox of the recipient could not be written, the stored object is
+// updated with the actual SCHEDULE-STATUS.
+func (s *scheduler) deliverAll(sc *scheduling) {
+	if sc == nil {
+		return
+	}
+
+	changed := false
+	for _, message := range sc.messages {
+		status := s.deliver(message.recipient, message.msg)
+		if message.statusProp != "" && status != message.status {
+			itip.SetScheduleStatus(sc.cal, message.statusProp, message.recipient, status)
+			changed = true
+		}
+	}
+
+	if changed {
+		if _, err := s.storage.UpdateResource(sc.rpath, ics.Serialize(sc.cal)); err != nil {
+			log.Printf("ERROR: Could not update the object with the scheduling status.\nError: %s.\nResource path: %s", err, sc.rpath)
+		}
+	}
+}
+
+// Returns the attendees, other than the organizer, that are scheduled by the server.
+func (s *scheduler) scheduledAttendees(cal *ical.Node, organizer string) []string {
+	result := []string{}
+
+	for _, attendee := range itip.Attendees(cal) {
+		if data.SameAddress(attendee, organizer) {
+			continue
+		}
+
+		for _, comp := range itip.Components(cal) {
+			if prop := itip.Attendee(comp, attendee); prop != nil {
+				if itip.IsScheduledByServer(prop) {
+					result = append(result, attendee)
+				}
+				break
+			}
+		}
+	}
+
+	return result
+}
+
+// Delivers the iTIP message to the recipient and returns the scheduling status. Messages to local users are
+// stored in their scheduling inboxes, and messages to other users are sent by email.
+func (s *scheduler) deliver(recipient string, msg *ical.Node) string {
+	user, found := s.directory.GetUserByAddress(recipient)
+	if !found {
+		return s.sendMail(recipient, msg)
+	}
+
+	return s.deliverLocal(user, msg, true)
+}
+
+// Returns the status the delivery of a message to the recipient is expected to have, i.e. as long as storing the message
+// in the inbox of a local user or sending the email to another user does not fail.
+func (s *scheduler) expectedStatus(recipient string) string {
+	if _, found := s.directory.GetUserByAddress(recipient); found {
+		return itip.StatusDelivered
+	}
+
+	if _, ok := imip.EmailAddress(recipient); !ok || s.mailer == nil {
+		return itip.StatusInvalidUser
+	}
+
+	return itip.StatusSent
+}
+
+// Stores the iTIP message in the scheduling inbox of the local user. When a REPLY is delivered and `applyReply`
+// is true, the organizer's copy of the object is also updated.
+func (s *scheduler) deliverLocal(user *data.CalUser, msg *ical.Node, applyReply bool) string {
+	uid := itip.UID(msg)
+	rpath := fmt.Sprintf("%s/%s-%d.ics", ScheduleInboxPath(user.Name), unsafeNameChars.ReplaceAllString(uid, "_"), time.Now().UnixNano())
+	if _, err := s.storage.CreateResource(rpath, ics.Serialize(msg)); err != nil {
+		log.Printf("ERROR: Could not deliver the scheduling message.\nError: %s.\nRecipient: %s", err, user.Name)
+		return itip.StatusDeliveryFailed
+	}
+
+	if applyReply && msg.PropString("METHOD", "") == itip.MethodReply {
+		s.applyReply(user, msg)
+	}
+
+	return itip.StatusDelivered
+}
+
+// Sends the iTIP message by email (iMIP) to a recipient that is not a local user. The status is "1.1" (sent) because
+// the delivery itself cannot be confirmed.
+func (s *scheduler) sendMail(recipient string, msg *ical.Node) string {
+	if s.mailer == nil {
+		return itip.StatusInvalidUser
+	}
+
+	if _, ok := imip.EmailAddress(recipient); !ok {
+		return itip.StatusInvalidUser
+	}
+
+	email, err := imip.NewMessage(itip.Sender(msg), recipient, msg)
+	if err != nil {
+		return itip.StatusInvalidDeliveryMethod
+	}
+
+	if err := s.mailer.Send(email); err != nil {
+		log.Printf("ERROR: Could not send the scheduling message by email.\nError: %s.\nRecipient: %s", err, recipient)
+		return itip.StatusDeliveryFailed
+	}
+
+	return itip.StatusSent
+}
+
+// DeliverIMIP delivers a scheduling message received by email (see `imip.Parse`) into the scheduling inboxes of
+// its local recipients. The sender of the email must be the one sending the iTIP message, i.e. the organizer or,
+// for replies, the attendee (RFC6047#3), which must be the only attendee of the reply. It returns the scheduling status for each recipient, by calendar user
+// address. Messages are never forwarded to non-local users.
+//
+// The From header of an email can be forged by anyone, so `senderVerified` tells whether the mail server authenticated
+// the sender, e.g. with a passing DKIM signature or SPF check aligned with the From address. Only the replies of
+// verified senders are applied to the organizer's copy of the object; the other ones are just delivered to the inbox.
+func DeliverIMIP(msg *imip.Message, senderVerified bool) map[string]string {
+	result := make(map[string]string)
+
+	sched := handlerData{storage: global.Storage}.scheduler()
+	from := imip.CalendarAddress(msg.From)
+	authorized := data.SameAddress(from, itip.Sender(msg.Calendar))
+	if msg.Method() == itip.MethodReply {
+		attendee, err := itip.ReplyAttendee(msg.Calendar)
+		authorized = err == nil && data.SameAddress(from, attendee)
+	}
+
+	for _, to := range msg.To {
+		recipient := imip.CalendarAddress(to)
+
+		if sched == nil {
+			result[recipient] = itip.StatusInvalidUser
+			continue
+		}
+
+		user, found := sched.directory.GetUserByAddress(recipient)
+		if !found {
+			result[recipient] = itip.StatusInvalidUser
+		} else if !authorized {
+			result[recipient] = itip.StatusNoPrivileges
+		} else {
+			result[recipient] = sched.deliverLocal(user, msg.Calendar, senderVerified)
+		}
+	}
+
+	return result
+}
+
+// Updates the organizer's copy of the object with the attendee's reply.
+func (s *scheduler) applyReply(organizer *data.CalUser, reply *ical.Node) {
+	resource, object, found := s.findObject(organizer.Name, itip.UID(reply))
+	if !found {
+		return
+	}
+
+	changed, err := itip.ApplyReply(object, reply)
+	if err != nil {
+		log.Printf("WARNING: Could not apply the scheduling reply.\nError: %s.\nResource path: %s", err, resource.Path)
+		return
+	}
+
+	if changed {
+		if _, err := s.storage.UpdateResource(resource.Path, ics.Serialize(object)); err != nil {
+			log.Printf("ERROR: Could not update the object with the scheduling reply.\nError: %s.\nResource path: %s", err, resource.Path)
+		}
+	}
+}
+
+// Looks for the calendar object with the given UID in the calendars of the user.
+func (s *scheduler) findObject(username, uid string) (*data.Resource, *ical.Node, bool) {
+	objects := s.calendarObjects(username)
+
+	for i := range objects {
+		content, _ := objects[i].GetContentData()
+		if object, err := ics.Parse(content); err == nil && itip.UID(object) == uid {
+			return &objects[i], object, true
+		}
+	}
+
+	return nil, nil, false
+}
+
+// Returns the calendar objects in all the calendars of the user, leaving the scheduling boxes out.
+func (s *scheduler) calendarObjects(username string) []data.Resource {
+	result := []data.Resource{}
+
+	calendars, err := s.storage.GetResources("/"+username, true)
+	if err != nil {
+		return result
+	}
+
+	for _, calendar := range calendars {
+		if !calendar.IsCollection() || calendar.IsPrincipal() || isInScheduleBox(calendar.Path) {
+			continue
+		}
+
+		objects, err := s.storage.GetResources(calendar.Path, true)
+		if err != nil {
+			continue
+		}
+
+		for _, object := range objects {
+			if !object.IsCollection() {
+				result = append(result, object)
+			}
+		}
+	}
+
+	return result
+}
+
+// Returns the address of the given user as attendee of the calendar object.
+func userAttendee(cal *ical.Node, user *data.CalUser) (string, bool) {
+	for _, attendee := range itip.Attendees(cal) {
+		if user.HasAddress(attendee) {
+			return attendee, true
+		}
+	}
+
+	return "", false
+}
+
+func organizerScheduledByServer(cal *ical.Node) bool {
+	for _, comp := range itip.Components(cal) {
+		if organizer := ics.Property(comp, "ORGANIZER"); organizer != nil {
+			return itip.IsScheduledByServer(organizer)
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,443 @@
+package handlers
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/samedi/caldav-go/data"
+	"github.com/samedi/caldav-go/errs"
+	"github.com/samedi/caldav-go/global"
+	"github.com/samedi/caldav-go/ics"
+	"github.com/samedi/caldav-go/imip"
+	"github.com/samedi/caldav-go/itip"
+	"github.com/samedi/caldav-go/test"
+)
+
+const scheduledMeeting = `BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:-//test//test//EN
+BEGIN:VEVENT
+UID:meeting-1
+DTSTAMP:20170101T100000Z
+DTSTART:20170102T100000Z
+DTEND:20170102T110000Z
+SUMMARY:Meeting
+ORGANIZER:mailto:alice@example.com
+ATTENDEE;PARTSTAT=ACCEPTED:mailto:alice@example.com
+ATTENDEE;PARTSTAT=NEEDS-ACTION:mailto:bob@example.com
+ATTENDEE;PARTSTAT=NEEDS-ACTION:mailto:carol@example.com
+END:VEVENT
+END:VCALENDAR`
+
+// Sets up the users for the scheduling tests and returns the function that tears them down.
+func setupScheduling() func() {
+	global.UserDirectory = data.NewStaticUserDirectory(
+		&data.CalUser{Name: "test-data-alice", Addresses: []string{"mailto:alice@example.com"}},
+		&data.CalUser{Name: "test-data-bob", Addresses: []string{"mailto:bob@example.com"}},
+	)
+
+	return func() {
+		global.UserDirectory = nil
+		global.User = nil
+		os.RemoveAll("test-data-alice")
+		os.RemoveAll("test-data-bob")
+	}
+}
+
+// Sets the current user, the only one allowed to post to its outbox.
+func loginAs(name string) {
+	global.User = &data.CalUser{Name: name}
+}
+
+func newScheduleHandlerData(method, path, body string) handlerData {
+	return handlerData{
+		request:     &http.Request{Method: method, Header: make(http.Header)},
+		requestBody: body,
+		requestPath: path,
+		response:    NewResponse(),
+		storage:     test.NewFakeStorage(),
+	}
+}
+
+// Returns the contents of the scheduling messages in the user's inbox.
+func inboxMessages(username string) []string {
+	resources, _ := global.Storage.GetResources(ScheduleInboxPath(username), true)
+
+	messages := []string{}
+	for _, resource := range resources {
+		if !resource.IsCollection() {
+			content, _ := resource.GetContentData()
+			messages = append(messages, content)
+		}
+	}
+
+	return messages
+}
+
+func TestImplicitScheduling(t *testing.T) {
+	defer setupScheduling()()
+
+	// Test 1: the organizer creates the meeting. The local attendee gets the request and the
+	// SCHEDULE-STATUS is set for each attendee in the organizer's copy.
+	resp := putHandler{newScheduleHandlerData("PUT", "/test-data-alice/calendar/meeting.ics", scheduledMeeting)}.Handle()
+	test.AssertInt(resp.Status, http.StatusCreated, t)
+	test.AssertStr(resp.Header.Get("ETag"), "", t)
+
+	organizerCopy, _, _ := global.Storage.GetResource("/test-data-alice/calendar/meeting.ics")
+	content, _ := organizerCopy.GetContentData()
+	if !strings.Contains(content, "ATTENDEE;PARTSTAT=NEEDS-ACTION;SCHEDULE-STATUS=1.2:mailto:bob@example.com") ||
+		!strings.Contains(content, "ATTENDEE;PARTSTAT=NEEDS-ACTION;SCHEDULE-STATUS=3.7:mailto:carol@example.com") {
+		t.Error("Wrong scheduling status in the organizer's copy:\n", content)
+	}
+
+	messages := inboxMessages("test-data-bob")
+	if test.AssertInt(len(messages), 1, t) && !strings.Contains(messages[0], "METHOD:REQUEST") {
+		t.Error("The attendee should have received the request:\n", messages[0])
+	}
+
+	// Test 2: the attendee accepts the meeting. The organizer gets the reply and its copy is updated.
+	accepted := strings.Replace(scheduledMeeting, "PARTSTAT=NEEDS-ACTION:mailto:bob", "PARTSTAT=ACCEPTED:mailto:bob", 1)
+	resp = putHandler{newScheduleHandlerData("PUT", "/test-data-bob/calendar/meeting.ics", accepted)}.Handle()
+	test.AssertInt(resp.Status, http.StatusCreated, t)
+
+	messages = inboxMessages("test-data-alice")
+	if test.AssertInt(len(messages), 1, t) && !strings.Contains(messages[0], "METHOD:REPLY") {
+		t.Error("The organizer should have received the reply:\n", messages[0])
+	}
+
+	organizerCopy, _, _ = global.Storage.GetResource("/test-data-alice/calendar/meeting.ics")
+	content, _ = organizerCopy.GetContentData()
+	if !strings.Contains(content, "ATTENDEE;PARTSTAT=ACCEPTED;SCHEDULE-STATUS=1.2:mailto:bob@example.com") {
+		t.Error("The organizer's copy should have the attendee's reply:\n", content)
+	}
+
+	// Test 3: the organizer deletes the meeting and the attendee gets the cancellation.
+	resp = deleteHandler{newScheduleHandlerData("DELETE", "/test-data-alice/calendar/meeting.ics", "")}.Handle()
+	test.AssertInt(resp.Status, http.StatusNoContent, t)
+
+	messages = inboxMessages("test-data-bob")
+	cancelled := 0
+	for _, msg := range messages {
+		if strings.Contains(msg, "METHOD:CANCEL") {
+			cancelled++
+		}
+	}
+	test.AssertInt(cancelled, 1, t)
+
+	// Test 4: the attendee gets the cancellations of the meetings in the deleted calendars, whether
+	// the storage deletes them child by child or at once.
+	for _, storage := range []data.Storage{test.NewFakeStorage(), global.Storage} {
+		resp = putHandler{newScheduleHandlerData("PUT", "/test-data-alice/work/meeting.ics", scheduledMeeting)}.Handle()
+		test.AssertInt(resp.Status, http.StatusCreated, t)
+
+		hdata := newScheduleHandlerData("DELETE", "/test-data-alice/work/", "")
+		hdata.storage = storage
+		resp = deleteHandler{hdata}.Handle()
+		test.AssertInt(resp.Status, http.StatusNoContent, t)
+		test.AssertResourceDoesNotExist("/test-data-alice/work", t)
+	}
+
+	cancelled = 0
+	for _, msg := range inboxMessages("test-data-bob") {
+		if strings.Contains(msg, "METHOD:CANCEL") {
+			cancelled++
+		}
+	}
+	test.AssertInt(cancelled, 3, t)
+}
+
+// Storage that fails to store the resources on the given path.
+type failingStorage struct {
+	test.FakeStorage
+	path string
+}
+
+func (s failingStorage) CreateResource(rpath, content string) (*data.Resource, error) {
+	if rpath == s.path {
+		return nil, errs.LockedError
+	}
+
+	return s.FakeStorage.CreateResource(rpath, content)
+}
+
+func TestSchedulingAfterStore(t *testing.T) {
+	defer setupScheduling()()
+
+	// the messages are not sent when the object could not be stored
+	rpath := "/test-data-alice/calendar/meeting.ics"
+	hdata := newScheduleHandlerData("PUT", rpath, scheduledMeeting)
+	hdata.storage = failingStorage{test.NewFakeStorage(), rpath}
+
+	resp := putHandler{hdata}.Handle()
+	test.AssertInt(resp.Status, http.StatusLocked, t)
+	test.AssertInt(len(inboxMessages("test-data-bob")), 0, t)
+
+	// when the delivery fails, the stored object has the actual scheduling status
+	hdata = newScheduleHandlerData("PUT", rpath, scheduledMeeting)
+	hdata.storage = failingStorage{test.NewFakeStorage(), ""}
+	os.MkdirAll("test-data-bob", os.ModePerm)
+	ioutil.WriteFile("test-data-bob/inbox", nil, os.ModePerm)
+
+	resp = putHandler{hdata}.Handle()
+	test.AssertInt(resp.Status, http.StatusCreated, t)
+
+	organizerCopy, _, _ := global.Storage.GetResource(rpath)
+	content, _ := organizerCopy.GetContentData()
+	if !strings.Contains(content, "SCHEDULE-STATUS=5.1:mailto:bob@example.com") {
+		t.Error("Wrong scheduling status in the organizer's copy:\n", content)
+	}
+}
+
+func TestSchedulingOnImport(t *testing.T) {
+	defer setupScheduling()()
+
+	// the objects imported into a calendar are scheduled like the ones stored with PUT
+	os.MkdirAll("test-data-alice/calendar", os.ModePerm)
+	resp := putHandler{newScheduleHandlerData("PUT", "/test-data-alice/calendar/", scheduledMeeting)}.Handle()
+	test.AssertInt(resp.Status, http.StatusMultiStatus, t)
+	test.AssertInt(len(inboxMessages("test-data-bob")), 1, t)
+
+	organizerCopy, _, _ := global.Storage.GetResource("/test-data-alice/calendar/meeting-1.ics")
+	content, _ := organizerCopy.GetContentData()
+	if !strings.Contains(content, "SCHEDULE-STATUS=1.2:mailto:bob@example.com") {
+		t.Error("Wrong scheduling status in the imported organizer's copy:\n", content)
+	}
+}
+
+func TestPostToOutbox(t *testing.T) {
+	defer setupScheduling()()
+
+	request := strings.Replace(scheduledMeeting, "PRODID:-//test//test//EN", "PRODID:-//test//test//EN\nMETHOD:REQUEST", 1)
+	loginAs("test-data-alice")
+	resp := postHandler{newScheduleHandlerData("POST", "/test-data-alice/outbox/", request)}.Handle()
+
+	expected := `
+  <?xml version="1.0" encoding="UTF-8"?>
+  <C:schedule-response xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav" xmlns:CS="http://calendarserver.org/ns/">
+    <C:response>
+      <C:recipient><D:href>mailto:bob@example.com</D:href></C:recipient>
+      <C:request-status>1.2;Delivered</C:request-status>
+    </C:response>
+    <C:response>
+      <C:recipient><D:href>mailto:carol@example.com</D:href></C:recipient>
+      <C:request-status>3.7;Invalid calendar user</C:request-status>
+    </C:response>
+  </C:schedule-response>`
+
+	test.AssertInt(resp.Status, http.StatusOK, t)
+	test.AssertMultistatusXML(resp.BodyString(), expected, t)
+	test.AssertInt(len(inboxMessages("test-data-bob")), 1, t)
+
+	// only the owner of the outbox can post to it
+	resp = postHandler{newScheduleHandlerData("POST", "/test-data-bob/outbox/", request)}.Handle()
+	test.AssertInt(resp.Status, http.StatusForbidden, t)
+	test.AssertInt(len(inboxMessages("test-data-bob")), 1, t)
+
+	// only the organizer can send requests
+	loginAs("test-data-bob")
+	resp = postHandler{newScheduleHandlerData("POST", "/test-data-bob/outbox/", request)}.Handle()
+	test.AssertInt(resp.Status, http.StatusForbidden, t)
+	if !strings.Contains(resp.BodyString(), "organizer-allowed") {
+		t.Error("Expected the organizer-allowed precondition, got:", resp.BodyString())
+	}
+
+	// an attendee replies only for itself
+	resp = putHandler{newScheduleHandlerData("PUT", "/test-data-alice/calendar/meeting.ics", scheduledMeeting)}.Handle()
+	test.AssertInt(resp.Status, http.StatusCreated, t)
+	reply := strings.Replace(request, "METHOD:REQUEST", "METHOD:REPLY", 1)
+	reply = strings.Replace(reply, "PARTSTAT=NEEDS-ACTION:mailto:bob", "PARTSTAT=ACCEPTED:mailto:bob", 1)
+	reply = strings.Replace(reply, "PARTSTAT=NEEDS-ACTION:mailto:carol", "PARTSTAT=DECLINED:mailto:carol", 1)
+	resp = postHandler{newScheduleHandlerData("POST", "/test-data-bob/outbox/", reply)}.Handle()
+	test.AssertInt(resp.Status, http.StatusOK, t)
+
+	organizerCopy, _, _ := global.Storage.GetResource("/test-data-alice/calendar/meeting.ics")
+	content, _ := organizerCopy.GetContentData()
+	if !strings.Contains(content, "PARTSTAT=ACCEPTED;SCHEDULE-STATUS=1.2:mailto:bob@example.com") || strings.Contains(content, "DECLINED") {
+		t.Error("The organizer's copy should have only the reply of bob:\n", content)
+	}
+
+	// POST is only allowed on the outbox
+	resp = postHandler{newScheduleHandlerData("POST", "/test-data-alice/calendar/", request)}.Handle()
+	test.AssertInt(resp.Status, http.StatusMethodNotAllowed, t)
+
+	resp = optionsHandler{newScheduleHandlerData("OPTIONS", "/test-data-alice/", "")}.Handle()
+	test.AssertStr(resp.Header.Get("DAV"), "1, 3, calendar-access, calendar-auto-schedule", t)
+}
+
+func TestIMIP(t *testing.T) {
+	defer setupScheduling()()
+
+	mailer := new(imip.MemoryMailer)
+	global.Mailer = mailer
+	defer func() { global.Mailer = nil }()
+
+	// the external attendee gets the request by email
+	resp := putHandler{newScheduleHandlerData("PUT", "/test-data-alice/calendar/meeting.ics", scheduledMeeting)}.Handle()
+	test.AssertInt(resp.Status, http.StatusCreated, t)
+
+	organizerCopy, _, _ := global.Storage.GetResource("/test-data-alice/calendar/meeting.ics")
+	content, _ := organizerCopy.GetContentData()
+	if !strings.Contains(content, "ATTENDEE;PARTSTAT=NEEDS-ACTION;SCHEDULE-STATUS=1.1:mailto:carol@example.com") {
+		t.Error("Wrong scheduling status for the external attendee:\n", content)
+	}
+
+	sent := mailer.Messages()
+	if test.AssertInt(len(sent), 1, t) {
+		test.AssertStr(sent[0].From, "alice@example.com", t)
+		test.AssertStr(strings.Join(sent[0].To, ","), "carol@example.com", t)
+		test.AssertStr(sent[0].Method(), "REQUEST", t)
+	}
+
+	// the reply of the external attendee is delivered to the organizer
+	accepted, _ := ics.Parse(strings.Replace(scheduledMeeting, "PARTSTAT=NEEDS-ACTION:mailto:carol", "PARTSTAT=ACCEPTED:mailto:carol", 1))
+	reply, _ := imip.NewMessage("mailto:carol@example.com", "mailto:alice@example.com", itip.NewReply(accepted, "mailto:carol@example.com"))
+
+	// the reply of an unverified sender is delivered without changing the organizer's copy
+	statuses := DeliverIMIP(reply, false)
+	test.AssertStr(statuses["mailto:alice@example.com"], itip.StatusDelivered, t)
+	test.AssertInt(len(inboxMessages("test-data-alice")), 1, t)
+
+	organizerCopy, _, _ = global.Storage.GetResource("/test-data-alice/calendar/meeting.ics")
+	content, _ = organizerCopy.GetContentData()
+	if !strings.Contains(content, "PARTSTAT=NEEDS-ACTION;SCHEDULE-STATUS=1.1:mailto:carol@example.com") {
+		t.Error("The organizer's copy should not change with an unverified reply:\n", content)
+	}
+
+	statuses = DeliverIMIP(reply, true)
+	test.AssertStr(statuses["mailto:alice@example.com"], itip.StatusDelivered, t)
+
+	organizerCopy, _, _ = global.Storage.GetResource("/test-data-alice/calendar/meeting.ics")
+	content, _ = organizerCopy.GetContentData()
+	if !strings.Contains(content, "ATTENDEE;PARTSTAT=ACCEPTED;SCHEDULE-STATUS=1.1:mailto:carol@example.com") {
+		t.Error("The organizer's copy should have the external attendee's reply:\n", content)
+	}
+
+	// only the attendee can send its reply
+	reply.From = "mallory@example.com"
+	statuses = DeliverIMIP(reply, true)
+	test.AssertStr(statuses["mailto:alice@example.com"], itip.StatusNoPrivileges, t)
+
+	// and only for itself: the replies with other attendees are neither delivered nor applied
+	declined, _ := ics.Parse(strings.Replace(scheduledMeeting, "PARTSTAT=NEEDS-ACTION:mailto:bob", "PARTSTAT=DECLINED:mailto:bob", 1))
+	forged := itip.NewReply(accepted, "mailto:carol@example.com")
+	itip.Components(forged)[0].Children = append(itip.Components(forged)[0].Children, itip.Attendee(itip.Components(declined)[0], "mailto:bob@example.com"))
+	reply, _ = imip.NewMessage("mailto:carol@example.com", "mailto:alice@example.com", forged)
+	statuses = DeliverIMIP(reply, true)
+	test.AssertStr(statuses["mailto:alice@example.com"], itip.StatusNoPrivileges, t)
+	test.AssertInt(len(inboxMessages("test-data-alice")), 2, t)
+
+	organizerCopy, _, _ = global.Storage.GetResource("/test-data-alice/calendar/meeting.ics")
+	content, _ = organizerCopy.GetContentData()
+	if strings.Contains(content, "PARTSTAT=DECLINED") {
+		t.Error("The organizer's copy should not change with a forged reply:\n", content)
+	}
+}
+
+// Directory allowing only alice to look up the free-busy time of the others.
+type freeBusyDirectory struct {
+	data.UserDirectory
+}
+
+func (d freeBusyDirectory) CanReadFreeBusy(requester, target *data.CalUser) bool {
+	return requester.Name == "test-data-alice"
+}
+
+func TestFreeBusy(t *testing.T) {
+	defer setupScheduling()()
+
+	event := func(uid, start, end, extra string) string {
+		return "BEGIN:VCALENDAR\nVERSION:2.0\nPRODID:-//test//test//EN\nBEGIN:VEVENT\nUID:" + uid +
+			"\nDTSTAMP:20170101T100000Z\nDTSTART:" + start + "\nDTEND:" + end + extra + "\nEND:VEVENT\nEND:VCALENDAR"
+	}
+
+	events := map[string]string{
+		"busy1.ics":       event("busy1", "20170102T090000Z", "20170102T100000Z", ""),
+		"busy2.ics":       event("busy2", "20170102T093000Z", "20170102T110000Z", ""),
+		"tentative.ics":   event("tentative", "20170102T140000Z", "20170102T150000Z", "\nSTATUS:TENTATIVE"),
+		"transparent.ics": event("transparent", "20170102T160000Z", "20170102T170000Z", "\nTRANSP:TRANSPARENT"),
+		"cancelled.ics":   event("cancelled", "20170102T180000Z", "20170102T190000Z", "\nSTATUS:CANCELLED"),
+		"outside.ics":     event("outside", "20170105T090000Z", "20170105T100000Z", ""),
+		"allday.ics":      strings.Replace(event("allday", "20170103", "20170104", ""), "DTSTART:", "DTSTART;VALUE=DATE:", 1),
+		"weekly.ics":      event("weekly", "20161226T120000Z", "20161226T130000Z", "\nRRULE:FREQ=WEEKLY"),
+		// the instance of January 2nd is excluded and the one of January 1st moved to January 2nd
+		"daily.ics": strings.Replace(event("daily", "20161231T210000Z", "20161231T220000Z", "\nRRULE:FREQ=DAILY;COUNT=4\nEXDATE:20170102T210000Z"),
+			"END:VEVENT", "END:VEVENT\nBEGIN:VEVENT\nUID:daily\nDTSTAMP:20170101T100000Z\nRECURRENCE-ID:20170101T210000Z\nDTSTART:20170102T190000Z\nDTEND:20170102T193000Z\nEND:VEVENT", 1),
+		// the floating times are in the time zone of the calendar
+		"floating.ics": event("floating", "20170102T170000", "20170102T173000", ""),
+	}
+	for name, content := range events {
+		if _, err := global.Storage.CreateResource("/test-data-bob/calendar/"+name, content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	global.Storage.(data.CalendarMetadataStorage).SetCalendarMetadata("/test-data-bob/calendar", &data.CalendarMetadata{
+		Timezone: "BEGIN:VCALENDAR\nBEGIN:VTIMEZONE\nTZID:Plus1\nBEGIN:STANDARD\nDTSTART:19700101T000000\nTZOFFSETFROM:+0100\nTZOFFSETTO:+0100\nEND:STANDARD\nEND:VTIMEZONE\nEND:VCALENDAR",
+	})
+
+	request := `BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:-//test//test//EN
+METHOD:REQUEST
+BEGIN:VFREEBUSY
+UID:freebusy-1
+DTSTAMP:20170101T100000Z
+DTSTART:20170102T000000Z
+DTEND:20170103T120000Z
+ORGANIZER:mailto:alice@example.com
+ATTENDEE:mailto:bob@example.com
+ATTENDEE:mailto:carol@example.com
+END:VFREEBUSY
+END:VCALENDAR`
+
+	// the storage keeps the time zone of the calendar
+	loginAs("test-data-alice")
+	hdata := newScheduleHandlerData("POST", "/test-data-alice/outbox/", request)
+	hdata.storage = global.Storage
+	resp := postHandler{hdata}.Handle()
+	test.AssertInt(resp.Status, http.StatusOK, t)
+
+	body := resp.BodyString()
+	for _, expected := range []string{
+		"<C:request-status>2.0;Success</C:request-status>",
+		"<C:request-status>3.7;Invalid calendar user</C:request-status>",
+		"METHOD:REPLY",
+		"ATTENDEE:mailto:bob@example.com",
+		"FREEBUSY;FBTYPE=BUSY:20170102T090000Z/20170102T110000Z",
+		// the all-day events are floating too, January 3rd starting at 23:00 UTC
+		"FREEBUSY;FBTYPE=BUSY:20170102T230000Z/20170103T120000Z",
+		"FREEBUSY;FBTYPE=BUSY-TENTATIVE:20170102T140000Z/20170102T150000Z",
+		"FREEBUSY;FBTYPE=BUSY:20170102T120000Z/20170102T130000Z",
+		"FREEBUSY;FBTYPE=BUSY:20170102T190000Z/20170102T193000Z",
+		"FREEBUSY;FBTYPE=BUSY:20170102T160000Z/20170102T163000Z",
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("The free-busy response should contain %q:\n%s", expected, body)
+		}
+	}
+
+	if strings.Count(body, "FREEBUSY;") != 6 {
+		t.Error("The transparent, cancelled, excluded and out of range events must not be busy:\n", body)
+	}
+
+	// the directory can deny the lookup
+	global.UserDirectory = freeBusyDirectory{global.UserDirectory}
+	loginAs("test-data-bob")
+	resp = postHandler{newScheduleHandlerData("POST", "/test-data-bob/outbox/", strings.Replace(request, "ORGANIZER:mailto:alice", "ORGANIZER:mailto:bob", 1))}.Handle()
+	if !strings.Contains(resp.BodyString(), "<C:request-status>3.8;No scheduling privileges</C:request-status>") {
+		t.Error("The lookup should not be allowed:\n", resp.BodyString())
+	}
+
+	// only the owner of the outbox can be the organizer
+	resp = postHandler{newScheduleHandlerData("POST", "/test-data-bob/outbox/", request)}.Handle()
+	test.AssertInt(resp.Status, http.StatusForbidden, t)
+
+	// and only the current user can look up the free-busy time through its outbox
+	resp = postHandler{newScheduleHandlerData("POST", "/test-data-alice/outbox/", request)}.Handle()
+	test.AssertInt(resp.Status, http.StatusForbidden, t)
+	if strings.Contains(resp.BodyString(), "FREEBUSY") {
+		t.Error("The lookup should not be answered:\n", resp.BodyString())
+	}
+}
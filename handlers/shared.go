@@ -2,17 +2,39 @@ package handlers
 
 import (
 	"bytes"
+	"io"
 	"io/ioutil"
 	"net/http"
+
+	"github.com/samedi/caldav-go/errs"
 )
 
 // This function reads the request body and restore its content, so that
-// the request body can be read a second time.
-func readRequestBody(request *http.Request) string {
+// the request body can be read a second time. If `maxSize` is greater than zero
+// and the body is bigger than that, it returns `errs.RequestBodyTooLargeError`.
+func readRequestBody(request *http.Request, maxSize int64) (string, error) {
+	if request.Body == nil {
+		return "", nil
+	}
+
+	var reader io.Reader = request.Body
+	if maxSize > 0 {
+		// reads one byte more than allowed to be able to tell if the body is too large
+		reader = io.LimitReader(request.Body, maxSize+1)
+	}
+
 	// Read the content
-	body, _ := ioutil.ReadAll(request.Body)
+	body, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return "", err
+	}
+
+	if maxSize > 0 && int64(len(body)) > maxSize {
+		return "", errs.RequestBodyTooLargeError
+	}
+
 	// Restore the io.ReadCloser to its original state
 	request.Body = ioutil.NopCloser(bytes.NewBuffer(body))
 	// Use the content
-	return string(body)
+	return string(body), nil
 }
@@ -0,0 +1,121 @@
+package ics
+
+import (
+	"errors"
+
+	"github.com/laurent22/ical-go"
+
+	"github.com/samedi/caldav-go/lib"
+)
+
+const (
+	// PRODID is the product identifier used in the iCalendar objects generated by the lib.
+	PRODID = "-//samedi//caldav-go//EN"
+)
+
+// NewCalendar initializes a new VCALENDAR component with the required VERSION and PRODID properties.
+func NewCalendar(children ...*ical.Node) *ical.Node {
+	cal := NewComponent(lib.VCALENDAR)
+	cal.Children = append(cal.Children, NewProperty("VERSION", "2.0", nil), NewProperty("PRODID", PRODID, nil))
+	cal.Children = append(cal.Children, children...)
+
+	return cal
+}
+
+// Merge merges several VCALENDAR objects into a single one, containing all their components.
+// VTIMEZONE components are deduplicated by their TZID, keeping the first definition found.
+func Merge(calendars ...*ical.Node) *ical.Node {
+	result := NewCalendar()
+	timezones := make(map[string]bool)
+
+	for _, cal := range calendars {
+		for _, comp := range Components(cal) {
+			if comp.Name == lib.VTIMEZONE {
+				tzid := comp.PropString("TZID", "")
+				if timezones[tzid] {
+					continue
+				}
+				timezones[tzid] = true
+			}
+
+			result.Children = append(result.Children, comp)
+		}
+	}
+
+	return result
+}
+
+// SplitByUID splits a VCALENDAR object containing several components into one VCALENDAR per UID,
+// as required for calendar object resources (RFC4791#4.1). All the components sharing the same UID
+// (e.g. recurrence overrides) stay together and each object gets the VTIMEZONEs referenced in it.
+// Calendar level properties are copied to each object, except METHOD. The objects are returned in the order
+// their UIDs first appear, mapped by the UID. An error is returned if any component is missing the UID.
+func SplitByUID(cal *ical.Node) ([]string, map[string]*ical.Node, error) {
+	uids := []string{}
+	objects := make(map[string]*ical.Node)
+	timezones := make(map[string]*ical.Node)
+
+	for _, comp := range Components(cal, lib.VTIMEZONE) {
+		timezones[comp.PropString("TZID", "")] = comp
+	}
+
+	for _, comp := range Components(cal) {
+		if comp.Name == lib.VTIMEZONE {
+			continue
+		}
+
+		uid := comp.PropString("UID", "")
+		if uid == "" {
+			return nil, nil, errors.New("ics: component " + comp.Name + " is missing the UID property")
+		}
+
+		object, found := objects[uid]
+		if !found {
+			object = NewComponent(cal.Name)
+			for _, prop := range cal.Children {
+				if !IsComponent(prop) && prop.Name != "METHOD" {
+					object.Children = append(object.Children, Clone(prop))
+				}
+			}
+
+			objects[uid] = object
+			uids = append(uids, uid)
+		}
+
+		for _, tzid := range referencedTZIDs(comp) {
+			tz, exists := timezones[tzid]
+			if exists && !hasTimezone(object, tzid) {
+				object.Children = append(object.Children, Clone(tz))
+			}
+		}
+
+		object.Children = append(object.Children, Clone(comp))
+	}
+
+	return uids, objects, nil
+}
+
+// returns the TZIDs referenced by the properties of the component and its sub components.
+func referencedTZIDs(comp *ical.Node) []string {
+	tzids := []string{}
+
+	for _, child := range comp.Children {
+		if IsComponent(child) {
+			tzids = append(tzids, referencedTZIDs(child)...)
+		} else if tzid := child.Parameter("TZID", ""); tzid != "" && !contains(tzids, tzid) {
+			tzids = append(tzids, tzid)
+		}
+	}
+
+	return tzids
+}
+
+func hasTimezone(cal *ical.Node, tzid string) bool {
+	for _, tz := range Components(cal, lib.VTIMEZONE) {
+		if tz.PropString("TZID", "") == tzid {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,68 @@
+package ics
+
+import (
+	"fmt"
+
+	"github.com/laurent22/ical-go"
+)
+
+// The media types of the formats of the calendar data.
+const (
+	// MediaTypeICalendar is the media type of the iCalendar format (RFC5545).
+	MediaTypeICalendar = "text/calendar"
+	// MediaTypeJCal is the media type of the jCal format (RFC7265).
+	MediaTypeJCal = "application/calendar+json"
+	// MediaTypeXCal is the media type of the xCal format (RFC6321).
+	MediaTypeXCal = "application/calendar+xml"
+)
+
+// MediaTypes are the media types of the formats the iCalendar data can be converted to and from.
+var MediaTypes = []string{MediaTypeICalendar, MediaTypeJCal, MediaTypeXCal}
+
+// ConvertTo converts the iCalendar data to the format of the given media type.
+func ConvertTo(data, mediaType string) (string, error) {
+	if mediaType == MediaTypeICalendar {
+		return data, nil
+	}
+
+	cal, err := Parse(data)
+	if err != nil {
+		return "", err
+	}
+
+	var converted []byte
+	switch mediaType {
+	case MediaTypeJCal:
+		converted, err = MarshalJCal(cal)
+	case MediaTypeXCal:
+		converted, err = MarshalXCal(cal)
+	default:
+		err = fmt.Errorf("ics: unsupported media type %s", mediaType)
+	}
+
+	return string(converted), err
+}
+
+// ConvertFrom converts data in the format of the given media type to iCalendar data.
+func ConvertFrom(data, mediaType string) (string, error) {
+	if mediaType == MediaTypeICalendar {
+		return data, nil
+	}
+
+	var cal *ical.Node
+	var err error
+	switch mediaType {
+	case MediaTypeJCal:
+		cal, err = ParseJCal([]byte(data))
+	case MediaTypeXCal:
+		cal, err = ParseXCal([]byte(data))
+	default:
+		err = fmt.Errorf("ics: unsupported media type %s", mediaType)
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return Serialize(cal), nil
+}
@@ -0,0 +1,768 @@
+package ics
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/laurent22/ical-go"
+)
+
+func TestParse(t *testing.T) {
+	data := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"BEGIN:VEVENT",
+		"UID:123",
+		"SUMMARY:A very long summary that got",
+		"  folded by the client",
+		`ATTENDEE;CN="Doe, John";PARTSTAT=ACCEPTED:mailto:john@example.com`,
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}, "\r\n")
+
+	cal, err := Parse(data)
+	if err != nil {
+		t.Fatal("Parsing valid data returned an error:", err)
+	}
+
+	vevent := cal.ChildByName("VEVENT")
+	if vevent == nil {
+		t.Fatal("Parsed calendar should have a VEVENT")
+	}
+
+	if summary := vevent.PropString("SUMMARY", ""); summary != "A very long summary that got folded by the client" {
+		t.Error("Folded lines should be unfolded, got:", summary)
+	}
+
+	attendee := vevent.ChildByName("ATTENDEE")
+	if attendee.Value != "mailto:john@example.com" {
+		t.Error("Expected attendee value to be mailto:john@example.com, got:", attendee.Value)
+	}
+	if attendee.Parameter("CN", "") != "Doe, John" || attendee.Parameter("PARTSTAT", "") != "ACCEPTED" {
+		t.Error("Attendee params were not parsed correctly:", attendee.Parameters)
+	}
+
+	invalidData := []string{
+		"",
+		"BEGIN:VCALENDAR\nBEGIN:VEVENT\nEND:VCALENDAR",
+		"BEGIN:VCALENDAR\nFOO\nEND:VCALENDAR",
+		"BEGIN:VCALENDAR",
+		"UID:123",
+	}
+
+	for _, data := range invalidData {
+		if _, err := Parse(data); err == nil {
+			t.Error("Parsing invalid data should return an error. Data:", data)
+		}
+	}
+}
+
+func TestParseIndented(t *testing.T) {
+	// hand written data with a common indentation is still parsed, keeping its folded lines
+	cal, err := Parse(`
+  BEGIN:VCALENDAR
+  BEGIN:VEVENT
+  DTSTART:20160914T170000
+  SUMMARY:Hello 
+   World
+  END:VEVENT
+  END:VCALENDAR
+  `)
+
+	if err != nil {
+		t.Fatal("Parsing indented data returned an error:", err)
+	}
+
+	if value, _ := cal.DigProperty("VEVENT", "DTSTART"); value != "20160914T170000" {
+		t.Error("Expected DTSTART to be 20160914T170000, got", value)
+	}
+	if value, _ := cal.DigProperty("VEVENT", "SUMMARY"); value != "Hello World" {
+		t.Errorf("Expected SUMMARY to be %q, got %q", "Hello World", value)
+	}
+}
+
+func TestParseFolded(t *testing.T) {
+	// the spaces at the end of the folded segments and of the values are part of the content
+	cal, err := Parse("BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nSUMMARY:Hello \r\n World\r\nLOCATION:Room 1 \r\nEND:VEVENT\r\nEND:VCALENDAR\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if value, _ := cal.DigProperty("VEVENT", "SUMMARY"); value != "Hello World" {
+		t.Errorf("Expected SUMMARY to be %q, got %q", "Hello World", value)
+	}
+	if value, _ := cal.DigProperty("VEVENT", "LOCATION"); value != "Room 1 " {
+		t.Errorf("Expected LOCATION to be %q, got %q", "Room 1 ", value)
+	}
+
+	// a long text folded right after a space is parsed back as it was
+	description := strings.Repeat("x", 62) + " and more words"
+	serialized := Serialize(NewCalendar(NewComponent("VEVENT", NewProperty("DESCRIPTION", description, nil))))
+	if !strings.Contains(serialized, " \r\n ") {
+		t.Fatal("Expected a fold after a space | Got:", serialized)
+	}
+
+	parsed, err := Parse(serialized)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := parsed.DigProperty("VEVENT", "DESCRIPTION"); value != description {
+		t.Errorf("Expected DESCRIPTION to be %q, got %q", description, value)
+	}
+}
+
+func TestSerialize(t *testing.T) {
+	cal := NewCalendar(NewComponent("VEVENT",
+		NewProperty("UID", "123", nil),
+		NewProperty("SUMMARY", strings.Repeat("x", 100), nil),
+		NewProperty("ATTENDEE", "mailto:john@example.com", map[string]string{"PARTSTAT": "ACCEPTED", "CN": "Doe, John"}),
+	))
+
+	expected := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//samedi//caldav-go//EN",
+		"BEGIN:VEVENT",
+		"UID:123",
+		"SUMMARY:" + strings.Repeat("x", 67),
+		" " + strings.Repeat("x", 33),
+		`ATTENDEE;CN="Doe, John";PARTSTAT=ACCEPTED:mailto:john@example.com`,
+		"END:VEVENT",
+		"END:VCALENDAR",
+		"",
+	}, "\r\n")
+
+	if result := Serialize(cal); result != expected {
+		t.Error("Expected:", expected, "| Got:", result)
+	}
+
+	// serializing the parsed result gives back the same content
+	parsed, err := Parse(expected)
+	if err != nil {
+		t.Fatal("Parsing serialized data returned an error:", err)
+	}
+	if result := Serialize(parsed); result != expected {
+		t.Error("Expected:", expected, "| Got:", result)
+	}
+}
+
+func TestSplitByUID(t *testing.T) {
+	cal, _ := Parse(`BEGIN:VCALENDAR
+VERSION:2.0
+METHOD:PUBLISH
+BEGIN:VTIMEZONE
+TZID:Europe/Berlin
+END:VTIMEZONE
+BEGIN:VEVENT
+UID:1
+DTSTART;TZID=Europe/Berlin:20160914T170000
+END:VEVENT
+BEGIN:VEVENT
+UID:2
+END:VEVENT
+BEGIN:VEVENT
+UID:1
+RECURRENCE-ID;TZID=Europe/Berlin:20160915T170000
+END:VEVENT
+END:VCALENDAR`)
+
+	uids, objects, err := SplitByUID(cal)
+	if err != nil {
+		t.Fatal("Splitting returned an error:", err)
+	}
+
+	if strings.Join(uids, ",") != "1,2" {
+		t.Error("Expected UIDs 1,2, got", uids)
+	}
+
+	if n := len(Components(objects["1"], "VEVENT")); n != 2 {
+		t.Error("Object 1 should have 2 VEVENTs, got", n)
+	}
+	if n := len(Components(objects["1"], "VTIMEZONE")); n != 1 {
+		t.Error("Object 1 should have 1 VTIMEZONE, got", n)
+	}
+	if n := len(Components(objects["2"], "VTIMEZONE")); n != 0 {
+		t.Error("Object 2 should not have any VTIMEZONE, got", n)
+	}
+	if Property(objects["1"], "METHOD") != nil {
+		t.Error("Objects should not have the METHOD property")
+	}
+
+	cal, _ = Parse("BEGIN:VCALENDAR\nBEGIN:VEVENT\nSUMMARY:No UID\nEND:VEVENT\nEND:VCALENDAR")
+	if _, _, err := SplitByUID(cal); err == nil {
+		t.Error("Splitting components without UID should return an error")
+	}
+}
+
+func TestPeriod(t *testing.T) {
+	tests := []struct {
+		props    string
+		expected string
+	}{
+		{"DTSTART:20170102T100000Z\nDTEND:20170102T113000Z", "2017-01-02 10:00 - 2017-01-02 11:30"},
+		{"DTSTART:20170102T100000Z\nDURATION:P1DT2H", "2017-01-02 10:00 - 2017-01-03 12:00"},
+		{"DTSTART;VALUE=DATE:20170102", "2017-01-02 00:00 - 2017-01-03 00:00"},
+		{"DTSTART;TZID=Europe/Berlin:20170102T100000", "2017-01-02 09:00 - 2017-01-02 09:00"},
+		{"DTSTART:invalid", ""},
+	}
+
+	for _, tt := range tests {
+		cal, err := Parse("BEGIN:VEVENT\n" + tt.props + "\nEND:VEVENT")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got := ""
+		if start, end, ok := Period(cal); ok {
+			got = start.UTC().Format("2006-01-02 15:04") + " - " + end.UTC().Format("2006-01-02 15:04")
+		}
+		if got != tt.expected {
+			t.Errorf("Wrong period for %q: expected %q, got %q", tt.props, tt.expected, got)
+		}
+	}
+
+	if d, ok := ParseDuration("-PT15M"); !ok || d != -15*time.Minute {
+		t.Error("Wrong negative duration:", d)
+	}
+	if _, ok := ParseDuration("P"); ok {
+		t.Error("An empty duration must be invalid")
+	}
+}
+
+const customBerlin = `BEGIN:VCALENDAR
+BEGIN:VTIMEZONE
+TZID:Custom Berlin
+BEGIN:DAYLIGHT
+TZOFFSETFROM:+0100
+TZOFFSETTO:+0200
+DTSTART:19810329T020000
+RRULE:FREQ=YEARLY;BYMONTH=3;BYDAY=-1SU
+END:DAYLIGHT
+BEGIN:STANDARD
+TZOFFSETFROM:+0200
+TZOFFSETTO:+0100
+DTSTART:19961027T030000
+RRULE:FREQ=YEARLY;BYMONTH=10;BYDAY=-1SU
+END:STANDARD
+END:VTIMEZONE
+BEGIN:VEVENT
+DTSTART;TZID=Custom Berlin:20160914T170000
+DTEND;TZID=Custom Berlin:20161214T170000
+END:VEVENT
+END:VCALENDAR`
+
+func TestTimezone(t *testing.T) {
+	cal, err := Parse(customBerlin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tz, err := ParseTimezone(Components(cal, "VTIMEZONE")[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		wall     string
+		expected string
+	}{
+		{"20160914T170000", "20160914T150000Z"},
+		{"20161214T170000", "20161214T160000Z"},
+		// right before and after the changes of 2016 (March 27th and October 30th)
+		{"20160327T015900", "20160327T005900Z"},
+		{"20160327T030000", "20160327T010000Z"},
+		{"20161030T035900", "20161030T025900Z"},
+		{"19700101T000000", "19691231T230000Z"},
+	}
+
+	for _, tt := range tests {
+		wall, _ := time.Parse("20060102T150405", tt.wall)
+		if got := tz.ToUTC(wall).Format("20060102T150405Z"); got != tt.expected {
+			t.Errorf("Wrong UTC time for %s: expected %s, got %s", tt.wall, tt.expected, got)
+		}
+	}
+
+	// the time zones of the object are used to resolve the times
+	start, end, _ := NewTimeContext(cal, nil).Period(Components(cal, "VEVENT")[0])
+	if start.Format("20060102T150405Z") != "20160914T150000Z" || end.Format("20060102T150405Z") != "20161214T160000Z" {
+		t.Error("Wrong period with the VTIMEZONE:", start, end)
+	}
+
+	// the floating times and dates are resolved in the floating time zone
+	newYork, _ := LoadTimezone("America/New_York")
+	ctx := NewTimeContext(nil, newYork)
+	for value, expected := range map[string]string{"20160914T170000": "20160914T210000Z", "20160914": "20160914T040000Z", "20160914T170000Z": "20160914T170000Z"} {
+		if got, _ := ctx.DateTime(NewProperty("DTSTART", value, nil)); got.Format("20060102T150405Z") != expected {
+			t.Errorf("Wrong floating time for %s: expected %s, got %s", value, expected, got)
+		}
+	}
+
+	if _, ok := LoadTimezone("/mozilla.org/20050126_1/Europe/Berlin"); !ok {
+		t.Error("The IANA time zones prefixed with a path must be known")
+	}
+
+	if _, err := ParseCalendarTimezone(strings.Replace(customBerlin, "TZOFFSETTO:+0200", "TZOFFSETTO:invalid", 1)); err == nil {
+		t.Error("Expected an error for an invalid VTIMEZONE")
+	}
+}
+
+func TestEachInstance(t *testing.T) {
+	tests := []struct {
+		props    string
+		expected string
+	}{
+		{"DTSTART:20170102T100000Z\nRRULE:FREQ=DAILY;COUNT=3", "01-02 10:00, 01-03 10:00, 01-04 10:00"},
+		{"DTSTART:20170102T100000Z\nRRULE:FREQ=WEEKLY;BYDAY=MO,WE;UNTIL=20170111T000000Z", "01-02 10:00, 01-04 10:00, 01-09 10:00"},
+		{"DTSTART:20170104T100000Z\nRRULE:FREQ=WEEKLY;COUNT=3", "01-04 10:00, 01-11 10:00, 01-18 10:00"},
+		{"DTSTART:20170131T100000Z\nRRULE:FREQ=MONTHLY;COUNT=3", "01-31 10:00, 03-31 10:00, 05-31 10:00"},
+		{"DTSTART:20170105T100000Z\nRRULE:FREQ=MONTHLY;BYDAY=-1FR;COUNT=3", "01-05 10:00, 01-27 10:00, 02-24 10:00"},
+		{"DTSTART:20170102T100000Z\nRRULE:FREQ=MONTHLY;BYDAY=MO,TU,WE,TH,FR;BYSETPOS=-1;COUNT=2", "01-02 10:00, 01-31 10:00"},
+		{"DTSTART:20170102T100000Z\nRRULE:FREQ=DAILY;INTERVAL=2;COUNT=4\nEXDATE:20170104T100000Z\nRDATE:20170103T120000Z", "01-02 10:00, 01-03 12:00, 01-06 10:00, 01-08 10:00"},
+		{"DTSTART;TZID=Europe/Berlin:20170324T100000\nRRULE:FREQ=DAILY;COUNT=3", "03-24 09:00, 03-25 09:00, 03-26 08:00"},
+		{"DTSTART:20170102T100000Z", "01-02 10:00"},
+	}
+
+	for _, tt := range tests {
+		cal, err := Parse("BEGIN:VCALENDAR\nBEGIN:VEVENT\nUID:1\n" + tt.props + "\nEND:VEVENT\nEND:VCALENDAR")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var got []string
+		NewTimeContext(cal, nil).EachInstance(cal, "VEVENT", time.Time{}, func(comp *ical.Node, start, end time.Time) bool {
+			got = append(got, start.Format("01-02 15:04"))
+			return len(got) < 10
+		})
+
+		if strings.Join(got, ", ") != tt.expected {
+			t.Errorf("Wrong instances for %q: expected %q, got %q", tt.props, tt.expected, strings.Join(got, ", "))
+		}
+	}
+
+	// the overridden instances are given by their own component, and the expansion stops when asked to
+	cal, _ := Parse("BEGIN:VCALENDAR\nBEGIN:VEVENT\nUID:1\nDTSTART:20170102T100000Z\nRRULE:FREQ=DAILY\nEND:VEVENT\n" +
+		"BEGIN:VEVENT\nUID:1\nRECURRENCE-ID:20170103T100000Z\nDTSTART:20170103T150000Z\nEND:VEVENT\nEND:VCALENDAR")
+
+	var got []string
+	NewTimeContext(cal, nil).EachInstance(cal, "VEVENT", time.Time{}, func(comp *ical.Node, start, end time.Time) bool {
+		got = append(got, start.Format("01-02 15:04"))
+		return start.Before(time.Date(2017, 1, 4, 0, 0, 0, 0, time.UTC))
+	})
+
+	if strings.Join(got, ", ") != "01-02 10:00, 01-04 10:00, 01-03 15:00" {
+		t.Error("Wrong instances with an override:", got)
+	}
+
+	// the expansion goes up to the end of the range, and is incomplete when stopped by the limits before it
+	rangeEnd := time.Date(2017, 1, 5, 10, 0, 1, 0, time.UTC)
+	for _, tt := range []struct {
+		rrule    string
+		rangeEnd time.Time
+		last     string
+		complete bool
+	}{
+		{"FREQ=SECONDLY", rangeEnd, "01-05 10:00:00", true},
+		{"FREQ=SECONDLY", time.Time{}, "01-13 23:46:39", false},
+		{"FREQ=SECONDLY;BYMONTH=3", time.Date(2017, 3, 1, 0, 0, 1, 0, time.UTC), "03-01 00:00:00", true},
+		{"FREQ=DAILY;BYMONTH=2;BYMONTHDAY=30", rangeEnd, "01-02 10:00:00", true},
+		{"FREQ=DAILY;BYMONTH=2;BYMONTHDAY=30", time.Time{}, "01-02 10:00:00", false},
+	} {
+		cal, _ := Parse("BEGIN:VCALENDAR\nBEGIN:VEVENT\nUID:1\nDTSTART:20170102T100000Z\nRRULE:" + tt.rrule + "\nEND:VEVENT\nEND:VCALENDAR")
+
+		var last time.Time
+		complete := NewTimeContext(cal, nil).EachInstance(cal, "VEVENT", tt.rangeEnd, func(comp *ical.Node, start, end time.Time) bool {
+			last = start
+			return true
+		})
+
+		if last.Format("01-02 15:04:05") != tt.last || complete != tt.complete {
+			t.Errorf("Wrong expansion of %q: expected %s (%t), got %s (%t)", tt.rrule, tt.last, tt.complete, last.Format("01-02 15:04:05"), complete)
+		}
+	}
+}
+
+func TestObject(t *testing.T) {
+	data := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"X-WR-CALNAME:Work",
+		"BEGIN:VTIMEZONE",
+		"TZID:Europe/Berlin",
+		"END:VTIMEZONE",
+		"BEGIN:VEVENT",
+		"UID:123",
+		"DTSTART;TZID=Europe/Berlin:20170102T100000",
+		"DURATION:PT1H30M",
+		"RRULE:FREQ=WEEKLY;BYDAY=MO,WE;UNTIL=20170131T000000Z;BYHOUR=10",
+		"SUMMARY;LANGUAGE=en:Team meeting\\, weekly",
+		"SEQUENCE:2",
+		"ORGANIZER;CN=John:mailto:john@example.com",
+		`ATTENDEE;CN="Doe, Jane";PARTSTAT=ACCEPTED;RSVP=TRUE;DELEGATED-FROM="mailto:bob@example.com":mailto:jane@example.com`,
+		"ATTENDEE:mailto:bob@example.com",
+		"CATEGORIES:WORK,MEETING",
+		"CATEGORIES:TEAM\\,INTERNAL",
+		"X-CUSTOM;X-PARAM=1:custom value",
+		"BEGIN:VALARM",
+		"ACTION:DISPLAY",
+		"TRIGGER;RELATED=END:-PT15M",
+		"X-ALARM:yes",
+		"END:VALARM",
+		"END:VEVENT",
+		"BEGIN:VTODO",
+		"UID:456",
+		"DUE;VALUE=DATE:20170110",
+		"PERCENT-COMPLETE:50",
+		"END:VTODO",
+		"END:VCALENDAR",
+	}, "\r\n")
+
+	obj, err := ParseObject(data)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	if len(obj.Events) != 1 || len(obj.Todos) != 1 || len(obj.Journals) != 0 || len(obj.Components) != 1 {
+		t.Fatal("Wrong components:", obj)
+	}
+
+	event := obj.Events[0]
+	if event.UID != "123" || event.Summary != "Team meeting, weekly" || event.Sequence != 2 || event.Duration != 90*time.Minute {
+		t.Error("Wrong event properties:", event.UID, event.Summary, event.Sequence, event.Duration)
+	}
+	if event.Start.TZID != "Europe/Berlin" || event.Start.Floating || event.Start.Time != time.Date(2017, 1, 2, 10, 0, 0, 0, time.UTC) {
+		t.Error("Wrong event start:", event.Start)
+	}
+	if rule := event.Rule; rule.Freq != "WEEKLY" || strings.Join(rule.ByDay, ",") != "MO,WE" || rule.Until.String() != "20170131T000000Z" || rule.Parts["BYHOUR"] != "10" {
+		t.Error("Wrong recurrence rule:", rule)
+	}
+	if event.Organizer.Address != "mailto:john@example.com" || event.Organizer.CommonName != "John" {
+		t.Error("Wrong organizer:", event.Organizer)
+	}
+	if len(event.Attendees) != 2 {
+		t.Fatal("Expected 2 attendees | Got:", len(event.Attendees))
+	}
+	if jane := event.Attendees[0]; jane.CommonName != "Doe, Jane" || jane.PartStat != "ACCEPTED" || !jane.RSVP || jane.Params["DELEGATED-FROM"] != "mailto:bob@example.com" {
+		t.Error("Wrong attendee:", jane)
+	}
+	if strings.Join(event.Categories, "|") != "WORK|MEETING|TEAM,INTERNAL" {
+		t.Error("Wrong categories:", event.Categories)
+	}
+	if len(event.Properties) != 1 || event.Properties[0].Name != "X-CUSTOM" {
+		t.Error("The X- properties should be kept:", event.Properties)
+	}
+	if len(event.Alarms) != 1 || event.Alarms[0].Trigger.Offset != -15*time.Minute || !event.Alarms[0].Trigger.RelatedEnd {
+		t.Error("Wrong alarms:", event.Alarms)
+	}
+
+	todo := obj.Todos[0]
+	if !todo.Due.Date || todo.Due.String() != "20170110" || todo.PercentComplete != 50 {
+		t.Error("Wrong to-do:", todo.Due, todo.PercentComplete)
+	}
+
+	// the content is the same once encoded again
+	encoded := obj.String()
+	for _, line := range []string{
+		"X-WR-CALNAME:Work",
+		"DTSTART;TZID=Europe/Berlin:20170102T100000",
+		"DURATION:PT1H30M",
+		"RRULE:FREQ=WEEKLY;UNTIL=20170131T000000Z;BYDAY=MO,WE;BYHOUR=10",
+		"SUMMARY;LANGUAGE=en:Team meeting\\, weekly",
+		`ATTENDEE;CN="Doe, Jane";DELEGATED-FROM="mailto:bob@example.com";PARTSTAT=ACCEPTED;RSVP=TRUE:mailto:jane@example.com`,
+		"CATEGORIES:WORK,MEETING,TEAM\\,INTERNAL",
+		"X-CUSTOM;X-PARAM=1:custom value",
+		"TRIGGER;RELATED=END:-PT15M",
+		"X-ALARM:yes",
+		"DUE;VALUE=DATE:20170110",
+		"TZID:Europe/Berlin",
+	} {
+		if !strings.Contains(strings.Replace(encoded, CRLF+" ", "", -1), line+CRLF) {
+			t.Errorf("Expected the line %q in:\n%s", line, encoded)
+		}
+	}
+
+	again, err := ParseObject(encoded)
+	if err != nil || again.String() != encoded {
+		t.Error("Encoding the object twice should give the same data:", err)
+	}
+}
+
+func TestNewObject(t *testing.T) {
+	obj := NewObject()
+	event := &Event{Location: "Office", Duration: time.Hour}
+	event.UID = "123"
+	event.Start = UTC(time.Date(2017, 1, 2, 10, 0, 0, 0, time.FixedZone("", 3600)))
+	event.Attendees = []*Attendee{{Address: "mailto:jane@example.com", PartStat: "NEEDS-ACTION"}}
+	event.Alarms = []*Alarm{{Action: "DISPLAY", Trigger: Trigger{At: time.Date(2017, 1, 2, 8, 0, 0, 0, time.UTC)}}}
+	obj.Events = append(obj.Events, event)
+
+	expected := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:" + PRODID,
+		"BEGIN:VEVENT",
+		"UID:123",
+		"DTSTART:20170102T090000Z",
+		"LOCATION:Office",
+		"DURATION:PT1H",
+		"ATTENDEE;PARTSTAT=NEEDS-ACTION:mailto:jane@example.com",
+		"BEGIN:VALARM",
+		"ACTION:DISPLAY",
+		"TRIGGER;VALUE=DATE-TIME:20170102T080000Z",
+		"END:VALARM",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}, CRLF) + CRLF
+
+	if obj.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, obj.String())
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	tests := map[time.Duration]string{
+		0:                          "PT0S",
+		-15 * time.Minute:          "-PT15M",
+		14 * 24 * time.Hour:        "P2W",
+		26*time.Hour + time.Second: "P1DT2H1S",
+		24 * time.Hour:             "P1D",
+		90 * time.Minute:           "PT1H30M",
+	}
+
+	for duration, expected := range tests {
+		if got := FormatDuration(duration); got != expected {
+			t.Errorf("Wrong format of %s: expected %q, got %q", duration, expected, got)
+		}
+		if parsed, _ := ParseDuration(FormatDuration(duration)); parsed != duration {
+			t.Errorf("Wrong duration parsed from %q: %s", expected, parsed)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	data := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"BEGIN:VTIMEZONE",
+		"TZID:Europe/Berlin",
+		"END:VTIMEZONE",
+		"BEGIN:VTIMEZONE",
+		"TZID:Europe/Berlin",
+		"X-DUPLICATE:yes",
+		"END:VTIMEZONE",
+		"BEGIN:VTIMEZONE",
+		"TZID:America/New_York",
+		"END:VTIMEZONE",
+		"BEGIN:VEVENT",
+		"SUMMARY:" + strings.Repeat("A long summary. ", 6),
+		"DTSTART;TZID=Europe/Berlin:20170102T100000",
+		"LAST-MODIFIED;TZID=Europe/Berlin:20170101T100000",
+		"BEGIN:VALARM",
+		"ACTION:DISPLAY",
+		"END:VALARM",
+		"UID:123",
+		"END:VEVENT",
+		"VERSION:2.0",
+		"END:VCALENDAR",
+	}, "\n")
+
+	normalized, err := Normalize(data, DefaultNormalizers...)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(normalized, CRLF), CRLF)
+	expected := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:" + PRODID,
+		"BEGIN:VTIMEZONE",
+		"TZID:Europe/Berlin",
+		"END:VTIMEZONE",
+		"BEGIN:VEVENT",
+		"UID:123",
+		"DTSTAMP:",
+		"SUMMARY:A long summary. A long summary. A long summary. A long summary. A l",
+		" ong summary. A long summary.",
+		"DTSTART;TZID=Europe/Berlin:20170102T100000",
+		"LAST-MODIFIED:20170101T090000Z",
+		"BEGIN:VALARM",
+		"ACTION:DISPLAY",
+		"END:VALARM",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}
+
+	if len(lines) != len(expected) {
+		t.Fatalf("Wrong normalized data:\n%s", normalized)
+	}
+	for i := range lines {
+		if !strings.HasPrefix(lines[i], expected[i]) {
+			t.Errorf("Expected the line %q | Got: %q", expected[i], lines[i])
+		}
+	}
+
+	// the normalized data does not change anymore
+	if again, _ := Normalize(normalized, DefaultNormalizers...); again != normalized {
+		t.Errorf("The normalized data should not change:\n%s", again)
+	}
+
+	if _, err := Normalize("BEGIN:VCALENDAR", DefaultNormalizers...); err == nil {
+		t.Error("Expected an error for invalid data")
+	}
+}
+
+// A calendar with values of all the kinds, to check the conversions to the other formats are lossless.
+func conversionTestData() string {
+	return strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//Example//EN",
+		"BEGIN:VTIMEZONE",
+		"TZID:Europe/Berlin",
+		"BEGIN:STANDARD",
+		"DTSTART:19701025T030000",
+		"TZOFFSETFROM:+0200",
+		"TZOFFSETTO:+0100",
+		"END:STANDARD",
+		"END:VTIMEZONE",
+		"BEGIN:VEVENT",
+		"UID:123",
+		"DTSTAMP:20170101T100000Z",
+		"DTSTART;TZID=Europe/Berlin:20170102T100000",
+		"DURATION:PT1H",
+		`SUMMARY:Lunch\, then a walk\nor not`,
+		`CATEGORIES:WORK,LUNCH\, WALK`,
+		"GEO:37.386013;-122.082932",
+		"REQUEST-STATUS:2.0;Success",
+		"RRULE:FREQ=WEEKLY;UNTIL=20170301T000000Z;BYDAY=MO,TU;INTERVAL=2",
+		"EXDATE;VALUE=DATE:20170109,20170116",
+		`ORGANIZER;CN="Doe, John":mailto:john@example.com`,
+		`ATTENDEE;MEMBER="mailto:a@x.org","mailto:b@x.org":mailto:jane@x.org`,
+		"PRIORITY:1",
+		"X-EXAMPLE;X-PARAM=yes:Some\\, raw value",
+		"X-EXAMPLE-DATE;VALUE=DATE:20170102",
+		"BEGIN:VALARM",
+		"ACTION:DISPLAY",
+		"TRIGGER;RELATED=END:-PT15M",
+		"END:VALARM",
+		"END:VEVENT",
+		"BEGIN:VFREEBUSY",
+		"FREEBUSY:20170102T100000Z/20170102T110000Z,20170103T100000Z/PT1H",
+		"END:VFREEBUSY",
+		"END:VCALENDAR",
+	}, CRLF) + CRLF
+}
+
+func TestJCal(t *testing.T) {
+	cal, _ := Parse(conversionTestData())
+
+	jcal, err := MarshalJCal(cal)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	for _, expected := range []string{
+		`["vcalendar",[["version",{},"text","2.0"]`,
+		`["tzoffsetfrom",{},"utc-offset","+02:00"]`,
+		`["dtstart",{"tzid":"Europe/Berlin"},"date-time","2017-01-02T10:00:00"]`,
+		`["summary",{},"text","Lunch, then a walk\nor not"]`,
+		`["categories",{},"text","WORK","LUNCH, WALK"]`,
+		`["geo",{},"float",[37.386013,-122.082932]]`,
+		`["request-status",{},"text",["2.0","Success"]]`,
+		`["rrule",{},"recur",{"freq":"WEEKLY","until":"2017-03-01T00:00:00Z","byday":["MO","TU"],"interval":2}]`,
+		`["exdate",{},"date","2017-01-09","2017-01-16"]`,
+		`["organizer",{"cn":"Doe, John"},"cal-address","mailto:john@example.com"]`,
+		`["attendee",{"member":["mailto:a@x.org","mailto:b@x.org"]},"cal-address","mailto:jane@x.org"]`,
+		`["priority",{},"integer",1]`,
+		`["x-example",{"x-param":"yes"},"unknown","Some\\, raw value"]`,
+		`["x-example-date",{},"date","2017-01-02"]`,
+		`["trigger",{"related":"END"},"duration","-PT15M"]`,
+		`["freebusy",{},"period","2017-01-02T10:00:00Z/2017-01-02T11:00:00Z","2017-01-03T10:00:00Z/PT1H"]`,
+	} {
+		if !strings.Contains(string(jcal), expected) {
+			t.Errorf("Expected the jCal data to contain %s | Got: %s", expected, jcal)
+		}
+	}
+
+	parsed, err := ParseJCal(jcal)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if data := Serialize(parsed); data != conversionTestData() {
+		t.Errorf("Expected the same data back from jCal | Got:\n%s", data)
+	}
+
+	for _, invalid := range []string{
+		`{"vcalendar":[]}`,
+		`["vcalendar",[["summary",{},"text"]],[]]`,
+		`["vcalendar",[["summary",{},"text",null]],[]]`,
+		`["vcalendar",[],[]`,
+	} {
+		if _, err := ParseJCal([]byte(invalid)); err == nil {
+			t.Errorf("Expected an error parsing %s", invalid)
+		}
+	}
+}
+
+func TestXCal(t *testing.T) {
+	cal, _ := Parse(conversionTestData())
+
+	xcal, err := MarshalXCal(cal)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	for _, expected := range []string{
+		`<icalendar xmlns="urn:ietf:params:xml:ns:icalendar-2.0"><vcalendar><properties><version><text>2.0</text></version>`,
+		`<dtstart><parameters><tzid><text>Europe/Berlin</text></tzid></parameters><date-time>2017-01-02T10:00:00</date-time></dtstart>`,
+		`<categories><text>WORK</text><text>LUNCH, WALK</text></categories>`,
+		`<geo><latitude>37.386013</latitude><longitude>-122.082932</longitude></geo>`,
+		`<request-status><code>2.0</code><description>Success</description></request-status>`,
+		`<rrule><recur><freq>WEEKLY</freq><until>2017-03-01T00:00:00Z</until><byday>MO</byday><byday>TU</byday><interval>2</interval></recur></rrule>`,
+		`<member><cal-address>mailto:a@x.org</cal-address><cal-address>mailto:b@x.org</cal-address></member>`,
+		`<x-example-date><date>2017-01-02</date></x-example-date>`,
+		`<components><valarm><properties><action><text>DISPLAY</text></action>`,
+	} {
+		if !strings.Contains(string(xcal), expected) {
+			t.Errorf("Expected the xCal data to contain %s | Got: %s", expected, xcal)
+		}
+	}
+
+	parsed, err := ParseXCal(xcal)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if data := Serialize(parsed); data != conversionTestData() {
+		t.Errorf("Expected the same data back from xCal | Got:\n%s", data)
+	}
+
+	for _, invalid := range []string{
+		`<vcalendar/>`,
+		`<icalendar><vcalendar><properties><summary/></properties></vcalendar></icalendar>`,
+		`<icalendar><vcalendar>`,
+	} {
+		if _, err := ParseXCal([]byte(invalid)); err == nil {
+			t.Errorf("Expected an error parsing %s", invalid)
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+	for _, mediaType := range MediaTypes {
+		converted, err := ConvertTo(conversionTestData(), mediaType)
+		if err != nil {
+			t.Fatal("Unexpected error:", err)
+		}
+
+		data, err := ConvertFrom(converted, mediaType)
+		if err != nil || data != conversionTestData() {
+			t.Errorf("Expected the same data back from %s | Got: %s %v", mediaType, data, err)
+		}
+	}
+
+	if _, err := ConvertTo(conversionTestData(), "text/plain"); err == nil {
+		t.Error("Expected an error converting to an unsupported media type")
+	}
+	if _, err := ConvertFrom("BEGIN:VCALENDAR", MediaTypeJCal); err == nil {
+		t.Error("Expected an error converting invalid jCal data")
+	}
+}
@@ -0,0 +1,324 @@
+package ics
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/laurent22/ical-go"
+)
+
+// MarshalJCal converts the component (usually a VCALENDAR) into its jCal representation, the JSON format
+// for iCalendar. The conversion keeps all the data, so that `ParseJCal` gives back the same component.
+// [See RFC7265]
+func MarshalJCal(node *ical.Node) ([]byte, error) {
+	if !IsComponent(node) {
+		return nil, errors.New("ics: only components can be converted to jCal")
+	}
+
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(jcalComponent(node)); err != nil {
+		return nil, err
+	}
+
+	return bytes.TrimSpace(buffer.Bytes()), nil
+}
+
+// ParseJCal parses the jCal representation of a component and returns its node. [See RFC7265]
+func ParseJCal(data []byte) (*ical.Node, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	value, err := decodeJSON(decoder)
+	if err != nil {
+		return nil, fmt.Errorf("ics: invalid jCal data: %s", err)
+	}
+
+	node, err := parseJCalComponent(value)
+	if err != nil {
+		return nil, fmt.Errorf("ics: invalid jCal data: %s", err)
+	}
+
+	return node, nil
+}
+
+// A component is the array [name, properties, components].
+func jcalComponent(node *ical.Node) []interface{} {
+	props := []interface{}{}
+	comps := []interface{}{}
+
+	for _, child := range node.Children {
+		if IsComponent(child) {
+			comps = append(comps, jcalComponent(child))
+		} else {
+			props = append(props, jcalProperty(newTypedProperty(child)))
+		}
+	}
+
+	return []interface{}{strings.ToLower(node.Name), props, comps}
+}
+
+// A property is the array [name, params, type, values...].
+func jcalProperty(tp typedProperty) []interface{} {
+	params := make(map[string]interface{})
+	for _, param := range tp.Params {
+		if len(param.Values) == 1 {
+			params[param.Name] = param.Values[0]
+		} else {
+			params[param.Name] = param.Values
+		}
+	}
+
+	result := []interface{}{tp.Name, params, tp.ValueType}
+	for _, value := range tp.Values {
+		switch value := value.(type) {
+		case []string:
+			parts := make([]interface{}, len(value))
+			for i, part := range value {
+				parts[i] = jcalScalar(tp.ValueType, part)
+			}
+			result = append(result, parts)
+		case []recurPart:
+			result = append(result, jcalRecur(value))
+		default:
+			result = append(result, jcalScalar(tp.ValueType, value.(string)))
+		}
+	}
+
+	return result
+}
+
+// The numbers and booleans are written as JSON numbers and booleans, the other values as strings.
+func jcalScalar(valueType, value string) interface{} {
+	switch valueType {
+	case valueInteger, valueFloat:
+		if _, err := strconv.ParseFloat(value, 64); err == nil {
+			return json.Number(value)
+		}
+	case valueBoolean:
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+
+	return value
+}
+
+// A recurrence rule is an object with its parts as members, which keep the order of the rule.
+func jcalRecur(parts []recurPart) jsonObject {
+	object := jsonObject{}
+	for _, part := range parts {
+		values := make([]interface{}, len(part.Values))
+		for i, value := range part.Values {
+			values[i] = value
+			if contains(numericRecurParts, part.Name) {
+				values[i] = jcalScalar(valueInteger, value)
+			}
+		}
+
+		if len(values) == 1 {
+			object = append(object, jsonMember{Name: part.Name, Value: values[0]})
+		} else {
+			object = append(object, jsonMember{Name: part.Name, Value: values})
+		}
+	}
+
+	return object
+}
+
+func parseJCalComponent(value interface{}) (*ical.Node, error) {
+	array, ok := value.([]interface{})
+	if !ok || len(array) != 3 {
+		return nil, errors.New("a component must be an array of 3 elements")
+	}
+
+	name, ok := array[0].(string)
+	props, propsOk := array[1].([]interface{})
+	comps, compsOk := array[2].([]interface{})
+	if !ok || name == "" || !propsOk || !compsOk {
+		return nil, errors.New("a component must have a name, an array of properties and an array of components")
+	}
+
+	node := NewComponent(strings.ToUpper(name))
+	for _, prop := range props {
+		tp, err := parseJCalProperty(prop)
+		if err != nil {
+			return nil, err
+		}
+
+		child, err := tp.node()
+		if err != nil {
+			return nil, err
+		}
+		node.Children = append(node.Children, child)
+	}
+
+	for _, comp := range comps {
+		child, err := parseJCalComponent(comp)
+		if err != nil {
+			return nil, err
+		}
+		node.Children = append(node.Children, child)
+	}
+
+	return node, nil
+}
+
+func parseJCalProperty(value interface{}) (typedProperty, error) {
+	array, ok := value.([]interface{})
+	if !ok || len(array) < 4 {
+		return typedProperty{}, errors.New("a property must be an array of at least 4 elements")
+	}
+
+	name, nameOk := array[0].(string)
+	params, paramsOk := array[1].(jsonObject)
+	valueType, typeOk := array[2].(string)
+	if !nameOk || !paramsOk || !typeOk {
+		return typedProperty{}, errors.New("a property must have a name, an object of params and a value type")
+	}
+
+	tp := typedProperty{Name: name, ValueType: valueType}
+	for _, param := range params {
+		values, err := jcalStrings(param.Value)
+		if err != nil {
+			return typedProperty{}, fmt.Errorf("invalid param %s of property %s", param.Name, name)
+		}
+		tp.Params = append(tp.Params, typedParam{Name: param.Name, Values: values})
+	}
+
+	for _, value := range array[3:] {
+		switch value := value.(type) {
+		case jsonObject:
+			var parts []recurPart
+			for _, member := range value {
+				values, err := jcalStrings(member.Value)
+				if err != nil {
+					return typedProperty{}, fmt.Errorf("invalid value of property %s", name)
+				}
+				parts = append(parts, recurPart{Name: member.Name, Values: values})
+			}
+			tp.Values = append(tp.Values, parts)
+		case []interface{}:
+			parts, err := jcalStrings(value)
+			if err != nil {
+				return typedProperty{}, fmt.Errorf("invalid value of property %s", name)
+			}
+			tp.Values = append(tp.Values, parts)
+		default:
+			values, err := jcalStrings(value)
+			if err != nil {
+				return typedProperty{}, fmt.Errorf("invalid value of property %s", name)
+			}
+			tp.Values = append(tp.Values, values[0])
+		}
+	}
+
+	return tp, nil
+}
+
+// Converts a scalar, or an array of scalars, to strings.
+func jcalStrings(value interface{}) ([]string, error) {
+	switch value := value.(type) {
+	case string:
+		return []string{value}, nil
+	case json.Number:
+		return []string{value.String()}, nil
+	case bool:
+		return []string{strconv.FormatBool(value)}, nil
+	case []interface{}:
+		var result []string
+		for _, item := range value {
+			if _, ok := item.([]interface{}); ok {
+				return nil, errors.New("nested arrays")
+			}
+
+			values, err := jcalStrings(item)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, values...)
+		}
+		return result, nil
+	}
+
+	return nil, errors.New("not a scalar value")
+}
+
+// jsonObject is a JSON object that keeps the order of its members, as the parts of the recurrence rules.
+type jsonObject []jsonMember
+
+type jsonMember struct {
+	Name  string
+	Value interface{}
+}
+
+// MarshalJSON writes the members in their order.
+func (object jsonObject) MarshalJSON() ([]byte, error) {
+	var buffer bytes.Buffer
+	buffer.WriteByte('{')
+	for i, member := range object {
+		if i > 0 {
+			buffer.WriteByte(',')
+		}
+
+		name, err := json.Marshal(member.Name)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(member.Value)
+		if err != nil {
+			return nil, err
+		}
+
+		buffer.Write(name)
+		buffer.WriteByte(':')
+		buffer.Write(value)
+	}
+	buffer.WriteByte('}')
+
+	return buffer.Bytes(), nil
+}
+
+// Decodes the next JSON value, with the objects decoded as `jsonObject`s to keep the order of their members.
+func decodeJSON(decoder *json.Decoder) (interface{}, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch token {
+	case json.Delim('['):
+		array := []interface{}{}
+		for decoder.More() {
+			value, err := decodeJSON(decoder)
+			if err != nil {
+				return nil, err
+			}
+			array = append(array, value)
+		}
+		_, err := decoder.Token()
+		return array, err
+	case json.Delim('{'):
+		object := jsonObject{}
+		for decoder.More() {
+			name, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeJSON(decoder)
+			if err != nil {
+				return nil, err
+			}
+			object = append(object, jsonMember{Name: name.(string), Value: value})
+		}
+		_, err := decoder.Token()
+		return object, err
+	}
+
+	return token, nil
+}
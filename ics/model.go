@@ -0,0 +1,794 @@
+package ics
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/laurent22/ical-go"
+
+	"github.com/samedi/caldav-go/lib"
+)
+
+// Object is the typed model of a calendar object (a VCALENDAR component). The components and properties that
+// are not part of the model, like the VTIMEZONEs and the X- extensions, are kept as they are, so that an object
+// decoded and encoded again has the same content. Only the order of the properties and components can change.
+type Object struct {
+	// Properties holds the calendar properties, e.g. VERSION, PRODID and METHOD.
+	Properties []*ical.Node
+	Events     []*Event
+	Todos      []*Todo
+	Journals   []*Journal
+	// Components holds the other components, e.g. VTIMEZONE and VFREEBUSY.
+	Components []*ical.Node
+}
+
+// Component holds the properties shared by the events, to-dos and journals. The properties not in the model
+// are kept in `Properties`, and the sub components (other than the VALARMs of the events and to-dos) in
+// `Components`. The zero values are not encoded, e.g. an empty `Summary` or a zero `Sequence`.
+type Component struct {
+	UID          string
+	Stamp        *TimeValue // DTSTAMP
+	Start        *TimeValue // DTSTART
+	RecurrenceID *TimeValue
+	Rule         *RRule
+	Summary      string
+	Description  string
+	Status       string
+	Sequence     int
+	Organizer    *Organizer
+	Attendees    []*Attendee
+	Categories   []string
+	Properties   []*ical.Node
+	Components   []*ical.Node
+
+	// the parameters not in the model of the single properties, by property name
+	params map[string]map[string]string
+}
+
+// Event is the typed model of a VEVENT component (RFC5545#3.6.1).
+type Event struct {
+	Component
+	Location string
+	End      *TimeValue    // DTEND
+	Duration time.Duration // DURATION, when there is no DTEND
+	Alarms   []*Alarm
+}
+
+// Todo is the typed model of a VTODO component (RFC5545#3.6.2).
+type Todo struct {
+	Component
+	Location        string
+	Due             *TimeValue
+	Duration        time.Duration // DURATION, when there is no DUE
+	Completed       *TimeValue
+	PercentComplete int
+	Alarms          []*Alarm
+}
+
+// Journal is the typed model of a VJOURNAL component (RFC5545#3.6.3).
+type Journal struct {
+	Component
+}
+
+// TimeValue is the value of a DATE or DATE-TIME property. `Time` is the wall clock of the value (in UTC for
+// the UTC values), and `TZID` the time zone of the local times. The floating times have neither UTC nor TZID.
+// Use `TimeContext.DateTime` on the encoded property to get the absolute time.
+type TimeValue struct {
+	Time     time.Time
+	TZID     string
+	Date     bool
+	Floating bool
+}
+
+// Organizer is the ORGANIZER of a component. `Params` holds the parameters other than CN.
+type Organizer struct {
+	Address    string
+	CommonName string
+	Params     map[string]string
+}
+
+// Attendee is an ATTENDEE of a component. `Params` holds the parameters not in the model, e.g. DELEGATED-TO.
+type Attendee struct {
+	Address    string
+	CommonName string
+	Role       string
+	PartStat   string
+	CUType     string
+	RSVP       bool
+	Params     map[string]string
+}
+
+// Alarm is the typed model of a VALARM component (RFC5545#3.6.6).
+type Alarm struct {
+	Action      string
+	Trigger     Trigger
+	Summary     string
+	Description string
+	Repeat      int
+	Duration    time.Duration
+	Attendees   []*Attendee
+	Properties  []*ical.Node
+
+	params map[string]map[string]string
+}
+
+// Trigger is the TRIGGER of an alarm: an absolute time in UTC when `At` is not zero, or else an offset
+// from the start of the component (or from its end, when `RelatedEnd` is true).
+type Trigger struct {
+	Offset     time.Duration
+	RelatedEnd bool
+	At         time.Time
+}
+
+// RRule is the typed value of a RRULE property (RFC5545#3.3.10). `Parts` holds the parts not in the model,
+// e.g. BYHOUR.
+type RRule struct {
+	Freq       string
+	Interval   int
+	Count      int
+	Until      *TimeValue
+	ByDay      []string
+	ByMonthDay []int
+	ByMonth    []int
+	BySetPos   []int
+	WeekStart  string
+	Parts      map[string]string
+}
+
+// NewObject initializes an empty calendar object with the required VERSION and PRODID properties.
+func NewObject() *Object {
+	return &Object{Properties: NewCalendar().Children}
+}
+
+// UTC returns the DATE-TIME value of the time in UTC.
+func UTC(t time.Time) *TimeValue {
+	return &TimeValue{Time: t.UTC()}
+}
+
+// Local returns the DATE-TIME value of the wall clock of the time in the given time zone, or a floating
+// time when `tzid` is empty.
+func Local(t time.Time, tzid string) *TimeValue {
+	wall := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC)
+	return &TimeValue{Time: wall, TZID: tzid, Floating: tzid == ""}
+}
+
+// AllDay returns the DATE value of the day of the time.
+func AllDay(t time.Time) *TimeValue {
+	return &TimeValue{Time: time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC), Date: true}
+}
+
+// ParseObject parses the iCalendar data into its typed model.
+func ParseObject(data string) (*Object, error) {
+	cal, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return DecodeObject(cal)
+}
+
+// DecodeObject returns the typed model of the VCALENDAR component. The nodes kept in the model are copies,
+// so the component can be shared. The values that cannot be decoded, like a DTSTART with an invalid date,
+// are kept as they are in the `Properties` of their component.
+func DecodeObject(cal *ical.Node) (*Object, error) {
+	if cal == nil || cal.Name != lib.VCALENDAR {
+		return nil, errors.New("ics: the calendar object is not a VCALENDAR")
+	}
+
+	obj := &Object{}
+	for _, child := range cal.Children {
+		switch {
+		case !IsComponent(child):
+			obj.Properties = append(obj.Properties, Clone(child))
+		case child.Name == lib.VEVENT:
+			obj.Events = append(obj.Events, DecodeEvent(child))
+		case child.Name == lib.VTODO:
+			obj.Todos = append(obj.Todos, DecodeTodo(child))
+		case child.Name == lib.VJOURNAL:
+			obj.Journals = append(obj.Journals, DecodeJournal(child))
+		default:
+			obj.Components = append(obj.Components, Clone(child))
+		}
+	}
+
+	return obj, nil
+}
+
+// Encode returns the VCALENDAR component of the object. The other components (e.g. the VTIMEZONEs) come
+// first, followed by the events, the to-dos and the journals.
+func (obj *Object) Encode() *ical.Node {
+	cal := NewComponent(lib.VCALENDAR)
+	for _, prop := range obj.Properties {
+		cal.Children = append(cal.Children, Clone(prop))
+	}
+	for _, comp := range obj.Components {
+		cal.Children = append(cal.Children, Clone(comp))
+	}
+	for _, event := range obj.Events {
+		cal.Children = append(cal.Children, event.Encode())
+	}
+	for _, todo := range obj.Todos {
+		cal.Children = append(cal.Children, todo.Encode())
+	}
+	for _, journal := range obj.Journals {
+		cal.Children = append(cal.Children, journal.Encode())
+	}
+
+	return cal
+}
+
+// String returns the iCalendar data of the object.
+func (obj *Object) String() string {
+	return Serialize(obj.Encode())
+}
+
+// DecodeEvent returns the typed model of the VEVENT component.
+func DecodeEvent(node *ical.Node) *Event {
+	event := &Event{}
+	event.decode(node, func(prop *ical.Node) bool {
+		switch prop.Name {
+		case "LOCATION":
+			event.Location = event.text(prop)
+		case "DTEND":
+			return event.timeValue(prop, &event.End)
+		case "DURATION":
+			return event.duration(prop, &event.Duration)
+		default:
+			return false
+		}
+		return true
+	}, &event.Alarms)
+
+	return event
+}
+
+// Encode returns the VEVENT component of the event.
+func (event *Event) Encode() *ical.Node {
+	return event.encode(lib.VEVENT, func(add func(prop *ical.Node)) {
+		add(event.textProperty("LOCATION", event.Location))
+		add(event.timeProperty("DTEND", event.End))
+		add(event.durationProperty("DURATION", event.Duration))
+	}, event.Alarms)
+}
+
+// DecodeTodo returns the typed model of the VTODO component.
+func DecodeTodo(node *ical.Node) *Todo {
+	todo := &Todo{}
+	todo.decode(node, func(prop *ical.Node) bool {
+		switch prop.Name {
+		case "LOCATION":
+			todo.Location = todo.text(prop)
+		case "DUE":
+			return todo.timeValue(prop, &todo.Due)
+		case "DURATION":
+			return todo.duration(prop, &todo.Duration)
+		case "COMPLETED":
+			return todo.timeValue(prop, &todo.Completed)
+		case "PERCENT-COMPLETE":
+			return todo.integer(prop, &todo.PercentComplete)
+		default:
+			return false
+		}
+		return true
+	}, &todo.Alarms)
+
+	return todo
+}
+
+// Encode returns the VTODO component of the to-do.
+func (todo *Todo) Encode() *ical.Node {
+	return todo.encode(lib.VTODO, func(add func(prop *ical.Node)) {
+		add(todo.textProperty("LOCATION", todo.Location))
+		add(todo.timeProperty("DUE", todo.Due))
+		add(todo.durationProperty("DURATION", todo.Duration))
+		add(todo.timeProperty("COMPLETED", todo.Completed))
+		add(todo.intProperty("PERCENT-COMPLETE", todo.PercentComplete))
+	}, todo.Alarms)
+}
+
+// DecodeJournal returns the typed model of the VJOURNAL component.
+func DecodeJournal(node *ical.Node) *Journal {
+	journal := &Journal{}
+	journal.decode(node, func(prop *ical.Node) bool { return false }, nil)
+
+	return journal
+}
+
+// Encode returns the VJOURNAL component of the journal.
+func (journal *Journal) Encode() *ical.Node {
+	return journal.encode(lib.VJOURNAL, func(add func(prop *ical.Node)) {}, nil)
+}
+
+// Decodes the properties shared by all the components, passing the other ones to `decodeProp` first. The
+// properties it does not decode (returning false) are kept as they are. The VALARMs are decoded into `alarms`,
+// when not nil.
+func (c *Component) decode(node *ical.Node, decodeProp func(prop *ical.Node) bool, alarms *[]*Alarm) {
+	// only the first of the properties that cannot be repeated is decoded
+	decoded := make(map[string]bool)
+
+	for _, child := range node.Children {
+		if IsComponent(child) {
+			if child.Name == lib.VALARM && alarms != nil {
+				*alarms = append(*alarms, DecodeAlarm(child))
+			} else {
+				c.Components = append(c.Components, Clone(child))
+			}
+			continue
+		}
+
+		repeatable := child.Name == "ATTENDEE" || child.Name == "CATEGORIES"
+		if (decoded[child.Name] && !repeatable) || (!decodeProp(child) && !c.decodeProperty(child)) {
+			c.Properties = append(c.Properties, Clone(child))
+			continue
+		}
+		decoded[child.Name] = true
+	}
+}
+
+func (c *Component) decodeProperty(prop *ical.Node) bool {
+	switch prop.Name {
+	case "UID":
+		c.UID = c.text(prop)
+	case "DTSTAMP":
+		return c.timeValue(prop, &c.Stamp)
+	case "DTSTART":
+		return c.timeValue(prop, &c.Start)
+	case "RECURRENCE-ID":
+		return c.timeValue(prop, &c.RecurrenceID)
+	case "RRULE":
+		rule, err := ParseRRule(prop.Value)
+		if err != nil {
+			return false
+		}
+		c.Rule = rule
+		c.keepParams(prop)
+	case "SUMMARY":
+		c.Summary = c.text(prop)
+	case "DESCRIPTION":
+		c.Description = c.text(prop)
+	case "STATUS":
+		c.Status = c.text(prop)
+	case "SEQUENCE":
+		return c.integer(prop, &c.Sequence)
+	case "ORGANIZER":
+		c.Organizer = &Organizer{Address: prop.Value, CommonName: prop.Parameter("CN", ""), Params: otherParams(prop, "CN")}
+	case "ATTENDEE":
+		c.Attendees = append(c.Attendees, decodeAttendee(prop))
+	case "CATEGORIES":
+		// the values of all the CATEGORIES properties are merged
+		c.Categories = append(c.Categories, SplitText(prop.Value)...)
+		c.keepParams(prop)
+	default:
+		return false
+	}
+
+	return true
+}
+
+// Encodes the component, with the properties of the model first, followed by the ones given by `encodeProps`,
+// the other properties, the alarms and the other sub components.
+func (c *Component) encode(name string, encodeProps func(add func(prop *ical.Node)), alarms []*Alarm) *ical.Node {
+	node := NewComponent(name)
+	add := func(prop *ical.Node) {
+		if prop != nil {
+			node.Children = append(node.Children, prop)
+		}
+	}
+
+	add(c.textProperty("UID", c.UID))
+	add(c.timeProperty("DTSTAMP", c.Stamp))
+	add(c.timeProperty("DTSTART", c.Start))
+	add(c.timeProperty("RECURRENCE-ID", c.RecurrenceID))
+	if c.Rule != nil {
+		add(c.property("RRULE", c.Rule.String()))
+	}
+	add(c.textProperty("SUMMARY", c.Summary))
+	add(c.textProperty("DESCRIPTION", c.Description))
+	add(c.textProperty("STATUS", c.Status))
+	add(c.intProperty("SEQUENCE", c.Sequence))
+	encodeProps(add)
+
+	if c.Organizer != nil {
+		add(newAddressProperty("ORGANIZER", c.Organizer.Address, c.Organizer.Params, "CN", c.Organizer.CommonName))
+	}
+	for _, attendee := range c.Attendees {
+		add(attendee.encode("ATTENDEE"))
+	}
+	if len(c.Categories) > 0 {
+		escaped := make([]string, len(c.Categories))
+		for i, category := range c.Categories {
+			escaped[i] = EscapeText(category)
+		}
+		add(c.property("CATEGORIES", strings.Join(escaped, ",")))
+	}
+
+	for _, prop := range c.Properties {
+		add(Clone(prop))
+	}
+	for _, alarm := range alarms {
+		add(alarm.Encode())
+	}
+	for _, comp := range c.Components {
+		add(Clone(comp))
+	}
+
+	return node
+}
+
+// DecodeAlarm returns the typed model of the VALARM component.
+func DecodeAlarm(node *ical.Node) *Alarm {
+	alarm := &Alarm{}
+	values := &Component{}
+
+	for _, prop := range node.Children {
+		decoded := true
+
+		switch {
+		case IsComponent(prop):
+			decoded = false
+		case prop.Name == "ACTION":
+			alarm.Action = values.text(prop)
+		case prop.Name == "TRIGGER":
+			decoded = decodeTrigger(prop, &alarm.Trigger)
+		case prop.Name == "SUMMARY":
+			alarm.Summary = values.text(prop)
+		case prop.Name == "DESCRIPTION":
+			alarm.Description = values.text(prop)
+		case prop.Name == "REPEAT":
+			decoded = values.integer(prop, &alarm.Repeat)
+		case prop.Name == "DURATION":
+			decoded = values.duration(prop, &alarm.Duration)
+		case prop.Name == "ATTENDEE":
+			alarm.Attendees = append(alarm.Attendees, decodeAttendee(prop))
+		default:
+			decoded = false
+		}
+
+		if !decoded {
+			alarm.Properties = append(alarm.Properties, Clone(prop))
+		}
+	}
+
+	alarm.params = values.params
+	return alarm
+}
+
+// Encode returns the VALARM component of the alarm.
+func (alarm *Alarm) Encode() *ical.Node {
+	values := &Component{params: alarm.params}
+	node := NewComponent(lib.VALARM)
+	add := func(prop *ical.Node) {
+		if prop != nil {
+			node.Children = append(node.Children, prop)
+		}
+	}
+
+	add(values.textProperty("ACTION", alarm.Action))
+	add(alarm.Trigger.encode())
+	add(values.textProperty("SUMMARY", alarm.Summary))
+	add(values.textProperty("DESCRIPTION", alarm.Description))
+	add(values.intProperty("REPEAT", alarm.Repeat))
+	add(values.durationProperty("DURATION", alarm.Duration))
+	for _, attendee := range alarm.Attendees {
+		add(attendee.encode("ATTENDEE"))
+	}
+	for _, prop := range alarm.Properties {
+		add(Clone(prop))
+	}
+
+	return node
+}
+
+// The TRIGGERs with parameters other than VALUE and RELATED are kept as they are.
+func decodeTrigger(prop *ical.Node, trigger *Trigger) bool {
+	if len(otherParams(prop, "VALUE", "RELATED")) > 0 {
+		return false
+	}
+
+	if prop.Parameter("VALUE", "") == "DATE-TIME" {
+		at, err := time.Parse("20060102T150405Z", prop.Value)
+		trigger.At = at
+		return err == nil
+	}
+
+	offset, ok := ParseDuration(prop.Value)
+	trigger.Offset, trigger.RelatedEnd = offset, prop.Parameter("RELATED", "") == "END"
+	return ok
+}
+
+func (trigger *Trigger) encode() *ical.Node {
+	if !trigger.At.IsZero() {
+		return NewProperty("TRIGGER", trigger.At.UTC().Format("20060102T150405Z"), map[string]string{"VALUE": "DATE-TIME"})
+	}
+
+	prop := NewProperty("TRIGGER", FormatDuration(trigger.Offset), nil)
+	if trigger.RelatedEnd {
+		prop.Parameters["RELATED"] = "END"
+	}
+
+	return prop
+}
+
+func decodeAttendee(prop *ical.Node) *Attendee {
+	return &Attendee{
+		Address:    prop.Value,
+		CommonName: prop.Parameter("CN", ""),
+		Role:       prop.Parameter("ROLE", ""),
+		PartStat:   prop.Parameter("PARTSTAT", ""),
+		CUType:     prop.Parameter("CUTYPE", ""),
+		RSVP:       strings.ToUpper(prop.Parameter("RSVP", "")) == "TRUE",
+		Params:     otherParams(prop, "CN", "ROLE", "PARTSTAT", "CUTYPE", "RSVP"),
+	}
+}
+
+func (attendee *Attendee) encode(name string) *ical.Node {
+	rsvp := ""
+	if attendee.RSVP {
+		rsvp = "TRUE"
+	}
+
+	return newAddressProperty(name, attendee.Address, attendee.Params,
+		"CN", attendee.CommonName, "ROLE", attendee.Role, "PARTSTAT", attendee.PartStat, "CUTYPE", attendee.CUType, "RSVP", rsvp)
+}
+
+// Returns a property with the given params, and the pairs of names and values of the params in the model
+// that are not empty.
+func newAddressProperty(name, address string, params map[string]string, modelParams ...string) *ical.Node {
+	prop := NewProperty(name, address, params)
+	for i := 0; i+1 < len(modelParams); i += 2 {
+		if modelParams[i+1] != "" {
+			prop.Parameters[modelParams[i]] = modelParams[i+1]
+		}
+	}
+
+	return prop
+}
+
+// Returns the parameters of the property, but the given ones, or nil if there are none.
+func otherParams(prop *ical.Node, names ...string) map[string]string {
+	var params map[string]string
+	for name, value := range prop.Parameters {
+		if !contains(names, name) {
+			if params == nil {
+				params = make(map[string]string)
+			}
+			params[name] = value
+		}
+	}
+
+	return params
+}
+
+// Keeps the parameters not in the model of a single property, to encode them back with its value.
+func (c *Component) keepParams(prop *ical.Node, modelParams ...string) {
+	params := otherParams(prop, modelParams...)
+	if params == nil {
+		return
+	}
+
+	if c.params == nil {
+		c.params = make(map[string]map[string]string)
+	}
+	c.params[prop.Name] = params
+}
+
+// Returns a property with the given value and the kept parameters.
+func (c *Component) property(name, value string) *ical.Node {
+	return NewProperty(name, value, c.params[name])
+}
+
+func (c *Component) text(prop *ical.Node) string {
+	c.keepParams(prop)
+	return UnescapeText(prop.Value)
+}
+
+func (c *Component) textProperty(name, value string) *ical.Node {
+	if value == "" {
+		return nil
+	}
+
+	return c.property(name, EscapeText(value))
+}
+
+func (c *Component) integer(prop *ical.Node, value *int) bool {
+	n, err := strconv.Atoi(prop.Value)
+	if err != nil {
+		return false
+	}
+
+	*value = n
+	c.keepParams(prop)
+	return true
+}
+
+func (c *Component) intProperty(name string, value int) *ical.Node {
+	if value == 0 {
+		return nil
+	}
+
+	return c.property(name, strconv.Itoa(value))
+}
+
+// The zero durations are kept as they are, since they would not be encoded.
+func (c *Component) duration(prop *ical.Node, value *time.Duration) bool {
+	duration, ok := ParseDuration(prop.Value)
+	if !ok || duration == 0 {
+		return false
+	}
+
+	*value = duration
+	c.keepParams(prop)
+	return true
+}
+
+func (c *Component) durationProperty(name string, value time.Duration) *ical.Node {
+	if value == 0 {
+		return nil
+	}
+
+	return c.property(name, FormatDuration(value))
+}
+
+func (c *Component) timeValue(prop *ical.Node, value **TimeValue) bool {
+	tv, ok := parseTimeValue(prop.Value)
+	if !ok {
+		return false
+	}
+
+	tv.TZID = prop.Parameter("TZID", "")
+	tv.Floating = tv.Floating && tv.TZID == ""
+
+	*value = tv
+	c.keepParams(prop, "TZID", "VALUE")
+	return true
+}
+
+func (c *Component) timeProperty(name string, value *TimeValue) *ical.Node {
+	if value == nil {
+		return nil
+	}
+
+	prop := c.property(name, value.String())
+	if value.Date {
+		prop.Parameters["VALUE"] = "DATE"
+	} else if value.TZID != "" {
+		prop.Parameters["TZID"] = value.TZID
+	}
+
+	return prop
+}
+
+// Parses a DATE or DATE-TIME value, without the TZID.
+func parseTimeValue(value string) (*TimeValue, bool) {
+	for _, layout := range dateTimeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			date := layout == "20060102"
+			return &TimeValue{Time: t, Date: date, Floating: !date && !strings.HasSuffix(layout, "Z")}, true
+		}
+	}
+
+	return nil, false
+}
+
+// String returns the value as in the iCalendar data, e.g. "20160914T170000Z".
+func (tv *TimeValue) String() string {
+	switch {
+	case tv.Date:
+		return tv.Time.Format("20060102")
+	case tv.TZID != "" || tv.Floating:
+		return tv.Time.Format("20060102T150405")
+	default:
+		return tv.Time.UTC().Format("20060102T150405Z")
+	}
+}
+
+// ParseRRule parses the value of a RRULE property. The parts are not validated, but the frequency is required.
+func ParseRRule(value string) (*RRule, error) {
+	rule := &RRule{}
+
+	ints := func(value string) ([]int, error) {
+		var result []int
+		for _, v := range strings.Split(value, ",") {
+			n, err := strconv.Atoi(strings.TrimPrefix(v, "+"))
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, n)
+		}
+		return result, nil
+	}
+
+	var err error
+	for _, part := range strings.Split(value, ";") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return nil, errors.New("ics: invalid recurrence rule part " + part)
+		}
+
+		name, value := strings.ToUpper(kv[0]), kv[1]
+		switch name {
+		case "FREQ":
+			rule.Freq = strings.ToUpper(value)
+		case "INTERVAL":
+			rule.Interval, err = strconv.Atoi(value)
+		case "COUNT":
+			rule.Count, err = strconv.Atoi(value)
+		case "UNTIL":
+			var ok bool
+			if rule.Until, ok = parseTimeValue(value); !ok {
+				err = errors.New("ics: invalid UNTIL " + value)
+			}
+		case "BYDAY":
+			rule.ByDay = strings.Split(strings.ToUpper(value), ",")
+		case "BYMONTHDAY":
+			rule.ByMonthDay, err = ints(value)
+		case "BYMONTH":
+			rule.ByMonth, err = ints(value)
+		case "BYSETPOS":
+			rule.BySetPos, err = ints(value)
+		case "WKST":
+			rule.WeekStart = strings.ToUpper(value)
+		default:
+			if rule.Parts == nil {
+				rule.Parts = make(map[string]string)
+			}
+			rule.Parts[name] = value
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if rule.Freq == "" {
+		return nil, errors.New("ics: the recurrence rule has no FREQ")
+	}
+
+	return rule, nil
+}
+
+// String returns the value of the RRULE property, with the parts not in the model sorted by name.
+func (rule *RRule) String() string {
+	parts := []string{"FREQ=" + rule.Freq}
+	add := func(name, value string) {
+		if value != "" {
+			parts = append(parts, name+"="+value)
+		}
+	}
+	ints := func(values []int) string {
+		s := make([]string, len(values))
+		for i, v := range values {
+			s[i] = strconv.Itoa(v)
+		}
+		return strings.Join(s, ",")
+	}
+
+	if rule.Interval != 0 {
+		add("INTERVAL", strconv.Itoa(rule.Interval))
+	}
+	if rule.Count != 0 {
+		add("COUNT", strconv.Itoa(rule.Count))
+	}
+	if rule.Until != nil {
+		add("UNTIL", rule.Until.String())
+	}
+	add("BYDAY", strings.Join(rule.ByDay, ","))
+	add("BYMONTHDAY", ints(rule.ByMonthDay))
+	add("BYMONTH", ints(rule.ByMonth))
+	add("BYSETPOS", ints(rule.BySetPos))
+	add("WKST", rule.WeekStart)
+
+	names := make([]string, 0, len(rule.Parts))
+	for name := range rule.Parts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		add(name, rule.Parts[name])
+	}
+
+	return strings.Join(parts, ";")
+}
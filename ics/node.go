@@ -0,0 +1,145 @@
+package ics
+
+import (
+	"github.com/laurent22/ical-go"
+)
+
+// NewComponent initializes a new component node with the given name and children.
+func NewComponent(name string, children ...*ical.Node) *ical.Node {
+	return &ical.Node{
+		Name:     name,
+		Type:     TypeComponent,
+		Children: children,
+	}
+}
+
+// NewProperty initializes a new property node. The `params` map can be nil.
+func NewProperty(name, value string, params map[string]string) *ical.Node {
+	node := &ical.Node{
+		Name:       name,
+		Value:      value,
+		Type:       TypeProperty,
+		Parameters: make(map[string]string),
+	}
+
+	for k, v := range params {
+		node.Parameters[k] = v
+	}
+
+	return node
+}
+
+// IsComponent tells whether the node is a component or a property.
+func IsComponent(node *ical.Node) bool {
+	return node.Type == TypeComponent
+}
+
+// Components returns the child components of a node, optionally filtered by the given names.
+func Components(node *ical.Node, names ...string) []*ical.Node {
+	result := []*ical.Node{}
+
+	for _, child := range node.Children {
+		if IsComponent(child) && (len(names) == 0 || contains(names, child.Name)) {
+			result = append(result, child)
+		}
+	}
+
+	return result
+}
+
+// Properties returns all the properties of a node with the given name, in the order they appear.
+func Properties(node *ical.Node, name string) []*ical.Node {
+	result := []*ical.Node{}
+
+	for _, child := range node.Children {
+		if !IsComponent(child) && child.Name == name {
+			result = append(result, child)
+		}
+	}
+
+	return result
+}
+
+// Property returns the first property of a node with the given name, or nil if not present.
+func Property(node *ical.Node, name string) *ical.Node {
+	for _, child := range node.Children {
+		if !IsComponent(child) && child.Name == name {
+			return child
+		}
+	}
+
+	return nil
+}
+
+// SetProperty sets the value of the first property with the given name, adding it if not present.
+// It returns the property node.
+func SetProperty(node *ical.Node, name, value string) *ical.Node {
+	prop := Property(node, name)
+	if prop == nil {
+		prop = NewProperty(name, value, nil)
+		AddProperty(node, prop)
+	}
+
+	prop.Value = value
+	return prop
+}
+
+// AddProperty adds the property to the node, right after the last existing property,
+// so that properties are always kept before the child components.
+func AddProperty(node *ical.Node, prop *ical.Node) {
+	index := 0
+	for i, child := range node.Children {
+		if !IsComponent(child) {
+			index = i + 1
+		}
+	}
+
+	node.Children = append(node.Children, nil)
+	copy(node.Children[index+1:], node.Children[index:])
+	node.Children[index] = prop
+}
+
+// RemoveProperties removes all the properties of a node with the given name.
+func RemoveProperties(node *ical.Node, name string) {
+	children := node.Children[:0]
+
+	for _, child := range node.Children {
+		if IsComponent(child) || child.Name != name {
+			children = append(children, child)
+		}
+	}
+
+	node.Children = children
+}
+
+// Clone returns a deep copy of the node.
+func Clone(node *ical.Node) *ical.Node {
+	clone := &ical.Node{
+		Name:  node.Name,
+		Value: node.Value,
+		Type:  node.Type,
+	}
+
+	if node.Parameters != nil {
+		clone.Parameters = make(map[string]string, len(node.Parameters))
+		for k, v := range node.Parameters {
+			clone.Parameters[k] = v
+		}
+	}
+
+	for _, child := range node.Children {
+		clone.Children = append(clone.Children, Clone(child))
+	}
+
+	return clone
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+
+	return false
+}
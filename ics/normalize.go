@@ -0,0 +1,159 @@
+package ics
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/laurent22/ical-go"
+
+	"github.com/samedi/caldav-go/lib"
+)
+
+// Normalizer is a transformation of a calendar object, changing the VCALENDAR node in place. A normalizer
+// returns an error when the object cannot be normalized, e.g. when it is not valid for its purposes.
+type Normalizer func(cal *ical.Node) error
+
+// DefaultNormalizers are the built-in normalizers, in the order they are meant to be applied.
+var DefaultNormalizers = []Normalizer{AddRequiredProperties, UTCTimestamps, RemoveUnusedTimezones, SortComponents}
+
+// The components required to have a DTSTAMP (RFC5545#3.8.7.2).
+var stampedComponents = []string{lib.VEVENT, lib.VTODO, lib.VJOURNAL, lib.VFREEBUSY}
+
+// The properties whose values must be in UTC (RFC5545#3.8.2.1, #3.8.7).
+var utcProperties = []string{"DTSTAMP", "CREATED", "LAST-MODIFIED", "COMPLETED"}
+
+// The leading properties of the calendars and components, in the canonical order.
+var (
+	calendarPropertiesOrder  = []string{"VERSION", "PRODID", "CALSCALE", "METHOD"}
+	componentPropertiesOrder = []string{"UID", "DTSTAMP"}
+)
+
+// Normalize parses the iCalendar data, applies the normalizers to it and returns it serialized again, with
+// CRLF line endings and the long lines folded (RFC5545#3.1).
+func Normalize(data string, normalizers ...Normalizer) (string, error) {
+	cal, err := Parse(data)
+	if err != nil {
+		return "", err
+	}
+
+	for _, normalize := range normalizers {
+		if err := normalize(cal); err != nil {
+			return "", err
+		}
+	}
+
+	return Serialize(cal), nil
+}
+
+// AddRequiredProperties adds the VERSION and PRODID of the calendar, and the DTSTAMP of its components, when missing.
+// The DTSTAMPs added are the current time.
+func AddRequiredProperties(cal *ical.Node) error {
+	if Property(cal, "VERSION") == nil {
+		AddProperty(cal, NewProperty("VERSION", "2.0", nil))
+	}
+	if Property(cal, "PRODID") == nil {
+		AddProperty(cal, NewProperty("PRODID", PRODID, nil))
+	}
+
+	stamp := time.Now().UTC().Format("20060102T150405Z")
+	for _, comp := range Components(cal, stampedComponents...) {
+		if Property(comp, "DTSTAMP") == nil {
+			AddProperty(comp, NewProperty("DTSTAMP", stamp, nil))
+		}
+	}
+
+	return nil
+}
+
+// UTCTimestamps converts to UTC the DTSTAMP, CREATED, LAST-MODIFIED and COMPLETED properties given in local
+// times. The floating times are taken as UTC.
+func UTCTimestamps(cal *ical.Node) error {
+	timeContext := NewTimeContext(cal, nil)
+
+	var convert func(node *ical.Node)
+	convert = func(node *ical.Node) {
+		for _, child := range node.Children {
+			if IsComponent(child) {
+				convert(child)
+				continue
+			}
+
+			if !contains(utcProperties, child.Name) || strings.HasSuffix(child.Value, "Z") {
+				continue
+			}
+
+			if t, ok := timeContext.DateTime(child); ok && !IsDate(child) {
+				child.Value = t.Format("20060102T150405Z")
+				delete(child.Parameters, "TZID")
+			}
+		}
+	}
+
+	convert(cal)
+	return nil
+}
+
+// RemoveUnusedTimezones removes the VTIMEZONEs not referenced by any TZID of the calendar, and the ones
+// defined more than once, keeping the first definition.
+func RemoveUnusedTimezones(cal *ical.Node) error {
+	referenced := []string{}
+	for _, comp := range Components(cal) {
+		if comp.Name != lib.VTIMEZONE {
+			referenced = append(referenced, referencedTZIDs(comp)...)
+		}
+	}
+
+	kept := make(map[string]bool)
+	children := cal.Children[:0]
+	for _, child := range cal.Children {
+		if IsComponent(child) && child.Name == lib.VTIMEZONE {
+			tzid := child.PropString("TZID", "")
+			if kept[tzid] || !contains(referenced, tzid) {
+				continue
+			}
+			kept[tzid] = true
+		}
+
+		children = append(children, child)
+	}
+
+	cal.Children = children
+	return nil
+}
+
+// SortComponents puts the calendar and its components in the canonical order: the properties before the
+// sub components, starting with VERSION, PRODID, CALSCALE and METHOD for the calendar and with UID and DTSTAMP
+// for the components, and the VTIMEZONEs before the other components. The order is kept otherwise.
+func SortComponents(cal *ical.Node) error {
+	sortChildren(cal, calendarPropertiesOrder)
+	return nil
+}
+
+func sortChildren(node *ical.Node, propertiesOrder []string) {
+	rank := func(child *ical.Node) int {
+		if IsComponent(child) {
+			if child.Name == lib.VTIMEZONE {
+				return len(propertiesOrder) + 1
+			}
+			return len(propertiesOrder) + 2
+		}
+
+		for i, name := range propertiesOrder {
+			if child.Name == name {
+				return i
+			}
+		}
+		return len(propertiesOrder)
+	}
+
+	sort.SliceStable(node.Children, func(i, j int) bool {
+		return rank(node.Children[i]) < rank(node.Children[j])
+	})
+
+	for _, child := range node.Children {
+		if IsComponent(child) {
+			sortChildren(child, componentPropertiesOrder)
+		}
+	}
+}
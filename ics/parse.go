@@ -0,0 +1,167 @@
+// Package ics provides helpers to parse, build and serialize iCalendar (RFC5545) data. It works
+// on top of the `ical-go` node structure, which is the iCalendar representation used throughout the lib.
+package ics
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/laurent22/ical-go"
+)
+
+const (
+	// TypeProperty is the `ical.Node` type of properties (name/value nodes).
+	TypeProperty = 0
+	// TypeComponent is the `ical.Node` type of components (BEGIN/END blocks).
+	TypeComponent = 1
+)
+
+// Parse parses the iCalendar `data` and returns its root node, usually a VCALENDAR component.
+// Contrary to `ical.ParseCalendar`, it unfolds long lines (RFC5545#3.1), understands quoted parameter
+// values and never panics on malformed content, returning an error instead.
+func Parse(data string) (*ical.Node, error) {
+	lines := unfoldLines(data)
+	if len(lines) == 0 {
+		return nil, errors.New("ics: empty iCalendar data")
+	}
+
+	var stack []*ical.Node
+	var root *ical.Node
+
+	for i, line := range lines {
+		prop, err := parseLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("ics: %s on line %d", err, i+1)
+		}
+
+		switch prop.Name {
+		case "BEGIN":
+			comp := NewComponent(strings.ToUpper(strings.TrimSpace(prop.Value)))
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.Children = append(parent.Children, comp)
+			} else if root != nil {
+				return nil, fmt.Errorf("ics: unexpected content after the end of %s on line %d", root.Name, i+1)
+			} else {
+				root = comp
+			}
+			stack = append(stack, comp)
+		case "END":
+			if len(stack) == 0 || stack[len(stack)-1].Name != strings.ToUpper(strings.TrimSpace(prop.Value)) {
+				return nil, fmt.Errorf("ics: unexpected END:%s on line %d", prop.Value, i+1)
+			}
+			stack = stack[:len(stack)-1]
+		default:
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("ics: property %s outside of a component on line %d", prop.Name, i+1)
+			}
+			parent := stack[len(stack)-1]
+			parent.Children = append(parent.Children, prop)
+		}
+	}
+
+	if len(stack) > 0 {
+		return nil, fmt.Errorf("ics: missing END:%s", stack[len(stack)-1].Name)
+	}
+
+	return root, nil
+}
+
+// unfoldLines splits the data in content lines, joining the folded ones: a line break followed by a single
+// space or tab is removed (RFC5545#3.1). The content of the lines is kept as it is, trailing spaces included.
+// For leniency with hand written data, the leading spaces of the first line and a common indentation shared
+// by all the other lines are removed before unfolding, and the blank lines are skipped.
+func unfoldLines(data string) []string {
+	data = strings.Replace(data, "\r\n", "\n", -1)
+	data = strings.Replace(data, "\r", "\n", -1)
+	rawLines := strings.Split(strings.TrimLeft(data, " \t\n"), "\n")
+
+	indent := -1
+	for _, line := range rawLines[1:] {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if lineIndent := len(line) - len(strings.TrimLeft(line, " \t")); indent == -1 || lineIndent < indent {
+			indent = lineIndent
+		}
+	}
+
+	lines := []string{}
+	for i, line := range rawLines {
+		if strings.TrimSpace(line) == "" && len(line) <= indent {
+			continue
+		}
+		if i > 0 && indent > 0 {
+			line = line[indent:]
+		}
+
+		switch {
+		case line == "":
+			continue
+		case (line[0] == ' ' || line[0] == '\t') && len(lines) > 0:
+			lines[len(lines)-1] += line[1:]
+		case strings.TrimSpace(line) != "":
+			lines = append(lines, line)
+		}
+	}
+
+	return lines
+}
+
+// parseLine parses a single content line: `name *(";" param) ":" value`.
+func parseLine(line string) (*ical.Node, error) {
+	nameEnd := strings.IndexAny(line, ";:")
+	if nameEnd <= 0 {
+		return nil, errors.New("invalid content line")
+	}
+
+	prop := NewProperty(strings.ToUpper(line[:nameEnd]), "", nil)
+	rest := line[nameEnd:]
+
+	for rest != "" && rest[0] == ';' {
+		rest = rest[1:]
+
+		eq := strings.Index(rest, "=")
+		if eq <= 0 {
+			return nil, errors.New("invalid property parameter")
+		}
+		paramName := strings.ToUpper(rest[:eq])
+		rest = rest[eq+1:]
+
+		// the param value goes until the next `;` or `:` that is not inside a quoted string
+		quoted := false
+		end := -1
+		for i, c := range rest {
+			if c == '"' {
+				quoted = !quoted
+			} else if !quoted && (c == ';' || c == ':') {
+				end = i
+				break
+			}
+		}
+		if end == -1 {
+			return nil, errors.New("missing property value")
+		}
+
+		prop.Parameters[paramName] = unquoteParam(rest[:end])
+		rest = rest[end:]
+	}
+
+	if rest == "" || rest[0] != ':' {
+		return nil, errors.New("missing property value")
+	}
+	prop.Value = rest[1:]
+
+	return prop, nil
+}
+
+// unquoteParam removes the surrounding quotes of a param value made of one single quoted string.
+// Lists of values are kept as they are.
+func unquoteParam(value string) string {
+	if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' && !strings.Contains(value[1:len(value)-1], `"`) {
+		return value[1 : len(value)-1]
+	}
+
+	return value
+}
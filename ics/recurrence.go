@@ -0,0 +1,531 @@
+package ics
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/laurent22/ical-go"
+)
+
+// The limits of the expansion of a recurrence rule: the maximum number of consecutive periods (years, months, weeks,
+// etc) without any occurrence, so that rules never matching any day, like "FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=30", do
+// not loop forever, and the maximum number of occurrences. The expansions stopped by them are reported as incomplete.
+const (
+	maxRecurrencePeriods   = 100000
+	maxRecurrenceInstances = 1000000
+)
+
+// The length of the periods of the frequencies shorter than a day.
+var recurrenceUnits = map[string]time.Duration{"HOURLY": time.Hour, "MINUTELY": time.Minute, "SECONDLY": time.Second}
+
+// A recurrence rule (RFC5545#3.3.10). The BYHOUR, BYMINUTE, BYSECOND, BYYEARDAY and BYWEEKNO parts are not supported.
+type recurrenceRule struct {
+	freq       string
+	interval   int
+	count      int
+	until      string
+	byMonth    []int
+	byMonthDay []int
+	byDay      []weekdayNum
+	bySetPos   []int
+	wkst       time.Weekday
+}
+
+// A BYDAY value, e.g. "-1SU" for the last Sunday. The ordinal is 0 when not given.
+type weekdayNum struct {
+	ordinal int
+	weekday time.Weekday
+}
+
+var recurrenceFrequencies = []string{"SECONDLY", "MINUTELY", "HOURLY", "DAILY", "WEEKLY", "MONTHLY", "YEARLY"}
+
+func parseRecurrenceRule(value string) (*recurrenceRule, bool) {
+	rule := &recurrenceRule{interval: 1, wkst: time.Monday}
+
+	ints := func(value string, min, max int) ([]int, bool) {
+		var result []int
+		for _, v := range strings.Split(value, ",") {
+			n, err := strconv.Atoi(strings.TrimPrefix(v, "+"))
+			if err != nil || n == 0 || n < -max || n > max || (min > 0 && n < min) {
+				return nil, false
+			}
+			result = append(result, n)
+		}
+		return result, true
+	}
+
+	ok := true
+	for _, part := range strings.Split(value, ";") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+
+		value := strings.ToUpper(kv[1])
+		switch strings.ToUpper(kv[0]) {
+		case "FREQ":
+			rule.freq = value
+		case "INTERVAL":
+			n, err := strconv.Atoi(value)
+			ok = ok && err == nil && n > 0
+			rule.interval = n
+		case "COUNT":
+			n, err := strconv.Atoi(value)
+			ok = ok && err == nil && n > 0
+			rule.count = n
+		case "UNTIL":
+			rule.until = value
+		case "BYMONTH":
+			rule.byMonth, ok = ints(value, 1, 12)
+		case "BYMONTHDAY":
+			rule.byMonthDay, ok = ints(value, 0, 31)
+		case "BYSETPOS":
+			rule.bySetPos, ok = ints(value, 0, 366)
+		case "BYDAY":
+			for _, v := range strings.Split(value, ",") {
+				if len(v) < 2 {
+					return nil, false
+				}
+				weekday, found := weekdays[v[len(v)-2:]]
+				if !found {
+					return nil, false
+				}
+				day := weekdayNum{weekday: weekday}
+				if ordinal := v[:len(v)-2]; ordinal != "" {
+					n, err := strconv.Atoi(strings.TrimPrefix(ordinal, "+"))
+					if err != nil || n == 0 {
+						return nil, false
+					}
+					day.ordinal = n
+				}
+				rule.byDay = append(rule.byDay, day)
+			}
+		case "WKST":
+			rule.wkst, ok = weekdays[value]
+		}
+
+		if !ok {
+			return nil, false
+		}
+	}
+
+	return rule, contains(recurrenceFrequencies, rule.freq)
+}
+
+// EachInstance calls `fn` for the instances of the components with the given name in the calendar object, with the
+// component defining the instance and its period in UTC. A recurring component repeats with its RRULE and RDATEs,
+// except for its EXDATEs and for the instances overridden by the components with the same UID and a RECURRENCE-ID,
+// which are given on their own. The instances of each component are given in chronological order, and no more
+// instances of the component are given once `fn` returns false.
+//
+// Only the instances starting before `rangeEnd` are given, unless it is zero. It returns false when the expansion of
+// a recurrence was stopped by the limits of `maxRecurrencePeriods` and `maxRecurrenceInstances` before reaching
+// `rangeEnd` or its last instance: the later instances are then unknown and the recurrence must be considered open-ended.
+func (ctx *TimeContext) EachInstance(cal *ical.Node, name string, rangeEnd time.Time, fn func(comp *ical.Node, start, end time.Time) bool) bool {
+	comps := Components(cal, name)
+
+	overridden := make(map[string][]time.Time)
+	for _, comp := range comps {
+		if rid := Property(comp, "RECURRENCE-ID"); rid != nil {
+			if t, ok := ctx.DateTime(rid); ok {
+				uid := comp.PropString("UID", "")
+				overridden[uid] = append(overridden[uid], t)
+			}
+		}
+	}
+
+	complete := true
+	for _, comp := range comps {
+		if Property(comp, "RECURRENCE-ID") != nil {
+			if start, end, ok := ctx.Period(comp); ok && (rangeEnd.IsZero() || start.Before(rangeEnd)) {
+				fn(comp, start, end)
+			}
+			continue
+		}
+
+		complete = ctx.expand(comp, overridden[comp.PropString("UID", "")], rangeEnd, func(start, end time.Time) bool {
+			return fn(comp, start, end)
+		}) && complete
+	}
+
+	return complete
+}
+
+// Expands the instances of a component starting before `rangeEnd`, in chronological order, without the `excluded`
+// ones. It returns false when the expansion was stopped by the limits of the recurrence rules.
+func (ctx *TimeContext) expand(comp *ical.Node, excluded []time.Time, rangeEnd time.Time, fn func(start, end time.Time) bool) bool {
+	startProp := Property(comp, "DTSTART")
+	if startProp == nil {
+		return true
+	}
+
+	wall, tz, _ := ctx.localTime(startProp)
+	start, end, ok := ctx.Period(comp)
+	if !ok {
+		return true
+	}
+	duration := end.Sub(start)
+
+	// the RDATEs and EXDATEs have the same time zone of their property
+	dates := func(name string) []time.Time {
+		var result []time.Time
+		for _, prop := range Properties(comp, name) {
+			for _, value := range strings.Split(prop.Value, ",") {
+				// the periods of the RDATEs (RFC5545#3.3.9) have the same duration of the component
+				value = strings.SplitN(value, "/", 2)[0]
+				if t, ok := ctx.DateTime(&ical.Node{Name: name, Value: value, Parameters: prop.Parameters}); ok {
+					result = append(result, t)
+				}
+			}
+		}
+		return result
+	}
+
+	excluded = append(dates("EXDATE"), excluded...)
+	rdates := dates("RDATE")
+	sort.Slice(rdates, func(i, j int) bool { return rdates[i].Before(rdates[j]) })
+
+	var last time.Time
+	stopped := false
+	emit := func(t time.Time) bool {
+		if stopped || (!last.IsZero() && !t.After(last)) {
+			return !stopped
+		}
+		last = t
+
+		if !rangeEnd.IsZero() && !t.Before(rangeEnd) {
+			stopped = true
+			return false
+		}
+
+		for _, e := range excluded {
+			if e.Equal(t) {
+				return true
+			}
+		}
+
+		stopped = !fn(t, t.Add(duration))
+		return !stopped
+	}
+
+	// gives the RDATEs before the given time, so that all the instances are given in order
+	emitRDates := func(before time.Time) bool {
+		for len(rdates) > 0 && (before.IsZero() || rdates[0].Before(before)) {
+			if !emit(rdates[0]) {
+				return false
+			}
+			rdates = rdates[1:]
+		}
+		return true
+	}
+
+	rule, ok := parseRecurrenceRule(comp.PropString("RRULE", ""))
+	if !ok {
+		// without a valid rule, the component occurs only on its DTSTART and RDATEs
+		if emitRDates(start) && emit(start) {
+			emitRDates(time.Time{})
+		}
+		return true
+	}
+
+	if !emitRDates(start) {
+		return true
+	}
+
+	complete := rule.each(wall, tz, rangeEnd, func(t time.Time) bool {
+		return emitRDates(t) && emit(t)
+	})
+
+	emitRDates(time.Time{})
+	return complete
+}
+
+// Calls `fn`, in chronological order, with the absolute times of the occurrences of the rule starting at the local time
+// `dtstart` in the time zone `tz`, until the rule ends, the periods start after `rangeEnd` (unless it is zero) or `fn`
+// returns false. The first occurrence is always `dtstart`. It returns false when none of these happened before the
+// limits of `maxRecurrencePeriods` and `maxRecurrenceInstances`.
+func (rule *recurrenceRule) each(dtstart time.Time, tz *Timezone, rangeEnd time.Time, fn func(t time.Time) bool) bool {
+	until := time.Time{}
+	untilLocal := false
+	if rule.until != "" {
+		for _, layout := range dateTimeLayouts {
+			if t, err := time.Parse(layout, rule.until); err == nil {
+				until, untilLocal = t, !strings.HasSuffix(layout, "Z")
+				break
+			}
+		}
+	}
+
+	count := 0
+	yield := func(wall time.Time) bool {
+		t := tz.ToUTC(wall)
+		if !until.IsZero() && ((untilLocal && wall.After(until)) || (!untilLocal && t.After(until))) {
+			return false
+		}
+
+		count++
+		if rule.count > 0 && count > rule.count {
+			return false
+		}
+
+		return fn(t)
+	}
+
+	if !yield(dtstart) {
+		return true
+	}
+
+	for n, empty := 0, 0; empty < maxRecurrencePeriods && count < maxRecurrenceInstances; n += rule.interval {
+		start := rule.periodStart(dtstart, n)
+		if !rangeEnd.IsZero() && !tz.ToUTC(start).Before(rangeEnd) {
+			return true
+		}
+
+		occurrences := rule.occurrences(dtstart, n)
+		if len(occurrences) == 0 {
+			empty++
+			// the periods shorter than a day have no occurrence on the whole day, which is skipped
+			if unit := recurrenceUnits[rule.freq]; unit > 0 {
+				nextDay := time.Date(start.Year(), start.Month(), start.Day()+1, 0, 0, 0, 0, time.UTC)
+				periods := int((nextDay.Sub(dtstart)-1)/(unit*time.Duration(rule.interval))) + 1
+				n = periods*rule.interval - rule.interval
+			}
+			continue
+		}
+		empty = 0
+
+		for _, wall := range occurrences {
+			if wall.After(dtstart) && !yield(wall) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Returns the local time when the n-th period (year, month, etc) after the DTSTART starts.
+func (rule *recurrenceRule) periodStart(dtstart time.Time, n int) time.Time {
+	y, m, d := dtstart.Date()
+	switch rule.freq {
+	case "YEARLY":
+		return time.Date(y+n, time.January, 1, 0, 0, 0, 0, time.UTC)
+	case "MONTHLY":
+		return time.Date(y, m+time.Month(n), 1, 0, 0, 0, 0, time.UTC)
+	case "WEEKLY":
+		return time.Date(y, m, d-(int(dtstart.Weekday())-int(rule.wkst)+7)%7+7*n, 0, 0, 0, 0, time.UTC)
+	case "DAILY":
+		return time.Date(y, m, d+n, 0, 0, 0, 0, time.UTC)
+	}
+
+	return dtstart.Add(time.Duration(n) * recurrenceUnits[rule.freq])
+}
+
+// Returns the local times of the occurrences of the rule in the n-th period (year, month, etc) after the DTSTART.
+func (rule *recurrenceRule) occurrences(dtstart time.Time, n int) []time.Time {
+	start := rule.periodStart(dtstart, n)
+	clock := time.Duration(dtstart.Hour())*time.Hour + time.Duration(dtstart.Minute())*time.Minute + time.Duration(dtstart.Second())*time.Second
+
+	var days []time.Time
+	switch rule.freq {
+	case "YEARLY":
+		days = rule.yearDays(start.Year(), dtstart)
+	case "MONTHLY":
+		if rule.matchesMonth(start) {
+			days = rule.monthDays(start.Year(), start.Month(), dtstart.Day())
+		}
+	case "WEEKLY":
+		for i := 0; i < 7; i++ {
+			t := start.AddDate(0, 0, i)
+			// without BYDAY, the rule repeats on the weekday of the DTSTART
+			if rule.matchesMonth(t) && ((len(rule.byDay) == 0 && t.Weekday() == dtstart.Weekday()) || (len(rule.byDay) > 0 && rule.matchesWeekday(t))) {
+				days = append(days, t)
+			}
+		}
+	case "DAILY":
+		if rule.matches(start) {
+			days = append(days, start)
+		}
+	default:
+		if rule.matches(start) {
+			return []time.Time{start}
+		}
+		return nil
+	}
+
+	result := make([]time.Time, 0, len(days))
+	for _, t := range days {
+		result = append(result, t.Add(clock))
+	}
+
+	return rule.setPositions(result)
+}
+
+// Returns the days of the year matching the rule. See RFC5545#3.3.10 about how each BYxxx part expands the year.
+func (rule *recurrenceRule) yearDays(year int, dtstart time.Time) []time.Time {
+	var days []time.Time
+
+	switch {
+	case len(rule.byMonth) > 0:
+		for month := time.January; month <= time.December; month++ {
+			if rule.matchesMonth(time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)) {
+				days = append(days, rule.monthDays(year, month, dtstart.Day())...)
+			}
+		}
+	case len(rule.byMonthDay) > 0:
+		for month := time.January; month <= time.December; month++ {
+			days = append(days, rule.monthDays(year, month, 0)...)
+		}
+	case len(rule.byDay) > 0:
+		first := time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+		days = selectWeekdays(first, first.AddDate(1, 0, 0), rule.byDay)
+	default:
+		if t := time.Date(year, dtstart.Month(), dtstart.Day(), 0, 0, 0, 0, time.UTC); t.Month() == dtstart.Month() {
+			days = append(days, t)
+		}
+	}
+
+	return days
+}
+
+// Returns the days of the month matching the BYMONTHDAY and BYDAY parts of the rule or, without them, the `defaultDay`.
+func (rule *recurrenceRule) monthDays(year int, month time.Month, defaultDay int) []time.Time {
+	first := time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+	next := first.AddDate(0, 1, 0)
+	daysInMonth := next.AddDate(0, 0, -1).Day()
+
+	var days []time.Time
+	if len(rule.byMonthDay) > 0 {
+		for _, d := range rule.byMonthDay {
+			if d < 0 {
+				d = daysInMonth + d + 1
+			}
+			if d >= 1 && d <= daysInMonth {
+				days = append(days, first.AddDate(0, 0, d-1))
+			}
+		}
+	}
+
+	if len(rule.byDay) > 0 {
+		weekdays := selectWeekdays(first, next, rule.byDay)
+		if len(rule.byMonthDay) == 0 {
+			days = weekdays
+		} else {
+			var both []time.Time
+			for _, t := range days {
+				for _, w := range weekdays {
+					if t.Equal(w) {
+						both = append(both, t)
+						break
+					}
+				}
+			}
+			days = both
+		}
+	}
+
+	if len(rule.byMonthDay) == 0 && len(rule.byDay) == 0 && defaultDay >= 1 && defaultDay <= daysInMonth {
+		days = append(days, first.AddDate(0, 0, defaultDay-1))
+	}
+
+	sort.Slice(days, func(i, j int) bool { return days[i].Before(days[j]) })
+	return days
+}
+
+// Returns the days in [from, to) with the given weekdays. The weekdays with an ordinal select only the n-th
+// of them in the span, e.g. "2MO" is the second Monday and "-1FR" the last Friday.
+func selectWeekdays(from, to time.Time, byDay []weekdayNum) []time.Time {
+	var days []time.Time
+
+	for _, wd := range byDay {
+		var matching []time.Time
+		for t := from; t.Before(to); t = t.AddDate(0, 0, 1) {
+			if t.Weekday() == wd.weekday {
+				matching = append(matching, t)
+			}
+		}
+
+		switch {
+		case wd.ordinal == 0:
+			days = append(days, matching...)
+		case wd.ordinal > 0 && wd.ordinal <= len(matching):
+			days = append(days, matching[wd.ordinal-1])
+		case wd.ordinal < 0 && -wd.ordinal <= len(matching):
+			days = append(days, matching[len(matching)+wd.ordinal])
+		}
+	}
+
+	sort.Slice(days, func(i, j int) bool { return days[i].Before(days[j]) })
+	return days
+}
+
+// Tells whether the time is in one of the BYMONTH months, if any.
+func (rule *recurrenceRule) matchesMonth(t time.Time) bool {
+	if len(rule.byMonth) == 0 {
+		return true
+	}
+
+	for _, m := range rule.byMonth {
+		if time.Month(m) == t.Month() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Tells whether the time is on one of the BYDAY weekdays, if any. The ordinals are ignored.
+func (rule *recurrenceRule) matchesWeekday(t time.Time) bool {
+	if len(rule.byDay) == 0 {
+		return true
+	}
+
+	for _, wd := range rule.byDay {
+		if wd.weekday == t.Weekday() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Tells whether the time matches the BYMONTH, BYMONTHDAY and BYDAY parts, which limit the DAILY and shorter frequencies.
+func (rule *recurrenceRule) matches(t time.Time) bool {
+	if !rule.matchesMonth(t) || !rule.matchesWeekday(t) {
+		return false
+	}
+
+	if len(rule.byMonthDay) == 0 {
+		return true
+	}
+
+	daysInMonth := time.Date(t.Year(), t.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	for _, d := range rule.byMonthDay {
+		if d == t.Day() || daysInMonth+d+1 == t.Day() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Applies the BYSETPOS part to the occurrences of a period.
+func (rule *recurrenceRule) setPositions(occurrences []time.Time) []time.Time {
+	if len(rule.bySetPos) == 0 {
+		return occurrences
+	}
+
+	var result []time.Time
+	for _, pos := range rule.bySetPos {
+		if pos > 0 && pos <= len(occurrences) {
+			result = append(result, occurrences[pos-1])
+		} else if pos < 0 && -pos <= len(occurrences) {
+			result = append(result, occurrences[len(occurrences)+pos])
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Before(result[j]) })
+	return result
+}
@@ -0,0 +1,112 @@
+package ics
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/laurent22/ical-go"
+)
+
+const (
+	// CRLF is the line break required by RFC5545 between content lines.
+	CRLF = "\r\n"
+	// maximum length of a content line, in octets, before it gets folded. [See RFC5545#3.1]
+	maxLineOctets = 75
+)
+
+// Serialize converts the node (and all its children) into iCalendar text. Content lines are
+// terminated with CRLF and folded when longer than 75 octets. Parameters are written sorted by name.
+func Serialize(node *ical.Node) string {
+	var sb strings.Builder
+	writeNode(&sb, node)
+
+	return sb.String()
+}
+
+func writeNode(sb *strings.Builder, node *ical.Node) {
+	if node.Type == TypeComponent {
+		writeLine(sb, "BEGIN:"+node.Name)
+		for _, child := range node.Children {
+			writeNode(sb, child)
+		}
+		writeLine(sb, "END:"+node.Name)
+
+		return
+	}
+
+	line := node.Name
+	paramNames := make([]string, 0, len(node.Parameters))
+	for name := range node.Parameters {
+		paramNames = append(paramNames, name)
+	}
+	sort.Strings(paramNames)
+
+	for _, name := range paramNames {
+		line += ";" + name + "=" + quoteParam(node.Parameters[name])
+	}
+
+	writeLine(sb, line+":"+node.Value)
+}
+
+// writeLine writes a content line folding it in chunks of at most 75 octets,
+// taking care to not split multi-octet UTF-8 characters.
+func writeLine(sb *strings.Builder, line string) {
+	limit := maxLineOctets
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+
+		sb.WriteString(line[:cut])
+		sb.WriteString(CRLF + " ")
+		line = line[cut:]
+		// the leading space of a continuation line counts for the line length
+		limit = maxLineOctets - 1
+	}
+
+	sb.WriteString(line)
+	sb.WriteString(CRLF)
+}
+
+// quoteParam quotes the param value when it contains characters not allowed in unquoted values.
+// Values already containing quotes (e.g. lists of quoted values) are written as they are.
+func quoteParam(value string) string {
+	if strings.Contains(value, `"`) || !strings.ContainsAny(value, ":;,") {
+		return value
+	}
+
+	return `"` + value + `"`
+}
+
+// EscapeText escapes a TEXT property value. [See RFC5545#3.3.11]
+func EscapeText(text string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+	return replacer.Replace(text)
+}
+
+// UnescapeText reverts the escaping of a TEXT property value. [See RFC5545#3.3.11]
+func UnescapeText(text string) string {
+	replacer := strings.NewReplacer(`\\`, `\`, `\;`, ";", `\,`, ",", `\n`, "\n", `\N`, "\n")
+	return replacer.Replace(text)
+}
+
+// SplitText splits a list of TEXT values, e.g. of the CATEGORIES property, on the commas that are not escaped,
+// and unescapes the values.
+func SplitText(value string) []string {
+	var result []string
+
+	start := 0
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case '\\':
+			i++
+		case ',':
+			result = append(result, UnescapeText(value[start:i]))
+			start = i + 1
+		}
+	}
+
+	return append(result, UnescapeText(value[start:]))
+}
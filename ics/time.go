@@ -0,0 +1,199 @@
+package ics
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/laurent22/ical-go"
+
+	"github.com/samedi/caldav-go/lib"
+)
+
+var dateTimeLayouts = []string{"20060102T150405Z", "20060102T150405", "20060102"}
+
+// TimeContext resolves the DATE and DATE-TIME values of a calendar object into absolute times. The local times
+// with a TZID are resolved in the IANA time zone with that name or, when unknown, in the time zone defined by
+// the VTIMEZONE components of the object. The floating times and the dates are resolved in the floating time zone.
+type TimeContext struct {
+	timezones map[string]*Timezone
+	floating  *Timezone
+}
+
+// NewTimeContext initializes a new `TimeContext` for the calendar object (which can be nil) and the time zone
+// used for the floating times, e.g. the calendar-timezone of the collection. A nil `floating` means UTC.
+func NewTimeContext(cal *ical.Node, floating *Timezone) *TimeContext {
+	ctx := &TimeContext{timezones: make(map[string]*Timezone), floating: floating}
+
+	if cal != nil {
+		for _, vtimezone := range Components(cal, lib.VTIMEZONE) {
+			if tz, err := ParseTimezone(vtimezone); err == nil {
+				ctx.timezones[tz.TZID] = tz
+			}
+		}
+	}
+
+	return ctx
+}
+
+// Timezone returns the time zone with the given TZID, and a flag saying whether it is known.
+func (ctx *TimeContext) Timezone(tzid string) (*Timezone, bool) {
+	if tz, ok := LoadTimezone(tzid); ok {
+		return tz, true
+	}
+
+	tz, ok := ctx.timezones[tzid]
+	return tz, ok
+}
+
+// DateTime returns the absolute time, in UTC, of the value of a DATE or DATE-TIME property.
+// Contrary to `ical.Node.PropDate`, it never panics on unexpected values.
+func (ctx *TimeContext) DateTime(prop *ical.Node) (time.Time, bool) {
+	wall, tz, ok := ctx.localTime(prop)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	return tz.ToUTC(wall), true
+}
+
+// Returns the local time of the value of a DATE or DATE-TIME property, with the clock in UTC, and the
+// time zone it is in. The UTC values are in the nil time zone.
+func (ctx *TimeContext) localTime(prop *ical.Node) (time.Time, *Timezone, bool) {
+	for _, layout := range dateTimeLayouts {
+		wall, err := time.Parse(layout, prop.Value)
+		if err != nil {
+			continue
+		}
+
+		if strings.HasSuffix(layout, "Z") {
+			return wall, nil, true
+		}
+
+		tz := ctx.floating
+		if tzid := prop.Parameter("TZID", ""); tzid != "" && !IsDate(prop) {
+			if known, ok := ctx.Timezone(tzid); ok {
+				tz = known
+			}
+		}
+
+		return wall, tz, true
+	}
+
+	return time.Time{}, nil, false
+}
+
+// Period returns the time period, in UTC, of a VEVENT or VTODO component (RFC5545#3.6.1 and #3.6.2). The end is
+// the DTEND (or DUE), the start plus the DURATION, the next day for all-day events, or the start itself otherwise.
+func (ctx *TimeContext) Period(comp *ical.Node) (time.Time, time.Time, bool) {
+	startProp := Property(comp, "DTSTART")
+	if startProp == nil {
+		return time.Time{}, time.Time{}, false
+	}
+
+	start, ok := ctx.DateTime(startProp)
+	if !ok {
+		return time.Time{}, time.Time{}, false
+	}
+
+	for _, name := range []string{"DTEND", "DUE"} {
+		if endProp := Property(comp, name); endProp != nil {
+			if end, ok := ctx.DateTime(endProp); ok {
+				return start, end, true
+			}
+		}
+	}
+
+	if duration, ok := ParseDuration(comp.PropString("DURATION", "")); ok {
+		return start, start.Add(duration), true
+	}
+
+	if IsDate(startProp) {
+		return start, start.AddDate(0, 0, 1), true
+	}
+
+	return start, start, true
+}
+
+// DateTime parses the value of a DATE or DATE-TIME property, without the time zones defined in the calendar
+// object and with the floating times in UTC. See `TimeContext.DateTime`.
+func DateTime(prop *ical.Node) (time.Time, bool) {
+	return NewTimeContext(nil, nil).DateTime(prop)
+}
+
+// IsDate tells whether the value of the property is a DATE, e.g. the DTSTART of an all-day event.
+func IsDate(prop *ical.Node) bool {
+	return prop.Parameter("VALUE", "") == "DATE" || len(prop.Value) == len("20060102")
+}
+
+var durationRegexp = regexp.MustCompile(`^([+-])?P(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+
+// ParseDuration parses a DURATION value (RFC5545#3.3.6), e.g. "P1DT2H" or "-PT15M".
+func ParseDuration(value string) (time.Duration, bool) {
+	matches := durationRegexp.FindStringSubmatch(value)
+	if matches == nil || value == "P" || value == "+P" || value == "-P" {
+		return 0, false
+	}
+
+	units := []time.Duration{7 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute, time.Second}
+
+	var duration time.Duration
+	for i, unit := range units {
+		if matches[i+2] != "" {
+			n, _ := strconv.Atoi(matches[i+2])
+			duration += time.Duration(n) * unit
+		}
+	}
+
+	if matches[1] == "-" {
+		duration = -duration
+	}
+
+	return duration, true
+}
+
+// FormatDuration formats the duration as a DURATION value (RFC5545#3.3.6), e.g. "P1DT2H" or "-PT15M".
+// The durations of whole weeks are given in weeks.
+func FormatDuration(duration time.Duration) string {
+	sign := ""
+	if duration < 0 {
+		sign, duration = "-", -duration
+	}
+
+	if duration == 0 {
+		return "PT0S"
+	}
+
+	week := 7 * 24 * time.Hour
+	if duration%week == 0 {
+		return sign + "P" + strconv.Itoa(int(duration/week)) + "W"
+	}
+
+	value := sign + "P"
+	if days := duration / (24 * time.Hour); days > 0 {
+		value += strconv.Itoa(int(days)) + "D"
+		duration -= days * 24 * time.Hour
+	}
+
+	if duration > 0 {
+		value += "T"
+		for _, unit := range []struct {
+			duration time.Duration
+			name     string
+		}{{time.Hour, "H"}, {time.Minute, "M"}, {time.Second, "S"}} {
+			if n := duration / unit.duration; n > 0 {
+				value += strconv.Itoa(int(n)) + unit.name
+				duration -= n * unit.duration
+			}
+		}
+	}
+
+	return value
+}
+
+// Period returns the time period of a VEVENT or VTODO component, without the time zones defined in the
+// calendar object and with the floating times in UTC. See `TimeContext.Period`.
+func Period(comp *ical.Node) (time.Time, time.Time, bool) {
+	return NewTimeContext(nil, nil).Period(comp)
+}
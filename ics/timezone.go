@@ -0,0 +1,349 @@
+package ics
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/laurent22/ical-go"
+
+	"github.com/samedi/caldav-go/lib"
+)
+
+// Timezone is a time zone used to resolve local times into absolute times. It is either a time zone known by its
+// IANA name (e.g. "Europe/Berlin") or one defined by the rules of a VTIMEZONE component (RFC5545#3.6.5).
+// A nil `*Timezone` is UTC.
+type Timezone struct {
+	TZID string
+
+	location    *time.Location
+	observances []observance
+}
+
+// An observance (STANDARD or DAYLIGHT) of a VTIMEZONE, which starts to be in effect on its onsets.
+type observance struct {
+	start      time.Time // local wall clock, as UTC
+	offsetFrom time.Duration
+	offsetTo   time.Duration
+	rule       *yearlyRule
+	rdates     []time.Time
+}
+
+// The yearly recurrence rule of an observance, e.g. "FREQ=YEARLY;BYMONTH=3;BYDAY=-1SU".
+type yearlyRule struct {
+	month     time.Month
+	weekday   time.Weekday
+	ordinal   int // 0 when BYDAY has no ordinal, e.g. "SU"
+	monthDays []int
+	until     time.Time
+	count     int
+}
+
+var errInvalidTimezone = errors.New("ics: invalid VTIMEZONE")
+
+// LoadTimezone returns the IANA time zone with the given TZID. The TZIDs prefixed with a path, like
+// "/mozilla.org/20050126_1/Europe/Berlin", are also understood.
+func LoadTimezone(tzid string) (*Timezone, bool) {
+	candidates := []string{tzid}
+	if split := strings.Split(strings.Trim(tzid, "/"), "/"); len(split) > 2 {
+		candidates = append(candidates, strings.Join(split[len(split)-2:], "/"))
+	}
+
+	for _, name := range candidates {
+		if name == "" || name == "Local" {
+			continue
+		}
+		if loc, err := time.LoadLocation(name); err == nil {
+			return &Timezone{TZID: tzid, location: loc}, true
+		}
+	}
+
+	return nil, false
+}
+
+// ParseTimezone builds the time zone defined by the rules of a VTIMEZONE component.
+func ParseTimezone(vtimezone *ical.Node) (*Timezone, error) {
+	tz := &Timezone{TZID: vtimezone.PropString("TZID", "")}
+	if tz.TZID == "" {
+		return nil, errInvalidTimezone
+	}
+
+	for _, comp := range Components(vtimezone, "STANDARD", "DAYLIGHT") {
+		obs, ok := parseObservance(comp)
+		if !ok {
+			return nil, errInvalidTimezone
+		}
+		tz.observances = append(tz.observances, obs)
+	}
+
+	if len(tz.observances) == 0 {
+		return nil, errInvalidTimezone
+	}
+
+	return tz, nil
+}
+
+// ParseCalendarTimezone returns the time zone of an iCalendar object with a single VTIMEZONE, like the
+// CALDAV:calendar-timezone property and the CALDAV:timezone element of queries (RFC4791#5.2.2 and #9.8).
+// The IANA time zone is used when the TZID is known, otherwise the rules of the VTIMEZONE.
+func ParseCalendarTimezone(data string) (*Timezone, error) {
+	cal, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+
+	vtimezones := Components(cal, lib.VTIMEZONE)
+	if len(vtimezones) != 1 {
+		return nil, errInvalidTimezone
+	}
+
+	if tz, ok := LoadTimezone(vtimezones[0].PropString("TZID", "")); ok {
+		return tz, nil
+	}
+
+	return ParseTimezone(vtimezones[0])
+}
+
+// ToUTC returns the absolute time, in UTC, of the local time with the clock of `wall` (its location is ignored).
+func (tz *Timezone) ToUTC(wall time.Time) time.Time {
+	wall = time.Date(wall.Year(), wall.Month(), wall.Day(), wall.Hour(), wall.Minute(), wall.Second(), wall.Nanosecond(), time.UTC)
+
+	switch {
+	case tz == nil:
+		return wall
+	case tz.location != nil:
+		return time.Date(wall.Year(), wall.Month(), wall.Day(), wall.Hour(), wall.Minute(), wall.Second(), wall.Nanosecond(), tz.location).UTC()
+	default:
+		return wall.Add(-tz.offset(wall))
+	}
+}
+
+// Returns the UTC offset in effect at the local time: the offset of the observance with the latest onset before it.
+func (tz *Timezone) offset(wall time.Time) time.Duration {
+	var latest time.Time
+	var offset time.Duration
+	found := false
+
+	for _, obs := range tz.observances {
+		if onset, ok := obs.lastOnset(wall); ok && (!found || onset.After(latest)) {
+			latest, offset, found = onset, obs.offsetTo, true
+		}
+	}
+
+	if !found {
+		// before any onset, the offset is the one in effect before the first observance
+		first := tz.observances[0]
+		for _, obs := range tz.observances {
+			if obs.start.Before(first.start) {
+				first = obs
+			}
+		}
+		return first.offsetFrom
+	}
+
+	return offset
+}
+
+// Returns the latest onset of the observance not after the local time.
+func (obs observance) lastOnset(wall time.Time) (time.Time, bool) {
+	if obs.start.After(wall) {
+		return time.Time{}, false
+	}
+
+	latest := obs.start
+	for _, rdate := range obs.rdates {
+		if rdate.After(latest) && !rdate.After(wall) {
+			latest = rdate
+		}
+	}
+
+	if obs.rule != nil {
+		for year := wall.Year(); year >= wall.Year()-1 && year >= obs.start.Year(); year-- {
+			onset, ok := obs.onset(year)
+			if ok && !onset.After(wall) {
+				if onset.After(latest) {
+					latest = onset
+				}
+				break
+			}
+		}
+	}
+
+	return latest, true
+}
+
+// Returns the onset of the observance rule in the given year, as local wall clock.
+func (obs observance) onset(year int) (time.Time, bool) {
+	rule := obs.rule
+	if rule.count > 0 && year >= obs.start.Year()+rule.count {
+		return time.Time{}, false
+	}
+
+	day := 0
+	daysInMonth := time.Date(year, rule.month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	first := time.Date(year, rule.month, 1, 0, 0, 0, 0, time.UTC)
+
+	switch {
+	case len(rule.monthDays) > 0:
+		for _, d := range rule.monthDays {
+			if d < 0 {
+				d = daysInMonth + d + 1
+			}
+			if d >= 1 && d <= daysInMonth && (rule.weekday == -1 || first.AddDate(0, 0, d-1).Weekday() == rule.weekday) {
+				day = d
+				break
+			}
+		}
+	case rule.weekday >= 0 && rule.ordinal >= 0:
+		ordinal := rule.ordinal
+		if ordinal == 0 {
+			ordinal = 1
+		}
+		day = 1 + (int(rule.weekday)-int(first.Weekday())+7)%7 + (ordinal-1)*7
+	case rule.weekday >= 0:
+		last := time.Date(year, rule.month, daysInMonth, 0, 0, 0, 0, time.UTC)
+		day = daysInMonth - (int(last.Weekday())-int(rule.weekday)+7)%7 + (rule.ordinal+1)*7
+	default:
+		day = obs.start.Day()
+	}
+
+	if day < 1 || day > daysInMonth {
+		return time.Time{}, false
+	}
+
+	onset := time.Date(year, rule.month, day, obs.start.Hour(), obs.start.Minute(), obs.start.Second(), 0, time.UTC)
+	if !rule.until.IsZero() && onset.Add(-obs.offsetFrom).After(rule.until) {
+		return time.Time{}, false
+	}
+
+	return onset, true
+}
+
+func parseObservance(comp *ical.Node) (observance, bool) {
+	obs := observance{}
+
+	start, err := time.Parse("20060102T150405", strings.TrimSuffix(comp.PropString("DTSTART", ""), "Z"))
+	if err != nil {
+		return obs, false
+	}
+	obs.start = start
+
+	var ok bool
+	if obs.offsetFrom, ok = parseUTCOffset(comp.PropString("TZOFFSETFROM", "")); !ok {
+		return obs, false
+	}
+	if obs.offsetTo, ok = parseUTCOffset(comp.PropString("TZOFFSETTO", "")); !ok {
+		return obs, false
+	}
+
+	for _, rdate := range Properties(comp, "RDATE") {
+		for _, value := range strings.Split(rdate.Value, ",") {
+			if t, err := time.Parse("20060102T150405", strings.TrimSuffix(value, "Z")); err == nil {
+				obs.rdates = append(obs.rdates, t)
+			}
+		}
+	}
+
+	if rrule := comp.PropString("RRULE", ""); rrule != "" {
+		if obs.rule, ok = parseYearlyRule(rrule, start); !ok {
+			return obs, false
+		}
+	}
+
+	return obs, true
+}
+
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+func parseYearlyRule(value string, start time.Time) (*yearlyRule, bool) {
+	rule := &yearlyRule{month: start.Month(), weekday: -1}
+
+	for _, part := range strings.Split(value, ";") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+
+		switch strings.ToUpper(kv[0]) {
+		case "FREQ":
+			if strings.ToUpper(kv[1]) != "YEARLY" {
+				return nil, false
+			}
+		case "BYMONTH":
+			month, err := strconv.Atoi(kv[1])
+			if err != nil || month < 1 || month > 12 {
+				return nil, false
+			}
+			rule.month = time.Month(month)
+		case "BYDAY":
+			byday := strings.ToUpper(kv[1])
+			if len(byday) < 2 {
+				return nil, false
+			}
+			weekday, found := weekdays[byday[len(byday)-2:]]
+			if !found {
+				return nil, false
+			}
+			rule.weekday = weekday
+			if ordinal := byday[:len(byday)-2]; ordinal != "" {
+				n, err := strconv.Atoi(strings.TrimPrefix(ordinal, "+"))
+				if err != nil {
+					return nil, false
+				}
+				rule.ordinal = n
+			}
+		case "BYMONTHDAY":
+			for _, d := range strings.Split(kv[1], ",") {
+				n, err := strconv.Atoi(d)
+				if err != nil {
+					return nil, false
+				}
+				rule.monthDays = append(rule.monthDays, n)
+			}
+		case "UNTIL":
+			until, err := time.Parse("20060102T150405Z", kv[1])
+			if err != nil {
+				if until, err = time.Parse("20060102", kv[1]); err != nil {
+					return nil, false
+				}
+			}
+			rule.until = until
+		case "COUNT":
+			count, err := strconv.Atoi(kv[1])
+			if err != nil {
+				return nil, false
+			}
+			rule.count = count
+		}
+	}
+
+	return rule, true
+}
+
+// Parses a UTC-OFFSET value, e.g. "+0100" or "-053000".
+func parseUTCOffset(value string) (time.Duration, bool) {
+	if len(value) != 5 && len(value) != 7 || (value[0] != '+' && value[0] != '-') {
+		return 0, false
+	}
+
+	var parts []int
+	for i := 1; i < len(value); i += 2 {
+		n, err := strconv.Atoi(value[i : i+2])
+		if err != nil {
+			return 0, false
+		}
+		parts = append(parts, n)
+	}
+	parts = append(parts, 0)
+
+	offset := time.Duration(parts[0])*time.Hour + time.Duration(parts[1])*time.Minute + time.Duration(parts[2])*time.Second
+	if value[0] == '-' {
+		offset = -offset
+	}
+
+	return offset, true
+}
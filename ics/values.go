@@ -0,0 +1,413 @@
+package ics
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/laurent22/ical-go"
+)
+
+// The value types of the properties, as named by the jCal and xCal formats. [See RFC7265#3.6 and RFC6321#3.6]
+const (
+	valueBoolean    = "boolean"
+	valueCalAddress = "cal-address"
+	valueDate       = "date"
+	valueDateTime   = "date-time"
+	valueDuration   = "duration"
+	valueFloat      = "float"
+	valueInteger    = "integer"
+	valuePeriod     = "period"
+	valueRecur      = "recur"
+	valueText       = "text"
+	valueTime       = "time"
+	valueURI        = "uri"
+	valueUTCOffset  = "utc-offset"
+	// the type of the values of the properties not known, which are kept as they are
+	valueUnknown = "unknown"
+)
+
+// The default value types of the properties (RFC5545#3.7 and #3.8, RFC7986#5). The properties not
+// listed here, e.g. the X- properties, have the unknown type unless they have a VALUE param.
+var defaultValueTypes = map[string]string{
+	"ACKNOWLEDGED":     valueDateTime,
+	"ACTION":           valueText,
+	"ATTACH":           valueURI,
+	"ATTENDEE":         valueCalAddress,
+	"CALSCALE":         valueText,
+	"CATEGORIES":       valueText,
+	"CLASS":            valueText,
+	"COLOR":            valueText,
+	"COMMENT":          valueText,
+	"COMPLETED":        valueDateTime,
+	"CONFERENCE":       valueURI,
+	"CONTACT":          valueText,
+	"CREATED":          valueDateTime,
+	"DESCRIPTION":      valueText,
+	"DTEND":            valueDateTime,
+	"DTSTAMP":          valueDateTime,
+	"DTSTART":          valueDateTime,
+	"DUE":              valueDateTime,
+	"DURATION":         valueDuration,
+	"EXDATE":           valueDateTime,
+	"EXRULE":           valueRecur,
+	"FREEBUSY":         valuePeriod,
+	"GEO":              valueFloat,
+	"IMAGE":            valueURI,
+	"LAST-MODIFIED":    valueDateTime,
+	"LOCATION":         valueText,
+	"METHOD":           valueText,
+	"NAME":             valueText,
+	"ORGANIZER":        valueCalAddress,
+	"PERCENT-COMPLETE": valueInteger,
+	"PRIORITY":         valueInteger,
+	"PRODID":           valueText,
+	"RDATE":            valueDateTime,
+	"RECURRENCE-ID":    valueDateTime,
+	"REFRESH-INTERVAL": valueDuration,
+	"RELATED-TO":       valueText,
+	"REPEAT":           valueInteger,
+	"REQUEST-STATUS":   valueText,
+	"RESOURCES":        valueText,
+	"RRULE":            valueRecur,
+	"SEQUENCE":         valueInteger,
+	"SOURCE":           valueURI,
+	"STATUS":           valueText,
+	"SUMMARY":          valueText,
+	"TRANSP":           valueText,
+	"TRIGGER":          valueDuration,
+	"TZID":             valueText,
+	"TZNAME":           valueText,
+	"TZOFFSETFROM":     valueUTCOffset,
+	"TZOFFSETTO":       valueUTCOffset,
+	"TZURL":            valueURI,
+	"UID":              valueText,
+	"URL":              valueURI,
+	"VERSION":          valueText,
+}
+
+// The TEXT properties whose value is a list of texts. The values of the other types are lists when they
+// can be, e.g. the dates of the EXDATEs.
+var textListProperties = []string{"CATEGORIES", "RESOURCES"}
+
+// The properties with structured values, i.e. made of several values separated by semicolons.
+// [See RFC7265#3.4.1.3 and RFC6321#3.4.1.3]
+var structuredValueParts = map[string][]string{
+	"GEO":            {"latitude", "longitude"},
+	"REQUEST-STATUS": {"code", "description", "data"},
+}
+
+// The parts of a RRULE value that are numbers.
+var numericRecurParts = []string{"count", "interval", "bysecond", "byminute", "byhour", "bymonthday", "byyearday", "byweekno", "bymonth", "bysetpos"}
+
+// typedProperty is a property with its value typed, in the form shared by the jCal and xCal formats: the
+// names are in lower case and the values are written in their ISO 8601 like forms (e.g. 2016-09-14T17:00:00Z)
+// and without the escaping of the iCalendar text.
+type typedProperty struct {
+	Name      string
+	Params    []typedParam
+	ValueType string
+	// the values, each one being a `string`, a `[]string` for the structured values or a `[]recurPart`
+	Values []interface{}
+}
+
+type typedParam struct {
+	Name   string
+	Values []string
+}
+
+type recurPart struct {
+	Name   string
+	Values []string
+}
+
+// newTypedProperty types the value of the property node.
+func newTypedProperty(prop *ical.Node) typedProperty {
+	valueType := propertyValueType(prop)
+	tp := typedProperty{Name: strings.ToLower(prop.Name), ValueType: valueType}
+
+	paramNames := make([]string, 0, len(prop.Parameters))
+	for name := range prop.Parameters {
+		if name != "VALUE" {
+			paramNames = append(paramNames, name)
+		}
+	}
+	sort.Strings(paramNames)
+
+	for _, name := range paramNames {
+		tp.Params = append(tp.Params, typedParam{Name: strings.ToLower(name), Values: splitParamValues(prop.Parameters[name])})
+	}
+
+	if _, structured := structuredValueParts[prop.Name]; structured {
+		parts := splitUnescaped(prop.Value, ';')
+		if valueType == valueText {
+			for i := range parts {
+				parts[i] = UnescapeText(parts[i])
+			}
+		}
+		tp.Values = []interface{}{parts}
+
+		return tp
+	}
+
+	for _, value := range splitValues(prop, valueType) {
+		tp.Values = append(tp.Values, typedValue(valueType, value))
+	}
+
+	return tp
+}
+
+// node converts the typed property back to a property node. The VALUE param is set only when the
+// value type is not the default one of the property.
+func (tp typedProperty) node() (*ical.Node, error) {
+	if tp.Name == "" {
+		return nil, errors.New("property without name")
+	}
+
+	prop := NewProperty(strings.ToUpper(tp.Name), "", nil)
+	for _, param := range tp.Params {
+		prop.Parameters[strings.ToUpper(param.Name)] = joinParamValues(param.Values)
+	}
+
+	valueType := strings.ToLower(tp.ValueType)
+	if valueType != valueUnknown && valueType != defaultValueType(prop.Name) {
+		prop.Parameters["VALUE"] = strings.ToUpper(valueType)
+	}
+
+	values := make([]string, 0, len(tp.Values))
+	for _, value := range tp.Values {
+		switch value := value.(type) {
+		case string:
+			values = append(values, untypedValue(valueType, value))
+		case []string:
+			parts := make([]string, len(value))
+			for i, part := range value {
+				parts[i] = untypedValue(valueType, part)
+			}
+			values = append(values, strings.Join(parts, ";"))
+		case []recurPart:
+			values = append(values, untypedRecur(value))
+		default:
+			return nil, errors.New("invalid value of property " + prop.Name)
+		}
+	}
+	prop.Value = strings.Join(values, ",")
+
+	return prop, nil
+}
+
+// Returns the value type of the property, given by its VALUE param or else the default one of the property.
+func propertyValueType(prop *ical.Node) string {
+	if valueType, ok := prop.Parameters["VALUE"]; ok && valueType != "" {
+		return strings.ToLower(valueType)
+	}
+
+	return defaultValueType(prop.Name)
+}
+
+func defaultValueType(name string) string {
+	if valueType, ok := defaultValueTypes[name]; ok {
+		return valueType
+	}
+
+	return valueUnknown
+}
+
+// Splits the value of the property in its list of values. The texts are split only for the properties
+// whose value is a list of texts, and the types that may contain commas are never split.
+func splitValues(prop *ical.Node, valueType string) []string {
+	switch valueType {
+	case valueText:
+		if contains(textListProperties, prop.Name) {
+			return splitUnescaped(prop.Value, ',')
+		}
+	case valueDate, valueDateTime, valueTime, valuePeriod, valueDuration, valueInteger, valueFloat, valueBoolean, valueUTCOffset:
+		return strings.Split(prop.Value, ",")
+	}
+
+	return []string{prop.Value}
+}
+
+// Splits the value on the separators not escaped, without unescaping the parts.
+func splitUnescaped(value string, sep byte) []string {
+	var result []string
+
+	start := 0
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case '\\':
+			i++
+		case sep:
+			result = append(result, value[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(result, value[start:])
+}
+
+// Splits a list of quoted param values, e.g. MEMBER="mailto:a@example.com","mailto:b@example.com".
+// The values not quoted are kept as a single value.
+func splitParamValues(value string) []string {
+	if !strings.HasPrefix(value, `"`) {
+		return []string{value}
+	}
+
+	var result []string
+	quoted := false
+	start := 0
+	for i, c := range value {
+		if c == '"' {
+			quoted = !quoted
+		} else if c == ',' && !quoted {
+			result = append(result, unquoteParam(value[start:i]))
+			start = i + 1
+		}
+	}
+
+	return append(result, unquoteParam(value[start:]))
+}
+
+func joinParamValues(values []string) string {
+	if len(values) == 1 {
+		return values[0]
+	}
+
+	quoted := make([]string, len(values))
+	for i, value := range values {
+		quoted[i] = `"` + value + `"`
+	}
+
+	return strings.Join(quoted, ",")
+}
+
+// Converts a single iCalendar value to its typed form.
+func typedValue(valueType, value string) interface{} {
+	switch valueType {
+	case valueText:
+		return UnescapeText(value)
+	case valueDate:
+		return typedDate(value)
+	case valueDateTime:
+		return typedDateTime(value)
+	case valueTime:
+		return typedTime(value)
+	case valueUTCOffset:
+		if len(value) == 5 || len(value) == 7 {
+			return value[:3] + ":" + typedTime(value[3:])
+		}
+	case valuePeriod:
+		if slash := strings.Index(value, "/"); slash >= 0 {
+			return typedDateTime(value[:slash]) + "/" + typedPeriodEnd(value[slash+1:])
+		}
+	case valueBoolean:
+		return strings.ToLower(value)
+	case valueRecur:
+		return typedRecur(value)
+	}
+
+	return value
+}
+
+// Converts a typed value back to its iCalendar form.
+func untypedValue(valueType, value string) string {
+	switch valueType {
+	case valueText:
+		return EscapeText(value)
+	case valueDate, valueDateTime, valueTime, valuePeriod:
+		return strings.NewReplacer("-", "", ":", "").Replace(value)
+	case valueUTCOffset:
+		return strings.Replace(value, ":", "", -1)
+	case valueBoolean:
+		return strings.ToUpper(value)
+	}
+
+	return value
+}
+
+// YYYYMMDD to YYYY-MM-DD.
+func typedDate(value string) string {
+	if len(value) != 8 {
+		return value
+	}
+
+	return value[:4] + "-" + value[4:6] + "-" + value[6:]
+}
+
+// YYYYMMDDTHHMMSS[Z] to YYYY-MM-DDTHH:MM:SS[Z]. The dates are accepted too, e.g. for the UNTIL of the rules.
+func typedDateTime(value string) string {
+	if len(value) == 8 {
+		return typedDate(value)
+	}
+	if len(value) < 15 || value[8] != 'T' {
+		return value
+	}
+
+	return typedDate(value[:8]) + "T" + typedTime(value[9:])
+}
+
+// HHMMSS[Z] to HH:MM:SS[Z].
+func typedTime(value string) string {
+	if len(value) < 4 {
+		return value
+	}
+
+	result := value[:2] + ":" + value[2:4]
+	if len(value) >= 6 {
+		result += ":" + value[4:]
+	}
+
+	return result
+}
+
+// The end of a period is a date-time or a duration.
+func typedPeriodEnd(value string) string {
+	if strings.HasPrefix(value, "P") || strings.HasPrefix(value, "+P") || strings.HasPrefix(value, "-P") {
+		return value
+	}
+
+	return typedDateTime(value)
+}
+
+func typedRecur(value string) []recurPart {
+	parts := []recurPart{}
+	for _, part := range strings.Split(value, ";") {
+		if part == "" {
+			continue
+		}
+
+		name, values := part, ""
+		if eq := strings.Index(part, "="); eq >= 0 {
+			name, values = part[:eq], part[eq+1:]
+		}
+		name = strings.ToLower(name)
+
+		typed := strings.Split(values, ",")
+		if name == "until" {
+			for i := range typed {
+				typed[i] = typedDateTime(typed[i])
+			}
+		}
+
+		parts = append(parts, recurPart{Name: name, Values: typed})
+	}
+
+	return parts
+}
+
+func untypedRecur(parts []recurPart) string {
+	result := make([]string, len(parts))
+	for i, part := range parts {
+		values := part.Values
+		if part.Name == "until" {
+			values = make([]string, len(part.Values))
+			for j, value := range part.Values {
+				values[j] = untypedValue(valueDateTime, value)
+			}
+		}
+
+		result[i] = strings.ToUpper(part.Name) + "=" + strings.Join(values, ",")
+	}
+
+	return strings.Join(result, ";")
+}
@@ -0,0 +1,272 @@
+package ics
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/laurent22/ical-go"
+)
+
+// XCalNamespace is the XML namespace of the xCal elements.
+const XCalNamespace = "urn:ietf:params:xml:ns:icalendar-2.0"
+
+// The types of the param values other than text in xCal. [See RFC6321#3.5]
+var xcalParamTypes = map[string]string{
+	"altrep":         valueURI,
+	"delegated-from": valueCalAddress,
+	"delegated-to":   valueCalAddress,
+	"dir":            valueURI,
+	"member":         valueCalAddress,
+	"sent-by":        valueCalAddress,
+}
+
+// MarshalXCal converts the component (usually a VCALENDAR) into its xCal representation, the XML format
+// for iCalendar, within an <icalendar> document. The conversion keeps all the data, so that `ParseXCal`
+// gives back the same component. [See RFC6321]
+func MarshalXCal(node *ical.Node) ([]byte, error) {
+	if !IsComponent(node) {
+		return nil, errors.New("ics: only components can be converted to xCal")
+	}
+
+	var buffer bytes.Buffer
+	buffer.WriteString(xml.Header)
+
+	encoder := xml.NewEncoder(&buffer)
+	root := xml.StartElement{Name: xml.Name{Local: "icalendar"}, Attr: []xml.Attr{{Name: xml.Name{Local: "xmlns"}, Value: XCalNamespace}}}
+	encoder.EncodeToken(root)
+	writeXCalComponent(encoder, node)
+	encoder.EncodeToken(root.End())
+
+	if err := encoder.Flush(); err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// ParseXCal parses an xCal document and returns the node of its first component. [See RFC6321]
+func ParseXCal(data []byte) (*ical.Node, error) {
+	var root xcalElement
+	if err := xml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("ics: invalid xCal data: %s", err)
+	}
+
+	if root.XMLName.Local != "icalendar" || len(root.Children) == 0 {
+		return nil, errors.New("ics: invalid xCal data: missing icalendar component")
+	}
+
+	node, err := parseXCalComponent(root.Children[0])
+	if err != nil {
+		return nil, fmt.Errorf("ics: invalid xCal data: %s", err)
+	}
+
+	return node, nil
+}
+
+// A component is an element with its <properties> and its sub <components>. The empty ones are omitted.
+func writeXCalComponent(encoder *xml.Encoder, node *ical.Node) {
+	var props, comps []*ical.Node
+	for _, child := range node.Children {
+		if IsComponent(child) {
+			comps = append(comps, child)
+		} else {
+			props = append(props, child)
+		}
+	}
+
+	start := xcalStart(node.Name)
+	encoder.EncodeToken(start)
+
+	if len(props) > 0 {
+		propsStart := xcalStart("properties")
+		encoder.EncodeToken(propsStart)
+		for _, prop := range props {
+			writeXCalProperty(encoder, newTypedProperty(prop))
+		}
+		encoder.EncodeToken(propsStart.End())
+	}
+
+	if len(comps) > 0 {
+		compsStart := xcalStart("components")
+		encoder.EncodeToken(compsStart)
+		for _, comp := range comps {
+			writeXCalComponent(encoder, comp)
+		}
+		encoder.EncodeToken(compsStart.End())
+	}
+
+	encoder.EncodeToken(start.End())
+}
+
+// A property is an element with its <parameters> and an element per value, named by the value type.
+func writeXCalProperty(encoder *xml.Encoder, tp typedProperty) {
+	start := xcalStart(tp.Name)
+	encoder.EncodeToken(start)
+
+	if len(tp.Params) > 0 {
+		paramsStart := xcalStart("parameters")
+		encoder.EncodeToken(paramsStart)
+		for _, param := range tp.Params {
+			paramType, ok := xcalParamTypes[param.Name]
+			if !ok {
+				paramType = valueText
+			}
+
+			paramStart := xcalStart(param.Name)
+			encoder.EncodeToken(paramStart)
+			for _, value := range param.Values {
+				writeXCalText(encoder, paramType, value)
+			}
+			encoder.EncodeToken(paramStart.End())
+		}
+		encoder.EncodeToken(paramsStart.End())
+	}
+
+	for _, value := range tp.Values {
+		switch value := value.(type) {
+		case []string:
+			// the parts of the structured values are named by the property
+			names := structuredValueParts[strings.ToUpper(tp.Name)]
+			for i, part := range value {
+				if i < len(names) {
+					writeXCalText(encoder, names[i], part)
+				}
+			}
+		case []recurPart:
+			recurStart := xcalStart(valueRecur)
+			encoder.EncodeToken(recurStart)
+			for _, part := range value {
+				for _, partValue := range part.Values {
+					writeXCalText(encoder, part.Name, partValue)
+				}
+			}
+			encoder.EncodeToken(recurStart.End())
+		default:
+			writeXCalText(encoder, tp.ValueType, value.(string))
+		}
+	}
+
+	encoder.EncodeToken(start.End())
+}
+
+func writeXCalText(encoder *xml.Encoder, name, text string) {
+	start := xcalStart(name)
+	encoder.EncodeToken(start)
+	encoder.EncodeToken(xml.CharData(text))
+	encoder.EncodeToken(start.End())
+}
+
+func xcalStart(name string) xml.StartElement {
+	return xml.StartElement{Name: xml.Name{Local: strings.ToLower(name)}}
+}
+
+// xcalElement is the generic tree of the elements of a xCal document.
+type xcalElement struct {
+	XMLName  xml.Name
+	Text     string        `xml:",chardata"`
+	Children []xcalElement `xml:",any"`
+}
+
+// Returns the first child element with the given name.
+func (el xcalElement) child(name string) (xcalElement, bool) {
+	for _, child := range el.Children {
+		if child.XMLName.Local == name {
+			return child, true
+		}
+	}
+
+	return xcalElement{}, false
+}
+
+func parseXCalComponent(el xcalElement) (*ical.Node, error) {
+	node := NewComponent(strings.ToUpper(el.XMLName.Local))
+
+	props, _ := el.child("properties")
+	for _, prop := range props.Children {
+		tp, err := parseXCalProperty(prop)
+		if err != nil {
+			return nil, err
+		}
+
+		child, err := tp.node()
+		if err != nil {
+			return nil, err
+		}
+		node.Children = append(node.Children, child)
+	}
+
+	comps, _ := el.child("components")
+	for _, comp := range comps.Children {
+		child, err := parseXCalComponent(comp)
+		if err != nil {
+			return nil, err
+		}
+		node.Children = append(node.Children, child)
+	}
+
+	return node, nil
+}
+
+func parseXCalProperty(el xcalElement) (typedProperty, error) {
+	tp := typedProperty{Name: el.XMLName.Local}
+
+	var values []xcalElement
+	for _, child := range el.Children {
+		if child.XMLName.Local == "parameters" {
+			for _, param := range child.Children {
+				tparam := typedParam{Name: param.XMLName.Local}
+				for _, value := range param.Children {
+					tparam.Values = append(tparam.Values, value.Text)
+				}
+				tp.Params = append(tp.Params, tparam)
+			}
+		} else {
+			values = append(values, child)
+		}
+	}
+
+	if len(values) == 0 {
+		return typedProperty{}, fmt.Errorf("missing value of property %s", tp.Name)
+	}
+
+	// the structured values are made of the parts of the property, in their order
+	if names, structured := structuredValueParts[strings.ToUpper(tp.Name)]; structured {
+		tp.ValueType = defaultValueType(strings.ToUpper(tp.Name))
+
+		var parts []string
+		for _, name := range names {
+			if part, ok := el.child(name); ok {
+				parts = append(parts, part.Text)
+			}
+		}
+		tp.Values = []interface{}{parts}
+
+		return tp, nil
+	}
+
+	tp.ValueType = values[0].XMLName.Local
+	for _, value := range values {
+		if value.XMLName.Local != tp.ValueType {
+			return typedProperty{}, fmt.Errorf("values of different types in property %s", tp.Name)
+		}
+
+		if tp.ValueType == valueRecur {
+			var parts []recurPart
+			for _, part := range value.Children {
+				if len(parts) > 0 && parts[len(parts)-1].Name == part.XMLName.Local {
+					parts[len(parts)-1].Values = append(parts[len(parts)-1].Values, part.Text)
+				} else {
+					parts = append(parts, recurPart{Name: part.XMLName.Local, Values: []string{part.Text}})
+				}
+			}
+			tp.Values = append(tp.Values, parts)
+		} else {
+			tp.Values = append(tp.Values, value.Text)
+		}
+	}
+
+	return tp, nil
+}
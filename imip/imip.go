@@ -0,0 +1,298 @@
+// Package imip implements the iCalendar Message-Based Interoperability Protocol (iMIP, RFC6047), which
+// is the binding of the iTIP scheduling messages to email. It is used to schedule with calendar users
+// that are not local to the server.
+package imip
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/laurent22/ical-go"
+
+	"github.com/samedi/caldav-go/ics"
+	"github.com/samedi/caldav-go/itip"
+)
+
+var (
+	// ErrNotEmailAddress is returned when a calendar user address is not a "mailto:" address, so it cannot be reached by email.
+	ErrNotEmailAddress = errors.New("imip: the calendar user address is not an email address")
+	// ErrNoCalendar is returned when a parsed email has no "text/calendar" part.
+	ErrNoCalendar = errors.New("imip: the email has no calendar part")
+)
+
+// Returns the current time. Replaced in the tests to get predictable messages.
+var now = time.Now
+
+// Message is an iTIP message sent or received by email.
+type Message struct {
+	// From is the email address of the sender, e.g. "john@example.com".
+	From string
+	// To are the email addresses of the recipients.
+	To []string
+	// Subject is the subject of the email.
+	Subject string
+	// Calendar is the iTIP message, i.e. a calendar object with the METHOD property.
+	Calendar *ical.Node
+}
+
+// NewMessage builds the email sending the iTIP message from one calendar user to another. Both `from` and
+// `to` are calendar user addresses, which must be "mailto:" addresses.
+func NewMessage(from, to string, cal *ical.Node) (*Message, error) {
+	fromEmail, ok := EmailAddress(from)
+	if !ok {
+		return nil, ErrNotEmailAddress
+	}
+
+	toEmail, ok := EmailAddress(to)
+	if !ok {
+		return nil, ErrNotEmailAddress
+	}
+
+	return &Message{
+		From:     fromEmail,
+		To:       []string{toEmail},
+		Subject:  subject(cal),
+		Calendar: cal,
+	}, nil
+}
+
+// EmailAddress returns the email address of a "mailto:" calendar user address, e.g.: "mailto:john@example.com" => "john@example.com".
+func EmailAddress(address string) (string, bool) {
+	address = strings.TrimSpace(address)
+	if len(address) <= len("mailto:") || !strings.EqualFold(address[:len("mailto:")], "mailto:") {
+		return "", false
+	}
+
+	return address[len("mailto:"):], true
+}
+
+// CalendarAddress returns the calendar user address of an email address, e.g.: "john@example.com" => "mailto:john@example.com".
+func CalendarAddress(email string) string {
+	return "mailto:" + email
+}
+
+// Method returns the iTIP method of the message.
+func (m *Message) Method() string {
+	return m.Calendar.PropString("METHOD", "")
+}
+
+// Bytes returns the message formatted as an email (RFC5322). As recommended by RFC6047#2.4, the body is a
+// "multipart/alternative" with a plain text description of the message followed by the "text/calendar"
+// part, which has the `method` parameter set.
+func (m *Message) Bytes() ([]byte, error) {
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+
+	text, err := parts.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := writeQuotedPrintable(text, description(m.Calendar)); err != nil {
+		return nil, err
+	}
+
+	calParams := map[string]string{"charset": "utf-8", "method": m.Method()}
+	if comp := component(m.Calendar); comp != "" {
+		calParams["component"] = comp
+	}
+	calendar, err := parts.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {mime.FormatMediaType("text/calendar", calParams)},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := writeQuotedPrintable(calendar, ics.Serialize(m.Calendar)); err != nil {
+		return nil, err
+	}
+
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+
+	var msg bytes.Buffer
+	headers := [][2]string{
+		{"From", m.From},
+		{"To", strings.Join(m.To, ", ")},
+		{"Subject", mime.QEncoding.Encode("utf-8", m.Subject)},
+		{"Date", now().Format(time.RFC1123Z)},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", mime.FormatMediaType("multipart/alternative", map[string]string{"boundary": parts.Boundary()})},
+	}
+	for _, header := range headers {
+		fmt.Fprintf(&msg, "%s: %s\r\n", header[0], header[1])
+	}
+	msg.WriteString("\r\n")
+	msg.Write(body.Bytes())
+
+	return msg.Bytes(), nil
+}
+
+// Parse reads an email (RFC5322) and extracts the iTIP message from its "text/calendar" part, which can be nested
+// in multipart bodies. When the calendar has no METHOD property, the `method` parameter of the part is used.
+func Parse(r io.Reader) (*Message, error) {
+	email, err := mail.ReadMessage(r)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := &Message{}
+	if from, err := mail.ParseAddress(email.Header.Get("From")); err == nil {
+		msg.From = from.Address
+	}
+	if to, err := email.Header.AddressList("To"); err == nil {
+		for _, address := range to {
+			msg.To = append(msg.To, address.Address)
+		}
+	}
+	if subject, err := new(mime.WordDecoder).DecodeHeader(email.Header.Get("Subject")); err == nil {
+		msg.Subject = subject
+	}
+
+	content, method, err := findCalendar(email.Header.Get("Content-Type"), email.Header.Get("Content-Transfer-Encoding"), email.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if msg.Calendar, err = ics.Parse(content); err != nil {
+		return nil, err
+	}
+	if msg.Method() == "" && method != "" {
+		ics.AddProperty(msg.Calendar, ics.NewProperty("METHOD", strings.ToUpper(method), nil))
+	}
+
+	return msg, nil
+}
+
+// Looks for the "text/calendar" content in the body with the given content type, returning the
+// decoded content and the `method` parameter of its type.
+func findCalendar(contentType, encoding string, body io.Reader) (string, string, error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", "", ErrNoCalendar
+	}
+
+	if mediaType == "text/calendar" {
+		content, err := ioutil.ReadAll(decode(encoding, body))
+		if err != nil {
+			return "", "", err
+		}
+
+		return string(content), params["method"], nil
+	}
+
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		return "", "", ErrNoCalendar
+	}
+
+	parts := multipart.NewReader(body, params["boundary"])
+	for {
+		part, err := parts.NextRawPart()
+		if err == io.EOF {
+			return "", "", ErrNoCalendar
+		} else if err != nil {
+			return "", "", err
+		}
+
+		content, method, err := findCalendar(part.Header.Get("Content-Type"), part.Header.Get("Content-Transfer-Encoding"), part)
+		if err != ErrNoCalendar {
+			return content, method, err
+		}
+	}
+}
+
+func decode(encoding string, r io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, r)
+	case "quoted-printable":
+		return quotedprintable.NewReader(r)
+	default:
+		return r
+	}
+}
+
+func writeQuotedPrintable(w io.Writer, content string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := qp.Write([]byte(content)); err != nil {
+		return err
+	}
+
+	return qp.Close()
+}
+
+// The subject prefixes for the methods.
+var subjects = map[string]string{
+	itip.MethodPublish:        "Event",
+	itip.MethodRequest:        "Invitation",
+	itip.MethodReply:          "Reply",
+	itip.MethodAdd:            "New instances",
+	itip.MethodCancel:         "Cancelled",
+	itip.MethodRefresh:        "Update request",
+	itip.MethodCounter:        "Counter proposal",
+	itip.MethodDeclineCounter: "Counter proposal declined",
+}
+
+func subject(cal *ical.Node) string {
+	prefix := subjects[cal.PropString("METHOD", "")]
+	if prefix == "" {
+		prefix = "Scheduling message"
+	}
+
+	summary := ""
+	if comps := itip.Components(cal); len(comps) > 0 {
+		summary = ics.UnescapeText(comps[0].PropString("SUMMARY", ""))
+	}
+	if summary == "" {
+		return prefix
+	}
+
+	return prefix + ": " + summary
+}
+
+// Returns the plain text description of the message, for the email clients without iMIP support.
+func description(cal *ical.Node) string {
+	lines := []string{subject(cal), ""}
+
+	if comps := itip.Components(cal); len(comps) > 0 {
+		comp := comps[0]
+		if start := comp.PropString("DTSTART", ""); start != "" {
+			lines = append(lines, "Start: "+start)
+		}
+		if end := comp.PropString("DTEND", ""); end != "" {
+			lines = append(lines, "End: "+end)
+		}
+		if location := comp.PropString("LOCATION", ""); location != "" {
+			lines = append(lines, "Location: "+ics.UnescapeText(location))
+		}
+	}
+
+	if organizer, ok := EmailAddress(itip.Organizer(cal)); ok {
+		lines = append(lines, "Organizer: "+organizer)
+	}
+
+	return strings.Join(lines, "\r\n") + "\r\n"
+}
+
+// Returns the name of the scheduling component of the message, e.g. "VEVENT".
+func component(cal *ical.Node) string {
+	if comps := itip.Components(cal); len(comps) > 0 {
+		return comps[0].Name
+	}
+
+	return ""
+}
@@ -0,0 +1,165 @@
+package imip
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samedi/caldav-go/ics"
+)
+
+const request = `BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:-//test//test//EN
+METHOD:REQUEST
+BEGIN:VEVENT
+UID:meeting-1
+DTSTAMP:20170101T100000Z
+DTSTART:20170102T100000Z
+DTEND:20170102T110000Z
+SUMMARY:Meeting
+ORGANIZER:mailto:alice@example.com
+ATTENDEE;PARTSTAT=NEEDS-ACTION:mailto:bob@example.org
+END:VEVENT
+END:VCALENDAR`
+
+func init() {
+	now = func() time.Time {
+		return time.Date(2017, 1, 1, 12, 0, 0, 0, time.UTC)
+	}
+}
+
+func TestMessage(t *testing.T) {
+	cal, _ := ics.Parse(request)
+
+	msg, err := NewMessage("mailto:alice@example.com", "MAILTO:bob@example.org", cal)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if msg.From != "alice@example.com" || strings.Join(msg.To, ",") != "bob@example.org" || msg.Subject != "Invitation: Meeting" {
+		t.Errorf("Wrong message: %+v", msg)
+	}
+
+	if _, err := NewMessage("mailto:alice@example.com", "urn:uuid:bob", cal); err != ErrNotEmailAddress {
+		t.Error("Expected an error for a non email address, got", err)
+	}
+
+	content, err := msg.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	email := string(content)
+	for _, expected := range []string{
+		"Date: Sun, 01 Jan 2017 12:00:00 +0000\r\n",
+		"Content-Type: multipart/alternative;",
+		"Content-Type: text/plain; charset=utf-8",
+		"Content-Type: text/calendar; charset=utf-8; component=VEVENT; method=REQUEST",
+	} {
+		if !strings.Contains(email, expected) {
+			t.Errorf("The email should contain %q:\n%s", expected, email)
+		}
+	}
+
+	// the built message can be parsed back
+	parsed, err := Parse(bytes.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if parsed.From != msg.From || strings.Join(parsed.To, ",") != "bob@example.org" || parsed.Subject != msg.Subject {
+		t.Errorf("Wrong parsed message: %+v", parsed)
+	}
+
+	if got, expected := ics.Serialize(parsed.Calendar), ics.Serialize(cal); got != expected {
+		t.Errorf("Wrong parsed calendar.\nExpected:\n%s\nGot:\n%s", expected, got)
+	}
+}
+
+func TestParse(t *testing.T) {
+	// nested multipart, base64 encoded and without METHOD in the calendar
+	reply := strings.Replace(request, "METHOD:REQUEST\n", "", 1)
+	reply = strings.Replace(reply, "PARTSTAT=NEEDS-ACTION", "PARTSTAT=ACCEPTED", 1)
+
+	email := "From: Bob <bob@example.org>\r\n" +
+		"To: alice@example.com\r\n" +
+		"Subject: =?utf-8?q?Accepted=3A_Meeting?=\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/mixed; boundary=outer\r\n" +
+		"\r\n" +
+		"--outer\r\n" +
+		"Content-Type: multipart/alternative; boundary=inner\r\n" +
+		"\r\n" +
+		"--inner\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"Bob accepted.\r\n" +
+		"--inner\r\n" +
+		"Content-Type: text/calendar; method=reply; charset=utf-8\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"\r\n" +
+		base64Lines(reply) +
+		"--inner--\r\n" +
+		"--outer--\r\n"
+
+	msg, err := Parse(strings.NewReader(email))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if msg.From != "bob@example.org" || msg.Subject != "Accepted: Meeting" || msg.Method() != "REPLY" {
+		t.Errorf("Wrong parsed message: %+v, method %s", msg, msg.Method())
+	}
+
+	noCalendar := "From: bob@example.org\r\nTo: alice@example.com\r\nContent-Type: text/plain\r\n\r\nHello\r\n"
+	if _, err := Parse(strings.NewReader(noCalendar)); err != ErrNoCalendar {
+		t.Error("Expected the no calendar error, got", err)
+	}
+}
+
+func TestMailers(t *testing.T) {
+	cal, _ := ics.Parse(request)
+	msg, _ := NewMessage("mailto:alice@example.com", "mailto:bob@example.org", cal)
+
+	memory := new(MemoryMailer)
+	memory.Send(msg)
+	if messages := memory.Messages(); len(messages) != 1 || messages[0] != msg {
+		t.Error("The memory mailer must keep the sent messages")
+	}
+
+	dir := "test-data-mails"
+	defer os.RemoveAll(dir)
+
+	files := &FileMailer{Dir: dir}
+	if err := files.Send(msg); err != nil {
+		t.Fatal(err)
+	}
+
+	written, _ := ioutil.ReadDir(dir)
+	if len(written) != 1 || !strings.HasSuffix(written[0].Name(), ".eml") {
+		t.Fatal("The file mailer must write the message in the directory")
+	}
+
+	content, _ := os.Open(dir + "/" + written[0].Name())
+	defer content.Close()
+	if parsed, err := Parse(content); err != nil || parsed.Method() != "REQUEST" {
+		t.Error("The written message must be a valid email", err)
+	}
+}
+
+func base64Lines(content string) string {
+	encoded := base64.StdEncoding.EncodeToString([]byte(strings.Replace(content, "\n", "\r\n", -1)))
+
+	lines := ""
+	for len(encoded) > 76 {
+		lines += encoded[:76] + "\r\n"
+		encoded = encoded[76:]
+	}
+
+	return lines + encoded + "\r\n"
+}
@@ -0,0 +1,93 @@
+package imip
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Mailer sends the iMIP messages. Implementations must be safe for concurrent use.
+type Mailer interface {
+	Send(msg *Message) error
+}
+
+// SMTPMailer sends the messages through an SMTP server.
+type SMTPMailer struct {
+	// Addr is the address of the SMTP server, with the port, e.g. "smtp.example.com:587".
+	Addr string
+	// Auth is the authentication mechanism, nil when the server requires none.
+	Auth smtp.Auth
+	// Sender, when set, is used as the envelope sender instead of the `From` of the messages,
+	// e.g. when the SMTP server only accepts to relay emails from a given address.
+	Sender string
+}
+
+// Send sends the message with `smtp.SendMail`.
+func (m *SMTPMailer) Send(msg *Message) error {
+	content, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+
+	sender := m.Sender
+	if sender == "" {
+		sender = msg.From
+	}
+
+	return smtp.SendMail(m.Addr, m.Auth, sender, msg.To, content)
+}
+
+// MemoryMailer keeps the sent messages in memory, instead of sending them. Useful for tests.
+type MemoryMailer struct {
+	lock     sync.Mutex
+	messages []*Message
+}
+
+// Send keeps the message.
+func (m *MemoryMailer) Send(msg *Message) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+// Messages returns the messages sent so far, in order.
+func (m *MemoryMailer) Messages() []*Message {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return append([]*Message(nil), m.messages...)
+}
+
+// FileMailer writes each message as an email file (.eml) in a directory, instead of sending it.
+// Useful for tests and for development.
+type FileMailer struct {
+	// Dir is the directory where the messages are written. It is created if it does not exist.
+	Dir string
+
+	lock  sync.Mutex
+	count int
+}
+
+// Send writes the message in a new file.
+func (m *FileMailer) Send(msg *Message) error {
+	content, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if err := os.MkdirAll(m.Dir, 0755); err != nil {
+		return err
+	}
+
+	m.count++
+	name := fmt.Sprintf("%d-%04d.eml", now().UnixNano(), m.count)
+	return ioutil.WriteFile(filepath.Join(m.Dir, name), content, 0644)
+}
@@ -9,6 +9,9 @@ import (
 	"testing"
 	"time"
 
+	"github.com/laurent22/ical-go"
+
+	"github.com/samedi/caldav-go/ics"
 	"github.com/samedi/caldav-go/ixml"
 	"github.com/samedi/caldav-go/test"
 )
@@ -36,7 +39,7 @@ func TestOPTIONS(t *testing.T) {
 	resp := doRequest("OPTIONS", "/test-data/", "", nil)
 
 	if test.AssertInt(len(resp.Header["Allow"]), 1, t) {
-		test.AssertStr(resp.Header["Allow"][0], "GET, HEAD, PUT, DELETE, OPTIONS, PROPFIND, REPORT", t)
+		test.AssertStr(resp.Header["Allow"][0], "GET, HEAD, POST, PUT, DELETE, OPTIONS, PROPFIND, PROPPATCH, REPORT, MKCALENDAR", t)
 	}
 
 	if test.AssertInt(len(resp.Header["Dav"]), 1, t) {
@@ -62,6 +65,22 @@ func TestGET(t *testing.T) {
 	test.AssertStr(resp.Header["Content-Type"][0], "text/calendar; component=vcalendar", t)
 	test.AssertStr(body, rData, t)
 	test.AssertInt(resp.StatusCode, http.StatusOK, t)
+
+	// test conditional GET when the client already has the current version of the resource
+	headers := map[string]string{
+		"If-None-Match": resp.Header.Get("Etag"),
+	}
+	resp = doRequest("GET", rPath, "", headers)
+	body = readResponseBody(resp)
+	test.AssertInt(resp.StatusCode, http.StatusNotModified, t)
+	test.AssertStr(body, "", t)
+	test.AssertInt(len(resp.Header["Etag"]), 1, t)
+
+	headers = map[string]string{
+		"If-Modified-Since": time.Now().Add(time.Hour).UTC().Format(http.TimeFormat),
+	}
+	resp = doRequest("GET", rPath, "", headers)
+	test.AssertInt(resp.StatusCode, http.StatusNotModified, t)
 }
 
 func TestPUT(t *testing.T) {
@@ -86,9 +105,9 @@ func TestPUT(t *testing.T) {
 	test.AssertResourceExists(rpath, t)
 	test.AssertResourceData(rpath, resourceData, t)
 
-	// test when trying to update a collection (folder)
+	// test when trying to import invalid calendar data into a collection (folder)
 	resp = doRequest("PUT", "/test-data/put/", "", nil)
-	test.AssertInt(resp.StatusCode, http.StatusPreconditionFailed, t)
+	test.AssertInt(resp.StatusCode, http.StatusForbidden, t)
 
 	// test when trying to update the resource but the ETag check (IF-MATCH header) does not match
 	originalData := resourceData
@@ -120,6 +139,271 @@ func TestPUT(t *testing.T) {
 	test.AssertResourceData(rpath, originalData, t)
 }
 
+func TestGETCollection(t *testing.T) {
+	collection := "/test-data/get-collection/"
+	timezone := "BEGIN:VTIMEZONE\nTZID:Europe/Berlin\nEND:VTIMEZONE"
+	createResource(collection, "1.ics", "BEGIN:VCALENDAR\n"+timezone+"\nBEGIN:VEVENT\nUID:1\nDTSTART;TZID=Europe/Berlin:20160914T170000\nEND:VEVENT\nEND:VCALENDAR")
+	createResource(collection, "2.ics", "BEGIN:VCALENDAR\n"+timezone+"\nBEGIN:VEVENT\nUID:2\nDTSTART;TZID=Europe/Berlin:20160915T170000\nEND:VEVENT\nEND:VCALENDAR")
+
+	resp := doRequest("GET", collection, "", nil)
+	body := readResponseBody(resp)
+
+	// the result is a single calendar, with both events and the timezone only once
+	expectedBody := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//samedi//caldav-go//EN",
+		"BEGIN:VTIMEZONE",
+		"TZID:Europe/Berlin",
+		"END:VTIMEZONE",
+		"BEGIN:VEVENT",
+		"UID:1",
+		"DTSTART;TZID=Europe/Berlin:20160914T170000",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:2",
+		"DTSTART;TZID=Europe/Berlin:20160915T170000",
+		"END:VEVENT",
+		"END:VCALENDAR",
+		"",
+	}, "\r\n")
+
+	test.AssertInt(resp.StatusCode, http.StatusOK, t)
+	test.AssertStr(resp.Header.Get("Content-Type"), "text/calendar", t)
+	test.AssertStr(body, expectedBody, t)
+}
+
+func TestGETFormats(t *testing.T) {
+	collection := "/test-data/get-formats/"
+	rData := "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nUID:1\r\nSUMMARY:Party\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"
+	createResource(collection, "1.ics", rData)
+
+	get := func(accept string) (*http.Response, string) {
+		resp := doRequest("GET", collection+"1.ics", "", map[string]string{"Accept": accept})
+		return resp, readResponseBody(resp)
+	}
+
+	resp, body := get("application/calendar+json")
+	test.AssertStr(resp.Header.Get("Content-Type"), "application/calendar+json", t)
+	test.AssertStr(resp.Header.Get("Vary"), "Accept", t)
+	test.AssertStr(body, `["vcalendar",[],[["vevent",[["uid",{},"text","1"],["summary",{},"text","Party"]],[]]]]`, t)
+
+	resp, body = get("text/calendar;q=0.5, application/calendar+xml")
+	test.AssertStr(resp.Header.Get("Content-Type"), "application/calendar+xml", t)
+	if !strings.Contains(body, "<summary><text>Party</text></summary>") {
+		t.Error("Expected the resource in xCal | Got:", body)
+	}
+
+	// iCalendar is preferred when all the formats are accepted
+	for _, accept := range []string{"", "*/*", "text/*, application/*", "application/calendar+json;q=0, */*"} {
+		resp, body = get(accept)
+		test.AssertStr(resp.Header.Get("Content-Type"), "text/calendar; component=vcalendar", t)
+		test.AssertStr(body, rData, t)
+	}
+
+	// each format has its own ETag, and the conditional requests are evaluated against the one of the sent format
+	etag := resp.Header.Get("ETag")
+	resp, _ = get("application/calendar+json")
+	jcalEtag := resp.Header.Get("ETag")
+	if jcalEtag == "" || jcalEtag == etag {
+		t.Errorf("The jCal ETag should differ from the iCalendar one %s | Got: %s", etag, jcalEtag)
+	}
+
+	resp = doRequest("GET", collection+"1.ics", "", map[string]string{"Accept": "application/calendar+json", "If-None-Match": etag})
+	test.AssertInt(resp.StatusCode, http.StatusOK, t)
+	resp = doRequest("GET", collection+"1.ics", "", map[string]string{"Accept": "application/calendar+json", "If-None-Match": jcalEtag})
+	test.AssertInt(resp.StatusCode, http.StatusNotModified, t)
+	test.AssertStr(resp.Header.Get("ETag"), jcalEtag, t)
+
+	// the whole collection can be fetched in the other formats too
+	resp = doRequest("GET", collection, "", map[string]string{"Accept": "application/calendar+json"})
+	body = readResponseBody(resp)
+	test.AssertStr(resp.Header.Get("Content-Type"), "application/calendar+json", t)
+	if !strings.Contains(body, `["summary",{},"text","Party"]`) {
+		t.Error("Expected the collection in jCal | Got:", body)
+	}
+
+	// and the calendar object resources in JSCalendar too
+	resp, body = get("application/jscalendar+json")
+	test.AssertStr(resp.Header.Get("Content-Type"), "application/jscalendar+json; type=event", t)
+	test.AssertStr(body, `{"@type":"Event","uid":"1","title":"Party"}`, t)
+}
+
+func TestPUTFormats(t *testing.T) {
+	rpath := "/test-data/put-formats/123-456-789.ics"
+
+	// the calendar data sent in jCal is stored as iCalendar, without returning the ETag
+	jcal := `["vcalendar",[["version",{},"text","2.0"]],[["vevent",[["uid",{},"text","123"],["dtstart",{"tzid":"Europe/Berlin"},"date-time","2017-01-02T10:00:00"]],[]]]]`
+	resp := doRequest("PUT", rpath, jcal, map[string]string{"Content-Type": "application/calendar+json; charset=utf-8"})
+	test.AssertInt(resp.StatusCode, http.StatusCreated, t)
+	test.AssertInt(len(resp.Header["Etag"]), 0, t)
+	test.AssertResourceData(rpath, "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nBEGIN:VEVENT\r\nUID:123\r\nDTSTART;TZID=Europe/Berlin:20170102T100000\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n", t)
+
+	xcal := `<icalendar xmlns="urn:ietf:params:xml:ns:icalendar-2.0"><vcalendar><components><vevent><properties>
+		<uid><text>123</text></uid><summary><text>Lunch, then a walk</text></summary>
+	</properties></vevent></components></vcalendar></icalendar>`
+	resp = doRequest("PUT", rpath, xcal, map[string]string{"Content-Type": "application/calendar+xml"})
+	test.AssertInt(resp.StatusCode, http.StatusCreated, t)
+	test.AssertResourceData(rpath, "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nUID:123\r\nSUMMARY:Lunch\\, then a walk\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n", t)
+
+	// the data that cannot be converted is refused
+	resp = doRequest("PUT", rpath, "BEGIN:VCALENDAR\nEND:VCALENDAR", map[string]string{"Content-Type": "application/calendar+json"})
+	test.AssertInt(resp.StatusCode, http.StatusForbidden, t)
+}
+
+func TestPUTCollection(t *testing.T) {
+	collection := "/test-data/put-collection/"
+	createResource(collection, "2.ics", "BEGIN:VCALENDAR\nBEGIN:VEVENT\nUID:2\nSUMMARY:Old\nEND:VEVENT\nEND:VCALENDAR")
+
+	calendar := `BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:-//Foo//Bar//EN
+METHOD:PUBLISH
+BEGIN:VTIMEZONE
+TZID:Europe/Berlin
+END:VTIMEZONE
+BEGIN:VEVENT
+UID:1
+DTSTART;TZID=Europe/Berlin:20160914T170000
+END:VEVENT
+BEGIN:VEVENT
+UID:2
+SUMMARY:New
+END:VEVENT
+END:VCALENDAR`
+
+	expectedRespBody := `
+  <?xml version="1.0" encoding="UTF-8"?>
+  <D:multistatus xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav" xmlns:CS="http://calendarserver.org/ns/">
+    <D:response>
+      <D:href>/test-data/put-collection/1.ics</D:href>
+      <D:status>HTTP/1.1 201 Created</D:status>
+    </D:response>
+    <D:response>
+      <D:href>/test-data/put-collection/2.ics</D:href>
+      <D:status>HTTP/1.1 204 No Content</D:status>
+    </D:response>
+  </D:multistatus>
+  `
+
+	resp := doRequest("PUT", collection, calendar, nil)
+	respBody := readResponseBody(resp)
+	test.AssertInt(resp.StatusCode, 207, t)
+	test.AssertMultistatusXML(respBody, expectedRespBody, t)
+
+	// each object keeps only the timezones it references and no METHOD
+	test.AssertResourceData(collection+"1.ics", strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//Foo//Bar//EN",
+		"BEGIN:VTIMEZONE",
+		"TZID:Europe/Berlin",
+		"END:VTIMEZONE",
+		"BEGIN:VEVENT",
+		"UID:1",
+		"DTSTART;TZID=Europe/Berlin:20160914T170000",
+		"END:VEVENT",
+		"END:VCALENDAR",
+		"",
+	}, "\r\n"), t)
+	test.AssertResourceData(collection+"2.ics", strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//Foo//Bar//EN",
+		"BEGIN:VEVENT",
+		"UID:2",
+		"SUMMARY:New",
+		"END:VEVENT",
+		"END:VCALENDAR",
+		"",
+	}, "\r\n"), t)
+
+	// the UIDs used by other resources are not imported, and the UIDs with unsafe characters do not overwrite each other
+	createResource(collection, "other.ics", "BEGIN:VCALENDAR\nBEGIN:VEVENT\nUID:3\nSUMMARY:Other\nEND:VEVENT\nEND:VCALENDAR")
+	calendar = strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"BEGIN:VEVENT", "UID:3", "SUMMARY:Conflict", "END:VEVENT",
+		"BEGIN:VEVENT", "UID:a/b", "SUMMARY:Slash", "END:VEVENT",
+		"BEGIN:VEVENT", "UID:a_b", "SUMMARY:Underscore", "END:VEVENT",
+		"END:VCALENDAR",
+	}, "\n")
+
+	expectedRespBody = `
+  <?xml version="1.0" encoding="UTF-8"?>
+  <D:multistatus xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav" xmlns:CS="http://calendarserver.org/ns/">
+    <D:response>
+      <D:href>/test-data/put-collection/3.ics</D:href>
+      <D:status>HTTP/1.1 403 Forbidden</D:status>
+      <D:error><C:no-uid-conflict><D:href>/test-data/put-collection/other.ics</D:href></C:no-uid-conflict></D:error>
+    </D:response>
+    <D:response>
+      <D:href>/test-data/put-collection/a_b-07f4401c.ics</D:href>
+      <D:status>HTTP/1.1 201 Created</D:status>
+    </D:response>
+    <D:response>
+      <D:href>/test-data/put-collection/a_b.ics</D:href>
+      <D:status>HTTP/1.1 201 Created</D:status>
+    </D:response>
+  </D:multistatus>
+  `
+
+	resp = doRequest("PUT", collection, calendar, nil)
+	test.AssertInt(resp.StatusCode, 207, t)
+	test.AssertMultistatusXML(readResponseBody(resp), expectedRespBody, t)
+	test.AssertResourceDoesNotExist(collection+"3.ics", t)
+	test.AssertResourceData(collection+"other.ics", "BEGIN:VCALENDAR\nBEGIN:VEVENT\nUID:3\nSUMMARY:Other\nEND:VEVENT\nEND:VCALENDAR", t)
+}
+
+func TestPUTNormalizers(t *testing.T) {
+	SetupNormalizers(append(ics.DefaultNormalizers, func(cal *ical.Node) error {
+		for _, comp := range ics.Components(cal) {
+			ics.SetProperty(comp, "X-NORMALIZED", "yes")
+		}
+		return nil
+	})...)
+	defer SetupNormalizers()
+
+	rpath := "/test-data/put-normalizers/123-456-789.ics"
+
+	// the objects altered by the normalization are stored without returning their ETag
+	resp := doRequest("PUT", rpath, "BEGIN:VCALENDAR\nBEGIN:VEVENT\nUID:123\nSUMMARY:Lunch\nEND:VEVENT\nEND:VCALENDAR", nil)
+	test.AssertInt(resp.StatusCode, http.StatusCreated, t)
+	test.AssertInt(len(resp.Header["Etag"]), 0, t)
+
+	stored := readResource(rpath)
+	for _, line := range []string{"PRODID:" + ics.PRODID + "\r\n", "DTSTAMP:", "X-NORMALIZED:yes\r\n"} {
+		if !strings.Contains(stored, line) {
+			t.Errorf("Expected %q in the stored object:\n%s", line, stored)
+		}
+	}
+
+	// the objects already normalized are stored as they are
+	resp = doRequest("PUT", rpath, stored, nil)
+	test.AssertInt(resp.StatusCode, http.StatusCreated, t)
+	test.AssertInt(len(resp.Header["Etag"]), 1, t)
+	test.AssertResourceData(rpath, stored, t)
+
+	// the objects that cannot be parsed are refused
+	resp = doRequest("PUT", rpath, "BEGIN:VEVENT; SUMMARY:Lunch; END:VEVENT", nil)
+	test.AssertInt(resp.StatusCode, http.StatusForbidden, t)
+	test.AssertResourceData(rpath, stored, t)
+}
+
+func TestMaxRequestBodySize(t *testing.T) {
+	SetupMaxRequestBodySize(10)
+	defer SetupMaxRequestBodySize(0)
+
+	rpath := "/test-data/max-body-size/123-456-789.ics"
+
+	resp := doRequest("PUT", rpath, "BEGIN:VEVENT; SUMMARY:Lunch; END:VEVENT", nil)
+	test.AssertInt(resp.StatusCode, http.StatusRequestEntityTooLarge, t)
+	test.AssertResourceDoesNotExist(rpath, t)
+
+	resp = doRequest("PUT", rpath, "BEGIN:VEV", nil)
+	test.AssertInt(resp.StatusCode, http.StatusCreated, t)
+	test.AssertResourceExists(rpath, t)
+}
+
 func TestDELETE(t *testing.T) {
 	collection := "/test-data/delete/"
 	rName := "123-456-789.ics"
@@ -130,11 +414,6 @@ func TestDELETE(t *testing.T) {
 	resp := doRequest("DELETE", "/foo/bar", "", nil)
 	test.AssertInt(resp.StatusCode, http.StatusNotFound, t)
 
-	// test deleting a collection (folder)
-	resp = doRequest("DELETE", collection, "", nil)
-	test.AssertInt(resp.StatusCode, http.StatusMethodNotAllowed, t)
-	test.AssertResourceExists(rpath, t)
-
 	// test trying deleting when ETag check fails
 	headers := map[string]string{
 		"If-Match": "1111111111111",
@@ -147,6 +426,13 @@ func TestDELETE(t *testing.T) {
 	resp = doRequest("DELETE", rpath, "", nil)
 	test.AssertInt(resp.StatusCode, http.StatusNoContent, t)
 	test.AssertResourceDoesNotExist(rpath, t)
+
+	// test deleting a collection (folder) with all its children, including nested collections
+	createResource(collection, rName, "BEGIN:VEVENT; SUMMARY:Party; END:VEVENT")
+	createResource(collection+"nested/", rName, "BEGIN:VEVENT; SUMMARY:Party; END:VEVENT")
+	resp = doRequest("DELETE", collection, "", nil)
+	test.AssertInt(resp.StatusCode, http.StatusNoContent, t)
+	test.AssertResourceDoesNotExist(collection, t)
 }
 
 func TestPROPFIND(t *testing.T) {
@@ -230,9 +516,10 @@ func TestPROPFIND(t *testing.T) {
 
 	propfindXML = `
   <?xml version="1.0" encoding="utf-8" ?>
-  <D:propfind xmlns:D="DAV:" xmlns:CS="http://calendarserver.org/ns/" xmlns:C="urn:ietf:params:xml:ns:caldav">
+  <D:propfind xmlns:D="DAV:" xmlns:CS="http://calendarserver.org/ns/" xmlns:C="urn:ietf:params:xml:ns:caldav" xmlns:A="http://apple.com/ns/ical/">
    <D:prop>
      <unknown-property/>
+     <A:calendar-color/>
    </D:prop>
   </D:propfind>
   `
@@ -244,6 +531,7 @@ func TestPROPFIND(t *testing.T) {
       <D:propstat>
         <D:prop>
           <unknown-property/>
+          <x1:calendar-color xmlns:x1="http://apple.com/ns/ical/"/>
         </D:prop>
         <D:status>HTTP/1.1 404 Not Found</D:status>
       </D:propstat>
@@ -0,0 +1,127 @@
+package itip
+
+import (
+	"errors"
+
+	"github.com/laurent22/ical-go"
+
+	"github.com/samedi/caldav-go/ics"
+)
+
+var (
+	// ErrUIDMismatch is returned when the message and the calendar object are not about the same UID.
+	ErrUIDMismatch = errors.New("itip: the message UID does not match the calendar object")
+	// ErrUnknownAttendee is returned when a reply comes from an attendee not present in the calendar object.
+	ErrUnknownAttendee = errors.New("itip: the replying attendee is not present in the calendar object")
+)
+
+// ApplyReply updates the organizer's copy of a calendar object with the participation status sent by an attendee
+// in a REPLY message. Each reply component is applied to the component with the same RECURRENCE-ID. When the reply
+// is about a single instance without override in the object, the override is created out of the master component.
+// Replies to an older SEQUENCE of the object are ignored. Only the status of the attendee sending the reply is
+// applied: the replies with more or less than one attendee are refused with `ErrInvalidMessage`. It returns
+// whether the object was changed.
+func ApplyReply(object, reply *ical.Node) (bool, error) {
+	sender, err := ReplyAttendee(reply)
+	if err != nil {
+		return false, err
+	}
+
+	if UID(object) != UID(reply) {
+		return false, ErrUIDMismatch
+	}
+
+	changed := false
+	for _, replyComp := range Components(reply) {
+		comp := componentByRecurrenceID(object, recurrenceID(replyComp))
+		if comp == nil {
+			master := componentByRecurrenceID(object, "")
+			if master == nil || recurrenceID(replyComp) == "" {
+				continue
+			}
+
+			comp = newOverride(master, ics.Property(replyComp, "RECURRENCE-ID"))
+			object.Children = append(object.Children, comp)
+			changed = true
+		}
+
+		if sequence(replyComp) < sequence(comp) {
+			continue
+		}
+
+		replyAttendee := Attendee(replyComp, sender)
+		if replyAttendee == nil {
+			continue
+		}
+
+		attendee := Attendee(comp, sender)
+		if attendee == nil {
+			return changed, ErrUnknownAttendee
+		}
+
+		partstat := replyAttendee.Parameter("PARTSTAT", "NEEDS-ACTION")
+		if attendee.Parameter("PARTSTAT", "") != partstat {
+			if attendee.Parameters == nil {
+				attendee.Parameters = make(map[string]string)
+			}
+			attendee.Parameters["PARTSTAT"] = partstat
+			changed = true
+		}
+	}
+
+	return changed, nil
+}
+
+// ReplyAttendee returns the address of the attendee replying in a REPLY message, which must be its only attendee
+// (RFC5546#3.2.3), otherwise it returns `ErrInvalidMessage`.
+func ReplyAttendee(reply *ical.Node) (string, error) {
+	attendees := Attendees(reply)
+	if len(attendees) != 1 {
+		return "", ErrInvalidMessage
+	}
+
+	return attendees[0], nil
+}
+
+// HasSignificantChange tells whether the new version of a calendar object differs from the old one in
+// something that must be sent to the attendees. The changes in the participation status of the attendees,
+// in the scheduling status and in the time stamps are not considered significant.
+func HasSignificantChange(oldObject, newObject *ical.Node) bool {
+	return ics.Serialize(significantContent(oldObject)) != ics.Serialize(significantContent(newObject))
+}
+
+// Returns a copy of the calendar object with only the content considered in `HasSignificantChange`.
+func significantContent(cal *ical.Node) *ical.Node {
+	result := ics.Clone(cal)
+
+	for _, comp := range Components(result) {
+		ics.RemoveProperties(comp, "DTSTAMP")
+		ics.RemoveProperties(comp, "LAST-MODIFIED")
+
+		for _, child := range comp.Children {
+			if child.Name == "ORGANIZER" || child.Name == "ATTENDEE" {
+				delete(child.Parameters, "SCHEDULE-STATUS")
+				delete(child.Parameters, "PARTSTAT")
+				delete(child.Parameters, "RSVP")
+			}
+		}
+	}
+
+	return result
+}
+
+func recurrenceID(comp *ical.Node) string {
+	return comp.PropString("RECURRENCE-ID", "")
+}
+
+// Returns the component of the calendar object with the given RECURRENCE-ID, or the master
+// component when the id is empty.
+func componentByRecurrenceID(cal *ical.Node, id string) *ical.Node {
+	for _, comp := range Components(cal) {
+		if recurrenceID(comp) == id {
+			return comp
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,129 @@
+package itip
+
+import (
+	"sort"
+	"time"
+
+	"github.com/laurent22/ical-go"
+
+	"github.com/samedi/caldav-go/ics"
+	"github.com/samedi/caldav-go/lib"
+)
+
+// The free-busy types (RFC5545#3.2.9).
+const (
+	FreeBusyBusy        = "BUSY"
+	FreeBusyTentative   = "BUSY-TENTATIVE"
+	FreeBusyUnavailable = "BUSY-UNAVAILABLE"
+)
+
+// Period is a busy time period of a calendar user, with its free-busy type.
+type Period struct {
+	Start time.Time
+	End   time.Time
+	Type  string
+}
+
+// FreeBusyRequest returns the VFREEBUSY component of a free-busy request, i.e. a REQUEST message with a VFREEBUSY.
+func FreeBusyRequest(msg *ical.Node) (*ical.Node, bool) {
+	if msg.PropString("METHOD", "") != MethodRequest {
+		return nil, false
+	}
+
+	comps := ics.Components(msg, lib.VFREEBUSY)
+	if len(comps) != 1 {
+		return nil, false
+	}
+
+	return comps[0], true
+}
+
+// FreeBusyRange returns the time range, in UTC, of the VFREEBUSY component of a free-busy request.
+func FreeBusyRange(freebusy *ical.Node) (time.Time, time.Time, bool) {
+	var zero time.Time
+
+	startProp, endProp := ics.Property(freebusy, "DTSTART"), ics.Property(freebusy, "DTEND")
+	if startProp == nil || endProp == nil {
+		return zero, zero, false
+	}
+
+	start, startOk := ics.DateTime(startProp)
+	end, endOk := ics.DateTime(endProp)
+	if !startOk || !endOk || !start.Before(end) {
+		return zero, zero, false
+	}
+
+	return start.UTC(), end.UTC(), true
+}
+
+// NewFreeBusyReply builds the REPLY to a free-busy request with the busy periods of the given attendee. The periods
+// are clipped to the requested range and the overlapping periods of the same type are merged (RFC5546#3.3.2).
+func NewFreeBusyReply(request *ical.Node, attendee string, periods []Period) *ical.Node {
+	msg := ics.NewCalendar()
+	ics.AddProperty(msg, ics.NewProperty("METHOD", MethodReply, nil))
+
+	reply := ics.NewComponent(lib.VFREEBUSY)
+	msg.Children = append(msg.Children, reply)
+
+	freebusy, _ := FreeBusyRequest(request)
+	if freebusy == nil {
+		return msg
+	}
+
+	for _, name := range []string{"UID", "DTSTART", "DTEND", "ORGANIZER"} {
+		if prop := ics.Property(freebusy, name); prop != nil {
+			ics.AddProperty(reply, ics.Clone(prop))
+		}
+	}
+	ics.SetProperty(reply, "DTSTAMP", now().UTC().Format(utcTimeFormat))
+	ics.AddProperty(reply, ics.NewProperty("ATTENDEE", attendee, nil))
+
+	start, end, ok := FreeBusyRange(freebusy)
+	if !ok {
+		return msg
+	}
+
+	for _, period := range mergePeriods(periods, start, end) {
+		value := period.Start.Format(utcTimeFormat) + "/" + period.End.Format(utcTimeFormat)
+		ics.AddProperty(reply, ics.NewProperty("FREEBUSY", value, map[string]string{"FBTYPE": period.Type}))
+	}
+
+	return msg
+}
+
+// Clips the periods to the range and merges the overlapping ones of the same type, sorted by type and start.
+func mergePeriods(periods []Period, start, end time.Time) []Period {
+	clipped := []Period{}
+	for _, period := range periods {
+		if period.Start.Before(start) {
+			period.Start = start
+		}
+		if period.End.After(end) {
+			period.End = end
+		}
+		if period.Start.Before(period.End) {
+			clipped = append(clipped, Period{period.Start.UTC(), period.End.UTC(), period.Type})
+		}
+	}
+
+	sort.Slice(clipped, func(i, j int) bool {
+		if clipped[i].Type != clipped[j].Type {
+			return clipped[i].Type < clipped[j].Type
+		}
+		return clipped[i].Start.Before(clipped[j].Start)
+	})
+
+	result := []Period{}
+	for _, period := range clipped {
+		last := len(result) - 1
+		if last >= 0 && result[last].Type == period.Type && !period.Start.After(result[last].End) {
+			if period.End.After(result[last].End) {
+				result[last].End = period.End
+			}
+			continue
+		}
+		result = append(result, period)
+	}
+
+	return result
+}
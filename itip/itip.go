@@ -0,0 +1,272 @@
+// Package itip implements the iCalendar Transport-Independent Interoperability Protocol (iTIP, RFC5546),
+// which defines the scheduling messages exchanged between the organizer and the attendees of events and to-dos.
+package itip
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/laurent22/ical-go"
+
+	"github.com/samedi/caldav-go/data"
+	"github.com/samedi/caldav-go/ics"
+	"github.com/samedi/caldav-go/lib"
+)
+
+// The iTIP methods (RFC5546#1.4).
+const (
+	MethodPublish        = "PUBLISH"
+	MethodRequest        = "REQUEST"
+	MethodReply          = "REPLY"
+	MethodAdd            = "ADD"
+	MethodCancel         = "CANCEL"
+	MethodRefresh        = "REFRESH"
+	MethodCounter        = "COUNTER"
+	MethodDeclineCounter = "DECLINECOUNTER"
+)
+
+// The scheduling status codes used in the SCHEDULE-STATUS parameters and in the
+// schedule responses (RFC6638#3.2.9 and RFC5546#3.6).
+const (
+	StatusPending               = "1.0"
+	StatusSent                  = "1.1"
+	StatusDelivered             = "1.2"
+	StatusSuccess               = "2.0"
+	StatusInvalidUser           = "3.7"
+	StatusNoPrivileges          = "3.8"
+	StatusDeliveryFailed        = "5.1"
+	StatusInvalidDeliveryMethod = "5.2"
+	StatusDeliveryRefused       = "5.3"
+)
+
+var statusDescriptions = map[string]string{
+	StatusPending:               "Pending",
+	StatusSent:                  "Sent",
+	StatusDelivered:             "Delivered",
+	StatusSuccess:               "Success",
+	StatusInvalidUser:           "Invalid calendar user",
+	StatusNoPrivileges:          "No scheduling privileges",
+	StatusDeliveryFailed:        "Delivery failed",
+	StatusInvalidDeliveryMethod: "Invalid delivery method",
+	StatusDeliveryRefused:       "Delivery refused",
+}
+
+// The iCalendar date-time format used for the UTC times, e.g. in DTSTAMP.
+const utcTimeFormat = "20060102T150405Z"
+
+// Returns the current time. Replaced in the tests to get predictable messages.
+var now = time.Now
+
+// RequestStatus returns the REQUEST-STATUS value for the given status code, e.g.: "2.0;Success".
+func RequestStatus(code string) string {
+	return code + ";" + statusDescriptions[code]
+}
+
+// Components returns the scheduling components of a calendar, i.e. all the components but the VTIMEZONEs.
+func Components(cal *ical.Node) []*ical.Node {
+	result := []*ical.Node{}
+
+	for _, comp := range ics.Components(cal) {
+		if comp.Name != lib.VTIMEZONE {
+			result = append(result, comp)
+		}
+	}
+
+	return result
+}
+
+// UID returns the UID of the scheduling components of the calendar.
+func UID(cal *ical.Node) string {
+	for _, comp := range Components(cal) {
+		if uid := comp.PropString("UID", ""); uid != "" {
+			return uid
+		}
+	}
+
+	return ""
+}
+
+// Returns the SEQUENCE of the component, 0 when it has none or when it is not a number.
+func sequence(comp *ical.Node) int {
+	seq, err := strconv.Atoi(strings.TrimSpace(comp.PropString("SEQUENCE", "")))
+	if err != nil {
+		return 0
+	}
+
+	return seq
+}
+
+// Organizer returns the address of the organizer of the calendar object, or an empty string if there is none.
+func Organizer(cal *ical.Node) string {
+	for _, comp := range Components(cal) {
+		if organizer := ics.Property(comp, "ORGANIZER"); organizer != nil {
+			return organizer.Value
+		}
+	}
+
+	return ""
+}
+
+// Attendees returns the addresses of all the attendees of the calendar object, in all its components.
+// Each address is returned only once, in the order they first appear.
+func Attendees(cal *ical.Node) []string {
+	result := []string{}
+	found := make(map[string]bool)
+
+	for _, comp := range Components(cal) {
+		for _, attendee := range ics.Properties(comp, "ATTENDEE") {
+			address := data.NormalizeAddress(attendee.Value)
+			if !found[address] {
+				found[address] = true
+				result = append(result, attendee.Value)
+			}
+		}
+	}
+
+	return result
+}
+
+// Sender returns the address of the calendar user sending the message: the attendee for the methods sent by
+// attendees (REPLY, REFRESH and COUNTER) and the organizer for the others.
+func Sender(msg *ical.Node) string {
+	switch msg.PropString("METHOD", "") {
+	case MethodReply, MethodRefresh, MethodCounter:
+		if attendees := Attendees(msg); len(attendees) > 0 {
+			return attendees[0]
+		}
+		return ""
+	default:
+		return Organizer(msg)
+	}
+}
+
+// Attendee returns the ATTENDEE property of the component with the given address, or nil if not present.
+func Attendee(comp *ical.Node, address string) *ical.Node {
+	for _, attendee := range ics.Properties(comp, "ATTENDEE") {
+		if data.SameAddress(attendee.Value, address) {
+			return attendee
+		}
+	}
+
+	return nil
+}
+
+// PartStat returns the participation status of the attendee in the first component where it
+// is present, or "NEEDS-ACTION", which is the default, when the attendee is not found.
+func PartStat(cal *ical.Node, address string) string {
+	for _, comp := range Components(cal) {
+		if attendee := Attendee(comp, address); attendee != nil {
+			return attendee.Parameter("PARTSTAT", "NEEDS-ACTION")
+		}
+	}
+
+	return "NEEDS-ACTION"
+}
+
+// IsScheduledByServer tells whether the server is responsible for scheduling the given ORGANIZER or ATTENDEE property,
+// i.e. when it has no SCHEDULE-AGENT parameter or it is set to SERVER (RFC6638#7.1).
+func IsScheduledByServer(prop *ical.Node) bool {
+	agent := strings.ToUpper(prop.Parameter("SCHEDULE-AGENT", "SERVER"))
+	return agent == "SERVER"
+}
+
+// SetScheduleStatus sets the SCHEDULE-STATUS parameter of the ORGANIZER or ATTENDEE properties with the given
+// address, in all the components of the calendar object.
+func SetScheduleStatus(cal *ical.Node, propName, address, status string) {
+	for _, comp := range Components(cal) {
+		for _, prop := range ics.Properties(comp, propName) {
+			if data.SameAddress(prop.Value, address) {
+				if prop.Parameters == nil {
+					prop.Parameters = make(map[string]string)
+				}
+				prop.Parameters["SCHEDULE-STATUS"] = status
+			}
+		}
+	}
+}
+
+// NewMessage builds an iTIP message with the given method out of a calendar object. The object is copied with the
+// METHOD property set, a new DTSTAMP and without the scheduling parameters that must not be sent in messages.
+func NewMessage(method string, cal *ical.Node) *ical.Node {
+	msg := ics.Clone(cal)
+	ics.RemoveProperties(msg, "METHOD")
+	ics.AddProperty(msg, ics.NewProperty("METHOD", method, nil))
+
+	dtstamp := now().UTC().Format(utcTimeFormat)
+	for _, comp := range Components(msg) {
+		ics.SetProperty(comp, "DTSTAMP", dtstamp)
+
+		for _, child := range comp.Children {
+			if child.Name == "ORGANIZER" || child.Name == "ATTENDEE" {
+				delete(child.Parameters, "SCHEDULE-STATUS")
+				delete(child.Parameters, "SCHEDULE-AGENT")
+				delete(child.Parameters, "SCHEDULE-FORCE-SEND")
+			}
+		}
+	}
+
+	return msg
+}
+
+// NewRequest builds a REQUEST message, sent by the organizer to invite the attendees or update the object.
+func NewRequest(cal *ical.Node) *ical.Node {
+	return NewMessage(MethodRequest, cal)
+}
+
+// NewCancel builds a CANCEL message, sent by the organizer to the given attendees to cancel the object.
+// Only these attendees are kept in the message.
+func NewCancel(cal *ical.Node, attendees ...string) *ical.Node {
+	msg := NewMessage(MethodCancel, cal)
+
+	for _, comp := range Components(msg) {
+		ics.SetProperty(comp, "STATUS", "CANCELLED")
+
+		children := comp.Children[:0]
+		for _, child := range comp.Children {
+			if child.Name == "ATTENDEE" && !data.ContainsAddress(attendees, child.Value) {
+				continue
+			}
+			children = append(children, child)
+		}
+		comp.Children = children
+	}
+
+	return msg
+}
+
+// The properties kept in the components of a REPLY (RFC5546#3.2.3).
+var replyProperties = []string{"UID", "DTSTAMP", "ORGANIZER", "SEQUENCE", "RECURRENCE-ID", "DTSTART", "DTEND", "DUE", "SUMMARY", "REQUEST-STATUS"}
+
+// NewReply builds a REPLY message, sent by the attendee to the organizer with its participation status.
+// Only the replying attendee and the properties identifying the object are kept in the message.
+func NewReply(cal *ical.Node, attendee string) *ical.Node {
+	msg := NewMessage(MethodReply, cal)
+
+	for _, comp := range Components(msg) {
+		children := []*ical.Node{}
+		for _, child := range comp.Children {
+			keep := !ics.IsComponent(child) && containsName(replyProperties, child.Name)
+			if child.Name == "ATTENDEE" {
+				keep = data.SameAddress(child.Value, attendee)
+			}
+
+			if keep {
+				children = append(children, child)
+			}
+		}
+		comp.Children = children
+	}
+
+	return msg
+}
+
+func containsName(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,170 @@
+package itip
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/laurent22/ical-go"
+
+	"github.com/samedi/caldav-go/data"
+	"github.com/samedi/caldav-go/ics"
+)
+
+const meeting = `BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:-//test//test//EN
+BEGIN:VEVENT
+UID:meeting-1
+DTSTAMP:20170101T100000Z
+DTSTART:20170102T100000Z
+DTEND:20170102T110000Z
+SUMMARY:Meeting
+SEQUENCE:1
+ORGANIZER;SCHEDULE-STATUS=1.2:mailto:alice@example.com
+ATTENDEE;PARTSTAT=ACCEPTED:mailto:alice@example.com
+ATTENDEE;PARTSTAT=NEEDS-ACTION;RSVP=TRUE:mailto:Bob@Example.com
+ATTENDEE;PARTSTAT=NEEDS-ACTION:mailto:carol@example.com
+END:VEVENT
+END:VCALENDAR`
+
+func parse(t *testing.T, data string) *ical.Node {
+	cal, err := ics.Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cal
+}
+
+func init() {
+	now = func() time.Time {
+		return time.Date(2017, 1, 1, 12, 0, 0, 0, time.UTC)
+	}
+}
+
+func TestAddresses(t *testing.T) {
+	cal := parse(t, meeting)
+
+	if Organizer(cal) != "mailto:alice@example.com" {
+		t.Error("Wrong organizer:", Organizer(cal))
+	}
+
+	attendees := strings.Join(Attendees(cal), ",")
+	if attendees != "mailto:alice@example.com,mailto:Bob@Example.com,mailto:carol@example.com" {
+		t.Error("Wrong attendees:", attendees)
+	}
+
+	if !data.SameAddress("MAILTO:bob@example.com", "mailto:Bob@Example.com") {
+		t.Error("mailto addresses must be case insensitive")
+	}
+
+	if PartStat(cal, "mailto:bob@example.com") != "NEEDS-ACTION" || PartStat(cal, "mailto:alice@example.com") != "ACCEPTED" {
+		t.Error("Wrong participation status")
+	}
+}
+
+func TestNewReply(t *testing.T) {
+	cal := parse(t, meeting)
+	Attendee(Components(cal)[0], "mailto:bob@example.com").Parameters["PARTSTAT"] = "ACCEPTED"
+
+	expected := "BEGIN:VCALENDAR\r\n" +
+		"VERSION:2.0\r\n" +
+		"PRODID:-//test//test//EN\r\n" +
+		"METHOD:REPLY\r\n" +
+		"BEGIN:VEVENT\r\n" +
+		"UID:meeting-1\r\n" +
+		"DTSTAMP:20170101T120000Z\r\n" +
+		"DTSTART:20170102T100000Z\r\n" +
+		"DTEND:20170102T110000Z\r\n" +
+		"SUMMARY:Meeting\r\n" +
+		"SEQUENCE:1\r\n" +
+		"ORGANIZER:mailto:alice@example.com\r\n" +
+		"ATTENDEE;PARTSTAT=ACCEPTED;RSVP=TRUE:mailto:Bob@Example.com\r\n" +
+		"END:VEVENT\r\n" +
+		"END:VCALENDAR\r\n"
+
+	if got := ics.Serialize(NewReply(cal, "mailto:bob@example.com")); got != expected {
+		t.Errorf("Wrong reply.\nExpected:\n%s\nGot:\n%s", expected, got)
+	}
+}
+
+func TestNewCancel(t *testing.T) {
+	cal := parse(t, meeting)
+	msg := NewCancel(cal, "mailto:carol@example.com")
+
+	if msg.PropString("METHOD", "") != MethodCancel {
+		t.Error("Wrong method:", msg.PropString("METHOD", ""))
+	}
+
+	comp := Components(msg)[0]
+	if comp.PropString("STATUS", "") != "CANCELLED" {
+		t.Error("The cancelled components must have the CANCELLED status")
+	}
+
+	if attendees := strings.Join(Attendees(msg), ","); attendees != "mailto:carol@example.com" {
+		t.Error("Only the cancelled attendees must be kept:", attendees)
+	}
+
+	// the original object is untouched
+	if len(Attendees(cal)) != 3 {
+		t.Error("The original object must not be changed")
+	}
+}
+
+func TestApplyReply(t *testing.T) {
+	object := parse(t, meeting)
+	reply := NewReply(parse(t, strings.Replace(meeting, "PARTSTAT=NEEDS-ACTION;RSVP=TRUE", "PARTSTAT=DECLINED", 1)), "mailto:bob@example.com")
+
+	changed, err := ApplyReply(object, reply)
+	if err != nil || !changed {
+		t.Fatal("The reply must be applied", err)
+	}
+
+	if PartStat(object, "mailto:bob@example.com") != "DECLINED" {
+		t.Error("Wrong participation status after reply:", PartStat(object, "mailto:bob@example.com"))
+	}
+
+	// applying it again changes nothing
+	if changed, _ := ApplyReply(object, reply); changed {
+		t.Error("The reply was already applied")
+	}
+
+	// the replies with a malformed SEQUENCE are taken as replies to the first sequence, older than the object's
+	malformed := NewReply(parse(t, strings.Replace(meeting, "SEQUENCE:1", "SEQUENCE:x", 1)), "mailto:bob@example.com")
+	if changed, err := ApplyReply(parse(t, meeting), malformed); changed || err != nil {
+		t.Error("The reply to an older sequence must be ignored", err)
+	}
+
+	other := parse(t, strings.Replace(meeting, "UID:meeting-1", "UID:meeting-2", 1))
+	if _, err := ApplyReply(other, reply); err != ErrUIDMismatch {
+		t.Error("Expected UID mismatch error, got", err)
+	}
+
+	// an attendee cannot reply for the other attendees
+	forged := NewReply(parse(t, meeting), "mailto:bob@example.com")
+	ics.AddProperty(Components(forged)[0], ics.NewProperty("ATTENDEE", "mailto:carol@example.com", map[string]string{"PARTSTAT": "DECLINED"}))
+	object = parse(t, meeting)
+	if changed, err := ApplyReply(object, forged); changed || err != ErrInvalidMessage {
+		t.Error("Expected an invalid message error for a reply with several attendees, got", err)
+	}
+	if PartStat(object, "mailto:carol@example.com") != "NEEDS-ACTION" {
+		t.Error("The status of the other attendee must not change")
+	}
+}
+
+func TestHasSignificantChange(t *testing.T) {
+	old := parse(t, meeting)
+
+	// participation and time stamps changes are not significant
+	sameMeeting := strings.Replace(meeting, "PARTSTAT=NEEDS-ACTION;RSVP=TRUE", "PARTSTAT=ACCEPTED", 1)
+	sameMeeting = strings.Replace(sameMeeting, "DTSTAMP:20170101T100000Z", "DTSTAMP:20170101T110000Z", 1)
+	if HasSignificantChange(old, parse(t, sameMeeting)) {
+		t.Error("Changes in the participation status must not be significant")
+	}
+
+	movedMeeting := strings.Replace(meeting, "DTSTART:20170102T100000Z", "DTSTART:20170102T090000Z", 1)
+	if !HasSignificantChange(old, parse(t, movedMeeting)) {
+		t.Error("Changes in the start time must be significant")
+	}
+}
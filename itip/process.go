@@ -0,0 +1,343 @@
+package itip
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/laurent22/ical-go"
+
+	"github.com/samedi/caldav-go/data"
+	"github.com/samedi/caldav-go/ics"
+)
+
+var (
+	// ErrNoObject is returned when the message can only be applied to an existing calendar object and there is none.
+	ErrNoObject = errors.New("itip: there is no calendar object to apply the message to")
+	// ErrInvalidMessage is returned when the message has no method, no UID or no scheduling components.
+	ErrInvalidMessage = errors.New("itip: invalid scheduling message")
+	// ErrUnsupportedMethod is returned when the message method is unknown.
+	ErrUnsupportedMethod = errors.New("itip: unsupported scheduling method")
+)
+
+// Result is the outcome of processing an iTIP message against a calendar object.
+type Result struct {
+	// Object is the resulting calendar object, or nil when there is none, e.g. when it was cancelled.
+	Object *ical.Node
+	// Changed tells whether the object was created, changed or removed by the message. Messages older than
+	// the object (by SEQUENCE and DTSTAMP) are ignored and do not change it.
+	Changed bool
+	// Replies are the messages to be sent back to the sender of the processed message, e.g. the
+	// latest version of the object for a REFRESH.
+	Replies []*ical.Node
+	// NeedsDecision tells that the message is a COUNTER proposal, which must be accepted (see
+	// `AcceptCounter`) or declined (see `DeclineCounter`) by the organizer.
+	NeedsDecision bool
+}
+
+// Process applies the iTIP message to the calendar object stored in the given resource. The resource is nil
+// when the recipient has no copy of the object yet. See `Apply` for the details.
+func Process(resource *data.Resource, msg *ical.Node) (*Result, error) {
+	var object *ical.Node
+
+	if resource != nil {
+		content, _ := resource.GetContentData()
+
+		var err error
+		if object, err = ics.Parse(content); err != nil {
+			return nil, err
+		}
+	}
+
+	return Apply(object, msg)
+}
+
+// Apply applies the iTIP message to a calendar object, which is nil when the recipient has no copy of it yet.
+// The object is changed in place and also returned in the result. The messages are handled as follows (RFC5546#3.2):
+//
+//   - PUBLISH, REQUEST: the components in the message replace the ones in the object. When the message has the
+//     master component, it replaces the whole object, otherwise only the given instances are replaced.
+//   - ADD: the instances in the message are added to the object. Without object, a REFRESH is replied.
+//   - CANCEL: the object is removed or, when the message has only instances, those instances are excluded.
+//   - REPLY: the participation status of the replying attendee is updated, per instance.
+//   - REFRESH: the object is replied as a REQUEST to the attendee asking for it.
+//   - COUNTER: nothing is changed, the organizer must decide about the proposal.
+//   - DECLINECOUNTER: nothing is changed, it only informs that the proposal was declined.
+func Apply(object, msg *ical.Node) (*Result, error) {
+	method := msg.PropString("METHOD", "")
+	uid := UID(msg)
+	if method == "" || uid == "" {
+		return nil, ErrInvalidMessage
+	}
+
+	if object != nil && UID(object) != uid {
+		return nil, ErrUIDMismatch
+	}
+
+	result := &Result{Object: object}
+
+	switch method {
+	case MethodPublish, MethodRequest:
+		applyRequest(result, msg)
+	case MethodAdd:
+		applyAdd(result, msg)
+	case MethodCancel:
+		applyCancel(result, msg)
+	case MethodReply:
+		if object == nil {
+			return nil, ErrNoObject
+		}
+
+		changed, err := ApplyReply(object, msg)
+		if err != nil {
+			return nil, err
+		}
+		result.Changed = changed
+	case MethodRefresh:
+		if object == nil {
+			return nil, ErrNoObject
+		}
+
+		result.Replies = append(result.Replies, NewRequest(object))
+	case MethodCounter:
+		if object == nil {
+			return nil, ErrNoObject
+		}
+		result.NeedsDecision = true
+	case MethodDeclineCounter:
+		// nothing to be done, the proposal of the attendee was declined
+	default:
+		return nil, ErrUnsupportedMethod
+	}
+
+	return result, nil
+}
+
+// AcceptCounter accepts the changes proposed by an attendee in a COUNTER message. The proposed components
+// replace the ones in the object, which gets a new SEQUENCE, and the resulting REQUEST is returned as reply.
+func AcceptCounter(object, counter *ical.Node) (*Result, error) {
+	if UID(object) != UID(counter) {
+		return nil, ErrUIDMismatch
+	}
+
+	sequence := objectSequence(object) + 1
+	for _, comp := range Components(counter) {
+		proposal := ics.Clone(comp)
+		ics.RemoveProperties(proposal, "REQUEST-STATUS")
+		replaceComponent(object, proposal)
+	}
+
+	for _, comp := range Components(object) {
+		ics.SetProperty(comp, "SEQUENCE", strconv.Itoa(sequence))
+	}
+
+	return &Result{Object: object, Changed: true, Replies: []*ical.Node{NewRequest(object)}}, nil
+}
+
+// DeclineCounter returns the DECLINECOUNTER message, sent by the organizer to decline the proposal in a COUNTER message.
+func DeclineCounter(object, counter *ical.Node) *ical.Node {
+	msg := NewMessage(MethodDeclineCounter, counter)
+
+	sequence := strconv.Itoa(objectSequence(object))
+	for _, comp := range Components(msg) {
+		ics.SetProperty(comp, "SEQUENCE", sequence)
+	}
+
+	return msg
+}
+
+func applyRequest(result *Result, msg *ical.Node) {
+	components := Components(msg)
+
+	if result.Object == nil || componentByRecurrenceID(msg, "") != nil {
+		if result.Object != nil && isOutdated(componentByRecurrenceID(result.Object, ""), componentByRecurrenceID(msg, "")) {
+			return
+		}
+
+		result.Object = objectFromMessage(msg)
+		result.Changed = true
+		return
+	}
+
+	// only some instances are given
+	for _, comp := range components {
+		if isOutdated(componentByRecurrenceID(result.Object, recurrenceID(comp)), comp) {
+			continue
+		}
+
+		replaceComponent(result.Object, ics.Clone(comp))
+		result.Changed = true
+	}
+}
+
+func applyAdd(result *Result, msg *ical.Node) {
+	if result.Object == nil {
+		// the attendee missed the original request, so it asks the organizer for the whole object
+		refresh := NewMessage(MethodRefresh, msg)
+		for _, comp := range Components(refresh) {
+			ics.RemoveProperties(comp, "RECURRENCE-ID")
+		}
+		result.Replies = append(result.Replies, refresh)
+		return
+	}
+
+	for _, comp := range Components(msg) {
+		instance := ics.Clone(comp)
+		if recurrenceID(instance) == "" {
+			// the added instances are kept as overrides, identified by their start
+			start := ics.Property(instance, "DTSTART")
+			if start == nil || componentByRecurrenceID(result.Object, start.Value) != nil {
+				continue
+			}
+
+			ics.AddProperty(instance, ics.NewProperty("RECURRENCE-ID", start.Value, start.Parameters))
+			addRecurrenceDate(result.Object, start)
+		} else if componentByRecurrenceID(result.Object, recurrenceID(instance)) != nil {
+			continue
+		}
+
+		result.Object.Children = append(result.Object.Children, instance)
+		result.Changed = true
+	}
+}
+
+func applyCancel(result *Result, msg *ical.Node) {
+	if result.Object == nil {
+		return
+	}
+
+	if master := componentByRecurrenceID(msg, ""); master != nil {
+		if isOutdated(componentByRecurrenceID(result.Object, ""), master) {
+			return
+		}
+
+		result.Object = nil
+		result.Changed = true
+		return
+	}
+
+	master := componentByRecurrenceID(result.Object, "")
+	for _, comp := range Components(msg) {
+		id := ics.Property(comp, "RECURRENCE-ID")
+		if isOutdated(componentByRecurrenceID(result.Object, id.Value), comp) {
+			continue
+		}
+
+		removeComponent(result.Object, id.Value)
+		if master != nil {
+			ics.AddProperty(master, ics.NewProperty("EXDATE", id.Value, id.Parameters))
+		}
+		result.Changed = true
+	}
+
+	// nothing left of the object
+	if len(Components(result.Object)) == 0 {
+		result.Object = nil
+	}
+}
+
+// Builds a calendar object out of a message, without the METHOD.
+func objectFromMessage(msg *ical.Node) *ical.Node {
+	object := ics.Clone(msg)
+	ics.RemoveProperties(object, "METHOD")
+
+	return object
+}
+
+// Tells whether the message component is older than the object component, by its SEQUENCE and DTSTAMP (RFC5546#2.1.5).
+func isOutdated(current, comp *ical.Node) bool {
+	if current == nil || comp == nil {
+		return false
+	}
+
+	currentSeq, seq := sequence(current), sequence(comp)
+	if seq != currentSeq {
+		return seq < currentSeq
+	}
+
+	// the DTSTAMPs are always in UTC, in the same format, so they can be compared as strings
+	return comp.PropString("DTSTAMP", "") < current.PropString("DTSTAMP", "")
+}
+
+// Returns the highest SEQUENCE of the object components.
+func objectSequence(object *ical.Node) int {
+	result := 0
+	for _, comp := range Components(object) {
+		if seq := sequence(comp); seq > result {
+			result = seq
+		}
+	}
+
+	return result
+}
+
+// Replaces the component with the same RECURRENCE-ID, or adds it when there is none.
+func replaceComponent(object, comp *ical.Node) {
+	for i, child := range object.Children {
+		if ics.IsComponent(child) && child.Name == comp.Name && recurrenceID(child) == recurrenceID(comp) {
+			object.Children[i] = comp
+			return
+		}
+	}
+
+	object.Children = append(object.Children, comp)
+}
+
+func removeComponent(object *ical.Node, id string) {
+	children := object.Children[:0]
+	for _, child := range object.Children {
+		if ics.IsComponent(child) && child.Name != "VTIMEZONE" && recurrenceID(child) == id {
+			continue
+		}
+		children = append(children, child)
+	}
+
+	object.Children = children
+}
+
+func addRecurrenceDate(object *ical.Node, start *ical.Node) {
+	if master := componentByRecurrenceID(object, ""); master != nil {
+		ics.AddProperty(master, ics.NewProperty("RDATE", start.Value, start.Parameters))
+	}
+}
+
+// Builds an override of the master component for the instance with the given RECURRENCE-ID.
+func newOverride(master, id *ical.Node) *ical.Node {
+	override := ics.Clone(master)
+	for _, name := range []string{"RRULE", "RDATE", "EXDATE", "EXRULE"} {
+		ics.RemoveProperties(override, name)
+	}
+	ics.AddProperty(override, ics.NewProperty("RECURRENCE-ID", id.Value, id.Parameters))
+
+	start, end := ics.Property(override, "DTSTART"), ics.Property(override, "DTEND")
+	if start == nil {
+		return override
+	}
+
+	// the instance keeps the duration of the master
+	if end != nil {
+		if startTime, layout, ok := parseDateTime(start.Value); ok {
+			if endTime, _, ok := parseDateTime(end.Value); ok {
+				if idTime, _, ok := parseDateTime(id.Value); ok {
+					end.Value = idTime.Add(endTime.Sub(startTime)).Format(layout)
+				}
+			}
+		}
+	}
+	start.Value = id.Value
+
+	return override
+}
+
+var dateTimeLayouts = []string{"20060102T150405Z", "20060102T150405", "20060102"}
+
+// Parses the iCalendar DATE and DATE-TIME values, returning also the layout used.
+func parseDateTime(value string) (time.Time, string, bool) {
+	for _, layout := range dateTimeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, layout, true
+		}
+	}
+
+	return time.Time{}, "", false
+}
@@ -0,0 +1,296 @@
+package itip
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samedi/caldav-go/data"
+	"github.com/samedi/caldav-go/ics"
+)
+
+// The event used in the examples of RFC5546#4.2.
+const conference = `BEGIN:VEVENT
+UID:calsrv.example.com-873970198738777@example.com
+SEQUENCE:0
+DTSTAMP:19970611T190000Z
+DTSTART:19970701T200000Z
+DTEND:19970701T203000Z
+SUMMARY:Conference
+ORGANIZER:mailto:a@example.com
+ATTENDEE;PARTSTAT=ACCEPTED:mailto:a@example.com
+ATTENDEE;PARTSTAT=NEEDS-ACTION:mailto:b@example.com
+ATTENDEE;PARTSTAT=NEEDS-ACTION:mailto:c@example.com
+END:VEVENT`
+
+// The recurring event used in the examples of RFC5546#4.3.
+var weekly = edit(conference, "DTEND:19970701T203000Z", "DTEND:19970701T203000Z\nRRULE:FREQ=WEEKLY;COUNT=6")
+
+// Builds a VCALENDAR with the given method (none if empty) and components.
+func calendar(method string, components ...string) string {
+	lines := []string{"BEGIN:VCALENDAR", "VERSION:2.0", "PRODID:-//Example/ExampleCalendarClient//EN"}
+	if method != "" {
+		lines = append(lines, "METHOD:"+method)
+	}
+	lines = append(lines, components...)
+	lines = append(lines, "END:VCALENDAR")
+
+	return strings.Join(lines, "\n")
+}
+
+// Keeps only the ATTENDEE with the given address in the component, as in the replies of that attendee.
+func replyOf(comp, address string) string {
+	var lines []string
+	for _, line := range strings.Split(comp, "\n") {
+		if !strings.HasPrefix(line, "ATTENDEE") || strings.HasSuffix(line, ":"+address) {
+			lines = append(lines, line)
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// Replaces, in order, each pair of old and new strings.
+func edit(s string, oldnew ...string) string {
+	return strings.NewReplacer(oldnew...).Replace(s)
+}
+
+func TestApply(t *testing.T) {
+	declinedInstance := edit(conference,
+		"SEQUENCE:0", "RECURRENCE-ID:19970708T200000Z\nSEQUENCE:0",
+		"ATTENDEE;PARTSTAT=NEEDS-ACTION:mailto:b@example.com\nATTENDEE;PARTSTAT=NEEDS-ACTION:mailto:c@example.com", "ATTENDEE;PARTSTAT=DECLINED:mailto:b@example.com")
+	movedInstance := edit(conference, "SEQUENCE:0", "RECURRENCE-ID:19970708T200000Z\nSEQUENCE:1", "T200000Z", "T210000Z", "T203000Z", "T213000Z")
+	// the instance id stays the same when the instance is moved
+	movedInstance = edit(movedInstance, "RECURRENCE-ID:19970708T210000Z", "RECURRENCE-ID:19970708T200000Z")
+
+	tests := []struct {
+		name          string
+		object        string
+		msg           string
+		expected      string
+		changed       bool
+		replies       []string
+		needsDecision bool
+		err           error
+	}{
+		{
+			name:     "REQUEST creates the object",
+			msg:      calendar(MethodRequest, conference),
+			expected: calendar("", conference),
+			changed:  true,
+		},
+		{
+			name:     "REQUEST with a new SEQUENCE replaces the object",
+			object:   calendar("", conference),
+			msg:      calendar(MethodRequest, edit(conference, "SEQUENCE:0", "SEQUENCE:1", "DTSTART:19970701T200000Z", "DTSTART:19970701T190000Z")),
+			expected: calendar("", edit(conference, "SEQUENCE:0", "SEQUENCE:1", "DTSTART:19970701T200000Z", "DTSTART:19970701T190000Z")),
+			changed:  true,
+		},
+		{
+			name:     "REQUEST with an older SEQUENCE is ignored",
+			object:   calendar("", edit(conference, "SEQUENCE:0", "SEQUENCE:2")),
+			msg:      calendar(MethodRequest, edit(conference, "SEQUENCE:0", "SEQUENCE:1")),
+			expected: calendar("", edit(conference, "SEQUENCE:0", "SEQUENCE:2")),
+		},
+		{
+			name:     "REQUEST with a malformed SEQUENCE is taken as the first one",
+			object:   calendar("", edit(conference, "SEQUENCE:0", "SEQUENCE:1")),
+			msg:      calendar(MethodRequest, edit(conference, "SEQUENCE:0", "SEQUENCE:x")),
+			expected: calendar("", edit(conference, "SEQUENCE:0", "SEQUENCE:1")),
+		},
+		{
+			name:     "REQUEST with the same SEQUENCE and an older DTSTAMP is ignored",
+			object:   calendar("", edit(conference, "DTSTAMP:19970611T190000Z", "DTSTAMP:19970612T190000Z")),
+			msg:      calendar(MethodRequest, edit(conference, "SUMMARY:Conference", "SUMMARY:Old conference")),
+			expected: calendar("", edit(conference, "DTSTAMP:19970611T190000Z", "DTSTAMP:19970612T190000Z")),
+		},
+		{
+			name:     "REQUEST for an instance adds the override",
+			object:   calendar("", weekly),
+			msg:      calendar(MethodRequest, movedInstance),
+			expected: calendar("", weekly, movedInstance),
+			changed:  true,
+		},
+		{
+			name:     "REPLY updates the attendee's participation status",
+			object:   calendar("", conference),
+			msg:      calendar(MethodReply, replyOf(edit(conference, "PARTSTAT=NEEDS-ACTION:mailto:b", "PARTSTAT=ACCEPTED:mailto:b"), "mailto:b@example.com")),
+			expected: calendar("", edit(conference, "PARTSTAT=NEEDS-ACTION:mailto:b", "PARTSTAT=ACCEPTED:mailto:b")),
+			changed:  true,
+		},
+		{
+			name:     "REPLY for an instance creates the override",
+			object:   calendar("", weekly),
+			msg:      calendar(MethodReply, replyOf(declinedInstance, "mailto:b@example.com")),
+			expected: calendar("", weekly, edit(conference, "PARTSTAT=NEEDS-ACTION:mailto:b", "PARTSTAT=DECLINED:mailto:b", "DTSTART:19970701T200000Z", "DTSTART:19970708T200000Z", "DTEND:19970701T203000Z", "DTEND:19970708T203000Z", "ATTENDEE;PARTSTAT=NEEDS-ACTION:mailto:c@example.com", "ATTENDEE;PARTSTAT=NEEDS-ACTION:mailto:c@example.com\nRECURRENCE-ID:19970708T200000Z")),
+			changed:  true,
+		},
+		{
+			name:     "REPLY to an older SEQUENCE is ignored",
+			object:   calendar("", edit(conference, "SEQUENCE:0", "SEQUENCE:1")),
+			msg:      calendar(MethodReply, replyOf(edit(conference, "PARTSTAT=NEEDS-ACTION:mailto:b", "PARTSTAT=ACCEPTED:mailto:b"), "mailto:b@example.com")),
+			expected: calendar("", edit(conference, "SEQUENCE:0", "SEQUENCE:1")),
+		},
+		{
+			name:   "REPLY from an unknown attendee",
+			object: calendar("", conference),
+			msg:    calendar(MethodReply, replyOf(edit(conference, "mailto:b@example.com", "mailto:x@example.com"), "mailto:x@example.com")),
+			err:    ErrUnknownAttendee,
+		},
+		{
+			name:   "REPLY with several attendees",
+			object: calendar("", conference),
+			msg:    calendar(MethodReply, edit(conference, "PARTSTAT=NEEDS-ACTION:mailto:c", "PARTSTAT=DECLINED:mailto:c")),
+			err:    ErrInvalidMessage,
+		},
+		{
+			name:    "CANCEL removes the object",
+			object:  calendar("", conference),
+			msg:     calendar(MethodCancel, edit(conference, "SEQUENCE:0", "SEQUENCE:1\nSTATUS:CANCELLED")),
+			changed: true,
+		},
+		{
+			name:     "CANCEL for an instance excludes it",
+			object:   calendar("", weekly, movedInstance),
+			msg:      calendar(MethodCancel, edit(movedInstance, "SEQUENCE:1", "SEQUENCE:2\nSTATUS:CANCELLED")),
+			expected: calendar("", edit(weekly, "mailto:c@example.com", "mailto:c@example.com\nEXDATE:19970708T200000Z")),
+			changed:  true,
+		},
+		{
+			name:     "ADD adds an instance",
+			object:   calendar("", weekly),
+			msg:      calendar(MethodAdd, edit(conference, "T200000Z", "T180000Z", "T203000Z", "T183000Z")),
+			expected: calendar("", edit(weekly, "mailto:c@example.com", "mailto:c@example.com\nRDATE:19970701T180000Z"), edit(conference, "T200000Z", "T180000Z", "T203000Z", "T183000Z", "ATTENDEE;PARTSTAT=NEEDS-ACTION:mailto:c@example.com", "ATTENDEE;PARTSTAT=NEEDS-ACTION:mailto:c@example.com\nRECURRENCE-ID:19970701T180000Z")),
+			changed:  true,
+		},
+		{
+			name:    "ADD without object asks for a REFRESH",
+			msg:     calendar(MethodAdd, conference),
+			replies: []string{MethodRefresh},
+		},
+		{
+			name:     "REFRESH replies the object",
+			object:   calendar("", conference),
+			msg:      calendar(MethodRefresh, "BEGIN:VEVENT\nUID:calsrv.example.com-873970198738777@example.com\nDTSTAMP:19970612T190000Z\nORGANIZER:mailto:a@example.com\nATTENDEE:mailto:b@example.com\nEND:VEVENT"),
+			expected: calendar("", conference),
+			replies:  []string{MethodRequest},
+		},
+		{
+			name:          "COUNTER needs a decision",
+			object:        calendar("", conference),
+			msg:           calendar(MethodCounter, edit(conference, "DTSTART:19970701T200000Z", "DTSTART:19970701T190000Z")),
+			expected:      calendar("", conference),
+			needsDecision: true,
+		},
+		{
+			name:     "DECLINECOUNTER changes nothing",
+			object:   calendar("", conference),
+			msg:      calendar(MethodDeclineCounter, conference),
+			expected: calendar("", conference),
+		},
+		{
+			name:   "UID mismatch",
+			object: calendar("", edit(conference, "UID:calsrv", "UID:other")),
+			msg:    calendar(MethodRequest, conference),
+			err:    ErrUIDMismatch,
+		},
+		{
+			name: "unsupported method",
+			msg:  calendar("FOO", conference),
+			err:  ErrUnsupportedMethod,
+		},
+		{
+			name: "message without method",
+			msg:  calendar("", conference),
+			err:  ErrInvalidMessage,
+		},
+	}
+
+	for _, tt := range tests {
+		var resource *data.Resource
+		if tt.object != "" {
+			r := data.NewResource("/a/calendar/conference.ics", contentAdapter(tt.object))
+			resource = &r
+		}
+
+		result, err := Process(resource, parse(t, tt.msg))
+		if err != tt.err {
+			t.Errorf("%s: expected error %v, got %v", tt.name, tt.err, err)
+			continue
+		} else if err != nil {
+			continue
+		}
+
+		if result.Changed != tt.changed || result.NeedsDecision != tt.needsDecision {
+			t.Errorf("%s: expected changed=%v and needsDecision=%v, got %v and %v", tt.name, tt.changed, tt.needsDecision, result.Changed, result.NeedsDecision)
+		}
+
+		expected, got := "", ""
+		if tt.expected != "" {
+			expected = ics.Serialize(parse(t, tt.expected))
+		}
+		if result.Object != nil {
+			got = ics.Serialize(result.Object)
+		}
+		if got != expected {
+			t.Errorf("%s: wrong resulting object.\nExpected:\n%s\nGot:\n%s", tt.name, expected, got)
+		}
+
+		replies := []string{}
+		for _, reply := range result.Replies {
+			replies = append(replies, reply.PropString("METHOD", ""))
+		}
+		if strings.Join(replies, ",") != strings.Join(tt.replies, ",") {
+			t.Errorf("%s: expected replies %v, got %v", tt.name, tt.replies, replies)
+		}
+	}
+}
+
+func TestCounter(t *testing.T) {
+	proposal := edit(conference, "DTSTART:19970701T200000Z", "DTSTART:19970701T190000Z", "DTEND:19970701T203000Z", "DTEND:19970701T193000Z")
+
+	// declining keeps the object and sends the current SEQUENCE
+	object := parse(t, calendar("", edit(conference, "SEQUENCE:0", "SEQUENCE:2")))
+	decline := DeclineCounter(object, parse(t, calendar(MethodCounter, proposal)))
+	if decline.PropString("METHOD", "") != MethodDeclineCounter || Components(decline)[0].PropString("SEQUENCE", "") != "2" {
+		t.Errorf("Wrong DECLINECOUNTER:\n%s", ics.Serialize(decline))
+	}
+
+	// accepting applies the proposal with a new SEQUENCE
+	result, err := AcceptCounter(object, parse(t, calendar(MethodCounter, proposal)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := ics.Serialize(parse(t, calendar("", edit(proposal, "SEQUENCE:0", "SEQUENCE:3"))))
+	if got := ics.Serialize(result.Object); got != expected {
+		t.Errorf("Wrong object after accepting the counter.\nExpected:\n%s\nGot:\n%s", expected, got)
+	}
+
+	if len(result.Replies) != 1 || result.Replies[0].PropString("METHOD", "") != MethodRequest {
+		t.Error("Accepting a counter must reply a REQUEST")
+	}
+}
+
+// Resource adapter with a fixed content.
+type contentAdapter string
+
+func (adp contentAdapter) IsCollection() bool {
+	return false
+}
+
+func (adp contentAdapter) CalculateEtag() string {
+	return ""
+}
+
+func (adp contentAdapter) GetContent() string {
+	return string(adp)
+}
+
+func (adp contentAdapter) GetContentSize() int64 {
+	return int64(len(adp))
+}
+
+func (adp contentAdapter) GetModTime() time.Time {
+	return time.Time{}
+}
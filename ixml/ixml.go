@@ -22,31 +22,72 @@ var NS_PREFIXES = map[string]string{
 }
 
 var (
+	ATTENDEE_ALLOWED_TG                 = xml.Name{CALDAV_NS, "attendee-allowed"}
+	CALDAV_RESPONSE_TG                  = xml.Name{CALDAV_NS, "response"}
 	CALENDAR_TG                         = xml.Name{CALDAV_NS, "calendar"}
 	CALENDAR_DATA_TG                    = xml.Name{CALDAV_NS, "calendar-data"}
+	CALENDAR_DESCRIPTION_TG             = xml.Name{CALDAV_NS, "calendar-description"}
 	CALENDAR_HOME_SET_TG                = xml.Name{CALDAV_NS, "calendar-home-set"}
+	CALENDAR_TIMEZONE_TG                = xml.Name{CALDAV_NS, "calendar-timezone"}
 	CALENDAR_QUERY_TG                   = xml.Name{CALDAV_NS, "calendar-query"}
 	CALENDAR_MULTIGET_TG                = xml.Name{CALDAV_NS, "calendar-multiget"}
 	CALENDAR_USER_ADDRESS_SET_TG        = xml.Name{CALDAV_NS, "calendar-user-address-set"}
 	COLLECTION_TG                       = xml.Name{DAV_NS, "collection"}
+	COMP_TG                             = xml.Name{CALDAV_NS, "comp"}
+	COMP_FILTER_TG                      = xml.Name{CALDAV_NS, "comp-filter"}
 	CURRENT_USER_PRINCIPAL_TG           = xml.Name{DAV_NS, "current-user-principal"}
 	DISPLAY_NAME_TG                     = xml.Name{DAV_NS, "displayname"}
+	ERROR_TG                            = xml.Name{DAV_NS, "error"}
 	GET_CONTENT_LENGTH_TG               = xml.Name{DAV_NS, "getcontentlength"}
 	GET_CONTENT_TYPE_TG                 = xml.Name{DAV_NS, "getcontenttype"}
 	GET_CTAG_TG                         = xml.Name{CALSERV_NS, "getctag"}
 	GET_ETAG_TG                         = xml.Name{DAV_NS, "getetag"}
 	GET_LAST_MODIFIED_TG                = xml.Name{DAV_NS, "getlastmodified"}
 	HREF_TG                             = xml.Name{DAV_NS, "href"}
+	MAX_ATTENDEES_PER_INSTANCE_TG       = xml.Name{CALDAV_NS, "max-attendees-per-instance"}
+	MAX_DATE_TIME_TG                    = xml.Name{CALDAV_NS, "max-date-time"}
+	MAX_INSTANCES_TG                    = xml.Name{CALDAV_NS, "max-instances"}
+	MAX_RESOURCE_SIZE_TG                = xml.Name{CALDAV_NS, "max-resource-size"}
+	MIN_DATE_TIME_TG                    = xml.Name{CALDAV_NS, "min-date-time"}
+	MKCALENDAR_TG                       = xml.Name{CALDAV_NS, "mkcalendar"}
+	MKCALENDAR_RESPONSE_TG              = xml.Name{CALDAV_NS, "mkcalendar-response"}
+	MULTISTATUS_TG                      = xml.Name{DAV_NS, "multistatus"}
+	NO_UID_CONFLICT_TG                  = xml.Name{CALDAV_NS, "no-uid-conflict"}
+	ORGANIZER_ALLOWED_TG                = xml.Name{CALDAV_NS, "organizer-allowed"}
 	OWNER_TG                            = xml.Name{DAV_NS, "owner"}
 	PRINCIPAL_TG                        = xml.Name{DAV_NS, "principal"}
 	PRINCIPAL_COLLECTION_SET_TG         = xml.Name{DAV_NS, "principal-collection-set"}
 	PRINCIPAL_URL_TG                    = xml.Name{DAV_NS, "principal-URL"}
+	PROP_TG                             = xml.Name{DAV_NS, "prop"}
+	PROPERTY_UPDATE_TG                  = xml.Name{DAV_NS, "propertyupdate"}
+	PROPSTAT_TG                         = xml.Name{DAV_NS, "propstat"}
+	RECIPIENT_TG                        = xml.Name{CALDAV_NS, "recipient"}
+	REMOVE_TG                           = xml.Name{DAV_NS, "remove"}
+	REQUEST_STATUS_TG                   = xml.Name{CALDAV_NS, "request-status"}
+	RESOURCE_MUST_BE_NULL_TG            = xml.Name{DAV_NS, "resource-must-be-null"}
 	RESOURCE_TYPE_TG                    = xml.Name{DAV_NS, "resourcetype"}
+	RESPONSE_TG                         = xml.Name{DAV_NS, "response"}
+	SCHEDULE_INBOX_TG                   = xml.Name{CALDAV_NS, "schedule-inbox"}
+	SCHEDULE_INBOX_URL_TG               = xml.Name{CALDAV_NS, "schedule-inbox-URL"}
+	SCHEDULE_OUTBOX_TG                  = xml.Name{CALDAV_NS, "schedule-outbox"}
+	SCHEDULE_OUTBOX_URL_TG              = xml.Name{CALDAV_NS, "schedule-outbox-URL"}
+	SCHEDULE_RESPONSE_TG                = xml.Name{CALDAV_NS, "schedule-response"}
+	SET_TG                              = xml.Name{DAV_NS, "set"}
 	STATUS_TG                           = xml.Name{DAV_NS, "status"}
 	SUPPORTED_CALENDAR_COMPONENT_SET_TG = xml.Name{CALDAV_NS, "supported-calendar-component-set"}
+	SUPPORTED_CALENDAR_DATA_TG          = xml.Name{CALDAV_NS, "supported-calendar-data"}
+	SUPPORTED_COLLATION_TG              = xml.Name{CALDAV_NS, "supported-collation"}
+	SUPPORTED_COLLATION_SET_TG          = xml.Name{CALDAV_NS, "supported-collation-set"}
+	SUPPORTED_FILTER_TG                 = xml.Name{CALDAV_NS, "supported-filter"}
+	TIMEZONE_TG                         = xml.Name{CALDAV_NS, "timezone"}
+	VALID_CALENDAR_DATA_TG              = xml.Name{CALDAV_NS, "valid-calendar-data"}
+	VALID_FILTER_TG                     = xml.Name{CALDAV_NS, "valid-filter"}
+	VALID_SCHEDULING_MESSAGE_TG         = xml.Name{CALDAV_NS, "valid-scheduling-message"}
 )
 
 // Namespaces returns the default XML namespaces in for CalDAV contents.
+//
+// Deprecated: use the `ixml.Writer`, which declares the namespaces as needed.
 func Namespaces() string {
 	bf := new(lib.StringBuffer)
 	bf.Write(`xmlns:%s="%s" `, NS_PREFIXES[DAV_NS], DAV_NS)
@@ -58,6 +99,9 @@ func Namespaces() string {
 
 // Tag returns a XML tag as string based on the given tag name and content. It
 // takes in consideration the namespace and also if it is an empty content or not.
+//
+// Deprecated: tags in namespaces other than the ones in `NS_PREFIXES` are not properly
+// namespaced. Use the `ixml.Writer` instead.
 func Tag(xmlName xml.Name, content string) string {
 	name := xmlName.Local
 	ns := NS_PREFIXES[xmlName.Space]
@@ -74,15 +118,41 @@ func Tag(xmlName xml.Name, content string) string {
 }
 
 // HrefTag returns a DAV <D:href> tag with the given href path.
+//
+// Deprecated: use `ixml.HrefElement` with the `ixml.Writer` instead.
 func HrefTag(href string) (tag string) {
 	return Tag(HREF_TG, href)
 }
 
 // StatusTag returns a DAV <D:status> tag with the given HTTP status. The
 // status is translated into a label, e.g.: HTTP/1.1 404 NotFound.
+//
+// Deprecated: use `ixml.StatusElement` with the `ixml.Writer` instead.
 func StatusTag(status int) string {
-	statusText := fmt.Sprintf("HTTP/1.1 %d %s", status, http.StatusText(status))
-	return Tag(STATUS_TG, statusText)
+	return Tag(STATUS_TG, StatusText(status))
+}
+
+// StatusText translates the HTTP status into the label used in DAV <D:status> tags, e.g.: HTTP/1.1 404 Not Found.
+func StatusText(status int) string {
+	return fmt.Sprintf("HTTP/1.1 %d %s", status, http.StatusText(status))
+}
+
+// StatusElement returns a DAV <D:status> element with the given HTTP status.
+func StatusElement(status int) Element {
+	return NewTextElement(STATUS_TG, StatusText(status))
+}
+
+// ErrorXML returns a DAV <D:error> XML document reporting the given failed precondition,
+// with the given child elements as its content. [See RFC4918#section-16]
+func ErrorXML(condition xml.Name, content ...Element) string {
+	var buffer bytes.Buffer
+
+	w := NewWriter(&buffer)
+	w.Header()
+	w.Element(NewElement(ERROR_TG, NewElement(condition, content...)))
+	w.Flush()
+
+	return buffer.String()
 }
 
 // EscapeText escapes any special character in the given text and returns the result.
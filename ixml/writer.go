@@ -0,0 +1,206 @@
+package ixml
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Element represents a generic XML element, with its attributes, text and child elements. It can be
+// written with a `Writer` and also be decoded with `xml.Unmarshal`, e.g. to read the properties of a request.
+type Element struct {
+	XMLName  xml.Name
+	Attrs    []xml.Attr `xml:",any,attr"`
+	Text     string     `xml:",chardata"`
+	Children []Element  `xml:",any"`
+}
+
+// NewElement initializes a new element with the given name and child elements.
+func NewElement(name xml.Name, children ...Element) Element {
+	return Element{XMLName: name, Children: children}
+}
+
+// NewTextElement initializes a new element with the given name and text content.
+func NewTextElement(name xml.Name, text string) Element {
+	return Element{XMLName: name, Text: text}
+}
+
+// HrefElement returns a DAV <D:href> element with the given href path.
+func HrefElement(href string) Element {
+	return NewTextElement(HREF_TG, href)
+}
+
+// Attr returns the value of the element's attribute with the given local name, or an empty string if not present.
+func (e Element) Attr(name string) string {
+	for _, attr := range e.Attrs {
+		if attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+
+	return ""
+}
+
+// Writer writes XML documents into a stream, taking care of the namespaces and the escaping. The namespaces
+// in `NS_PREFIXES` are declared in the root element with their usual prefixes. Any other namespace is
+// declared on demand, in the first element using it, with a generated prefix. Writing errors are kept
+// and returned when flushing the writer.
+type Writer struct {
+	w *bufio.Writer
+	// the open elements, each one with the namespaces (namespace => prefix) declared on it
+	stack []writerScope
+	// counter used to generate unique prefixes for unknown namespaces
+	nsCounter int
+}
+
+type writerScope struct {
+	name       xml.Name
+	namespaces map[string]string
+}
+
+// NewWriter initializes a new XML writer on top of the given stream.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: bufio.NewWriter(w)}
+}
+
+// Header writes the XML declaration.
+func (w *Writer) Header() {
+	w.w.WriteString(`<?xml version="1.0" encoding="UTF-8"?>`)
+}
+
+// Start writes the start tag of an element. The element stays open until `End` is called.
+func (w *Writer) Start(name xml.Name, attrs ...xml.Attr) {
+	w.writeStartTag(name, attrs, false)
+}
+
+// End writes the end tag of the last open element.
+func (w *Writer) End() {
+	scope := w.stack[len(w.stack)-1]
+	w.w.WriteString("</" + w.qualifiedName(scope.name) + ">")
+	w.stack = w.stack[:len(w.stack)-1]
+}
+
+// Empty writes an element without any content, e.g.: <D:prop/>.
+func (w *Writer) Empty(name xml.Name, attrs ...xml.Attr) {
+	w.writeStartTag(name, attrs, true)
+}
+
+// Text writes escaped text content inside the current element.
+func (w *Writer) Text(text string) {
+	xml.EscapeText(w.w, []byte(text))
+}
+
+// TextElement writes an element with the given escaped text as content, or an empty element if the text is empty.
+func (w *Writer) TextElement(name xml.Name, text string) {
+	w.Element(NewTextElement(name, text))
+}
+
+// Element writes the whole element, including attributes, text and child elements.
+func (w *Writer) Element(e Element) {
+	text := e.Text
+	if len(e.Children) > 0 {
+		// ignore the whitespace used for indentation of the child elements
+		text = strings.TrimSpace(text)
+	}
+
+	if text == "" && len(e.Children) == 0 {
+		w.Empty(e.XMLName, e.Attrs...)
+		return
+	}
+
+	w.Start(e.XMLName, e.Attrs...)
+	w.Text(text)
+	for _, child := range e.Children {
+		w.Element(child)
+	}
+	w.End()
+}
+
+// Flush writes any buffered data to the underlying stream and returns the first error that happened while writing.
+func (w *Writer) Flush() error {
+	return w.w.Flush()
+}
+
+func (w *Writer) writeStartTag(name xml.Name, attrs []xml.Attr, empty bool) {
+	attrs = withoutNamespaceDecls(attrs)
+	scope := writerScope{name: name, namespaces: make(map[string]string)}
+	declarations := ""
+
+	if len(w.stack) == 0 {
+		// the root element declares all the well known namespaces
+		for _, ns := range []string{DAV_NS, CALDAV_NS, CALSERV_NS} {
+			scope.namespaces[ns] = NS_PREFIXES[ns]
+			declarations += fmt.Sprintf(` xmlns:%s="%s"`, NS_PREFIXES[ns], ns)
+		}
+	}
+	w.stack = append(w.stack, scope)
+
+	declare := func(ns string) {
+		if ns == "" || w.prefix(ns) != "" {
+			return
+		}
+
+		w.nsCounter++
+		prefix := fmt.Sprintf("x%d", w.nsCounter)
+		scope.namespaces[ns] = prefix
+		declarations += fmt.Sprintf(` xmlns:%s="%s"`, prefix, escapeAttr(ns))
+	}
+
+	declare(name.Space)
+	for _, attr := range attrs {
+		declare(attr.Name.Space)
+	}
+
+	w.w.WriteString("<" + w.qualifiedName(name) + declarations)
+	for _, attr := range attrs {
+		w.w.WriteString(fmt.Sprintf(` %s="%s"`, w.qualifiedName(attr.Name), escapeAttr(attr.Value)))
+	}
+
+	if empty {
+		w.w.WriteString("/>")
+		w.stack = w.stack[:len(w.stack)-1]
+	} else {
+		w.w.WriteString(">")
+	}
+}
+
+// returns the prefix of a namespace declared in the current scope, or an empty string if not declared.
+func (w *Writer) prefix(ns string) string {
+	for i := len(w.stack) - 1; i >= 0; i-- {
+		if prefix, found := w.stack[i].namespaces[ns]; found {
+			return prefix
+		}
+	}
+
+	return ""
+}
+
+func (w *Writer) qualifiedName(name xml.Name) string {
+	if prefix := w.prefix(name.Space); prefix != "" {
+		return prefix + ":" + name.Local
+	}
+
+	return name.Local
+}
+
+// removes the namespace declarations coming from decoded elements, as those are handled by the writer itself.
+func withoutNamespaceDecls(attrs []xml.Attr) []xml.Attr {
+	result := []xml.Attr{}
+	for _, attr := range attrs {
+		if attr.Name.Space != "xmlns" && attr.Name.Local != "xmlns" {
+			result = append(result, attr)
+		}
+	}
+
+	return result
+}
+
+func escapeAttr(value string) string {
+	var buffer bytes.Buffer
+	xml.EscapeText(&buffer, []byte(value))
+
+	return buffer.String()
+}
@@ -0,0 +1,60 @@
+package ixml
+
+import (
+	"bytes"
+	"encoding/xml"
+	"testing"
+)
+
+func TestWriter(t *testing.T) {
+	appleNS := "http://apple.com/ns/ical/"
+
+	var buffer bytes.Buffer
+	w := NewWriter(&buffer)
+	w.Header()
+	w.Start(xml.Name{DAV_NS, "prop"})
+	w.TextElement(DISPLAY_NAME_TG, `Tom & Jerry's <calendar>`)
+	w.Empty(xml.Name{appleNS, "calendar-color"})
+	w.Start(xml.Name{appleNS, "calendar-order"})
+	w.Element(NewElement(xml.Name{appleNS, "nested"}))
+	w.End()
+	w.Element(Element{
+		XMLName: xml.Name{CALDAV_NS, "comp"},
+		Attrs:   []xml.Attr{{Name: xml.Name{Local: "name"}, Value: `"VEVENT"`}},
+	})
+	w.Empty(xml.Name{Local: "no-namespace"})
+	w.End()
+
+	if err := w.Flush(); err != nil {
+		t.Fatal("Flushing the writer returned an error:", err)
+	}
+
+	expected := `<?xml version="1.0" encoding="UTF-8"?>` +
+		`<D:prop xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav" xmlns:CS="http://calendarserver.org/ns/">` +
+		`<D:displayname>Tom &amp; Jerry&#39;s &lt;calendar&gt;</D:displayname>` +
+		`<x1:calendar-color xmlns:x1="http://apple.com/ns/ical/"/>` +
+		`<x2:calendar-order xmlns:x2="http://apple.com/ns/ical/"><x2:nested/></x2:calendar-order>` +
+		`<C:comp name="&#34;VEVENT&#34;"/>` +
+		`<no-namespace/>` +
+		`</D:prop>`
+
+	if buffer.String() != expected {
+		t.Error("Expected:", expected, "| Got:", buffer.String())
+	}
+
+	// the output must be a valid XML, with all the elements in the right namespaces
+	var decoded Element
+	if err := xml.Unmarshal(buffer.Bytes(), &decoded); err != nil {
+		t.Fatal("Written XML could not be decoded:", err)
+	}
+
+	if decoded.Children[1].XMLName != (xml.Name{appleNS, "calendar-color"}) {
+		t.Error("Expected element in the Apple namespace, got", decoded.Children[1].XMLName)
+	}
+	if decoded.Children[2].Children[0].XMLName != (xml.Name{appleNS, "nested"}) {
+		t.Error("Expected element in the Apple namespace, got", decoded.Children[2].Children[0].XMLName)
+	}
+	if decoded.Children[3].Attr("name") != `"VEVENT"` {
+		t.Error("Expected attribute to be unescaped, got", decoded.Children[3].Attr("name"))
+	}
+}
@@ -0,0 +1,775 @@
+package jscalendar
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/laurent22/ical-go"
+
+	"github.com/samedi/caldav-go/data"
+	"github.com/samedi/caldav-go/ics"
+	"github.com/samedi/caldav-go/lib"
+)
+
+// ErrNoEntries is returned when converting a calendar without events nor to-dos.
+var ErrNoEntries = errors.New("jscalendar: the calendar has no events nor to-dos")
+
+// The layouts of the LocalDateTime and UTCDateTime values (RFC8984#1.4.4 and #1.4.5).
+const (
+	localDateTimeLayout = "2006-01-02T15:04:05"
+	utcDateTimeLayout   = "2006-01-02T15:04:05Z"
+)
+
+// The time zone of the UTC times.
+const utcTimeZone = "Etc/UTC"
+
+// The properties that can be repeated in a component, all of them being mapped.
+var repeatableProperties = []string{"ATTENDEE", "CATEGORIES", "EXDATE", "RDATE", "RRULE", "EXRULE"}
+
+// The calendar properties mapped to the groups or to their entries.
+var mappedCalendarProperties = []string{"VERSION", "PRODID", "METHOD", "NAME"}
+
+// ConvertResource converts the iCalendar content of the resource to JSCalendar. See `Convert`.
+func ConvertResource(resource *data.Resource) (Object, error) {
+	content, found := resource.GetContentData()
+	if !found {
+		return nil, errors.New("jscalendar: the resource has no content")
+	}
+
+	cal, err := ics.Parse(content)
+	if err != nil {
+		return nil, err
+	}
+
+	return Convert(cal)
+}
+
+// Convert converts the VCALENDAR object to JSCalendar. The calendars whose events and to-dos all share the
+// same UID, like the calendar object resources, are converted to an Event or a Task, and the other ones to
+// a Group of them. The properties without JSCalendar mapping are kept in the `ICalComponent` of the objects.
+// The VTIMEZONEs and the other calendar properties without mapping are kept in the `ICalComponent` of the
+// Group or, for an Event or a Task, in the one of the object, which then is a VCALENDAR holding them together
+// with the VEVENT or VTODO of the object's own properties without mapping.
+func Convert(cal *ical.Node) (Object, error) {
+	if cal == nil || cal.Name != lib.VCALENDAR {
+		return nil, errors.New("jscalendar: the calendar object is not a VCALENDAR")
+	}
+
+	// the components are grouped by UID, each group being an entry with its overridden instances
+	var uids []string
+	comps := make(map[string][]*ical.Node)
+	for _, comp := range ics.Components(cal, lib.VEVENT, lib.VTODO) {
+		uid := comp.PropString("UID", "")
+		if _, found := comps[uid]; !found {
+			uids = append(uids, uid)
+		}
+		comps[uid] = append(comps[uid], comp)
+	}
+
+	if len(uids) == 0 {
+		return nil, ErrNoEntries
+	}
+
+	c := &converter{ctx: ics.NewTimeContext(cal, nil)}
+
+	var entries []Object
+	for _, uid := range uids {
+		entry, err := c.entry(comps[uid])
+		if err != nil {
+			return nil, err
+		}
+
+		common := commonOf(entry)
+		common.Method = strings.ToLower(cal.PropString("METHOD", ""))
+		entries = append(entries, entry)
+	}
+
+	if len(entries) == 1 {
+		common := commonOf(entries[0])
+		common.ProdID = cal.PropString("PRODID", "")
+
+		// the NAME of the calendar is only mapped to the title of the groups
+		unmapped := unmappedCalendarChildren(cal, "VERSION", "PRODID", "METHOD")
+		if len(unmapped) == 0 {
+			return entries[0], nil
+		}
+
+		if len(common.ICalComponent) > 0 {
+			comp, err := ics.ParseJCal(common.ICalComponent)
+			if err != nil {
+				return nil, err
+			}
+			unmapped = append(unmapped, comp)
+		}
+
+		var err error
+		common.ICalComponent, err = iCalComponent(lib.VCALENDAR, unmapped)
+		return entries[0], err
+	}
+
+	group := &Group{
+		Type:    TypeGroup,
+		UID:     cal.PropString("UID", ""),
+		ProdID:  cal.PropString("PRODID", ""),
+		Title:   ics.UnescapeText(cal.PropString("NAME", "")),
+		Entries: entries,
+	}
+
+	// the groups of calendars without UID get one derived from their entries
+	if group.UID == "" {
+		hash := sha1.Sum([]byte(strings.Join(uids, "\n")))
+		group.UID = hex.EncodeToString(hash[:])
+	}
+
+	var err error
+	group.ICalComponent, err = iCalComponent(lib.VCALENDAR, unmappedCalendarChildren(cal, mappedCalendarProperties...))
+	return group, err
+}
+
+// Returns the properties of the calendar but the mapped ones, and its components but the events and to-dos,
+// e.g. the VTIMEZONEs.
+func unmappedCalendarChildren(cal *ical.Node, mapped ...string) []*ical.Node {
+	var unmapped []*ical.Node
+	for _, child := range cal.Children {
+		if ics.IsComponent(child) {
+			if child.Name != lib.VEVENT && child.Name != lib.VTODO {
+				unmapped = append(unmapped, child)
+			}
+		} else if !contains(mapped, child.Name) {
+			unmapped = append(unmapped, child)
+		}
+	}
+
+	return unmapped
+}
+
+// Returns the common properties of an event or task.
+func commonOf(obj Object) *Common {
+	switch obj := obj.(type) {
+	case *Event:
+		return &obj.Common
+	case *Task:
+		return &obj.Common
+	}
+
+	return nil
+}
+
+// Returns the jCal of a component with the given children, or nil when there are none.
+func iCalComponent(name string, children []*ical.Node) (json.RawMessage, error) {
+	if len(children) == 0 {
+		return nil, nil
+	}
+
+	return ics.MarshalJCal(ics.NewComponent(name, children...))
+}
+
+type converter struct {
+	ctx *ics.TimeContext
+}
+
+// Converts the components sharing an UID: the master component and its overridden instances, which become
+// patches of the master. When there is no master component, the first instance is used as the entry.
+func (c *converter) entry(comps []*ical.Node) (Object, error) {
+	master := comps[0]
+	for _, comp := range comps {
+		if ics.Property(comp, "RECURRENCE-ID") == nil {
+			master = comp
+			break
+		}
+	}
+
+	entry, err := c.component(master)
+	if err != nil {
+		return nil, err
+	}
+	common := commonOf(entry)
+
+	masterMap, err := toMap(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, comp := range comps {
+		recurrenceID := ics.Property(comp, "RECURRENCE-ID")
+		if comp == master || recurrenceID == nil {
+			continue
+		}
+
+		override, err := c.component(comp)
+		if err != nil {
+			return nil, err
+		}
+		overrideMap, err := toMap(override)
+		if err != nil {
+			return nil, err
+		}
+
+		if common.RecurrenceOverrides == nil {
+			common.RecurrenceOverrides = make(map[string]PatchObject)
+		}
+		common.RecurrenceOverrides[c.localDateTimeIn(recurrenceID, common.TimeZone)] = diff(masterMap, overrideMap)
+	}
+
+	return entry, nil
+}
+
+// Converts a VEVENT to an Event or a VTODO to a Task, without the overridden instances.
+func (c *converter) component(comp *ical.Node) (Object, error) {
+	var obj Object
+	var mapSpecific func(prop *ical.Node) bool
+
+	switch comp.Name {
+	case lib.VEVENT:
+		event := &Event{Common: Common{Type: TypeEvent}}
+		obj = event
+		mapSpecific = func(prop *ical.Node) bool {
+			switch prop.Name {
+			case "DURATION":
+				event.Duration = prop.Value
+			case "DTEND":
+				return c.mapDuration(comp, prop, &event.Duration)
+			case "STATUS":
+				status := strings.ToLower(prop.Value)
+				if status != "confirmed" && status != "cancelled" && status != "tentative" {
+					return false
+				}
+				event.Status = status
+			default:
+				return false
+			}
+			return true
+		}
+	case lib.VTODO:
+		task := &Task{Common: Common{Type: TypeTask}}
+		obj = task
+		mapSpecific = func(prop *ical.Node) bool {
+			switch prop.Name {
+			case "DUE":
+				timeZone := task.TimeZone
+				// without start, the task has the time zone of its due time
+				if ics.Property(comp, "DTSTART") == nil {
+					_, timeZone, task.ShowWithoutTime, _ = localDateTime(prop)
+					task.TimeZone = timeZone
+				}
+				task.Due = c.localDateTimeIn(prop, timeZone)
+			case "DURATION":
+				task.EstimatedDuration = prop.Value
+			case "PERCENT-COMPLETE":
+				return integer(prop, &task.PercentComplete)
+			case "STATUS":
+				progress := strings.ToLower(prop.Value)
+				if progress != "needs-action" && progress != "in-process" && progress != "completed" && progress != "cancelled" {
+					return false
+				}
+				task.Progress = progress
+			default:
+				return false
+			}
+			return true
+		}
+	default:
+		return nil, errors.New("jscalendar: unsupported component " + comp.Name)
+	}
+
+	common := commonOf(obj)
+
+	// the start comes first, since the other times are given in its time zone
+	if start := ics.Property(comp, "DTSTART"); start != nil {
+		if local, timeZone, date, ok := localDateTime(start); ok {
+			common.Start, common.TimeZone, common.ShowWithoutTime = local, timeZone, date
+		}
+	}
+
+	var unmapped []*ical.Node
+	mapped := make(map[string]bool)
+	for _, child := range comp.Children {
+		if ics.IsComponent(child) {
+			if child.Name == lib.VALARM {
+				if err := c.mapAlert(common, child); err != nil {
+					return nil, err
+				}
+			} else {
+				unmapped = append(unmapped, child)
+			}
+			continue
+		}
+
+		// only the first of the properties that cannot be repeated is mapped, but the ones given in
+		// other languages, which are localizations
+		var ok bool
+		if mapped[child.Name] && !contains(repeatableProperties, child.Name) {
+			ok = c.mapLocalization(common, child)
+		} else {
+			ok = mapSpecific(child) || c.mapProperty(common, child)
+		}
+
+		if !ok {
+			unmapped = append(unmapped, child)
+			continue
+		}
+		mapped[child.Name] = true
+	}
+
+	c.mapOrganizer(common, ics.Property(comp, "ORGANIZER"))
+
+	var err error
+	common.ICalComponent, err = iCalComponent(comp.Name, unmapped)
+	return obj, err
+}
+
+// Maps the properties shared by the events and to-dos. It returns false for the properties without mapping
+// or with values that cannot be mapped.
+func (c *converter) mapProperty(common *Common, prop *ical.Node) bool {
+	switch prop.Name {
+	case "UID":
+		common.UID = prop.Value
+	case "DTSTART":
+		return common.Start != ""
+	case "RECURRENCE-ID":
+		local, timeZone, _, ok := localDateTime(prop)
+		if !ok {
+			return false
+		}
+		common.RecurrenceID, common.RecurrenceIDTimeZone = local, timeZone
+	case "CREATED":
+		return c.utcDateTime(prop, &common.Created)
+	case "LAST-MODIFIED":
+		return c.utcDateTime(prop, &common.Updated)
+	case "SEQUENCE":
+		return integer(prop, &common.Sequence)
+	case "PRIORITY":
+		return integer(prop, &common.Priority)
+	case "SUMMARY":
+		common.Title = ics.UnescapeText(prop.Value)
+		common.Locale = prop.Parameter("LANGUAGE", common.Locale)
+	case "DESCRIPTION":
+		common.Description = ics.UnescapeText(prop.Value)
+		common.Locale = prop.Parameter("LANGUAGE", common.Locale)
+	case "LOCATION":
+		location := common.location()
+		location.Name = ics.UnescapeText(prop.Value)
+		common.Locale = prop.Parameter("LANGUAGE", common.Locale)
+	case "GEO":
+		coordinates := strings.Split(prop.Value, ";")
+		if len(coordinates) != 2 {
+			return false
+		}
+		common.location().Coordinates = "geo:" + coordinates[0] + "," + coordinates[1]
+	case "CATEGORIES":
+		if common.Keywords == nil {
+			common.Keywords = make(map[string]bool)
+		}
+		for _, keyword := range ics.SplitText(prop.Value) {
+			common.Keywords[keyword] = true
+		}
+	case "COLOR":
+		common.Color = prop.Value
+	case "CLASS":
+		privacy, ok := map[string]string{"PUBLIC": "public", "PRIVATE": "private", "CONFIDENTIAL": "secret"}[prop.Value]
+		if !ok {
+			return false
+		}
+		common.Privacy = privacy
+	case "TRANSP":
+		status, ok := map[string]string{"OPAQUE": "busy", "TRANSPARENT": "free"}[prop.Value]
+		if !ok {
+			return false
+		}
+		common.FreeBusyStatus = status
+	case "RRULE", "EXRULE":
+		rule, ok := c.recurrenceRule(prop.Value, common.TimeZone)
+		if !ok {
+			return false
+		}
+		if prop.Name == "RRULE" {
+			common.RecurrenceRules = append(common.RecurrenceRules, rule)
+		} else {
+			common.ExcludedRecurrenceRules = append(common.ExcludedRecurrenceRules, rule)
+		}
+	case "EXDATE", "RDATE":
+		// the excluded and added instances are overrides, excluded or without changes
+		if prop.Parameter("VALUE", "") == "PERIOD" {
+			return false
+		}
+		if common.RecurrenceOverrides == nil {
+			common.RecurrenceOverrides = make(map[string]PatchObject)
+		}
+		for _, value := range strings.Split(prop.Value, ",") {
+			instance := ics.NewProperty(prop.Name, value, prop.Parameters)
+			patch := PatchObject{}
+			if prop.Name == "EXDATE" {
+				patch["excluded"] = true
+			}
+			common.RecurrenceOverrides[c.localDateTimeIn(instance, common.TimeZone)] = patch
+		}
+	case "ATTENDEE":
+		if common.Participants == nil {
+			common.Participants = make(map[string]*Participant)
+		}
+		common.Participants[strconv.Itoa(len(common.Participants)+1)] = newParticipant(prop)
+	case "ORGANIZER":
+		// mapped once all the attendees are known
+	default:
+		return false
+	}
+
+	return true
+}
+
+// Maps the SUMMARY, DESCRIPTION or LOCATION property given in another language than the first one.
+func (c *converter) mapLocalization(common *Common, prop *ical.Node) bool {
+	paths := map[string]string{"SUMMARY": "title", "DESCRIPTION": "description", "LOCATION": "locations/1/name"}
+
+	language := prop.Parameter("LANGUAGE", "")
+	path, ok := paths[prop.Name]
+	if !ok || language == "" || language == common.Locale {
+		return false
+	}
+
+	if common.Localizations == nil {
+		common.Localizations = make(map[string]PatchObject)
+	}
+	if common.Localizations[language] == nil {
+		common.Localizations[language] = PatchObject{}
+	}
+	if _, exists := common.Localizations[language][path]; exists {
+		return false
+	}
+
+	common.Localizations[language][path] = ics.UnescapeText(prop.Value)
+	return true
+}
+
+// The organizer is the participant with the owner role, which is added when the organizer is not an attendee.
+func (c *converter) mapOrganizer(common *Common, prop *ical.Node) {
+	if prop == nil {
+		return
+	}
+
+	common.ReplyTo = map[string]string{sendToMethod(prop.Value): prop.Value}
+
+	for _, participant := range common.Participants {
+		if strings.EqualFold(participant.SendTo[sendToMethod(prop.Value)], prop.Value) {
+			participant.Roles["owner"] = true
+			return
+		}
+	}
+
+	if common.Participants == nil {
+		common.Participants = make(map[string]*Participant)
+	}
+	common.Participants[strconv.Itoa(len(common.Participants)+1)] = &Participant{
+		Type:   "Participant",
+		Name:   prop.Parameter("CN", ""),
+		Email:  email(prop.Value),
+		SendTo: map[string]string{sendToMethod(prop.Value): prop.Value},
+		Roles:  map[string]bool{"owner": true},
+	}
+}
+
+func (c *converter) mapAlert(common *Common, valarm *ical.Node) error {
+	alert := &Alert{Type: "Alert"}
+
+	var unmapped []*ical.Node
+	for _, child := range valarm.Children {
+		switch {
+		case ics.IsComponent(child):
+			unmapped = append(unmapped, child)
+		case child.Name == "ACTION" && (child.Value == "DISPLAY" || child.Value == "EMAIL") && alert.Action == "":
+			alert.Action = strings.ToLower(child.Value)
+		case child.Name == "TRIGGER" && alert.Trigger == nil:
+			alert.Trigger = c.trigger(child)
+			if alert.Trigger == nil {
+				unmapped = append(unmapped, child)
+			}
+		default:
+			unmapped = append(unmapped, child)
+		}
+	}
+
+	var err error
+	if alert.ICalComponent, err = iCalComponent(lib.VALARM, unmapped); err != nil {
+		return err
+	}
+
+	if common.Alerts == nil {
+		common.Alerts = make(map[string]*Alert)
+	}
+	common.Alerts[strconv.Itoa(len(common.Alerts)+1)] = alert
+
+	return nil
+}
+
+func (c *converter) trigger(prop *ical.Node) *Trigger {
+	if prop.Parameter("VALUE", "") == "DATE-TIME" {
+		var when string
+		if !c.utcDateTime(prop, &when) {
+			return nil
+		}
+		return &Trigger{Type: "AbsoluteTrigger", When: when}
+	}
+
+	if _, ok := ics.ParseDuration(prop.Value); !ok {
+		return nil
+	}
+
+	trigger := &Trigger{Type: "OffsetTrigger", Offset: prop.Value}
+	if prop.Parameter("RELATED", "") == "END" {
+		trigger.RelativeTo = "end"
+	}
+
+	return trigger
+}
+
+// Maps the DTEND of an event to its duration from the DTSTART.
+func (c *converter) mapDuration(comp, end *ical.Node, duration *string) bool {
+	start, ok := c.dateTime(ics.Property(comp, "DTSTART"))
+	if !ok {
+		return false
+	}
+
+	t, ok := c.dateTime(end)
+	if !ok || t.Before(start) {
+		return false
+	}
+
+	*duration = ics.FormatDuration(t.Sub(start))
+	return true
+}
+
+func (c *converter) recurrenceRule(value, timeZone string) (*RecurrenceRule, bool) {
+	rrule, err := ics.ParseRRule(value)
+	if err != nil {
+		return nil, false
+	}
+
+	rule := &RecurrenceRule{
+		Type:           "RecurrenceRule",
+		Frequency:      strings.ToLower(rrule.Freq),
+		Interval:       rrule.Interval,
+		Count:          rrule.Count,
+		FirstDayOfWeek: strings.ToLower(rrule.WeekStart),
+		ByMonthDay:     rrule.ByMonthDay,
+		BySetPosition:  rrule.BySetPos,
+	}
+
+	for _, month := range rrule.ByMonth {
+		rule.ByMonth = append(rule.ByMonth, strconv.Itoa(month))
+	}
+
+	for _, day := range rrule.ByDay {
+		if len(day) < 2 {
+			return nil, false
+		}
+
+		nday := &NDay{Type: "NDay", Day: strings.ToLower(day[len(day)-2:])}
+		if nth := strings.TrimPrefix(day[:len(day)-2], "+"); nth != "" {
+			if nday.NthOfPeriod, err = strconv.Atoi(nth); err != nil {
+				return nil, false
+			}
+		}
+		rule.ByDay = append(rule.ByDay, nday)
+	}
+
+	if rrule.Until != nil {
+		until := ics.NewProperty("UNTIL", rrule.Until.String(), nil)
+		if rrule.Until.TZID != "" {
+			until.Parameters["TZID"] = rrule.Until.TZID
+		}
+		rule.Until = c.localDateTimeIn(until, timeZone)
+	}
+
+	for name, value := range rrule.Parts {
+		var err error
+		switch name {
+		case "BYYEARDAY":
+			rule.ByYearDay, err = integers(value)
+		case "BYWEEKNO":
+			rule.ByWeekNo, err = integers(value)
+		case "BYHOUR":
+			rule.ByHour, err = integers(value)
+		case "BYMINUTE":
+			rule.ByMinute, err = integers(value)
+		case "BYSECOND":
+			rule.BySecond, err = integers(value)
+		case "RSCALE":
+			rule.RScale = strings.ToLower(value)
+		case "SKIP":
+			rule.Skip = strings.ToLower(value)
+		default:
+			return nil, false
+		}
+
+		if err != nil {
+			return nil, false
+		}
+	}
+
+	return rule, true
+}
+
+// Returns the absolute time of the DATE or DATE-TIME property.
+func (c *converter) dateTime(prop *ical.Node) (time.Time, bool) {
+	if prop == nil {
+		return time.Time{}, false
+	}
+
+	return c.ctx.DateTime(prop)
+}
+
+// Converts the DATE-TIME property to an UTCDateTime value.
+func (c *converter) utcDateTime(prop *ical.Node, value *string) bool {
+	t, ok := c.dateTime(prop)
+	if !ok {
+		return false
+	}
+
+	*value = t.Format(utcDateTimeLayout)
+	return true
+}
+
+// Returns the LocalDateTime of the DATE or DATE-TIME property in the given time zone, e.g. the one of the
+// start of the event. The values in other time zones are converted when the time zone is known.
+func (c *converter) localDateTimeIn(prop *ical.Node, timeZone string) string {
+	local, propTimeZone, date, ok := localDateTime(prop)
+	if !ok || date || propTimeZone == timeZone {
+		return local
+	}
+
+	t, ok := c.dateTime(prop)
+	if !ok {
+		return local
+	}
+
+	if timeZone == "" {
+		return t.Format(localDateTimeLayout)
+	}
+
+	location, err := time.LoadLocation(timeZone)
+	if err != nil {
+		return local
+	}
+
+	return t.In(location).Format(localDateTimeLayout)
+}
+
+// Returns the LocalDateTime of the DATE or DATE-TIME property, with its time zone and whether it is a date.
+// The time zone of the UTC values is Etc/UTC, and the one of the floating values is empty.
+func localDateTime(prop *ical.Node) (local, timeZone string, date, ok bool) {
+	layout := "20060102T150405"
+	switch {
+	case ics.IsDate(prop):
+		layout, date = "20060102", true
+	case strings.HasSuffix(prop.Value, "Z"):
+		layout, timeZone = "20060102T150405Z", utcTimeZone
+	default:
+		timeZone = prop.Parameter("TZID", "")
+	}
+
+	t, err := time.Parse(layout, prop.Value)
+	if err != nil {
+		return "", "", false, false
+	}
+
+	return t.Format(localDateTimeLayout), timeZone, date, true
+}
+
+// Returns the location of the component, which holds the LOCATION and the GEO properties.
+func (common *Common) location() *Location {
+	if common.Locations == nil {
+		common.Locations = map[string]*Location{"1": {Type: "Location"}}
+	}
+
+	return common.Locations["1"]
+}
+
+func newParticipant(prop *ical.Node) *Participant {
+	participant := &Participant{
+		Type:                "Participant",
+		Name:                prop.Parameter("CN", ""),
+		Email:               email(prop.Value),
+		SendTo:              map[string]string{sendToMethod(prop.Value): prop.Value},
+		Kind:                participantKinds[prop.Parameter("CUTYPE", "")],
+		Roles:               map[string]bool{},
+		ParticipationStatus: strings.ToLower(prop.Parameter("PARTSTAT", "")),
+		ExpectReply:         prop.Parameter("RSVP", "") == "TRUE",
+	}
+
+	switch prop.Parameter("ROLE", "") {
+	case "CHAIR":
+		participant.Roles["attendee"], participant.Roles["chair"] = true, true
+	case "OPT-PARTICIPANT":
+		participant.Roles["attendee"], participant.Roles["optional"] = true, true
+	case "NON-PARTICIPANT":
+		participant.Roles["informational"] = true
+	default:
+		participant.Roles["attendee"] = true
+	}
+
+	return participant
+}
+
+// The kinds of the participants, by CUTYPE.
+var participantKinds = map[string]string{
+	"INDIVIDUAL": "individual",
+	"GROUP":      "group",
+	"RESOURCE":   "resource",
+	"ROOM":       "location",
+	"UNKNOWN":    "unknown",
+}
+
+// The calendar user addresses are sent with iMIP when they are emails, or by other means otherwise.
+func sendToMethod(address string) string {
+	if email(address) != "" {
+		return "imip"
+	}
+
+	return "other"
+}
+
+func email(address string) string {
+	if len(address) > len("mailto:") && strings.EqualFold(address[:len("mailto:")], "mailto:") {
+		return address[len("mailto:"):]
+	}
+
+	return ""
+}
+
+func integer(prop *ical.Node, value *int) bool {
+	n, err := strconv.Atoi(prop.Value)
+	if err != nil {
+		return false
+	}
+
+	*value = n
+	return true
+}
+
+func integers(value string) ([]int, error) {
+	var result []int
+	for _, v := range strings.Split(value, ",") {
+		n, err := strconv.Atoi(strings.TrimPrefix(v, "+"))
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, n)
+	}
+
+	return result, nil
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+
+	return false
+}
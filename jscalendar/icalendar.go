@@ -0,0 +1,521 @@
+package jscalendar
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/laurent22/ical-go"
+
+	"github.com/samedi/caldav-go/ics"
+	"github.com/samedi/caldav-go/lib"
+)
+
+// ToICalendar converts the JSCalendar object to a VCALENDAR object: a Group to a calendar with all its
+// entries, and an Event or a Task to a calendar with its VEVENT or VTODO, followed by its overridden instances.
+// The calendar properties and components kept in the `ICalComponent` of the object are added back.
+func ToICalendar(obj Object) (*ical.Node, error) {
+	cal := ics.NewComponent(lib.VCALENDAR, ics.NewProperty("VERSION", "2.0", nil))
+
+	prodID := ics.PRODID
+	var entries []Object
+	var unmapped []*ical.Node
+	switch obj := obj.(type) {
+	case *Group:
+		if obj.ProdID != "" {
+			prodID = obj.ProdID
+		}
+		entries = obj.Entries
+	case *Event, *Task:
+		if common := commonOf(obj); common.ProdID != "" {
+			prodID = common.ProdID
+		}
+		entry, calendarChildren, err := splitICalComponent(obj)
+		if err != nil {
+			return nil, err
+		}
+		entries = []Object{entry}
+		unmapped = calendarChildren
+	default:
+		return nil, errors.New("jscalendar: unsupported object")
+	}
+
+	ics.AddProperty(cal, ics.NewProperty("PRODID", prodID, nil))
+	for _, entry := range entries {
+		if method := commonOf(entry).Method; method != "" {
+			ics.AddProperty(cal, ics.NewProperty("METHOD", strings.ToUpper(method), nil))
+			break
+		}
+	}
+
+	if group, ok := obj.(*Group); ok {
+		if group.Title != "" {
+			ics.AddProperty(cal, ics.NewProperty("NAME", ics.EscapeText(group.Title), nil))
+		}
+		if err := addICalComponent(cal, group.ICalComponent); err != nil {
+			return nil, err
+		}
+	}
+	cal.Children = append(cal.Children, unmapped...)
+
+	for _, entry := range entries {
+		comps, err := entryComponents(entry)
+		if err != nil {
+			return nil, err
+		}
+		cal.Children = append(cal.Children, comps...)
+	}
+
+	return cal, nil
+}
+
+// Separates the calendar properties and components kept in the `ICalComponent` of an Event or a Task, when
+// it is a VCALENDAR (see `Convert`), from the ones of its own component. It returns a copy of the object with
+// only the latter in its `ICalComponent`, and the former.
+func splitICalComponent(entry Object) (Object, []*ical.Node, error) {
+	common := commonOf(entry)
+	if len(common.ICalComponent) == 0 {
+		return entry, nil, nil
+	}
+
+	jcal, err := ics.ParseJCal(common.ICalComponent)
+	if err != nil || jcal.Name != lib.VCALENDAR {
+		return entry, nil, err
+	}
+
+	name := lib.VEVENT
+	if _, ok := entry.(*Task); ok {
+		name = lib.VTODO
+	}
+
+	var own json.RawMessage
+	var unmapped []*ical.Node
+	for _, child := range jcal.Children {
+		if child.Name == name && own == nil {
+			if own, err = ics.MarshalJCal(child); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+		unmapped = append(unmapped, child)
+	}
+
+	switch entry := entry.(type) {
+	case *Event:
+		event := *entry
+		event.ICalComponent = own
+		return &event, unmapped, nil
+	case *Task:
+		task := *entry
+		task.ICalComponent = own
+		return &task, unmapped, nil
+	}
+
+	return entry, unmapped, nil
+}
+
+// Returns the components of an event or task: the master component and its overridden instances.
+// The excluded instances become EXDATEs of the master and the instances without changes RDATEs.
+func entryComponents(entry Object) ([]*ical.Node, error) {
+	common := commonOf(entry)
+	if common == nil {
+		return nil, errors.New("jscalendar: groups cannot be entries of groups")
+	}
+
+	master, err := componentNode(entry)
+	if err != nil {
+		return nil, err
+	}
+	comps := []*ical.Node{master}
+
+	keys := make([]string, 0, len(common.RecurrenceOverrides))
+	for key := range common.RecurrenceOverrides {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		patch := common.RecurrenceOverrides[key]
+		if excluded, _ := patch["excluded"].(bool); excluded {
+			ics.AddProperty(master, timeProperty("EXDATE", key, common.TimeZone, common.ShowWithoutTime))
+			continue
+		}
+		if len(patch) == 0 {
+			ics.AddProperty(master, timeProperty("RDATE", key, common.TimeZone, common.ShowWithoutTime))
+			continue
+		}
+
+		override, err := overrideOf(entry, key, patch)
+		if err != nil {
+			return nil, err
+		}
+		comp, err := componentNode(override)
+		if err != nil {
+			return nil, err
+		}
+		comps = append(comps, comp)
+	}
+
+	return comps, nil
+}
+
+// Returns the overridden instance of the event or task: the master object with the patch applied.
+func overrideOf(entry Object, recurrenceID string, patch PatchObject) (Object, error) {
+	m, err := toMap(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range []string{"recurrenceRules", "excludedRecurrenceRules", "recurrenceOverrides"} {
+		delete(m, name)
+	}
+	if err := applyPatch(m, patch); err != nil {
+		return nil, err
+	}
+	m["recurrenceId"] = recurrenceID
+	m["recurrenceIdTimeZone"] = commonOf(entry).TimeZone
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+
+	return Unmarshal(data)
+}
+
+// Converts an Event to a VEVENT or a Task to a VTODO, without the overridden instances.
+func componentNode(obj Object) (*ical.Node, error) {
+	common := commonOf(obj)
+
+	comp := ics.NewComponent(lib.VEVENT)
+	if _, ok := obj.(*Task); ok {
+		comp = ics.NewComponent(lib.VTODO)
+	}
+
+	add := func(name, value string, params map[string]string) {
+		if value != "" {
+			ics.AddProperty(comp, ics.NewProperty(name, value, params))
+		}
+	}
+	language := func(locale string) map[string]string {
+		if locale == "" {
+			return nil
+		}
+		return map[string]string{"LANGUAGE": locale}
+	}
+
+	add("UID", common.UID, nil)
+	if common.Start != "" {
+		ics.AddProperty(comp, timeProperty("DTSTART", common.Start, common.TimeZone, common.ShowWithoutTime))
+	}
+	if common.RecurrenceID != "" {
+		ics.AddProperty(comp, timeProperty("RECURRENCE-ID", common.RecurrenceID, common.RecurrenceIDTimeZone, common.ShowWithoutTime))
+	}
+	add("CREATED", utcValue(common.Created), nil)
+	add("LAST-MODIFIED", utcValue(common.Updated), nil)
+	if common.Sequence != 0 {
+		add("SEQUENCE", strconv.Itoa(common.Sequence), nil)
+	}
+	if common.Priority != 0 {
+		add("PRIORITY", strconv.Itoa(common.Priority), nil)
+	}
+
+	add("SUMMARY", ics.EscapeText(common.Title), language(common.Locale))
+	add("DESCRIPTION", ics.EscapeText(common.Description), language(common.Locale))
+	for _, id := range sortedKeys(common.Locations) {
+		location := common.Locations[id]
+		add("LOCATION", ics.EscapeText(location.Name), language(common.Locale))
+		if coordinates := strings.Split(strings.TrimPrefix(location.Coordinates, "geo:"), ","); len(coordinates) == 2 {
+			add("GEO", coordinates[0]+";"+coordinates[1], nil)
+		}
+	}
+	for _, locale := range sortedKeys(common.Localizations) {
+		for _, path := range sortedKeys(common.Localizations[locale]) {
+			text, _ := common.Localizations[locale][path].(string)
+			switch {
+			case path == "title":
+				add("SUMMARY", ics.EscapeText(text), language(locale))
+			case path == "description":
+				add("DESCRIPTION", ics.EscapeText(text), language(locale))
+			case strings.HasPrefix(path, "locations/") && strings.HasSuffix(path, "/name"):
+				add("LOCATION", ics.EscapeText(text), language(locale))
+			}
+		}
+	}
+
+	if len(common.Keywords) > 0 {
+		var keywords []string
+		for _, keyword := range sortedKeys(common.Keywords) {
+			keywords = append(keywords, ics.EscapeText(keyword))
+		}
+		add("CATEGORIES", strings.Join(keywords, ","), nil)
+	}
+	add("COLOR", common.Color, nil)
+	add("CLASS", map[string]string{"public": "PUBLIC", "private": "PRIVATE", "secret": "CONFIDENTIAL"}[common.Privacy], nil)
+	add("TRANSP", map[string]string{"busy": "OPAQUE", "free": "TRANSPARENT"}[common.FreeBusyStatus], nil)
+
+	for _, rule := range common.RecurrenceRules {
+		add("RRULE", rruleValue(rule, common.TimeZone, common.ShowWithoutTime), nil)
+	}
+	for _, rule := range common.ExcludedRecurrenceRules {
+		add("EXRULE", rruleValue(rule, common.TimeZone, common.ShowWithoutTime), nil)
+	}
+
+	switch obj := obj.(type) {
+	case *Event:
+		add("DURATION", obj.Duration, nil)
+		add("STATUS", strings.ToUpper(obj.Status), nil)
+	case *Task:
+		if obj.Due != "" {
+			ics.AddProperty(comp, timeProperty("DUE", obj.Due, obj.TimeZone, obj.ShowWithoutTime))
+		}
+		add("DURATION", obj.EstimatedDuration, nil)
+		if obj.PercentComplete != 0 {
+			add("PERCENT-COMPLETE", strconv.Itoa(obj.PercentComplete), nil)
+		}
+		add("STATUS", strings.ToUpper(obj.Progress), nil)
+	}
+
+	addParticipants(comp, common)
+
+	// the properties and components without mapping, e.g. the DTSTAMP, which is added when missing
+	if err := addICalComponent(comp, common.ICalComponent); err != nil {
+		return nil, err
+	}
+	if ics.Property(comp, "DTSTAMP") == nil {
+		stamp := time.Now().UTC().Format("20060102T150405Z")
+		if common.Updated != "" {
+			stamp = utcValue(common.Updated)
+		}
+		ics.AddProperty(comp, ics.NewProperty("DTSTAMP", stamp, nil))
+	}
+
+	for _, id := range sortedKeys(common.Alerts) {
+		valarm, err := alarmNode(common.Alerts[id])
+		if err != nil {
+			return nil, err
+		}
+		comp.Children = append(comp.Children, valarm)
+	}
+
+	return comp, nil
+}
+
+// Adds the ORGANIZER, given by the replyTo address or else by the participant with the owner role,
+// and an ATTENDEE per participant that is not only the owner.
+func addParticipants(comp *ical.Node, common *Common) {
+	organizer := common.ReplyTo["imip"]
+	if organizer == "" {
+		organizer = common.ReplyTo["other"]
+	}
+
+	var owner *Participant
+	for _, id := range sortedKeys(common.Participants) {
+		participant := common.Participants[id]
+		if participant.Roles["owner"] && (organizer == "" || strings.EqualFold(participantAddress(participant), organizer)) {
+			owner = participant
+			break
+		}
+	}
+
+	if organizer == "" && owner != nil {
+		organizer = participantAddress(owner)
+	}
+	if organizer != "" {
+		params := make(map[string]string)
+		if owner != nil && owner.Name != "" {
+			params["CN"] = owner.Name
+		}
+		ics.AddProperty(comp, ics.NewProperty("ORGANIZER", organizer, params))
+	}
+
+	for _, id := range sortedKeys(common.Participants) {
+		participant := common.Participants[id]
+		if participant.Roles["owner"] && len(participant.Roles) == 1 {
+			continue
+		}
+
+		address := participantAddress(participant)
+		if address == "" {
+			continue
+		}
+
+		params := make(map[string]string)
+		if participant.Name != "" {
+			params["CN"] = participant.Name
+		}
+		for cutype, kind := range participantKinds {
+			if participant.Kind == kind {
+				params["CUTYPE"] = cutype
+			}
+		}
+		switch {
+		case participant.Roles["chair"]:
+			params["ROLE"] = "CHAIR"
+		case participant.Roles["optional"]:
+			params["ROLE"] = "OPT-PARTICIPANT"
+		case participant.Roles["informational"] && !participant.Roles["attendee"]:
+			params["ROLE"] = "NON-PARTICIPANT"
+		}
+		if participant.ParticipationStatus != "" {
+			params["PARTSTAT"] = strings.ToUpper(participant.ParticipationStatus)
+		}
+		if participant.ExpectReply {
+			params["RSVP"] = "TRUE"
+		}
+
+		ics.AddProperty(comp, ics.NewProperty("ATTENDEE", address, params))
+	}
+}
+
+// Returns the calendar user address of the participant: its iMIP address, its email or any other address.
+func participantAddress(participant *Participant) string {
+	if address := participant.SendTo["imip"]; address != "" {
+		return address
+	}
+	if participant.Email != "" {
+		return "mailto:" + participant.Email
+	}
+
+	return participant.SendTo["other"]
+}
+
+func alarmNode(alert *Alert) (*ical.Node, error) {
+	valarm := ics.NewComponent(lib.VALARM)
+	if alert.Action != "" {
+		ics.AddProperty(valarm, ics.NewProperty("ACTION", strings.ToUpper(alert.Action), nil))
+	}
+
+	if trigger := alert.Trigger; trigger != nil {
+		switch trigger.Type {
+		case "AbsoluteTrigger":
+			ics.AddProperty(valarm, ics.NewProperty("TRIGGER", utcValue(trigger.When), map[string]string{"VALUE": "DATE-TIME"}))
+		case "OffsetTrigger":
+			params := make(map[string]string)
+			if trigger.RelativeTo == "end" {
+				params["RELATED"] = "END"
+			}
+			ics.AddProperty(valarm, ics.NewProperty("TRIGGER", trigger.Offset, params))
+		}
+	}
+
+	err := addICalComponent(valarm, alert.ICalComponent)
+	return valarm, err
+}
+
+// Adds to the component the properties and components of the jCal of the `iCalComponent` property.
+func addICalComponent(comp *ical.Node, jcal json.RawMessage) error {
+	if len(jcal) == 0 {
+		return nil
+	}
+
+	unmapped, err := ics.ParseJCal(jcal)
+	if err != nil {
+		return err
+	}
+
+	comp.Children = append(comp.Children, unmapped.Children...)
+	return nil
+}
+
+func rruleValue(rule *RecurrenceRule, timeZone string, date bool) string {
+	parts := []string{"FREQ=" + strings.ToUpper(rule.Frequency)}
+	add := func(name, value string) {
+		if value != "" {
+			parts = append(parts, name+"="+value)
+		}
+	}
+	ints := func(values []int) string {
+		s := make([]string, len(values))
+		for i, v := range values {
+			s[i] = strconv.Itoa(v)
+		}
+		return strings.Join(s, ",")
+	}
+
+	if rule.Interval != 0 {
+		add("INTERVAL", strconv.Itoa(rule.Interval))
+	}
+	if rule.Count != 0 {
+		add("COUNT", strconv.Itoa(rule.Count))
+	}
+	if rule.Until != "" {
+		until := timeProperty("UNTIL", rule.Until, timeZone, date)
+		// the UNTIL of the rules of local times is in UTC (RFC5545#3.3.10)
+		if tzid := until.Parameter("TZID", ""); tzid != "" {
+			if location, err := time.LoadLocation(tzid); err == nil {
+				t, _ := time.ParseInLocation(localDateTimeLayout, rule.Until, location)
+				until.Value = t.UTC().Format("20060102T150405Z")
+			}
+		}
+		add("UNTIL", until.Value)
+	}
+
+	var days []string
+	for _, day := range rule.ByDay {
+		nth := ""
+		if day.NthOfPeriod != 0 {
+			nth = strconv.Itoa(day.NthOfPeriod)
+		}
+		days = append(days, nth+strings.ToUpper(day.Day))
+	}
+	add("BYDAY", strings.Join(days, ","))
+	add("BYMONTHDAY", ints(rule.ByMonthDay))
+	add("BYMONTH", strings.Join(rule.ByMonth, ","))
+	add("BYYEARDAY", ints(rule.ByYearDay))
+	add("BYWEEKNO", ints(rule.ByWeekNo))
+	add("BYHOUR", ints(rule.ByHour))
+	add("BYMINUTE", ints(rule.ByMinute))
+	add("BYSECOND", ints(rule.BySecond))
+	add("BYSETPOS", ints(rule.BySetPosition))
+	add("WKST", strings.ToUpper(rule.FirstDayOfWeek))
+	add("RSCALE", strings.ToUpper(rule.RScale))
+	add("SKIP", strings.ToUpper(rule.Skip))
+
+	return strings.Join(parts, ";")
+}
+
+// Returns the DATE or DATE-TIME property of the LocalDateTime in the given time zone: a date when `date` is
+// true, an UTC time in the Etc/UTC time zone, a floating time without time zone or else a local time.
+func timeProperty(name, local, timeZone string, date bool) *ical.Node {
+	t, err := time.Parse(localDateTimeLayout, local)
+	if err != nil {
+		return ics.NewProperty(name, local, nil)
+	}
+
+	switch {
+	case date:
+		return ics.NewProperty(name, t.Format("20060102"), map[string]string{"VALUE": "DATE"})
+	case timeZone == utcTimeZone || timeZone == "UTC":
+		return ics.NewProperty(name, t.Format("20060102T150405Z"), nil)
+	case timeZone == "":
+		return ics.NewProperty(name, t.Format("20060102T150405"), nil)
+	}
+
+	return ics.NewProperty(name, t.Format("20060102T150405"), map[string]string{"TZID": timeZone})
+}
+
+// Converts an UTCDateTime to its DATE-TIME value.
+func utcValue(value string) string {
+	t, err := time.Parse(utcDateTimeLayout, value)
+	if err != nil {
+		return value
+	}
+
+	return t.Format("20060102T150405Z")
+}
+
+// Returns the keys of the map, sorted.
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	for _, key := range reflect.ValueOf(m).MapKeys() {
+		keys = append(keys, key.String())
+	}
+	sort.Strings(keys)
+
+	return keys
+}
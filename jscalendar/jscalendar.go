@@ -0,0 +1,235 @@
+// Package jscalendar converts the iCalendar data to JSCalendar (RFC8984), the JSON representation of
+// calendar data, and back. The mapping between both follows the rules of the JSCalendar to iCalendar
+// draft (draft-ietf-calext-jscalendar-icalendar): the overridden instances of the recurring events become
+// patches of the master event, the attendees and the organizer become participants, and the properties
+// given in other languages become localizations.
+package jscalendar
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// MediaType is the media type of the JSCalendar data (RFC8984#3.1). Its `type` parameter
+// gives the type of the object: event, task or group.
+const MediaType = "application/jscalendar+json"
+
+// The types of the JSCalendar objects.
+const (
+	TypeEvent = "Event"
+	TypeTask  = "Task"
+	TypeGroup = "Group"
+)
+
+// Object is a JSCalendar object: an *Event, a *Task or a *Group.
+type Object interface {
+	// ObjectType returns the type of the object, e.g. "Event".
+	ObjectType() string
+}
+
+// Common holds the properties shared by the events and the tasks (RFC8984#4).
+type Common struct {
+	Type                    string                  `json:"@type"`
+	UID                     string                  `json:"uid"`
+	ProdID                  string                  `json:"prodId,omitempty"`
+	Method                  string                  `json:"method,omitempty"`
+	Created                 string                  `json:"created,omitempty"`
+	Updated                 string                  `json:"updated,omitempty"`
+	Sequence                int                     `json:"sequence,omitempty"`
+	Title                   string                  `json:"title,omitempty"`
+	Description             string                  `json:"description,omitempty"`
+	Locations               map[string]*Location    `json:"locations,omitempty"`
+	Keywords                map[string]bool         `json:"keywords,omitempty"`
+	Color                   string                  `json:"color,omitempty"`
+	Locale                  string                  `json:"locale,omitempty"`
+	Localizations           map[string]PatchObject  `json:"localizations,omitempty"`
+	Start                   string                  `json:"start,omitempty"`
+	TimeZone                string                  `json:"timeZone,omitempty"`
+	ShowWithoutTime         bool                    `json:"showWithoutTime,omitempty"`
+	RecurrenceID            string                  `json:"recurrenceId,omitempty"`
+	RecurrenceIDTimeZone    string                  `json:"recurrenceIdTimeZone,omitempty"`
+	RecurrenceRules         []*RecurrenceRule       `json:"recurrenceRules,omitempty"`
+	ExcludedRecurrenceRules []*RecurrenceRule       `json:"excludedRecurrenceRules,omitempty"`
+	RecurrenceOverrides     map[string]PatchObject  `json:"recurrenceOverrides,omitempty"`
+	Excluded                bool                    `json:"excluded,omitempty"`
+	Priority                int                     `json:"priority,omitempty"`
+	FreeBusyStatus          string                  `json:"freeBusyStatus,omitempty"`
+	Privacy                 string                  `json:"privacy,omitempty"`
+	ReplyTo                 map[string]string       `json:"replyTo,omitempty"`
+	Participants            map[string]*Participant `json:"participants,omitempty"`
+	Alerts                  map[string]*Alert       `json:"alerts,omitempty"`
+	// ICalComponent is the jCal representation (RFC7265) of the component with the iCalendar properties and
+	// sub components that have no JSCalendar mapping, e.g. the DTSTAMP or the X- properties. For the objects
+	// converted from a calendar with VTIMEZONEs or properties without mapping, it is the jCal of a VCALENDAR
+	// with them and with the component of the object.
+	ICalComponent json.RawMessage `json:"iCalComponent,omitempty"`
+}
+
+// Event is a JSCalendar event (RFC8984#5.1), the counterpart of the VEVENT components.
+type Event struct {
+	Common
+	Duration string `json:"duration,omitempty"`
+	Status   string `json:"status,omitempty"`
+}
+
+// ObjectType returns "Event".
+func (event *Event) ObjectType() string {
+	return TypeEvent
+}
+
+// Task is a JSCalendar task (RFC8984#5.2), the counterpart of the VTODO components.
+type Task struct {
+	Common
+	Due               string `json:"due,omitempty"`
+	EstimatedDuration string `json:"estimatedDuration,omitempty"`
+	PercentComplete   int    `json:"percentComplete,omitempty"`
+	Progress          string `json:"progress,omitempty"`
+}
+
+// ObjectType returns "Task".
+func (task *Task) ObjectType() string {
+	return TypeTask
+}
+
+// Group is a JSCalendar group (RFC8984#5.3), a collection of events and tasks.
+type Group struct {
+	Type    string   `json:"@type"`
+	UID     string   `json:"uid"`
+	ProdID  string   `json:"prodId,omitempty"`
+	Title   string   `json:"title,omitempty"`
+	Entries []Object `json:"entries"`
+	// ICalComponent is the jCal representation of the calendar with its properties that have no JSCalendar mapping
+	// and its components that are not entries, e.g. the VTIMEZONEs.
+	ICalComponent json.RawMessage `json:"iCalComponent,omitempty"`
+}
+
+// ObjectType returns "Group".
+func (group *Group) ObjectType() string {
+	return TypeGroup
+}
+
+// UnmarshalJSON decodes the group with each entry decoded by its type.
+func (group *Group) UnmarshalJSON(data []byte) error {
+	type plainGroup Group
+	var decoded struct {
+		plainGroup
+		Entries []json.RawMessage `json:"entries"`
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+
+	*group = Group(decoded.plainGroup)
+	group.Entries = nil
+	for _, entry := range decoded.Entries {
+		obj, err := Unmarshal(entry)
+		if err != nil {
+			return err
+		}
+		if _, nested := obj.(*Group); nested {
+			return errors.New("jscalendar: groups cannot be entries of groups")
+		}
+		group.Entries = append(group.Entries, obj)
+	}
+
+	return nil
+}
+
+// Location is a location of an event or task (RFC8984#4.2.5).
+type Location struct {
+	Type        string `json:"@type"`
+	Name        string `json:"name,omitempty"`
+	Coordinates string `json:"coordinates,omitempty"`
+}
+
+// RecurrenceRule is a recurrence rule (RFC8984#4.3.3), the counterpart of the RRULE properties.
+type RecurrenceRule struct {
+	Type           string   `json:"@type"`
+	Frequency      string   `json:"frequency"`
+	Interval       int      `json:"interval,omitempty"`
+	RScale         string   `json:"rscale,omitempty"`
+	Skip           string   `json:"skip,omitempty"`
+	FirstDayOfWeek string   `json:"firstDayOfWeek,omitempty"`
+	ByDay          []*NDay  `json:"byDay,omitempty"`
+	ByMonthDay     []int    `json:"byMonthDay,omitempty"`
+	ByMonth        []string `json:"byMonth,omitempty"`
+	ByYearDay      []int    `json:"byYearDay,omitempty"`
+	ByWeekNo       []int    `json:"byWeekNo,omitempty"`
+	ByHour         []int    `json:"byHour,omitempty"`
+	ByMinute       []int    `json:"byMinute,omitempty"`
+	BySecond       []int    `json:"bySecond,omitempty"`
+	BySetPosition  []int    `json:"bySetPosition,omitempty"`
+	Count          int      `json:"count,omitempty"`
+	Until          string   `json:"until,omitempty"`
+}
+
+// NDay is a day of the week of a recurrence rule, optionally the nth of the period (RFC8984#4.3.3).
+type NDay struct {
+	Type        string `json:"@type"`
+	Day         string `json:"day"`
+	NthOfPeriod int    `json:"nthOfPeriod,omitempty"`
+}
+
+// Participant is a participant of an event or task (RFC8984#4.4.6), the counterpart of the
+// ATTENDEE and ORGANIZER properties.
+type Participant struct {
+	Type                string            `json:"@type"`
+	Name                string            `json:"name,omitempty"`
+	Email               string            `json:"email,omitempty"`
+	SendTo              map[string]string `json:"sendTo,omitempty"`
+	Kind                string            `json:"kind,omitempty"`
+	Roles               map[string]bool   `json:"roles,omitempty"`
+	ParticipationStatus string            `json:"participationStatus,omitempty"`
+	ExpectReply         bool              `json:"expectReply,omitempty"`
+}
+
+// Alert is an alert of an event or task (RFC8984#4.5.2), the counterpart of the VALARM components.
+type Alert struct {
+	Type    string   `json:"@type"`
+	Trigger *Trigger `json:"trigger"`
+	Action  string   `json:"action,omitempty"`
+	// ICalComponent is the jCal representation of the VALARM with its properties that have no JSCalendar mapping.
+	ICalComponent json.RawMessage `json:"iCalComponent,omitempty"`
+}
+
+// Trigger is the trigger of an alert: an OffsetTrigger, with the offset from the start or end of the
+// event or task, or an AbsoluteTrigger, with the UTC time of the alert.
+type Trigger struct {
+	Type       string `json:"@type"`
+	Offset     string `json:"offset,omitempty"`
+	RelativeTo string `json:"relativeTo,omitempty"`
+	When       string `json:"when,omitempty"`
+}
+
+// PatchObject is a set of changes to an object (RFC8984#1.4.9). The keys are the paths of the changed
+// properties, e.g. "title" or "locations/1/name", and a nil value removes the property.
+type PatchObject map[string]interface{}
+
+// Unmarshal decodes a JSCalendar object, choosing its type by its "@type" property.
+func Unmarshal(data []byte) (Object, error) {
+	var typed struct {
+		Type string `json:"@type"`
+	}
+	if err := json.Unmarshal(data, &typed); err != nil {
+		return nil, err
+	}
+
+	var obj Object
+	switch typed.Type {
+	case TypeEvent:
+		obj = &Event{}
+	case TypeTask:
+		obj = &Task{}
+	case TypeGroup:
+		obj = &Group{}
+	default:
+		return nil, fmt.Errorf("jscalendar: unsupported object type %q", typed.Type)
+	}
+
+	if err := json.Unmarshal(data, obj); err != nil {
+		return nil, err
+	}
+
+	return obj, nil
+}
@@ -0,0 +1,328 @@
+package jscalendar
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/samedi/caldav-go/ics"
+)
+
+const meeting = `BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:-//test//test//EN
+BEGIN:VEVENT
+UID:meeting-1
+DTSTAMP:20170101T100000Z
+DTSTART;TZID=Europe/Berlin:20170102T100000
+DTEND;TZID=Europe/Berlin:20170102T110000
+RRULE:FREQ=WEEKLY;COUNT=4;BYDAY=MO
+EXDATE;TZID=Europe/Berlin:20170109T100000
+SUMMARY;LANGUAGE=en:Meeting
+SUMMARY;LANGUAGE=de:Besprechung
+LOCATION:Room 1
+CATEGORIES:work,weekly
+ORGANIZER;CN=Alice:mailto:alice@example.com
+ATTENDEE;CN=Bob;ROLE=OPT-PARTICIPANT;PARTSTAT=NEEDS-ACTION;RSVP=TRUE:mailto:bob@example.org
+X-CUSTOM:kept
+BEGIN:VALARM
+ACTION:DISPLAY
+TRIGGER:-PT15M
+DESCRIPTION:Reminder
+END:VALARM
+END:VEVENT
+BEGIN:VEVENT
+UID:meeting-1
+DTSTAMP:20170101T100000Z
+RECURRENCE-ID;TZID=Europe/Berlin:20170116T100000
+DTSTART;TZID=Europe/Berlin:20170116T120000
+DTEND;TZID=Europe/Berlin:20170116T130000
+RRULE:FREQ=WEEKLY;COUNT=4;BYDAY=MO
+SUMMARY;LANGUAGE=en:Meeting
+SUMMARY;LANGUAGE=de:Besprechung
+LOCATION:Room 2
+CATEGORIES:work,weekly
+ORGANIZER;CN=Alice:mailto:alice@example.com
+ATTENDEE;CN=Bob;ROLE=OPT-PARTICIPANT;PARTSTAT=NEEDS-ACTION;RSVP=TRUE:mailto:bob@example.org
+X-CUSTOM:kept
+BEGIN:VALARM
+ACTION:DISPLAY
+TRIGGER:-PT15M
+DESCRIPTION:Reminder
+END:VALARM
+END:VEVENT
+END:VCALENDAR`
+
+const todos = `BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:-//test//test//EN
+NAME:Chores
+BEGIN:VTODO
+UID:todo-1
+DTSTAMP:20170101T100000Z
+DUE;VALUE=DATE:20170105
+SUMMARY:Groceries
+PERCENT-COMPLETE:50
+STATUS:IN-PROCESS
+END:VTODO
+BEGIN:VTODO
+UID:todo-2
+DTSTAMP:20170101T100000Z
+DUE:20170106T120000Z
+SUMMARY:Laundry
+PRIORITY:1
+END:VTODO
+END:VCALENDAR`
+
+func convert(t *testing.T, data string) Object {
+	cal, err := ics.Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	obj, err := Convert(cal)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return obj
+}
+
+func TestConvertEvent(t *testing.T) {
+	event, ok := convert(t, meeting).(*Event)
+	if !ok {
+		t.Fatal("Expected an Event")
+	}
+
+	if event.UID != "meeting-1" || event.ProdID != "-//test//test//EN" || event.Title != "Meeting" || event.Locale != "en" {
+		t.Errorf("Wrong event: %+v", event)
+	}
+	if event.Start != "2017-01-02T10:00:00" || event.TimeZone != "Europe/Berlin" || event.Duration != "PT1H" {
+		t.Errorf("Wrong times: %s %s %s", event.Start, event.TimeZone, event.Duration)
+	}
+	if event.Localizations["de"]["title"] != "Besprechung" {
+		t.Error("Wrong localizations:", event.Localizations)
+	}
+	if !reflect.DeepEqual(event.Keywords, map[string]bool{"work": true, "weekly": true}) {
+		t.Error("Wrong keywords:", event.Keywords)
+	}
+
+	rule := event.RecurrenceRules[0]
+	if rule.Frequency != "weekly" || rule.Count != 4 || rule.ByDay[0].Day != "mo" {
+		t.Errorf("Wrong recurrence rule: %+v", rule)
+	}
+
+	// the EXDATE is an excluded instance and the overridden instance a patch of the changes only
+	overrides := event.RecurrenceOverrides
+	if len(overrides) != 2 || overrides["2017-01-09T10:00:00"]["excluded"] != true {
+		t.Error("Wrong overrides:", overrides)
+	}
+	patch := overrides["2017-01-16T10:00:00"]
+	if len(patch) != 2 || patch["start"] != "2017-01-16T12:00:00" || patch["locations"] == nil {
+		t.Error("Wrong patch:", patch)
+	}
+
+	// the organizer is the owner and the attendee an optional participant
+	if event.ReplyTo["imip"] != "mailto:alice@example.com" || len(event.Participants) != 2 {
+		t.Error("Wrong participants:", event.ReplyTo, event.Participants)
+	}
+	for _, participant := range event.Participants {
+		switch participant.Email {
+		case "alice@example.com":
+			if participant.Name != "Alice" || !reflect.DeepEqual(participant.Roles, map[string]bool{"owner": true}) {
+				t.Errorf("Wrong organizer: %+v", participant)
+			}
+		case "bob@example.org":
+			if participant.Name != "Bob" || !participant.Roles["optional"] || participant.ParticipationStatus != "needs-action" || !participant.ExpectReply {
+				t.Errorf("Wrong attendee: %+v", participant)
+			}
+		default:
+			t.Errorf("Unexpected participant: %+v", participant)
+		}
+	}
+
+	alert := event.Alerts["1"]
+	if alert == nil || alert.Action != "display" || alert.Trigger.Type != "OffsetTrigger" || alert.Trigger.Offset != "-PT15M" {
+		t.Errorf("Wrong alert: %+v", alert)
+	}
+
+	// the properties without mapping are kept in jCal
+	unmapped := `["vevent",[["dtstamp",{},"date-time","2017-01-01T10:00:00Z"],["x-custom",{},"unknown","kept"]],[]]`
+	if string(event.ICalComponent) != unmapped {
+		t.Error("Wrong unmapped properties:", string(event.ICalComponent))
+	}
+}
+
+func TestConvertGroup(t *testing.T) {
+	group, ok := convert(t, todos).(*Group)
+	if !ok {
+		t.Fatal("Expected a Group")
+	}
+
+	if group.Title != "Chores" || group.UID == "" || len(group.Entries) != 2 {
+		t.Fatalf("Wrong group: %+v", group)
+	}
+
+	task := group.Entries[0].(*Task)
+	if task.UID != "todo-1" || task.Due != "2017-01-05T00:00:00" || !task.ShowWithoutTime || task.PercentComplete != 50 || task.Progress != "in-process" {
+		t.Errorf("Wrong task: %+v", task)
+	}
+
+	task = group.Entries[1].(*Task)
+	if task.UID != "todo-2" || task.Due != "2017-01-06T12:00:00" || task.TimeZone != "Etc/UTC" || task.Priority != 1 {
+		t.Errorf("Wrong task: %+v", task)
+	}
+
+	if _, err := Convert(ics.NewCalendar()); err != ErrNoEntries {
+		t.Error("Expected an error for a calendar without entries, got", err)
+	}
+}
+
+func TestToICalendar(t *testing.T) {
+	cal, err := ToICalendar(convert(t, meeting))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//test//test//EN",
+		"BEGIN:VEVENT",
+		"UID:meeting-1",
+		"DTSTART;TZID=Europe/Berlin:20170102T100000",
+		"SUMMARY;LANGUAGE=en:Meeting",
+		"LOCATION;LANGUAGE=en:Room 1",
+		"SUMMARY;LANGUAGE=de:Besprechung",
+		"CATEGORIES:weekly,work",
+		"RRULE:FREQ=WEEKLY;COUNT=4;BYDAY=MO",
+		"DURATION:PT1H",
+		"ORGANIZER;CN=Alice:mailto:alice@example.com",
+		"ATTENDEE;CN=Bob;PARTSTAT=NEEDS-ACTION;ROLE=OPT-PARTICIPANT;RSVP=TRUE:mailto",
+		" :bob@example.org",
+		"DTSTAMP:20170101T100000Z",
+		"X-CUSTOM:kept",
+		"EXDATE;TZID=Europe/Berlin:20170109T100000",
+		"BEGIN:VALARM",
+		"ACTION:DISPLAY",
+		"TRIGGER:-PT15M",
+		"DESCRIPTION:Reminder",
+		"END:VALARM",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:meeting-1",
+		"DTSTART;TZID=Europe/Berlin:20170116T120000",
+		"RECURRENCE-ID;TZID=Europe/Berlin:20170116T100000",
+		"SUMMARY;LANGUAGE=en:Meeting",
+		"LOCATION;LANGUAGE=en:Room 2",
+	}
+	if got := ics.Serialize(cal); !strings.HasPrefix(got, strings.Join(expected, "\r\n")) {
+		t.Error("Wrong calendar:", got)
+	}
+
+	cal, err = ToICalendar(convert(t, todos))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{
+		"NAME:Chores\r\n",
+		"DUE;VALUE=DATE:20170105\r\nPERCENT-COMPLETE:50\r\nSTATUS:IN-PROCESS\r\n",
+		"PRIORITY:1\r\nSUMMARY:Laundry\r\nDUE:20170106T120000Z\r\n",
+	} {
+		if got := ics.Serialize(cal); !strings.Contains(got, expected) {
+			t.Errorf("Expected %q in the calendar | Got: %s", expected, got)
+		}
+	}
+}
+
+func TestCalendarComponents(t *testing.T) {
+	// the time zones and calendar properties without mapping of a single event are kept
+	obj := convert(t, `BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:-//test//test//EN
+X-WR-CALNAME:Work
+BEGIN:VTIMEZONE
+TZID:Custom/Zone
+BEGIN:STANDARD
+DTSTART:19700101T000000
+TZOFFSETFROM:+0300
+TZOFFSETTO:+0300
+END:STANDARD
+END:VTIMEZONE
+BEGIN:VEVENT
+UID:custom-1
+DTSTAMP:20170101T100000Z
+DTSTART;TZID=Custom/Zone:20170102T100000
+DURATION:PT1H
+X-CUSTOM:kept
+END:VEVENT
+END:VCALENDAR`)
+
+	data, err := json.Marshal(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if obj, err = Unmarshal(data); err != nil {
+		t.Fatal(err)
+	}
+
+	event := obj.(*Event)
+	if event.TimeZone != "Custom/Zone" || !strings.HasPrefix(string(event.ICalComponent), `["vcalendar",[["x-wr-calname"`) {
+		t.Errorf("Wrong event: %s %s", event.TimeZone, event.ICalComponent)
+	}
+
+	cal, err := ToICalendar(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//test//test//EN",
+		"X-WR-CALNAME:Work",
+		"BEGIN:VTIMEZONE",
+		"TZID:Custom/Zone",
+		"BEGIN:STANDARD",
+		"DTSTART:19700101T000000",
+		"TZOFFSETFROM:+0300",
+		"TZOFFSETTO:+0300",
+		"END:STANDARD",
+		"END:VTIMEZONE",
+		"BEGIN:VEVENT",
+		"UID:custom-1",
+		"DTSTART;TZID=Custom/Zone:20170102T100000",
+		"DURATION:PT1H",
+		"DTSTAMP:20170101T100000Z",
+		"X-CUSTOM:kept",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}
+	if got := ics.Serialize(cal); got != strings.Join(expected, "\r\n")+"\r\n" {
+		t.Error("Wrong calendar:", got)
+	}
+}
+
+func TestUnmarshal(t *testing.T) {
+	data, err := json.Marshal(convert(t, todos))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	obj, err := Unmarshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if group, ok := obj.(*Group); !ok || len(group.Entries) != 2 || group.Entries[1].(*Task).Title != "Laundry" {
+		t.Errorf("Wrong group: %+v", obj)
+	}
+
+	if _, err := Unmarshal([]byte(`{"@type":"Group","uid":"1","entries":[{"@type":"Group","uid":"2"}]}`)); err == nil {
+		t.Error("Expected an error for nested groups")
+	}
+	if _, err := Unmarshal([]byte(`{"@type":"Card"}`)); err == nil {
+		t.Error("Expected an error for an unknown type")
+	}
+}
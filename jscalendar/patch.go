@@ -0,0 +1,84 @@
+package jscalendar
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+)
+
+// The properties of the master objects that are not patched by their overrides (RFC8984#4.3.5).
+var unpatchedProperties = []string{
+	"@type", "uid", "prodId", "method", "relatedTo", "recurrenceId", "recurrenceIdTimeZone",
+	"recurrenceRules", "excludedRecurrenceRules", "recurrenceOverrides",
+}
+
+// Returns the JSON object of the event or task.
+func toMap(obj Object) (map[string]interface{}, error) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	var m map[string]interface{}
+	err = json.Unmarshal(data, &m)
+	return m, err
+}
+
+// Returns the patch turning the master object into the overridden instance. The patch replaces the
+// changed properties as a whole, e.g. all the participants when one of them changed its status.
+func diff(master, override map[string]interface{}) PatchObject {
+	patch := PatchObject{}
+
+	for name, value := range override {
+		if contains(unpatchedProperties, name) {
+			continue
+		}
+		if masterValue, found := master[name]; !found || !reflect.DeepEqual(masterValue, value) {
+			patch[name] = value
+		}
+	}
+
+	for name := range master {
+		if _, found := override[name]; !found && !contains(unpatchedProperties, name) {
+			patch[name] = nil
+		}
+	}
+
+	return patch
+}
+
+// Applies the patch to the JSON object. The paths of the patch are JSON pointers (RFC6901), without
+// the leading slash, to the properties of the object. The intermediate objects are created when missing.
+func applyPatch(m map[string]interface{}, patch PatchObject) error {
+	for path, value := range patch {
+		segments := strings.Split(path, "/")
+		for i := range segments {
+			segments[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(segments[i])
+		}
+
+		parent := m
+		for _, segment := range segments[:len(segments)-1] {
+			child, found := parent[segment]
+			if !found || child == nil {
+				child = make(map[string]interface{})
+				parent[segment] = child
+			}
+
+			object, ok := child.(map[string]interface{})
+			if !ok {
+				return errors.New("jscalendar: invalid patch path " + path)
+			}
+			parent = object
+		}
+
+		name := segments[len(segments)-1]
+		if value == nil {
+			delete(parent, name)
+		} else {
+			parent[name] = value
+		}
+	}
+
+	return nil
+}
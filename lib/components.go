@@ -5,4 +5,7 @@ const (
 	VEVENT    = "VEVENT"
 	VJOURNAL  = "VJOURNAL"
 	VTODO     = "VTODO"
+	VTIMEZONE = "VTIMEZONE"
+	VFREEBUSY = "VFREEBUSY"
+	VALARM    = "VALARM"
 )